@@ -0,0 +1,157 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// The prefixes of assertion expressions given with -e, by assertion type. A
+// '!' before regex or header negates the assertion.
+var assertionPrefixes = []string{
+	AssertionRegex,
+	AssertionWellFormed,
+	AssertionCookie,
+	AssertionClock,
+	AssertionStatus,
+	AssertionJSONPath,
+	AssertionHeader,
+	AssertionCertExpiry,
+	AssertionOCSP,
+	AssertionLanguage,
+	AssertionVary,
+}
+
+// parseAssertionExpression parses an assertion written as 'type:value', like
+// "status:200" or "header:Content-Type: json". Expressions without a known
+// type are regexes, so "Welcome" and "regex:Welcome" are the same assertion.
+// The assertion is validated.
+func parseAssertionExpression(expr string) (Assertion, error) {
+	a := Assertion{Type: AssertionRegex, Value: expr}
+	rest := expr
+	negate := strings.HasPrefix(rest, "!")
+	if negate {
+		rest = rest[1:]
+	}
+	for _, prefix := range assertionPrefixes {
+		if strings.HasPrefix(rest, prefix+":") {
+			a = Assertion{Type: prefix, Value: strings.TrimPrefix(rest, prefix+":"), Negate: negate}
+			break
+		}
+	}
+	if err := a.Validate(); err != nil {
+		return Assertion{}, fmt.Errorf("invalid assertion `%s': %s", expr, err)
+	}
+	return a, nil
+}
+
+// assertionList is a flag.Value collecting assertion expressions.
+type assertionList []Assertion
+
+func (l *assertionList) String() string {
+	var exprs []string
+	for _, a := range *l {
+		exprs = append(exprs, a.String())
+	}
+	return strings.Join(exprs, ", ")
+}
+
+// Set adds a single assertion expression.
+func (l *assertionList) Set(value string) error {
+	a, err := parseAssertionExpression(value)
+	if err != nil {
+		return err
+	}
+	*l = append(*l, a)
+	return nil
+}
+
+// headerList is a flag.Value collecting headers, like "Accept: text/html".
+type headerList []Header
+
+func (l *headerList) String() string {
+	var headers []string
+	for _, h := range *l {
+		headers = append(headers, string(h))
+	}
+	return strings.Join(headers, ", ")
+}
+
+// Set adds a single header.
+func (l *headerList) Set(value string) error {
+	h := Header(value)
+	if err := h.Validate(); err != nil {
+		return err
+	}
+	*l = append(*l, h)
+	return nil
+}
+
+// Runs the 'assert' subcommand with the given arguments. Checks a single URL
+// against the assertions given on the command line, without a configuration
+// file, and prints the result like a regular run. Returns the exit code: 0
+// when the check passed, 1 otherwise.
+func runAssert(args []string) int {
+	var assertions assertionList
+	var headers headerList
+	fs := flag.NewFlagSet("assert", flag.ContinueOnError)
+	rawurl := fs.String("url", "", "The URL to check. Can also be given as argument.")
+	data := fs.String("data", "", "Request body to POST. Without a body, a GET is done.")
+	timeout := fs.Int("timeout", 0, "Timeout in milliseconds. If zero, the default of 60 seconds is used.")
+	insecure := fs.Bool("insecure", false, "When set, the certificate of the server is not verified.")
+	verbose := fs.Bool("verbose", false, "Print the input and output of the request.")
+	fs.Var(&assertions, "e", "Assertion as 'type:value', like 'regex:Welcome' or 'status:200'. Can be repeated.")
+	fs.Var(&headers, "H", "Request header, like 'Accept: application/json'. Can be repeated.")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: hmon assert [flags] [url]\n\n")
+		fmt.Fprintf(os.Stderr, "Checks a single URL against the given assertions, without a configuration\n")
+		fmt.Fprintf(os.Stderr, "file. Useful to try assertions before adding them to a configuration.\n\n")
+		fs.PrintDefaults()
+	}
+
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return flagExitCode(err)
+	}
+	if len(positional) == 1 && *rawurl == "" {
+		*rawurl = positional[0]
+	} else if len(positional) != 0 || *rawurl == "" {
+		fs.Usage()
+		return ExitUsage
+	}
+
+	m := Monitor{Name: *rawurl, URL: *rawurl, Body: *data, Timeout: *timeout, Headers: headers, Assertions: assertions}
+	if *insecure {
+		m.TLS = &TLSOptions{InsecureSkipVerify: true}
+	}
+	if *verbose {
+		m.Callback = verboseCallback(os.Stdout)
+	}
+	c := Config{Name: "assert", Monitor: map[string]Monitor{"assert": m}}
+	if err := c.Validate("."); err != nil {
+		verr := err.(ValidationError)
+		for _, e := range verr.ErrorList {
+			fmt.Printf("%s\n", e)
+		}
+		return ExitValidation
+	}
+
+	ch := make(chan Result, 1)
+	go c.Monitor["assert"].Run(".", ch)
+	result := <-ch
+	fmt.Printf("%s\n", result)
+	printDetails(os.Stdout, result)
+	for _, ar := range result.Assertions {
+		status := "pass"
+		if !ar.Passed {
+			status = "FAIL"
+		}
+		fmt.Printf("      %s  %s\n", status, ar.Assertion)
+	}
+
+	if result.Error != nil {
+		return ExitFailures
+	}
+	return ExitOK
+}
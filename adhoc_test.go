@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseAssertionExpression(t *testing.T) {
+	tests := []struct {
+		expr   string
+		typ    string
+		value  string
+		negate bool
+	}{
+		{"Welcome", AssertionRegex, "Welcome", false},
+		{"regex:Welcome", AssertionRegex, "Welcome", false},
+		{"!regex:Exception", AssertionRegex, "Exception", true},
+		{"status:2xx,304", AssertionStatus, "2xx,304", false},
+		{"header:Content-Type: json", AssertionHeader, "Content-Type: json", false},
+		{"!header:Server", AssertionHeader, "Server", true},
+		{"wellformed:json", AssertionWellFormed, "json", false},
+		{"jsonpath:$.status == \"up\"", AssertionJSONPath, "$.status == \"up\"", false},
+		{"cert_expiry_days:30", AssertionCertExpiry, "30", false},
+		{"version: 2", AssertionRegex, "version: 2", false},
+	}
+	for _, test := range tests {
+		a, err := parseAssertionExpression(test.expr)
+		if err != nil {
+			t.Errorf("%s: expected no error, got %s", test.expr, err)
+			continue
+		}
+		if a.Type != test.typ || a.Value != test.value || a.Negate != test.negate {
+			t.Errorf("%s: expected %s '%s' (negate %v), got %s '%s' (negate %v)", test.expr, test.typ, test.value, test.negate, a.Type, a.Value, a.Negate)
+		}
+	}
+
+	for _, expr := range []string{"status:200 OK", "regex:[", "!status:200", "cert_expiry_days:soon"} {
+		if _, err := parseAssertionExpression(expr); err == nil {
+			t.Errorf("%s: expected an error, got none", expr)
+		}
+	}
+}
+
+func TestRunAssert(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "Welcome %s", r.Header.Get("X-User"))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		args []string
+		code int
+	}{
+		{[]string{"-url", server.URL, "-e", "regex:Welcome", "-e", "status:200"}, ExitOK},
+		{[]string{server.URL, "-H", "X-User: probe", "-e", "Welcome probe"}, ExitOK},
+		{[]string{server.URL, "-e", "status:404"}, ExitFailures},
+		{[]string{"-e", "Welcome"}, ExitUsage},
+		{[]string{"-url", "not a url"}, ExitValidation},
+	}
+	for _, test := range tests {
+		if code := runAssert(test.args); code != test.code {
+			t.Errorf("%v: expected exit code %d, got %d", test.args, test.code, code)
+		}
+	}
+}
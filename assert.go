@@ -0,0 +1,739 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The types of assertions.
+const (
+	AssertionRegex      = "regex"            // the response must match a regular expression
+	AssertionWellFormed = "wellformed"       // the response must be a well-formed document
+	AssertionCookie     = "cookie"           // the response must set a cookie, see CookieRules
+	AssertionClock      = "clock"            // the Date header must be within the tolerance of the local time
+	AssertionStatus     = "status"           // the status code must be one of the given codes, like "401" or "2xx,304"
+	AssertionJSONPath   = "jsonpath"         // the JSON response must satisfy the JSONPath expression, see jsonPath
+	AssertionHeader     = "header"           // a response header must match, like "Content-Type: application/json"
+	AssertionCertExpiry = "cert_expiry_days" // the server certificate may not expire within the given amount of days
+	AssertionLanguage   = "content_language" // the Content-Language must match one of the language ranges, like "nl, en"
+	AssertionVary       = "vary"             // the Vary header must list all given headers, like "Accept, Accept-Language"
+	AssertionOCSP       = "ocsp"             // the server must staple a valid OCSP response, no older than the given duration
+	AssertionAll        = "all"              // all assertions of the group must pass
+	AssertionAny        = "any"              // at least one assertion of the group must pass
+	AssertionNone       = "none"             // no assertion of the group may pass
+)
+
+// The severities of assertions. A failing assertion with severity warning
+// does not fail the monitor, but is reported as a warning of the result.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Assertion is an assertion on the response of a monitor. In the configuration
+// it's either a plain string (a regex, or 'wellformed:<kind>'), or a table:
+//
+//	{ type = "regex", value = "Release .*", message = "No release banner", severity = "warning" }
+//
+// Only the value is required. The type defaults to regex, and the severity to
+// error. When a message is given, it is reported instead of the assertion
+// itself when the assertion fails. For cookie assertions, the value is the
+// name of the cookie, and the table can contain the CookieRules. For clock
+// assertions, the value is the maximum clock skew, as a duration like "30s".
+// With 'negate = true', a regex assertion fails when the response matches.
+// For header assertions, the value is the header name, optionally followed by
+// a colon and a regex the header value must match. A negated header
+// assertion fails when the header is present (and matches).
+// For status assertions, the value is a comma separated list of status codes,
+// where a class of codes can be given as "4xx". For cert_expiry_days
+// assertions, the value is the minimum amount of days the certificate of the
+// server must still be valid. For ocsp assertions, the value is the maximum
+// age of the stapled OCSP response, as a duration like "96h". For
+// content_language and vary assertions, the value is a comma separated list
+// of language ranges or header names.
+//
+// Assertions are grouped with an 'all', 'any' or 'none' table, of which the
+// value is a list of assertions (or groups) instead of a single value:
+//
+//	{ any = [ "Backend A", "Backend B" ], message = "Unknown backend" }
+type Assertion struct {
+	Type     string       `json:"type,omitempty"`
+	Value    string       `json:"value"`
+	Message  string       `json:"message,omitempty"`
+	Severity string       `json:"severity,omitempty"`
+	Cookie   *CookieRules `json:"cookie,omitempty"`
+	Negate   bool         `json:"negate,omitempty"`     // the response must not match the regex or header
+	Group    []Assertion  `json:"assertions,omitempty"` // the assertions of an all, any or none group
+
+	rex  *regexp.Regexp // the compiled regex, set by Validate
+	path *jsonPath      // the parsed JSONPath expression, set by Validate
+}
+
+// UnmarshalTOML decodes the assertion from either a string or a table.
+func (a *Assertion) UnmarshalTOML(data interface{}) error {
+	switch v := data.(type) {
+	case string:
+		*a = Assertion{Type: AssertionRegex, Value: v}
+		if isWellFormedAssertion(v) {
+			*a = Assertion{Type: AssertionWellFormed, Value: strings.TrimPrefix(v, wellFormedPrefix)}
+		}
+		return nil
+	case map[string]interface{}:
+		*a = Assertion{Type: AssertionRegex}
+		for key, value := range v {
+			if isCookieAttribute(key) {
+				if a.Cookie == nil {
+					a.Cookie = &CookieRules{}
+				}
+				if err := a.Cookie.set(key, value); err != nil {
+					return err
+				}
+				continue
+			}
+
+			if key == AssertionAll || key == AssertionAny || key == AssertionNone {
+				if a.Group != nil {
+					return fmt.Errorf("assertion can only be one of 'all', 'any' or 'none'")
+				}
+				group, err := decodeAssertionGroup(key, value)
+				if err != nil {
+					return err
+				}
+				a.Type, a.Group = key, group
+				continue
+			}
+
+			if key == "negate" {
+				negate, ok := value.(bool)
+				if !ok {
+					return fmt.Errorf("assertion attribute 'negate' must be a boolean")
+				}
+				a.Negate = negate
+				continue
+			}
+
+			str, ok := value.(string)
+			if !ok {
+				return fmt.Errorf("assertion attribute '%s' must be a string", key)
+			}
+			switch key {
+			case "type":
+				a.Type = str
+			case "value":
+				a.Value = str
+			case "message":
+				a.Message = str
+			case "severity":
+				a.Severity = str
+			default:
+				return fmt.Errorf("unknown assertion attribute '%s'", key)
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("assertion must be a string or a table, got %T", data)
+}
+
+// decodeAssertionGroup decodes the list of assertions of an all, any or none
+// group.
+func decodeAssertionGroup(key string, value interface{}) ([]Assertion, error) {
+	var items []interface{}
+	switch v := value.(type) {
+	case []interface{}:
+		items = v
+	case []map[string]interface{}:
+		for _, item := range v {
+			items = append(items, item)
+		}
+	default:
+		return nil, fmt.Errorf("assertion group '%s' must be a list of assertions", key)
+	}
+
+	group := make([]Assertion, len(items))
+	for i, item := range items {
+		if err := group[i].UnmarshalTOML(item); err != nil {
+			return nil, err
+		}
+	}
+	return group, nil
+}
+
+// MarshalJSON writes assertions without a message or severity as the plain
+// string they can be configured with, and others as an object.
+func (a Assertion) MarshalJSON() ([]byte, error) {
+	if a.Message == "" && a.Severity == "" && !a.Negate && (a.Type == "" || a.Type == AssertionRegex || a.Type == AssertionWellFormed) {
+		return json.Marshal(a.String())
+	}
+	type plain Assertion // prevents recursion into this method
+	return json.Marshal(plain(a))
+}
+
+// String returns the assertion as an expression given with -e of 'hmon assert',
+// like "status:200". Only regexes are written as plain strings in the
+// assertions of a configuration.
+func (a Assertion) String() string {
+	switch a.Type {
+	case AssertionWellFormed:
+		return wellFormedPrefix + a.Value
+	case AssertionCookie:
+		return "cookie:" + a.Value
+	case AssertionClock:
+		return "clock:" + a.Value
+	case AssertionStatus:
+		return "status:" + a.Value
+	case AssertionJSONPath:
+		return "jsonpath:" + a.Value
+	case AssertionCertExpiry:
+		return "cert_expiry_days:" + a.Value
+	case AssertionOCSP:
+		return "ocsp:" + a.Value
+	case AssertionLanguage:
+		return "content_language:" + a.Value
+	case AssertionVary:
+		return "vary:" + a.Value
+	case AssertionAll, AssertionAny, AssertionNone:
+		members := make([]string, len(a.Group))
+		for i, m := range a.Group {
+			members[i] = m.String()
+		}
+		return a.Type + "(" + strings.Join(members, ", ") + ")"
+	case AssertionHeader:
+		if a.Negate {
+			return "!header:" + a.Value
+		}
+		return "header:" + a.Value
+	}
+	if a.Negate {
+		return "!" + a.Value
+	}
+	return a.Value
+}
+
+// AssertionResult is the outcome of a single assertion of a monitor run.
+type AssertionResult struct {
+	Assertion string // the assertion, as an expression given with -e of 'hmon assert'
+	Passed    bool
+	Severity  string `json:",omitempty"`
+	Error     string `json:",omitempty"` // why the assertion failed
+	Duration  int64  // time to evaluate the assertion, in microseconds
+}
+
+// needsBody returns true if the assertion checks the response body: regexes,
+// wellformed and jsonpath assertions, and groups with any of those. The other
+// assertions only check the status, headers or TLS connection.
+func (a Assertion) needsBody() bool {
+	switch a.Type {
+	case "", AssertionRegex, AssertionWellFormed, AssertionJSONPath:
+		return true
+	case AssertionAll, AssertionAny, AssertionNone:
+		for _, m := range a.Group {
+			if m.needsBody() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// IsWarning returns true if a failure of the assertion is only a warning.
+func (a Assertion) IsWarning() bool {
+	return a.Severity == SeverityWarning
+}
+
+// Validate checks the type, severity and value of the assertion. The regex
+// of a regex assertion is compiled once here, and reused by every Check.
+func (a *Assertion) Validate() error {
+	switch a.Severity {
+	case "", SeverityError, SeverityWarning:
+	default:
+		return fmt.Errorf("unknown severity '%s' (must be error or warning)", a.Severity)
+	}
+	if a.Negate && a.Type != "" && a.Type != AssertionRegex && a.Type != AssertionHeader {
+		return fmt.Errorf("negate can only be used with regex and header assertions")
+	}
+
+	switch a.Type {
+	case "", AssertionRegex:
+		rex, err := regexp.Compile(a.Value)
+		if err != nil {
+			return fmt.Errorf("invalid regex: %s", err)
+		}
+		a.rex = rex
+	case AssertionWellFormed:
+		return validateWellFormedAssertion(a.String())
+	case AssertionCookie:
+		if a.Value == "" {
+			return fmt.Errorf("cookie assertion needs the cookie name as value")
+		}
+		if a.Cookie != nil {
+			return a.Cookie.validate()
+		}
+		return nil
+	case AssertionClock:
+		d, err := time.ParseDuration(a.Value)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("clock assertion needs a positive duration as value, like \"30s\"")
+		}
+	case AssertionStatus:
+		if err := StatusCodes(a.Value).validate(); err != nil {
+			return fmt.Errorf("status assertion needs %s", err)
+		}
+	case AssertionJSONPath:
+		path, err := parseJSONPath(a.Value)
+		if err != nil {
+			return fmt.Errorf("invalid jsonpath: %s", err)
+		}
+		a.path = path
+	case AssertionHeader:
+		name, pattern := splitHeaderAssertion(a.Value)
+		if name == "" {
+			return fmt.Errorf("header assertion needs a header name as value, like \"Content-Type: json\"")
+		}
+		rex, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid regex for header '%s': %s", name, err)
+		}
+		a.rex = rex
+	case AssertionCertExpiry:
+		if days, err := strconv.Atoi(a.Value); err != nil || days < 0 {
+			return fmt.Errorf("cert_expiry_days assertion needs an amount of days as value, like \"30\"")
+		}
+	case AssertionOCSP:
+		d, err := time.ParseDuration(a.Value)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("ocsp assertion needs the maximum age of the response as value, like \"96h\"")
+		}
+	case AssertionLanguage, AssertionVary:
+		if len(splitList(a.Value)) == 0 {
+			return fmt.Errorf("%s assertion needs a comma separated list as value", a.Type)
+		}
+	case AssertionAll, AssertionAny, AssertionNone:
+		if len(a.Group) == 0 || a.Value != "" {
+			return fmt.Errorf("%s group needs a list of assertions, and no value", a.Type)
+		}
+		// the members share their backing array with the group, so their
+		// compiled regexes are kept.
+		for i := range a.Group {
+			m := &a.Group[i]
+			if m.Severity != "" {
+				return fmt.Errorf("assertion '%s': a severity can only be given for the whole group", m)
+			}
+			if err := m.Validate(); err != nil {
+				return fmt.Errorf("assertion '%s': %s", m, err)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown type '%s' (must be regex, wellformed, cookie, clock, status, jsonpath, header, cert_expiry_days, ocsp, content_language, vary, all, any or none)", a.Type)
+	}
+
+	if a.Cookie != nil {
+		return fmt.Errorf("cookie attributes can only be used with cookie assertions")
+	}
+	return nil
+}
+
+// Check asserts the response with the given status code and header. Cookies
+// are checked against the Set-Cookie headers. Well-formedness and JSONPath
+// expressions are checked against the raw body, since normalization could
+// break the structure of the document. Regexes are matched against the
+// normalized body. Certificates can't be checked without the TLS connection,
+// see CheckCertificate.
+func (a Assertion) Check(status int, header http.Header, raw, normalized []byte) error {
+	var err error
+	if a.Type == AssertionAll || a.Type == AssertionAny || a.Type == AssertionNone {
+		return a.checkGroup(func(m Assertion) error { return m.Check(status, header, raw, normalized) })
+	} else if a.Type == AssertionCertExpiry || a.Type == AssertionOCSP {
+		err = a.CheckCertificate(nil, time.Now())
+	} else if a.Type == AssertionStatus {
+		err = checkStatus(a.Value, status)
+	} else if a.Type == AssertionJSONPath {
+		// like regexes, the path is parsed by Validate, or on the spot.
+		path := a.path
+		if path == nil {
+			path, err = parseJSONPath(a.Value)
+		}
+		if err == nil {
+			err = checkJSONPath(path, a.Value, raw)
+		}
+	} else if a.Type == AssertionHeader {
+		err = checkHeader(a, header)
+	} else if a.Type == AssertionLanguage {
+		err = checkContentLanguage(a.Value, header)
+	} else if a.Type == AssertionVary {
+		err = checkVary(a.Value, header)
+	} else if a.Type == AssertionCookie {
+		err = checkCookie(a.Value, a.Cookie, header)
+	} else if a.Type == AssertionClock {
+		err = checkClock(a.Value, header, time.Now())
+	} else if a.Type == AssertionWellFormed {
+		err = checkWellFormed(a.String(), raw)
+	} else {
+		// the regex is compiled by Validate(). Assertions which were not
+		// validated (e.g. created in code) are compiled on the spot, which
+		// must succeed for valid assertions. To make things sure, we do a
+		// MustCompile though.
+		rex := a.rex
+		if rex == nil {
+			rex = regexp.MustCompile(a.Value)
+		}
+		match := rex.Find(normalized)
+		if a.Negate && match != nil {
+			err = fmt.Errorf("assertion failed, response matches negated regex `%s' with `%s'", a.Value, excerpt(match, 0))
+		} else if !a.Negate && match == nil {
+			err = fmt.Errorf("assertion failed for regex `%s'", a.Value)
+		}
+	}
+
+	if err != nil && a.Message != "" {
+		return fmt.Errorf("%s", a.Message)
+	}
+	return err
+}
+
+// CheckResponse asserts the response, including the TLS connection it was
+// received over. Certificate assertions are checked with CheckCertificate,
+// and all others with Check.
+func (a Assertion) CheckResponse(resp *http.Response, raw, normalized []byte) error {
+	switch a.Type {
+	case AssertionCertExpiry, AssertionOCSP:
+		return a.CheckCertificate(resp.TLS, time.Now())
+	case AssertionAll, AssertionAny, AssertionNone:
+		return a.checkGroup(func(m Assertion) error { return m.CheckResponse(resp, raw, normalized) })
+	}
+	return a.Check(resp.StatusCode, resp.Header, raw, normalized)
+}
+
+// checkGroup checks the assertions of an all, any or none group with the
+// check function. An all group fails with the error of the first failing
+// assertion, an any group with the errors of all of them.
+func (a Assertion) checkGroup(check func(Assertion) error) error {
+	var err error
+	switch a.Type {
+	case AssertionAll:
+		for _, m := range a.Group {
+			if err = check(m); err != nil {
+				break
+			}
+		}
+	case AssertionAny:
+		var failures []string
+		for _, m := range a.Group {
+			merr := check(m)
+			if merr == nil {
+				failures = nil
+				break
+			}
+			failures = append(failures, merr.Error())
+		}
+		if failures != nil {
+			err = fmt.Errorf("assertion failed, none of %s passed: %s", a, strings.Join(failures, "; "))
+		}
+	case AssertionNone:
+		for _, m := range a.Group {
+			if check(m) == nil {
+				err = fmt.Errorf("assertion failed, %s passed within %s", m, a)
+				break
+			}
+		}
+	}
+
+	if err != nil && a.Message != "" {
+		return fmt.Errorf("%s", a.Message)
+	}
+	return err
+}
+
+// CheckCertificate asserts the certificate (or its stapled OCSP response) of
+// the TLS connection the response was received over, which is nil for plain
+// HTTP.
+func (a Assertion) CheckCertificate(state *tls.ConnectionState, now time.Time) error {
+	var err error
+	if a.Type == AssertionOCSP {
+		err = checkOCSP(a.Value, state, now)
+	} else {
+		err = checkCertExpiry(a.Value, state, now)
+	}
+	if err != nil && a.Message != "" {
+		return fmt.Errorf("%s", a.Message)
+	}
+	return err
+}
+
+// certNotAfter returns when the certificate of the server expires, or nil
+// without a TLS connection.
+func certNotAfter(state *tls.ConnectionState) *time.Time {
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return nil
+	}
+	notAfter := state.PeerCertificates[0].NotAfter
+	return &notAfter
+}
+
+// checkCertExpiry checks that the certificate of the server is still valid
+// for at least the given amount of days.
+func checkCertExpiry(days string, state *tls.ConnectionState, now time.Time) error {
+	notAfter := certNotAfter(state)
+	if notAfter == nil {
+		return fmt.Errorf("assertion failed for cert_expiry_days: no TLS connection")
+	}
+	// the amount of days is validated beforehand.
+	min, _ := strconv.Atoi(days)
+	left := notAfter.Sub(now)
+	if left < time.Duration(min)*24*time.Hour {
+		return fmt.Errorf("assertion failed, certificate of `%s' expires in %d days (%s), within %s days",
+			state.PeerCertificates[0].Subject.CommonName, int(left.Hours()/24), notAfter.UTC().Format("2006-01-02"), days)
+	}
+	return nil
+}
+
+// splitHeaderAssertion splits the value of a header assertion in the header
+// name and the regex its value must match. Without a regex, the header only
+// has to be present.
+func splitHeaderAssertion(value string) (name, pattern string) {
+	i := strings.Index(value, ":")
+	if i < 0 {
+		return strings.TrimSpace(value), ""
+	}
+	return strings.TrimSpace(value[:i]), strings.TrimSpace(value[i+1:])
+}
+
+// checkHeader checks the header of a header assertion. A header which is sent
+// more than once matches when any of its values matches.
+func checkHeader(a Assertion, header http.Header) error {
+	name, pattern := splitHeaderAssertion(a.Value)
+	rex := a.rex
+	if rex == nil {
+		rex = regexp.MustCompile(pattern)
+	}
+
+	values := header[http.CanonicalHeaderKey(name)]
+	for _, v := range values {
+		if rex.MatchString(v) {
+			if a.Negate {
+				return fmt.Errorf("assertion failed, response has header `%s: %s' which must not match `%s'", name, v, pattern)
+			}
+			return nil
+		}
+	}
+
+	switch {
+	case a.Negate:
+		return nil
+	case len(values) == 0:
+		return fmt.Errorf("assertion failed for header `%s': header is missing", a.Value)
+	}
+	return fmt.Errorf("assertion failed for header `%s': got `%s'", a.Value, strings.Join(values, ", "))
+}
+
+// The prefix of assertions checking whether the response is well-formed,
+// instead of matching a regular expression.
+const wellFormedPrefix = "wellformed:"
+
+// The kinds of documents which can be checked for well-formedness.
+var wellFormedKinds = map[string]bool{
+	"xml":  true,
+	"json": true,
+	"html": true,
+}
+
+// isWellFormedAssertion returns true if the assertion is a well-formedness
+// assertion (e.g. 'wellformed:xml') instead of a regular expression.
+func isWellFormedAssertion(assertion string) bool {
+	return strings.HasPrefix(assertion, wellFormedPrefix)
+}
+
+// validateWellFormedAssertion checks whether the kind of the well-formedness
+// assertion is known.
+func validateWellFormedAssertion(assertion string) error {
+	kind := strings.TrimPrefix(assertion, wellFormedPrefix)
+	if !wellFormedKinds[kind] {
+		return fmt.Errorf("unknown well-formedness kind '%s' (must be xml, json or html)", kind)
+	}
+	return nil
+}
+
+// checkWellFormed parses the body as the kind given in the assertion. If the
+// body is not well-formed, the returned error describes the location of the
+// parse error.
+func checkWellFormed(assertion string, body []byte) error {
+	kind := strings.TrimPrefix(assertion, wellFormedPrefix)
+
+	var err error
+	switch kind {
+	case "json":
+		err = checkJSON(body)
+	case "xml":
+		err = checkXML(body, true)
+	case "html":
+		err = checkXML(body, false)
+	}
+
+	if err != nil {
+		return fmt.Errorf("response is not well-formed %s: %s", kind, err)
+	}
+	return nil
+}
+
+// Parses the body as JSON, and reports the line and column of any error.
+func checkJSON(body []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	var v interface{}
+	err := dec.Decode(&v)
+	if err == nil {
+		// there must not be anything left except whitespace.
+		if _, err := dec.Token(); err != io.EOF {
+			return fmt.Errorf("%s: unexpected data after top-level value", position(body, dec.InputOffset()))
+		}
+		return nil
+	}
+
+	if serr, ok := err.(*json.SyntaxError); ok {
+		return fmt.Errorf("%s: %s", position(body, serr.Offset), serr)
+	}
+	return err
+}
+
+// Parses the body as XML. When strict is false, the parser is set up to be
+// forgiving for HTML: unclosed elements like <br> and HTML entities are
+// accepted.
+func checkXML(body []byte, strict bool) error {
+	dec := xml.NewDecoder(bytes.NewReader(body))
+	if !strict {
+		dec.Strict = false
+		dec.AutoClose = xml.HTMLAutoClose
+		dec.Entity = xml.HTMLEntity
+	}
+
+	elements := 0
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %s", position(body, dec.InputOffset()), err)
+		}
+		if _, ok := tok.(xml.StartElement); ok {
+			elements++
+		}
+	}
+
+	if elements == 0 {
+		return fmt.Errorf("no elements found")
+	}
+	return nil
+}
+
+// Returns the line and column (both starting at 1) of the offset in the body.
+func position(body []byte, offset int64) string {
+	if offset > int64(len(body)) {
+		offset = int64(len(body))
+	}
+	before := body[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	col := len(before) - bytes.LastIndex(before, []byte("\n"))
+	return fmt.Sprintf("line %d, column %d", line, col)
+}
+
+// checkClock compares the Date header of the response with the local time
+// now. The difference may not exceed the tolerance, which is a duration.
+func checkClock(tolerance string, header http.Header, now time.Time) error {
+	// the tolerance is validated beforehand.
+	max, _ := time.ParseDuration(tolerance)
+
+	date := header.Get("Date")
+	if date == "" {
+		return fmt.Errorf("response has no Date header to check the clock against")
+	}
+	t, err := http.ParseTime(date)
+	if err != nil {
+		return fmt.Errorf("unparsable Date header `%s'", date)
+	}
+
+	skew := now.Sub(t)
+	if skew < 0 {
+		skew = -skew
+	}
+	// the Date header only has a precision of seconds.
+	if skew > max+time.Second {
+		return fmt.Errorf("server clock differs %s from the local clock, more than %s (Date: %s)", skew.Round(time.Second), tolerance, date)
+	}
+	return nil
+}
+
+// Matches a single status code, or a class of status codes like 4xx.
+var statusCodeRegexp = regexp.MustCompile(`^[1-5]([0-9][0-9]|xx)$`)
+
+// StatusCodes are the expected status codes of a monitor, as a comma separated
+// list like "200,201" or "2xx". In the configuration, it's either a number, a
+// string, or a list of numbers and strings.
+type StatusCodes string
+
+// UnmarshalTOML decodes the status codes from a number, string or list.
+func (s *StatusCodes) UnmarshalTOML(data interface{}) error {
+	switch v := data.(type) {
+	case int64:
+		*s = StatusCodes(strconv.FormatInt(v, 10))
+		return nil
+	case string:
+		*s = StatusCodes(v)
+		return nil
+	case []interface{}:
+		var codes []string
+		for _, code := range v {
+			switch c := code.(type) {
+			case int64:
+				codes = append(codes, strconv.FormatInt(c, 10))
+			case string:
+				codes = append(codes, c)
+			default:
+				return fmt.Errorf("status codes must be numbers or strings, got %T", code)
+			}
+		}
+		*s = StatusCodes(strings.Join(codes, ","))
+		return nil
+	}
+	return fmt.Errorf("status must be a number, a string or a list, got %T", data)
+}
+
+// validate checks whether all status codes are valid.
+func (s StatusCodes) validate() error {
+	for _, code := range strings.Split(string(s), ",") {
+		if !statusCodeRegexp.MatchString(strings.TrimSpace(code)) {
+			return fmt.Errorf("status codes like \"401\" or \"2xx\", got '%s'", s)
+		}
+	}
+	return nil
+}
+
+// redirects returns true if any of the status codes is a redirect (3xx).
+func (s StatusCodes) redirects() bool {
+	for _, code := range strings.Split(string(s), ",") {
+		if strings.HasPrefix(strings.TrimSpace(code), "3") {
+			return true
+		}
+	}
+	return false
+}
+
+// checkStatus checks whether the status code is one of the comma separated
+// codes. A code like "4xx" matches all codes of that class.
+func checkStatus(codes string, status int) error {
+	actual := fmt.Sprintf("%d", status)
+	for _, code := range strings.Split(codes, ",") {
+		code = strings.TrimSpace(code)
+		if code == actual || (strings.HasSuffix(code, "xx") && code[0] == actual[0]) {
+			return nil
+		}
+	}
+	return fmt.Errorf("unexpected status code %d (expected %s)", status, codes)
+}
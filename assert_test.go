@@ -0,0 +1,567 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckWellFormed(t *testing.T) {
+	type Exp struct {
+		Assertion string
+		Body      string
+		Error     string // empty when well-formed, else a part of the error
+	}
+
+	tests := []Exp{
+		{"wellformed:json", `{"status": "ok", "items": [1, 2]}`, ""},
+		{"wellformed:json", "{\n  \"status\": ok\n}", "line 2, column"},
+		{"wellformed:json", `{"a": 1} {"b": 2}`, "unexpected data"},
+		{"wellformed:xml", `<a><b>text</b></a>`, ""},
+		{"wellformed:xml", "<a>\n<b>text</a>", "line 2"},
+		{"wellformed:xml", `just text`, "no elements"},
+		{"wellformed:html", `<html><body>Hello<br>world &nbsp;</body></html>`, ""},
+		{"wellformed:html", `<html><body`, "not well-formed html"},
+	}
+
+	for _, test := range tests {
+		err := checkWellFormed(test.Assertion, []byte(test.Body))
+		if test.Error == "" && err != nil {
+			t.Errorf("%s: expected no error for '%s', got: %s", test.Assertion, test.Body, err)
+		}
+		if test.Error != "" && (err == nil || !strings.Contains(err.Error(), test.Error)) {
+			t.Errorf("%s: expected error containing '%s' for '%s', got: %v", test.Assertion, test.Error, test.Body, err)
+		}
+	}
+}
+
+func TestValidateWellFormedAssertion(t *testing.T) {
+	if err := validateWellFormedAssertion("wellformed:yaml"); err == nil {
+		t.Errorf("expected error for unknown kind")
+	}
+}
+
+func TestDecodeAssertions(t *testing.T) {
+	var c Config
+	_, err := toml.Decode(`
+name = "Assertions"
+
+[monitor.plain]
+assertions = [ "Welcome", "wellformed:html" ]
+
+[monitor.tables]
+assertions = [
+	{ value = "Release .*" },
+	{ type = "wellformed", value = "json", message = "Not JSON", severity = "warning" },
+]
+`, &c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plain := c.Monitor["plain"].Assertions
+	if !reflect.DeepEqual(plain, []Assertion{{Type: AssertionRegex, Value: "Welcome"}, {Type: AssertionWellFormed, Value: "html"}}) {
+		t.Errorf("unexpected plain assertions %v", plain)
+	}
+
+	tables := c.Monitor["tables"].Assertions
+	expected := Assertion{Type: AssertionWellFormed, Value: "json", Message: "Not JSON", Severity: SeverityWarning}
+	if !reflect.DeepEqual(tables, []Assertion{{Type: AssertionRegex, Value: "Release .*"}, expected}) {
+		t.Errorf("unexpected table assertions %v", tables)
+	}
+
+	_, err = toml.Decode(`
+[monitor.bad]
+assertions = [ { value = "x", colour = "red" } ]
+`, &c)
+	if err == nil {
+		t.Errorf("expected error for unknown assertion attribute")
+	}
+}
+
+func TestAssertionCheck(t *testing.T) {
+	body := []byte("<p>Welcome</p>")
+
+	a := Assertion{Value: "Goodbye"}
+	if err := a.Check(200, nil, body, body); err == nil || !strings.Contains(err.Error(), "Goodbye") {
+		t.Errorf("expected the regex in the error, got: %v", err)
+	}
+
+	a.Message = "Homepage must say goodbye"
+	if err := a.Check(200, nil, body, body); err == nil || err.Error() != a.Message {
+		t.Errorf("expected the message as error, got: %v", err)
+	}
+
+	if err := (Assertion{Value: "Welcome"}).Check(200, nil, body, body); err != nil {
+		t.Errorf("expected no error, got: %s", err)
+	}
+
+	status := Assertion{Type: AssertionStatus, Value: "2xx, 304"}
+	if err := status.Check(204, nil, body, body); err != nil {
+		t.Errorf("expected no error for 204, got: %s", err)
+	}
+	if err := status.Check(304, nil, body, body); err != nil {
+		t.Errorf("expected no error for 304, got: %s", err)
+	}
+	if err := status.Check(401, nil, body, body); err == nil {
+		t.Errorf("expected an error for 401")
+	}
+
+	invalid := []Assertion{
+		{Value: "x", Severity: "fatal"},
+		{Type: "xpath", Value: "x"},
+		{Type: AssertionStatus, Value: "40"},
+		{Type: AssertionStatus, Value: "200,6xx"},
+	}
+	for _, a := range invalid {
+		if err := a.Validate(); err == nil {
+			t.Errorf("expected error for assertion %+v", a)
+		}
+	}
+}
+
+func TestValidateCompilesRegexes(t *testing.T) {
+	c := Config{
+		Name: "compile",
+		Monitor: map[string]Monitor{
+			"a": {
+				Name:       "A",
+				URL:        "http://example.org",
+				Assertions: []Assertion{{Value: "ok"}, {Type: AssertionWellFormed, Value: "xml"}},
+				Remove:     []string{"[0-9]+"},
+			},
+		},
+	}
+	if err := c.Validate("."); err != nil {
+		t.Fatal(err)
+	}
+
+	m := c.Monitor["a"]
+	if m.Assertions[0].rex == nil || m.Assertions[0].rex.String() != "ok" {
+		t.Errorf("expected the assertion regex to be compiled")
+	}
+	if len(m.removeRegexps) != 1 {
+		t.Errorf("expected the remove regex to be compiled")
+	}
+	if body := m.normalizeBody([]byte("id 123 ok")); string(body) != "id  ok" {
+		t.Errorf("unexpected normalized body '%s'", body)
+	}
+}
+
+func TestRunWarnings(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "Welcome")
+	}))
+	defer server.Close()
+
+	ch := make(chan Result, 1)
+	m := Monitor{Name: "warn", URL: server.URL, Assertions: []Assertion{
+		{Value: "Release", Message: "No release banner", Severity: SeverityWarning},
+		{Value: "Welcome"},
+	}}
+	go m.Run(".", ch)
+	r := <-ch
+
+	if r.Error != nil {
+		t.Errorf("expected no error, got: %s", r.Error)
+	}
+	if len(r.Warnings) != 1 || r.Warnings[0] != "No release banner" {
+		t.Errorf("expected one warning, got %v", r.Warnings)
+	}
+}
+
+func TestCheckClock(t *testing.T) {
+	now := time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)
+	header := http.Header{}
+
+	if err := checkClock("30s", header, now); err == nil {
+		t.Errorf("expected error without Date header")
+	}
+
+	header.Set("Date", now.Add(-20*time.Second).Format(http.TimeFormat))
+	if err := checkClock("30s", header, now); err != nil {
+		t.Errorf("expected no error within tolerance, got: %s", err)
+	}
+
+	header.Set("Date", now.Add(2*time.Minute).Format(http.TimeFormat))
+	if err := checkClock("30s", header, now); err == nil || !strings.Contains(err.Error(), "2m0s") {
+		t.Errorf("expected a clock skew error, got: %v", err)
+	}
+
+	if err := (&Assertion{Type: AssertionClock, Value: "soon"}).Validate(); err == nil {
+		t.Errorf("expected error for an invalid tolerance")
+	}
+}
+
+func TestRunAssertionResults(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "Welcome")
+	}))
+	defer server.Close()
+
+	ch := make(chan Result, 1)
+	m := Monitor{Name: "all", URL: server.URL, Assertions: []Assertion{
+		{Value: "Goodbye"},
+		{Value: "Welcome"},
+		{Value: "Release", Severity: SeverityWarning},
+	}}
+	go m.Run(".", ch)
+	r := <-ch
+
+	if r.Error == nil || !strings.Contains(r.Error.Error(), "Goodbye") {
+		t.Errorf("expected the first failing assertion as error, got %v", r.Error)
+	}
+	if len(r.Assertions) != 3 {
+		t.Fatalf("expected the results of all 3 assertions, got %+v", r.Assertions)
+	}
+	passed := []bool{false, true, false}
+	for i, ar := range r.Assertions {
+		if ar.Passed != passed[i] || ar.Assertion != m.Assertions[i].Value {
+			t.Errorf("unexpected result of assertion %d: %+v", i, ar)
+		}
+	}
+	if r.Assertions[2].Severity != SeverityWarning || r.Assertions[2].Error == "" {
+		t.Errorf("expected a failed warning, got %+v", r.Assertions[2])
+	}
+}
+
+func TestMonitorStatus(t *testing.T) {
+	var c Config
+	_, err := toml.Decode(`
+[monitor.a]
+url = "http://example.org"
+status = 200
+
+[monitor.b]
+url = "http://example.org"
+status = "2xx"
+
+[monitor.c]
+url = "http://example.org"
+status = ["200", "201", "3xx"]
+
+[monitor.d]
+url = "http://example.org"
+status = [200, 204]
+`, &c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]StatusCodes{"a": "200", "b": "2xx", "c": "200,201,3xx", "d": "200,204"}
+	for key, status := range expected {
+		if c.Monitor[key].Status != status {
+			t.Errorf("expected status '%s' for monitor %s, got '%s'", status, key, c.Monitor[key].Status)
+		}
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, "Welcome")
+	}))
+	defer server.Close()
+
+	ch := make(chan Result, 1)
+	m := Monitor{URL: server.URL, Status: "2xx", Assertions: []Assertion{{Value: "Welcome"}}}
+	go m.Run(".", ch)
+	if r := <-ch; r.Error == nil || !strings.Contains(r.Error.Error(), "500") {
+		t.Errorf("expected the status code to fail the monitor, got %v", r.Error)
+	}
+}
+
+func TestNegativeAssertions(t *testing.T) {
+	var c Config
+	_, err := toml.Decode(`
+[monitor.soap]
+url = "http://example.org"
+assertions = ["Envelope"]
+negative_assertions = ["faultstring"]
+`, &c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.mergeAssertions()
+
+	m := c.Monitor["soap"]
+	if len(m.Assertions) != 2 || !m.Assertions[1].Negate || m.Assertions[1].String() != "!faultstring" {
+		t.Fatalf("expected the negative assertion to be merged, got %+v", m.Assertions)
+	}
+
+	negative := m.Assertions[1]
+	fault := []byte("<Envelope><faultstring>Server error</faultstring></Envelope>")
+	if err := negative.Check(200, nil, fault, fault); err == nil || !strings.Contains(err.Error(), "faultstring") {
+		t.Errorf("expected the fault to fail the assertion, got %v", err)
+	}
+	ok := []byte("<Envelope><status>ok</status></Envelope>")
+	if err := negative.Check(200, nil, ok, ok); err != nil {
+		t.Errorf("expected no error without a fault, got %s", err)
+	}
+
+	wellformed := Assertion{Type: AssertionWellFormed, Value: "xml", Negate: true}
+	if err := wellformed.Validate(); err == nil {
+		t.Errorf("expected negate to be rejected for well-formedness assertions")
+	}
+}
+
+func TestHeaderAssertions(t *testing.T) {
+	header := http.Header{}
+	header.Set("Content-Type", "application/json; charset=utf-8")
+	header.Add("X-Cache", "MISS")
+	header.Add("X-Cache", "HIT")
+
+	tests := []struct {
+		value  string
+		negate bool
+		passed bool
+	}{
+		{"Content-Type: application/json", false, true},
+		{"content-type: ^text/html", false, false},
+		{"X-Cache: ^HIT$", false, true},
+		{"X-Cache", false, true},
+		{"Strict-Transport-Security", false, false},
+		{"X-Powered-By", true, true},
+		{"X-Cache: MISS", true, false},
+	}
+	for _, test := range tests {
+		a := Assertion{Type: AssertionHeader, Value: test.value, Negate: test.negate}
+		if err := a.Validate(); err != nil {
+			t.Fatalf("expected '%s' to be valid, got %s", test.value, err)
+		}
+		err := a.Check(200, header, nil, nil)
+		if passed := err == nil; passed != test.passed {
+			t.Errorf("expected passed=%v for '%s' (negate=%v), got %v", test.passed, test.value, test.negate, err)
+		}
+	}
+
+	for _, value := range []string{"", ": json", "Content-Type: ("} {
+		a := Assertion{Type: AssertionHeader, Value: value}
+		if err := a.Validate(); err == nil {
+			t.Errorf("expected '%s' to be invalid", value)
+		}
+	}
+}
+
+func TestRunHeaderAssertions(t *testing.T) {
+	var c Config
+	_, err := toml.Decode(`
+[monitor.api]
+url = "http://example.org"
+header_assertions = ["Content-Type: application/json", "X-Cache: HIT"]
+`, &c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.mergeAssertions()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Cache", "MISS")
+		fmt.Fprint(w, "{}")
+	}))
+	defer server.Close()
+
+	m := c.Monitor["api"]
+	m.URL = server.URL
+	ch := make(chan Result, 1)
+	go m.Run(".", ch)
+	r := <-ch
+
+	if r.Error == nil || !strings.Contains(r.Error.Error(), "X-Cache: HIT") {
+		t.Errorf("expected the X-Cache assertion to fail the monitor, got %v", r.Error)
+	}
+	if len(r.Assertions) != 2 || !r.Assertions[0].Passed || r.Assertions[1].Passed || r.Assertions[1].Assertion != "header:X-Cache: HIT" {
+		t.Errorf("expected the failed header assertion in the result, got %+v", r.Assertions)
+	}
+}
+
+func TestExpectStatus(t *testing.T) {
+	var c Config
+	_, err := toml.Decode(`
+name = "Expected errors"
+
+[monitor.removed]
+name = "Removed"
+url = "http://example.org/old"
+expect_status = 404
+assertions = ["Not here anymore"]
+
+[monitor.moved]
+name = "Moved"
+url = "http://example.org/moved"
+expect_status = "301"
+header_assertions = ["Location: /new$"]
+
+[monitor.both]
+name = "Both"
+url = "http://example.org"
+status = 200
+expect_status = 200
+`, &c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.mergeAssertions()
+
+	if c.Monitor["removed"].Status != "404" || c.Monitor["removed"].ExpectStatus != "" {
+		t.Errorf("expected expect_status to become the status, got %+v", c.Monitor["removed"])
+	}
+	verr, ok := c.Validate(".").(ValidationError)
+	if !ok || len(verr.ErrorList) != 1 || !strings.Contains(verr.ErrorList[0], "'both'") {
+		t.Errorf("expected an error for monitor 'both', got %v", verr)
+	}
+
+	// without the merge, expect_status alone is valid too.
+	alias := Config{Name: "c", Monitor: map[string]Monitor{"m": {Name: "m", URL: "http://example.org", ExpectStatus: "404"}}}
+	if err := alias.Validate("."); err != nil {
+		t.Errorf("expected no error for only an expect_status, got %s", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/moved":
+			http.Redirect(w, r, "/new", http.StatusMovedPermanently)
+		case "/new":
+			fmt.Fprint(w, "New")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, "Not here anymore")
+		}
+	}))
+	defer server.Close()
+
+	for _, key := range []string{"removed", "moved"} {
+		m := c.Monitor[key]
+		m.URL = server.URL + map[string]string{"removed": "/old", "moved": "/moved"}[key]
+		ch := make(chan Result, 1)
+		go m.Run(".", ch)
+		r := <-ch
+		if r.Error != nil {
+			t.Errorf("expected monitor '%s' to succeed, got %s", key, r.Error)
+		}
+		if expected := string(m.Status); fmt.Sprint(r.StatusCode) != expected {
+			t.Errorf("expected status code %s in the result, got %d", expected, r.StatusCode)
+		}
+	}
+}
+
+func TestCheckCertExpiry(t *testing.T) {
+	now := time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)
+	cert := &x509.Certificate{NotAfter: now.Add(10 * 24 * time.Hour)}
+	cert.Subject.CommonName = "www.example.org"
+	state := &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+
+	if err := checkCertExpiry("7", state, now); err != nil {
+		t.Errorf("expected no error for a certificate valid for 10 days, got: %s", err)
+	}
+	if err := checkCertExpiry("30", state, now); err == nil || !strings.Contains(err.Error(), "expires in 10 days (2020-05-11)") {
+		t.Errorf("expected an expiry error, got: %v", err)
+	}
+	if err := checkCertExpiry("7", nil, now); err == nil {
+		t.Errorf("expected an error without a TLS connection")
+	}
+
+	a := Assertion{Type: AssertionCertExpiry, Value: "30", Message: "Renew the certificate"}
+	if err := a.CheckCertificate(state, now); err == nil || err.Error() != a.Message {
+		t.Errorf("expected the message as error, got: %v", err)
+	}
+
+	for _, value := range []string{"", "soon", "-1"} {
+		if err := (&Assertion{Type: AssertionCertExpiry, Value: value}).Validate(); err == nil {
+			t.Errorf("expected error for an invalid amount of days '%s'", value)
+		}
+	}
+}
+
+func TestRunCertExpiry(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	}))
+	defer server.Close()
+	notAfter := server.Certificate().NotAfter
+
+	m := Monitor{URL: server.URL, TLS: &TLSOptions{InsecureSkipVerify: true}, Assertions: []Assertion{{Type: AssertionCertExpiry, Value: "30"}}}
+	ch := make(chan Result, 1)
+	go m.Run(".", ch)
+	r := <-ch
+	if r.Error != nil {
+		t.Errorf("expected the certificate to be valid long enough, got %s", r.Error)
+	}
+	if r.CertNotAfter == nil || !r.CertNotAfter.Equal(notAfter) {
+		t.Errorf("expected the expiry %s in the result, got %v", notAfter, r.CertNotAfter)
+	}
+
+	days := int(notAfter.Sub(time.Now()).Hours()/24) + 1
+	m.Assertions = []Assertion{{Type: AssertionCertExpiry, Value: fmt.Sprint(days), Severity: SeverityWarning}}
+	go m.Run(".", ch)
+	r = <-ch
+	if r.Error != nil || len(r.Warnings) != 1 {
+		t.Errorf("expected an expiry warning, got error %v and warnings %v", r.Error, r.Warnings)
+	}
+}
+
+func TestAssertionGroups(t *testing.T) {
+	var c Config
+	_, err := toml.Decode(`
+[monitor.groups]
+assertions = [
+	{ all = [ { value = "Order" }, { any = [ "Backend A", "Backend B" ] }, { none = [ "Error" ] } ] },
+]
+`, &c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := c.Monitor["groups"].Assertions[0]
+	if err := a.Validate(); err != nil {
+		t.Fatalf("expected a valid group, got %s", err)
+	}
+	if expected := "all(Order, any(Backend A, Backend B), none(Error))"; a.String() != expected {
+		t.Errorf("expected '%s', got '%s'", expected, a)
+	}
+
+	tests := map[string]string{
+		"Order from Backend B":            "",
+		"Order from Backend C":            "none of any(Backend A, Backend B) passed",
+		"Order from Backend A with Error": "Error passed within none(Error)",
+		"Backend A":                       "regex `Order'",
+	}
+	for body, expected := range tests {
+		err := a.Check(200, nil, []byte(body), []byte(body))
+		if expected == "" && err != nil {
+			t.Errorf("%s: expected no error, got %s", body, err)
+		}
+		if expected != "" && (err == nil || !strings.Contains(err.Error(), expected)) {
+			t.Errorf("%s: expected an error containing '%s', got %v", body, expected, err)
+		}
+	}
+
+	a.Message = "Unexpected order page"
+	if err := a.Check(200, nil, []byte("Backend A"), []byte("Backend A")); err == nil || err.Error() != a.Message {
+		t.Errorf("expected the message of the group, got %v", err)
+	}
+
+	invalid := []Assertion{
+		{Type: AssertionAny},
+		{Type: AssertionAll, Value: "x", Group: []Assertion{{Value: "a"}}},
+		{Type: AssertionNone, Group: []Assertion{{Value: "a", Severity: SeverityWarning}}},
+		{Type: AssertionAll, Group: []Assertion{{Type: AssertionAny, Group: []Assertion{{Value: "(unclosed"}}}}},
+	}
+	for _, a := range invalid {
+		if err := a.Validate(); err == nil {
+			t.Errorf("expected error for group %s", a)
+		}
+	}
+
+	_, err = toml.Decode(`
+[monitor.both]
+assertions = [ { any = [ "a" ], none = [ "b" ] } ]
+`, &c)
+	if err == nil {
+		t.Errorf("expected error for an assertion with two groups")
+	}
+}
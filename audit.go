@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// SecurityPolicy determines which security headers are checked by monitors
+// with 'security_audit = true'. A policy file (TOML) only needs to contain the
+// settings which differ from the DefaultSecurityPolicy.
+type SecurityPolicy struct {
+	HSTS               bool     `toml:"hsts"`                 // Strict-Transport-Security is required (for https)
+	HSTSMinMaxAge      int64    `toml:"hsts_min_max_age"`     // minimum max-age of the HSTS header, in seconds
+	ContentTypeOptions bool     `toml:"content_type_options"` // X-Content-Type-Options: nosniff is required
+	CSP                bool     `toml:"csp"`                  // Content-Security-Policy is required
+	FrameOptions       bool     `toml:"frame_options"`        // X-Frame-Options (or CSP frame-ancestors) is required
+	NoServerVersion    bool     `toml:"no_server_version"`    // Server and X-Powered-By must not contain a version
+	RequiredHeaders    []string `toml:"required_headers"`     // other headers which must be present
+	ForbiddenHeaders   []string `toml:"forbidden_headers"`    // headers which must not be present
+	Severity           string   // error (default) or warning
+}
+
+// DefaultSecurityPolicy is the standard bundle of checks.
+var DefaultSecurityPolicy = SecurityPolicy{
+	HSTS:               true,
+	HSTSMinMaxAge:      15552000, // 180 days
+	ContentTypeOptions: true,
+	CSP:                true,
+	NoServerVersion:    true,
+}
+
+// ReadSecurityPolicy reads a policy file. Settings which are not in the file
+// keep their value of the DefaultSecurityPolicy.
+func ReadSecurityPolicy(file string) (SecurityPolicy, error) {
+	p := DefaultSecurityPolicy
+	_, err := toml.DecodeFile(file, &p)
+	if err != nil {
+		return p, err
+	}
+	if p.Severity != "" && p.Severity != SeverityError && p.Severity != SeverityWarning {
+		return p, fmt.Errorf("unknown severity '%s' (must be error or warning)", p.Severity)
+	}
+	return p, nil
+}
+
+// AuditCheck is the outcome of a single check of a security audit.
+type AuditCheck struct {
+	Name   string // the checked header
+	Passed bool
+	Detail string // why the check failed, or why it was not applicable
+}
+
+// Matches a version number in a Server or X-Powered-By header.
+var versionRegexp = regexp.MustCompile(`[0-9]+(\.[0-9]+)*`)
+
+// auditHeaders checks the response headers of the URL against the policy.
+func auditHeaders(policy SecurityPolicy, url string, header http.Header) []AuditCheck {
+	var checks []AuditCheck
+	check := func(name string, passed bool, detail string) {
+		checks = append(checks, AuditCheck{name, passed, detail})
+	}
+
+	if policy.HSTS {
+		hsts := header.Get("Strict-Transport-Security")
+		switch {
+		case !strings.HasPrefix(url, "https://"):
+			check("Strict-Transport-Security", true, "not applicable over http")
+		case hsts == "":
+			check("Strict-Transport-Security", false, "missing")
+		case hstsMaxAge(hsts) < policy.HSTSMinMaxAge:
+			check("Strict-Transport-Security", false, fmt.Sprintf("max-age %d is lower than %d", hstsMaxAge(hsts), policy.HSTSMinMaxAge))
+		default:
+			check("Strict-Transport-Security", true, "")
+		}
+	}
+
+	if policy.ContentTypeOptions {
+		value := header.Get("X-Content-Type-Options")
+		switch {
+		case value == "":
+			check("X-Content-Type-Options", false, "missing")
+		case !strings.EqualFold(strings.TrimSpace(value), "nosniff"):
+			check("X-Content-Type-Options", false, fmt.Sprintf("'%s' instead of 'nosniff'", value))
+		default:
+			check("X-Content-Type-Options", true, "")
+		}
+	}
+
+	csp := header.Get("Content-Security-Policy")
+	if policy.CSP {
+		check("Content-Security-Policy", csp != "", missing(csp == ""))
+	}
+
+	if policy.FrameOptions {
+		passed := header.Get("X-Frame-Options") != "" || strings.Contains(csp, "frame-ancestors")
+		check("X-Frame-Options", passed, missing(!passed))
+	}
+
+	if policy.NoServerVersion {
+		for _, name := range []string{"Server", "X-Powered-By"} {
+			value := header.Get(name)
+			if versionRegexp.MatchString(value) {
+				check(name, false, fmt.Sprintf("leaks version '%s'", value))
+			} else {
+				check(name, true, "")
+			}
+		}
+	}
+
+	for _, name := range policy.RequiredHeaders {
+		present := header.Get(name) != ""
+		check(name, present, missing(!present))
+	}
+	for _, name := range policy.ForbiddenHeaders {
+		present := header.Get(name) != ""
+		detail := ""
+		if present {
+			detail = "present"
+		}
+		check(name, !present, detail)
+	}
+
+	return checks
+}
+
+// Returns the detail of a check for a missing header.
+func missing(isMissing bool) string {
+	if isMissing {
+		return "missing"
+	}
+	return ""
+}
+
+// hstsMaxAge returns the max-age directive of a HSTS header, or -1.
+func hstsMaxAge(hsts string) int64 {
+	for _, directive := range strings.Split(hsts, ";") {
+		parts := strings.SplitN(strings.TrimSpace(directive), "=", 2)
+		if len(parts) == 2 && strings.EqualFold(parts[0], "max-age") {
+			age, err := strconv.ParseInt(strings.Trim(parts[1], `"`), 10, 64)
+			if err == nil {
+				return age
+			}
+		}
+	}
+	return -1
+}
+
+// auditFailure returns an error listing the failed checks, or nil.
+func auditFailure(checks []AuditCheck) error {
+	var failed []string
+	for _, c := range checks {
+		if !c.Passed {
+			failed = append(failed, c.Name+" "+c.Detail)
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	return fmt.Errorf("security audit failed: %s", strings.Join(failed, "; "))
+}
+
+// ApplySecurityPolicy sets the policy for all monitors with a security audit.
+// Monitors use the DefaultSecurityPolicy otherwise.
+func (c *Config) ApplySecurityPolicy(p SecurityPolicy) {
+	for key, monitor := range c.Monitor {
+		if monitor.SecurityAudit {
+			monitor.securityPolicy = &p
+			c.Monitor[key] = monitor
+		}
+	}
+}
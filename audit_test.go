@@ -0,0 +1,89 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestAuditHeaders(t *testing.T) {
+	header := http.Header{}
+	header.Set("Strict-Transport-Security", "max-age=300; includeSubDomains")
+	header.Set("X-Content-Type-Options", "nosniff")
+	header.Set("Server", "nginx/1.18.0")
+	header.Set("X-Powered-By", "PHP")
+
+	policy := DefaultSecurityPolicy
+	policy.ForbiddenHeaders = []string{"X-Powered-By"}
+	checks := auditHeaders(policy, "https://example.org", header)
+
+	expected := map[string]bool{
+		"Strict-Transport-Security": false, // max-age too low
+		"X-Content-Type-Options":    true,
+		"Content-Security-Policy":   false,
+		"Server":                    false,
+	}
+	for _, c := range checks {
+		if passed, ok := expected[c.Name]; ok && passed != c.Passed {
+			t.Errorf("%s: expected passed=%v, got %v (%s)", c.Name, passed, c.Passed, c.Detail)
+		}
+	}
+
+	err := auditFailure(checks)
+	if err == nil || !strings.Contains(err.Error(), "X-Powered-By present") {
+		t.Errorf("expected the forbidden header in the failure, got: %v", err)
+	}
+
+	// HSTS doesn't apply to plain http.
+	for _, c := range auditHeaders(DefaultSecurityPolicy, "http://example.org", header) {
+		if c.Name == "Strict-Transport-Security" && !c.Passed {
+			t.Errorf("expected HSTS to be skipped over http")
+		}
+	}
+}
+
+func TestReadSecurityPolicy(t *testing.T) {
+	f, err := ioutil.TempFile("", "hmon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("csp = false\nrequired_headers = [\"Referrer-Policy\"]\nseverity = \"warning\"\n")
+	f.Close()
+
+	p, err := ReadSecurityPolicy(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.CSP || !p.HSTS || p.Severity != SeverityWarning || len(p.RequiredHeaders) != 1 {
+		t.Errorf("unexpected policy %+v", p)
+	}
+}
+
+func TestRunSecurityAudit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Content-Security-Policy", "default-src 'self'")
+	}))
+	defer server.Close()
+
+	ch := make(chan Result, 1)
+	m := Monitor{Name: "audit", URL: server.URL, SecurityAudit: true}
+	go m.Run(".", ch)
+	r := <-ch
+	if r.Error != nil || len(r.Audit) == 0 {
+		t.Errorf("expected a passed audit, got: %v %+v", r.Error, r.Audit)
+	}
+
+	c := Config{Monitor: map[string]Monitor{"a": m}}
+	policy := DefaultSecurityPolicy
+	policy.RequiredHeaders = []string{"Referrer-Policy"}
+	c.ApplySecurityPolicy(policy)
+	go c.Monitor["a"].Run(".", ch)
+	if r := <-ch; r.Error == nil {
+		t.Errorf("expected the audit to fail on the missing header")
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BasicAuth are the credentials a monitor sends as basic authentication:
+//
+//	basic_auth = { user = "probe", password = "secret" }
+//
+// The user can also be given as 'username'.
+type BasicAuth struct {
+	Username string
+	Password string
+}
+
+// UnmarshalTOML decodes the credentials from a table.
+func (b *BasicAuth) UnmarshalTOML(data interface{}) error {
+	table, ok := data.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("basic_auth must be a table, got %T", data)
+	}
+	*b = BasicAuth{}
+	for key, value := range table {
+		str, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("basic_auth attribute '%s' must be a string", key)
+		}
+		switch key {
+		case "user", "username":
+			b.Username = str
+		case "password":
+			b.Password = str
+		default:
+			return fmt.Errorf("unknown basic_auth attribute '%s'", key)
+		}
+	}
+	return nil
+}
+
+// hasAuthorizationHeader returns true if the headers set an Authorization
+// header explicitly.
+func hasAuthorizationHeader(headers []Header) bool {
+	for _, h := range headers {
+		if strings.EqualFold(h.GetName(), "Authorization") {
+			return true
+		}
+	}
+	return false
+}
+
+// OAuth2 are the client credentials a monitor fetches a bearer token with,
+// using the OAuth2 client credentials grant:
+//
+//	[monitor.API.oauth2]
+//	token_url = "https://login.example.org/oauth2/token"
+//	client_id = "hmon"
+//	client_secret = "secret"
+//	scopes = ["api.read"]
+//
+// Tokens are cached until they expire, and shared by all monitors with the
+// same credentials.
+type OAuth2 struct {
+	TokenURL     string   `toml:"token_url"`
+	ClientID     string   `toml:"client_id"`
+	ClientSecret string   `toml:"client_secret"`
+	Scopes       []string // the scopes requested, if any
+}
+
+// validate checks the token URL and client id.
+func (o OAuth2) validate() error {
+	if o.TokenURL == "" {
+		return fmt.Errorf("needs a 'token_url'")
+	}
+	if _, err := url.ParseRequestURI(o.TokenURL); err != nil {
+		return fmt.Errorf("malformed token_url (%s)", err)
+	}
+	if o.ClientID == "" {
+		return fmt.Errorf("needs a 'client_id'")
+	}
+	return nil
+}
+
+// Returns the key of the credentials in the token cache.
+func (o OAuth2) cacheKey() string {
+	return strings.Join([]string{o.TokenURL, o.ClientID, o.ClientSecret, strings.Join(o.Scopes, " ")}, "\n")
+}
+
+// oauth2Token is a cached access token. The mutex makes monitors with the
+// same credentials wait for a single token request, instead of all fetching
+// their own.
+type oauth2Token struct {
+	sync.Mutex
+	accessToken string
+	expires     time.Time
+}
+
+// The tokens fetched during this run, by cache key.
+var oauth2Tokens = struct {
+	sync.Mutex
+	tokens map[string]*oauth2Token
+}{tokens: make(map[string]*oauth2Token)}
+
+// Tokens are refreshed this long before they expire, so they don't expire
+// while the request of the monitor is underway.
+const oauth2ExpiryMargin = 10 * time.Second
+
+// Token returns an access token for the credentials, from the cache or
+// fetched from the token URL with the client.
+func (o OAuth2) Token(client *http.Client) (string, error) {
+	key := o.cacheKey()
+	oauth2Tokens.Lock()
+	t, found := oauth2Tokens.tokens[key]
+	if !found {
+		t = &oauth2Token{}
+		oauth2Tokens.tokens[key] = t
+	}
+	oauth2Tokens.Unlock()
+
+	t.Lock()
+	defer t.Unlock()
+	if t.accessToken != "" && time.Now().Before(t.expires) {
+		return t.accessToken, nil
+	}
+
+	accessToken, expiresIn, err := o.fetchToken(client)
+	if err != nil {
+		return "", err
+	}
+	t.accessToken = accessToken
+	// tokens without an expiry are used for the rest of the run.
+	t.expires = time.Now().Add(100 * 365 * 24 * time.Hour)
+	if expiresIn > 0 {
+		t.expires = time.Now().Add(time.Duration(expiresIn)*time.Second - oauth2ExpiryMargin)
+	}
+	return t.accessToken, nil
+}
+
+// fetchToken requests a token from the token URL with the client credentials
+// grant. The client authenticates with basic authentication. Returns the
+// token and the amount of seconds it expires in (zero if unknown).
+func (o OAuth2) fetchToken(client *http.Client) (string, int64, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(o.Scopes) > 0 {
+		form.Set("scope", strings.Join(o.Scopes, " "))
+	}
+	req, err := http.NewRequest("POST", o.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", 0, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(o.ClientID), url.QueryEscape(o.ClientSecret))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", 0, err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", 0, err
+	}
+
+	var token struct {
+		AccessToken      string `json:"access_token"`
+		TokenType        string `json:"token_type"`
+		ExpiresIn        int64  `json:"expires_in"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	jerr := json.Unmarshal(b, &token)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		if token.Error != "" {
+			return "", 0, fmt.Errorf("token request failed with status %s: %s", resp.Status, strings.TrimSpace(token.Error+" "+token.ErrorDescription))
+		}
+		return "", 0, fmt.Errorf("token request failed with status %s", resp.Status)
+	}
+	if jerr != nil {
+		return "", 0, fmt.Errorf("unparsable token response: %s", jerr)
+	}
+	if token.AccessToken == "" {
+		return "", 0, fmt.Errorf("token response has no access_token")
+	}
+	if token.TokenType != "" && !strings.EqualFold(token.TokenType, "bearer") {
+		return "", 0, fmt.Errorf("unsupported token type '%s'", token.TokenType)
+	}
+	return token.AccessToken, token.ExpiresIn, nil
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDecodeBasicAuth(t *testing.T) {
+	var c Config
+	_, err := toml.Decode(`
+[monitor.a]
+url = "http://example.org"
+basic_auth = { user = "probe", password = "secret" }
+
+[monitor.b]
+url = "http://example.org"
+basic_auth = { username = "probe", password = "secret" }
+
+[monitor.c]
+url = "http://example.org"
+username = "probe"
+password = "secret"
+`, &c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"a", "b", "c"} {
+		auth := c.Monitor[key].basicAuth()
+		if auth == nil || auth.Username != "probe" || auth.Password != "secret" {
+			t.Errorf("expected the credentials of monitor %s, got %+v", key, auth)
+		}
+	}
+
+	_, err = toml.Decode("[monitor.a]\nbasic_auth = { user = \"probe\", token = \"x\" }\n", &c)
+	if err == nil {
+		t.Errorf("expected an error for an unknown attribute")
+	}
+}
+
+func TestBasicAuthWarnings(t *testing.T) {
+	c := Config{Monitor: map[string]Monitor{
+		"both":   {BasicAuth: &BasicAuth{"probe", "secret"}, Headers: []Header{"authorization: Bearer abc"}},
+		"auth":   {Username: "probe", Password: "secret"},
+		"header": {Headers: []Header{"Authorization: Bearer abc"}},
+	}}
+	warnings := c.Warnings()
+	if len(warnings) != 1 || warnings[0] != "monitor 'both': the Authorization header replaces the basic authentication" {
+		t.Errorf("expected a warning for monitor 'both', got %v", warnings)
+	}
+}
+
+func TestRunBasicAuth(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+		fmt.Fprintf(w, "%v %s:%s", ok, user, password)
+	}))
+	defer server.Close()
+
+	m := Monitor{URL: server.URL, BasicAuth: &BasicAuth{"probe", "s3cret"}, Assertions: []Assertion{{Value: "true probe:s3cret"}}}
+	ch := make(chan Result, 1)
+	go m.Run(".", ch)
+	if r := <-ch; r.Error != nil {
+		t.Errorf("expected the credentials to be sent, got %s", r.Error)
+	}
+
+	// an identity replaces the credentials of the monitor.
+	id := m.asIdentity(Identity{Headers: []Header{"Authorization: Bearer abc"}})
+	if id.basicAuth() != nil {
+		t.Errorf("expected the identity to replace the basic authentication")
+	}
+}
+
+func TestOAuth2Token(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			requests++
+			id, secret, _ := r.BasicAuth()
+			r.ParseForm()
+			if id != "hmon" || secret != "s3cret" || r.PostForm.Get("grant_type") != "client_credentials" {
+				w.WriteHeader(http.StatusUnauthorized)
+				fmt.Fprint(w, `{"error": "invalid_client"}`)
+				return
+			}
+			fmt.Fprintf(w, `{"access_token": "token-%s", "token_type": "Bearer", "expires_in": 3600}`, r.PostForm.Get("scope"))
+			return
+		}
+		fmt.Fprintf(w, "Authorization %s", r.Header.Get("Authorization"))
+	}))
+	defer server.Close()
+
+	credentials := &OAuth2{TokenURL: server.URL + "/token", ClientID: "hmon", ClientSecret: "s3cret", Scopes: []string{"api.read", "api.write"}}
+	for i := 0; i < 3; i++ {
+		m := Monitor{URL: server.URL, OAuth2: credentials, Assertions: []Assertion{{Value: `Authorization Bearer token-api\.read api\.write`}}}
+		ch := make(chan Result, 1)
+		go m.Run(".", ch)
+		if r := <-ch; r.Error != nil {
+			t.Errorf("expected the token to be sent, got %s", r.Error)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("expected the token to be fetched once, got %d requests", requests)
+	}
+
+	wrong := &OAuth2{TokenURL: server.URL + "/token", ClientID: "hmon", ClientSecret: "wrong"}
+	m := Monitor{URL: server.URL, OAuth2: wrong}
+	ch := make(chan Result, 1)
+	go m.Run(".", ch)
+	if r := <-ch; r.Error == nil || !strings.Contains(r.Error.Error(), "invalid_client") {
+		t.Errorf("expected the token error to fail the monitor, got %v", r.Error)
+	}
+}
+
+func TestOAuth2TokenThroughProxy(t *testing.T) {
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.String() == "http://login.hmon.invalid/token" {
+			fmt.Fprint(w, `{"access_token": "proxied", "token_type": "Bearer"}`)
+			return
+		}
+		fmt.Fprintf(w, "Authorization %s", r.Header.Get("Authorization"))
+	}))
+	defer proxy.Close()
+
+	m := Monitor{
+		URL:        "http://api.hmon.invalid/",
+		Proxy:      proxy.URL,
+		OAuth2:     &OAuth2{TokenURL: "http://login.hmon.invalid/token", ClientID: "proxied"},
+		Assertions: []Assertion{{Value: "Authorization Bearer proxied"}},
+	}
+	ch := make(chan Result, 1)
+	go m.Run(".", ch)
+	if r := <-ch; r.Error != nil {
+		t.Errorf("expected the token to be fetched through the proxy, got %s", r.Error)
+	}
+}
+
+func TestOAuth2Validate(t *testing.T) {
+	tests := []struct {
+		o     OAuth2
+		valid bool
+	}{
+		{OAuth2{TokenURL: "https://login.example.org/token", ClientID: "hmon"}, true},
+		{OAuth2{ClientID: "hmon"}, false},
+		{OAuth2{TokenURL: "login.example.org", ClientID: "hmon"}, false},
+		{OAuth2{TokenURL: "https://login.example.org/token"}, false},
+	}
+	for _, test := range tests {
+		if err := test.o.validate(); (err == nil) != test.valid {
+			t.Errorf("expected valid=%v for %+v, got %v", test.valid, test.o, err)
+		}
+	}
+}
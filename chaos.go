@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// newChaosProxy returns the handler of the proxy of a chaos run. It never
+// forwards a request, nor answers it: every request (including the CONNECT of
+// HTTPS requests) is held until the monitor gives up, or done is closed.
+func newChaosProxy(done chan bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-done:
+		}
+	})
+}
+
+// InjectChaos prepares the monitors for a chaos run: all of them go through
+// the chaos proxy, so no request reaches its server, and their timeouts are
+// lowered to the tolerance (in ms). Retries and OAuth2 tokens are dropped, so
+// the run stays short and no token endpoint is contacted.
+func (c *Config) InjectChaos(proxy string, tolerance int) {
+	for key, monitor := range c.Monitor {
+		monitor.Proxy = proxy
+		monitor.Backend = ""
+		monitor.OAuth2 = nil
+		monitor.Retries = 0
+		if monitor.Timeout <= 0 || monitor.Timeout > tolerance {
+			monitor.Timeout = tolerance
+		}
+		c.Monitor[key] = monitor
+	}
+}
+
+// chaosExpectation returns the failure code a monitor must fail with in a
+// chaos run: a timeout, or a configuration failure for monitors of which the
+// OpenAPI document can't be fetched through the chaos proxy.
+func chaosExpectation(m Monitor) string {
+	if strings.HasPrefix(m.OpenAPI, "http://") || strings.HasPrefix(m.OpenAPI, "https://") {
+		return FailureConfig
+	}
+	return FailureTimeout
+}
+
+// checkChaosResults checks that every monitor of a chaos run failed the way
+// it should, and returns the problems.
+func checkChaosResults(configResults []ConfigurationResult) []string {
+	var problems []string
+	for _, cr := range configResults {
+		for _, r := range cr.Results {
+			expected := chaosExpectation(r.Monitor)
+			code := r.Code
+			// the response headers don't arrive either, so the
+			// response_header_timeout may expire first.
+			if code == FailureHeaderTimeout {
+				code = FailureTimeout
+			}
+			if r.Error == nil {
+				problems = append(problems, fmt.Sprintf("%s / %s: expected %s, but the monitor succeeded", cr.ConfigurationName, r.Monitor.Name, expected))
+			} else if code != expected {
+				problems = append(problems, fmt.Sprintf("%s / %s: expected %s, got %s", cr.ConfigurationName, r.Monitor.Name, expected, r.ErrorText()))
+			}
+		}
+	}
+	return problems
+}
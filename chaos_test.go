@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestInjectChaos(t *testing.T) {
+	c := Config{Monitor: map[string]Monitor{
+		"a": {URL: "http://hmon.invalid/", Timeout: 5000, Retries: 3, Backend: "10.0.0.1", OAuth2: &OAuth2{}},
+		"b": {URL: "https://hmon.invalid/", Timeout: 50},
+	}}
+	c.InjectChaos("http://127.0.0.1:1", 100)
+
+	a, b := c.Monitor["a"], c.Monitor["b"]
+	if a.Proxy != "http://127.0.0.1:1" || a.Backend != "" || a.OAuth2 != nil || a.Retries != 0 {
+		t.Errorf("expected the monitor to go through the chaos proxy only, got %+v", a)
+	}
+	if a.Timeout != 100 || b.Timeout != 50 {
+		t.Errorf("expected the timeouts to be lowered to the tolerance, got %d and %d", a.Timeout, b.Timeout)
+	}
+}
+
+func TestRunChaos(t *testing.T) {
+	done := make(chan bool)
+	proxy := httptest.NewServer(newChaosProxy(done))
+	defer proxy.Close()
+	defer close(done)
+
+	c := Config{Name: "Chaos", Monitor: map[string]Monitor{
+		"http":  {Name: "HTTP", URL: "http://hmon.invalid/"},
+		"https": {Name: "HTTPS", URL: "https://hmon.invalid/"},
+		// the request file is fetched through the chaos proxy too.
+		"file": {Name: "File", URL: "http://hmon.invalid/", File: "http://hmon.invalid/chaos.xml"},
+	}}
+	c.InjectChaos(proxy.URL, 100)
+
+	cr := runParallel(ioutil.Discard, ".", c, false, 0, false, make(map[string]string), nil)
+	if problems := checkChaosResults([]ConfigurationResult{cr}); len(problems) > 0 {
+		t.Errorf("expected all monitors to time out, got %v", problems)
+	}
+}
+
+func TestCheckChaosResults(t *testing.T) {
+	configResults := []ConfigurationResult{{
+		ConfigurationName: "Chaos",
+		Results: []Result{
+			{Monitor: Monitor{Name: "Timeout"}, Error: ResultError{errors.New("timeout after 100 ms")}, Code: FailureTimeout},
+			{Monitor: Monitor{Name: "Up"}},
+			{Monitor: Monitor{Name: "Refused"}, Error: ResultError{errors.New("connection refused")}, Code: FailureConnect},
+		},
+	}}
+
+	problems := checkChaosResults(configResults)
+	if len(problems) != 2 {
+		t.Fatalf("expected 2 problems, got %v", problems)
+	}
+	if !strings.Contains(problems[0], "Chaos / Up: expected HM-TIMEOUT, but the monitor succeeded") {
+		t.Errorf("unexpected problem: '%s'", problems[0])
+	}
+	if !strings.Contains(problems[1], "Chaos / Refused: expected HM-TIMEOUT, got [HM-CONNECT] connection refused") {
+		t.Errorf("unexpected problem: '%s'", problems[1])
+	}
+}
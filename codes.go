@@ -0,0 +1,121 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"strings"
+)
+
+// The failure codes of results. These are stable, so automation can route and
+// deduplicate failures on the code instead of matching the error text.
+const (
+	FailureConfig         = "HM-CONFIG"          // the request could not be created, like a missing request file
+	FailureAuth           = "HM-AUTH"            // the OAuth2 token could not be fetched
+	FailureTimeout        = "HM-TIMEOUT"         // no (complete) response within the timeout
+	FailureConnectTimeout = "HM-CONNECT-TIMEOUT" // no connection within the connect_timeout
+	FailureHeaderTimeout  = "HM-HEADER-TIMEOUT"  // no response headers within the response_header_timeout
+	FailureDNS            = "HM-DNS"             // the host could not be resolved
+	FailureConnect        = "HM-CONNECT"         // no connection could be made to the host
+	FailureTLS            = "HM-TLS"             // the TLS handshake or certificate verification failed
+	FailureTLSExpired     = "HM-TLS-EXPIRED"     // the certificate has expired, or expires too soon (cert_expiry_days)
+	FailureTLSPin         = "HM-TLS-PIN"         // no served certificate matches the pin_sha256 fingerprints
+	FailureOCSP           = "HM-OCSP"            // no valid stapled OCSP response, or the certificate is revoked (ocsp)
+	FailureHTTP           = "HM-HTTP"            // any other failure of the exchange, like a dropped connection
+	FailureStatus         = "HM-STATUS"          // an unexpected status code
+	FailureAudit          = "HM-AUDIT"           // the security audit of the response headers failed
+	FailureNegotiate      = "HM-NEGOTIATION"     // the response doesn't match the Accept or Accept-Language of the request
+	FailureAssert         = "HM-ASSERT"          // an assertion failed
+	FailureCompare        = "HM-COMPARE"         // the response differs from the one of the compare URL
+	FailureSample         = "HM-SAMPLE"          // the distribution of the sampled marker is off
+)
+
+// codedError is an error with the failure code it's reported with.
+type codedError struct {
+	code string
+	err  error
+}
+
+func (c codedError) Error() string {
+	return c.err.Error()
+}
+
+func (c codedError) Unwrap() error {
+	return c.err
+}
+
+// withCode returns the error with the given failure code.
+func withCode(code string, err error) error {
+	return codedError{code, err}
+}
+
+// failureCode returns the failure code of the error. Errors without a code of
+// their own are errors of the exchange, which are classified by their type.
+func failureCode(err error) string {
+	var coded codedError
+	if errors.As(err, &coded) {
+		return coded.code
+	}
+
+	var invalid x509.CertificateInvalidError
+	if errors.As(err, &invalid) && invalid.Reason == x509.Expired {
+		return FailureTLSExpired
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return FailureDNS
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		var opErr *net.OpError
+		switch {
+		case errors.As(err, &opErr) && opErr.Op == "dial":
+			return FailureConnectTimeout
+		case strings.Contains(err.Error(), "TLS handshake timeout"):
+			return FailureConnectTimeout
+		case strings.Contains(err.Error(), "timeout awaiting response headers"):
+			return FailureHeaderTimeout
+		}
+		return FailureTimeout
+	}
+	var verifyErr *tls.CertificateVerificationError
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var recordErr tls.RecordHeaderError
+	if errors.As(err, &verifyErr) || errors.As(err, &invalid) || errors.As(err, &unknownAuthority) ||
+		errors.As(err, &hostnameErr) || errors.As(err, &recordErr) || strings.Contains(err.Error(), "tls: ") {
+		return FailureTLS
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return FailureConnect
+	}
+	return FailureHTTP
+}
+
+// assertionFailureCode returns the failure code of a failed assertion.
+func assertionFailureCode(a Assertion) string {
+	switch a.Type {
+	case AssertionStatus:
+		return FailureStatus
+	case AssertionCertExpiry:
+		return FailureTLSExpired
+	case AssertionOCSP:
+		return FailureOCSP
+	}
+	return FailureAssert
+}
+
+// ErrorText returns the error of the result prefixed with its failure code,
+// like "[HM-TIMEOUT] timeout after 100 ms", for outputs without a field of
+// their own for the code. Returns an empty string for successful results.
+func (r Result) ErrorText() string {
+	if r.Error == nil {
+		return ""
+	}
+	if r.Code == "" {
+		return r.Error.Error()
+	}
+	return "[" + r.Code + "] " + r.Error.Error()
+}
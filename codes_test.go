@@ -0,0 +1,100 @@
+package main
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// timeoutError is a net.Error which timed out.
+type timeoutError struct{ msg string }
+
+func (e timeoutError) Error() string   { return e.msg }
+func (e timeoutError) Timeout() bool   { return true }
+func (e timeoutError) Temporary() bool { return true }
+
+func TestFailureCode(t *testing.T) {
+	urlError := func(err error) error {
+		return &url.Error{Op: "Get", URL: "https://www.example.org", Err: err}
+	}
+	tests := []struct {
+		err  error
+		code string
+	}{
+		{withCode(FailureAssert, errors.New("assertion failed")), FailureAssert},
+		{urlError(&net.DNSError{Err: "no such host", Name: "www.example.org"}), FailureDNS},
+		{urlError(&net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}), FailureConnect},
+		{urlError(&net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")}), FailureHTTP},
+		{urlError(&net.OpError{Op: "dial", Net: "tcp", Err: timeoutError{"i/o timeout"}}), FailureConnectTimeout},
+		{urlError(timeoutError{"net/http: timeout awaiting response headers"}), FailureHeaderTimeout},
+		{urlError(timeoutError{"net/http: TLS handshake timeout"}), FailureConnectTimeout},
+		{urlError(&net.OpError{Op: "read", Net: "tcp", Err: timeoutError{"i/o timeout"}}), FailureTimeout},
+		{urlError(x509.CertificateInvalidError{Reason: x509.Expired}), FailureTLSExpired},
+		{urlError(x509.CertificateInvalidError{Reason: x509.NotAuthorizedToSign}), FailureTLS},
+		{urlError(x509.UnknownAuthorityError{}), FailureTLS},
+		{urlError(errors.New("remote error: tls: handshake failure")), FailureTLS},
+		{errors.New("unexpected EOF"), FailureHTTP},
+	}
+	for _, test := range tests {
+		if code := failureCode(test.err); code != test.code {
+			t.Errorf("%s: expected %s, got %s", test.err, test.code, code)
+		}
+	}
+}
+
+func TestRunFailureCodes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "Welcome")
+	}))
+	defer server.Close()
+	tlsServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer tlsServer.Close()
+
+	// a port nothing listens on.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := "http://" + l.Addr().String()
+	l.Close()
+
+	tests := []struct {
+		monitor Monitor
+		code    string
+	}{
+		{Monitor{URL: server.URL}, ""},
+		{Monitor{URL: server.URL, Assertions: []Assertion{{Value: "Goodbye"}}}, FailureAssert},
+		{Monitor{URL: server.URL, Assertions: []Assertion{{Type: AssertionStatus, Value: "404"}}}, FailureStatus},
+		{Monitor{URL: server.URL, Status: "5xx"}, FailureStatus},
+		{Monitor{URL: server.URL, File: "missing.xml"}, FailureConfig},
+		{Monitor{URL: closed}, FailureConnect},
+		{Monitor{URL: tlsServer.URL}, FailureTLS},
+	}
+	for _, test := range tests {
+		ch := make(chan Result, 1)
+		go test.monitor.Run(".", ch)
+		r := <-ch
+		if r.Code != test.code {
+			t.Errorf("%s: expected code '%s', got '%s' (%v)", test.monitor.URL, test.code, r.Code, r.Error)
+		}
+	}
+}
+
+func TestErrorText(t *testing.T) {
+	r := Result{Error: ResultError{errors.New("timeout after 100 ms")}, Code: FailureTimeout}
+	if text := r.ErrorText(); text != "[HM-TIMEOUT] timeout after 100 ms" {
+		t.Errorf("expected the code before the error, got '%s'", text)
+	}
+	r.Code = ""
+	if text := r.ErrorText(); text != "timeout after 100 ms" {
+		t.Errorf("expected only the error without a code, got '%s'", text)
+	}
+	if text := (Result{}).ErrorText(); text != "" {
+		t.Errorf("expected no text for a success, got '%s'", text)
+	}
+}
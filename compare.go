@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// compare sends the request of the monitor to its compare URL, and checks
+// whether the normalized response is equal to the (normalized) response of
+// the monitor's own URL. On a mismatch, the error summarizes the difference.
+func (m Monitor) compare(client *http.Client, requestBody []byte, normalized []byte, timeout time.Duration) error {
+	req, err := m.newRequest(m.CompareURL, requestBody)
+	if err != nil {
+		return err
+	}
+
+	c := *client
+	c.Timeout = timeout
+	resp, err := c.Do(req)
+	if err != nil {
+		return fmt.Errorf("compare_url: %s", err)
+	}
+	defer resp.Body.Close()
+
+	var r io.Reader = resp.Body
+	if m.ReadLimit > 0 {
+		r = io.LimitReader(r, m.ReadLimit)
+	}
+	other, err := ioutil.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("compare_url: %s", err)
+	}
+
+	if diff := diffSummary(normalized, m.normalizeBody(other)); diff != "" {
+		return fmt.Errorf("response differs from compare_url %s: %s", m.CompareURL, diff)
+	}
+	return nil
+}
+
+// The maximum length of the excerpts in a diff summary.
+const diffExcerptLength = 60
+
+// diffSummary returns a short description of the first difference between
+// the two bodies, or an empty string if they're equal.
+func diffSummary(a, b []byte) string {
+	if bytes.Equal(a, b) {
+		return ""
+	}
+
+	linesA := bytes.Split(a, []byte("\n"))
+	linesB := bytes.Split(b, []byte("\n"))
+
+	line := 0
+	for line < len(linesA) && line < len(linesB) && bytes.Equal(linesA[line], linesB[line]) {
+		line++
+	}
+
+	var lineA, lineB []byte
+	if line < len(linesA) {
+		lineA = linesA[line]
+	}
+	if line < len(linesB) {
+		lineB = linesB[line]
+	}
+
+	// start the excerpts a bit before the first differing column.
+	col := 0
+	for col < len(lineA) && col < len(lineB) && lineA[col] == lineB[col] {
+		col++
+	}
+	start := col - 10
+	if start < 0 {
+		start = 0
+	}
+
+	return fmt.Sprintf("first difference at line %d, column %d: %q vs %q (%d vs %d lines)",
+		line+1, col+1, excerpt(lineA, start), excerpt(lineB, start), len(linesA), len(linesB))
+}
+
+// Returns at most diffExcerptLength bytes of the line, from start.
+func excerpt(line []byte, start int) string {
+	if start > len(line) {
+		return ""
+	}
+	line = line[start:]
+	if len(line) > diffExcerptLength {
+		return string(line[:diffExcerptLength]) + "..."
+	}
+	return string(line)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDiffSummary(t *testing.T) {
+	if diff := diffSummary([]byte("a\nb"), []byte("a\nb")); diff != "" {
+		t.Errorf("expected no difference, got: %s", diff)
+	}
+
+	diff := diffSummary([]byte("<a>\n<version>1.2</version>\n</a>"), []byte("<a>\n<version>1.3</version>\n</a>"))
+	if !strings.Contains(diff, "line 2, column 12") || !strings.Contains(diff, `"version>1.2</version>" vs "version>1.3</version>"`) {
+		t.Errorf("unexpected diff summary: %s", diff)
+	}
+
+	diff = diffSummary([]byte("a"), []byte("a\nb"))
+	if !strings.Contains(diff, "(1 vs 2 lines)") {
+		t.Errorf("unexpected diff summary: %s", diff)
+	}
+}
+
+func TestRunCompare(t *testing.T) {
+	blue := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<status>OK</status>  <time>1</time>")
+	}))
+	defer blue.Close()
+	green := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<status>OK</status> <time>2</time>")
+	}))
+	defer green.Close()
+
+	ch := make(chan Result, 1)
+	m := Monitor{Name: "compare", URL: blue.URL, CompareURL: green.URL}
+	go m.Run(".", ch)
+	if r := <-ch; r.Error == nil || !strings.Contains(r.Error.Error(), "differs") {
+		t.Errorf("expected the responses to differ, got: %v", r.Error)
+	}
+
+	m.Remove = []string{"<time>[0-9]+</time>"}
+	m.Normalize = []string{NormalizeWhitespace}
+	go m.Run(".", ch)
+	if r := <-ch; r.Error != nil {
+		t.Errorf("expected equal responses after normalization, got: %s", r.Error)
+	}
+}
@@ -2,15 +2,25 @@ package main
 
 import (
 	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"github.com/BurntSushi/toml"
+	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"net/http/httptrace"
 	"net/url"
 	"os"
 	"path"
+	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
+	"sync"
+	"text/template"
 	"time"
 )
 
@@ -61,7 +71,7 @@ func (r ResultError) MarshalJSON() ([]byte, error) {
 	if r.Err == nil {
 		return []byte("null"), nil
 	}
-	return []byte(fmt.Sprintf("\"%s\"", r.Err)), nil
+	return json.Marshal(r.Err.Error())
 }
 
 /*
@@ -70,15 +80,297 @@ func (r ResultError) MarshalJSON() ([]byte, error) {
  * ===============================================================================
  */
 
+// The schema versions of configurations. Version 1 is the XML format of older
+// hmon versions, version 2 the TOML format. Configurations without a schema
+// are read as the current schema.
+const (
+	LegacySchema  = 1
+	CurrentSchema = 2
+)
+
 // Config is the root configuration node, contains zero or more Monitor structs.
 type Config struct {
 	// The original filename (basename)
 	FileName string
 
-	Name    string
+	Schema    int // the schema version of the configuration
+	Name      string
+	CookieJar bool        `toml:"cookie_jar"` // the monitors share their cookies, and run one after another
+	Scrub     []ScrubRule // rules masking sensitive parts of the bodies of all monitors
+	Monitor   map[string]Monitor
+	Group     map[string]Group
+	// the statuses of the Pandora modules of all monitors, by failure code
+	PandoraStatus map[string]string `toml:"pandora_status"`
+	// the settings of the HTTP transports of all monitors
+	Transport *TransportOptions
+}
+
+// Group is a set of monitors sharing a base URL and headers. Monitors within a
+// group specify their URL relative to the base URL. After parsing, the monitors
+// of all groups are moved to the Monitor map of the configuration.
+type Group struct {
+	BaseURL string `toml:"base_url"`
+	Headers []Header
 	Monitor map[string]Monitor
 }
 
+// expandGroups moves the monitors of all groups into the Monitor map of the
+// configuration. The key of a group's monitor becomes 'group/monitor'. The
+// URL of these monitors is resolved against the group's base URL, and the
+// group's headers are prepended to the monitor's headers.
+func (c *Config) expandGroups() error {
+	if len(c.Group) > 0 && c.Monitor == nil {
+		c.Monitor = make(map[string]Monitor)
+	}
+
+	for groupName, group := range c.Group {
+		for monitorName, monitor := range group.Monitor {
+			key := groupName + "/" + monitorName
+			if _, found := c.Monitor[key]; found {
+				return fmt.Errorf("monitor '%s' is defined more than once", key)
+			}
+
+			monitor.URL = joinURL(group.BaseURL, monitor.URL)
+			monitor.Headers = append(append([]Header{}, group.Headers...), monitor.Headers...)
+			c.Monitor[key] = monitor
+		}
+	}
+
+	c.Group = nil
+	return nil
+}
+
+// joinURL appends the relative URL to the base URL. Absolute URLs (with a
+// scheme) are returned as-is. An empty base URL leaves the URL unchanged.
+func joinURL(base, rel string) string {
+	if base == "" || strings.Contains(rel, "://") {
+		return rel
+	}
+	if rel == "" {
+		return base
+	}
+	return strings.TrimSuffix(base, "/") + "/" + strings.TrimPrefix(rel, "/")
+}
+
+// Environment is the base URL and extra headers of a monitor in a single
+// environment, like production or staging. In the configuration it's either
+// a plain string (the base URL), or a table with a 'base_url' and 'headers'.
+type Environment struct {
+	BaseURL string
+	Headers []Header
+}
+
+// UnmarshalTOML decodes the environment from either a string or a table.
+func (e *Environment) UnmarshalTOML(data interface{}) error {
+	switch v := data.(type) {
+	case string:
+		*e = Environment{BaseURL: v}
+		return nil
+	case map[string]interface{}:
+		*e = Environment{}
+		for key, value := range v {
+			switch key {
+			case "base_url":
+				str, ok := value.(string)
+				if !ok {
+					return fmt.Errorf("environment attribute 'base_url' must be a string")
+				}
+				e.BaseURL = str
+			case "headers":
+				list, ok := value.([]interface{})
+				if !ok {
+					return fmt.Errorf("environment attribute 'headers' must be a list of strings")
+				}
+				for _, h := range list {
+					str, ok := h.(string)
+					if !ok {
+						return fmt.Errorf("environment attribute 'headers' must be a list of strings")
+					}
+					e.Headers = append(e.Headers, Header(str))
+				}
+			default:
+				return fmt.Errorf("unknown environment attribute '%s'", key)
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("environment must be a string or a table, got %T", data)
+}
+
+// SelectEnvironment resolves the monitors which have environments. When env
+// is given, the URL of these monitors is resolved against the base URL of
+// that environment, and its headers are added. Monitors which don't have the
+// environment are disabled. When env is empty, the monitors are run in every
+// environment: each monitor is replaced by one monitor per environment, with
+// the key 'monitor@env' and the environment appended to its name.
+func (c *Config) SelectEnvironment(env string) {
+	for key, monitor := range c.Monitor {
+		if len(monitor.Environments) == 0 {
+			continue
+		}
+
+		environments := monitor.Environments
+		monitor.Environments = nil
+
+		if env != "" {
+			e, found := environments[env]
+			if !found {
+				monitor.Disabled = true
+			} else {
+				monitor = monitor.inEnvironment(e)
+			}
+			c.Monitor[key] = monitor
+			continue
+		}
+
+		delete(c.Monitor, key)
+		for name, e := range environments {
+			m := monitor.inEnvironment(e)
+			m.Name = fmt.Sprintf("%s (%s)", monitor.Name, name)
+			c.Monitor[key+"@"+name] = m
+		}
+	}
+}
+
+// inEnvironment returns a copy of the monitor with the URL resolved against
+// the base URL of the environment, and the environment's headers appended.
+func (m Monitor) inEnvironment(e Environment) Monitor {
+	m.URL = joinURL(e.BaseURL, m.URL)
+	m.Headers = append(append([]Header{}, m.Headers...), e.Headers...)
+	return m
+}
+
+// Excludes are the monitors to skip for a run. Names are globs (as in
+// path.Match) matched against the monitor name and its key in the
+// configuration. Hosts are globs matched against the hostname of the URL.
+type Excludes struct {
+	Names []string
+	Hosts []string
+}
+
+// Matches returns true if the monitor with the given key is excluded.
+func (e Excludes) Matches(key string, m Monitor) bool {
+	for _, glob := range e.Names {
+		if ok, _ := path.Match(glob, m.Name); ok {
+			return true
+		}
+		if ok, _ := path.Match(glob, key); ok {
+			return true
+		}
+	}
+
+	if len(e.Hosts) == 0 {
+		return false
+	}
+	u, err := url.Parse(m.URL)
+	if err != nil {
+		return false
+	}
+	for _, glob := range e.Hosts {
+		if ok, _ := path.Match(glob, u.Hostname()); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadExcludes reads an excludes file. Every line is a glob of a monitor name
+// to skip, or a glob of a host when prefixed with 'host:'. Empty lines and
+// lines starting with a '#' are ignored.
+func ReadExcludes(file string) (Excludes, error) {
+	var e Excludes
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return e, err
+	}
+
+	for i, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		list := &e.Names
+		if strings.HasPrefix(line, "host:") {
+			list = &e.Hosts
+			line = strings.TrimSpace(strings.TrimPrefix(line, "host:"))
+		}
+		if _, err := path.Match(line, ""); err != nil {
+			return e, fmt.Errorf("line %d: invalid glob `%s'", i+1, line)
+		}
+		*list = append(*list, line)
+	}
+	return e, nil
+}
+
+// Skip disables all monitors matching the excludes, and returns the amount
+// of monitors which were disabled by it.
+func (c *Config) Skip(e Excludes) int {
+	skipped := 0
+	for key, monitor := range c.Monitor {
+		if monitor.Disabled || !e.Matches(key, monitor) {
+			continue
+		}
+		monitor.Disabled = true
+		c.Monitor[key] = monitor
+		skipped++
+	}
+	return skipped
+}
+
+// OverrideHosts rewrites the host of every monitor URL which is found in the
+// overrides map (original host -> replacement host). A host in the map may
+// include a port, in which case it only matches URLs with that exact port.
+// Otherwise, only the hostname is replaced and any port is kept.
+func (c *Config) OverrideHosts(overrides map[string]string) {
+	for key, monitor := range c.Monitor {
+		u, err := url.Parse(monitor.URL)
+		if err != nil {
+			// leave it to the validation to report this one.
+			continue
+		}
+
+		if replacement, found := overrides[u.Host]; found {
+			u.Host = replacement
+		} else if replacement, found := overrides[u.Hostname()]; found {
+			if port := u.Port(); port != "" {
+				u.Host = net.JoinHostPort(replacement, port)
+			} else {
+				u.Host = replacement
+			}
+		} else {
+			continue
+		}
+
+		monitor.URL = u.String()
+		c.Monitor[key] = monitor
+	}
+}
+
+// SortedMonitors returns the enabled monitors of the configuration ordered by
+// their priority (highest first). Monitors with the same priority are ordered
+// by their order attribute, and then by their name.
+func (c *Config) SortedMonitors() []Monitor {
+	monitors := make([]Monitor, 0, len(c.Monitor))
+	for _, m := range c.Monitor {
+		if !m.Disabled {
+			monitors = append(monitors, m)
+		}
+	}
+
+	sort.Slice(monitors, func(i, j int) bool {
+		if monitors[i].Priority != monitors[j].Priority {
+			return monitors[i].Priority > monitors[j].Priority
+		}
+		if monitors[i].Order != monitors[j].Order {
+			return monitors[i].Order < monitors[j].Order
+		}
+		return monitors[i].Name < monitors[j].Name
+	})
+
+	return monitors
+}
+
 // Validate runs a validation over the parsed configuration file. The returned
 // error is of type ValidationError.
 func (c *Config) Validate(basePath string) error {
@@ -92,10 +384,20 @@ func (c *Config) Validate(basePath string) error {
 		if monitor.Name == "" {
 			verr.Add(fmt.Sprintf("monitor '%s' must have a 'name' attribute", monitorName))
 		}
-		if monitor.URL == "" {
+		if monitor.OpenAPI != "" || monitor.Operation != "" {
+			if monitor.OpenAPI == "" || monitor.Operation == "" {
+				verr.Add(fmt.Sprintf("monitor '%s': 'openapi' and 'operation' must be given together", monitorName))
+			}
+			if monitor.File != "" || monitor.Body != "" {
+				verr.Add(fmt.Sprintf("monitor '%s': can't have a 'file' or 'body' with an OpenAPI operation", monitorName))
+			}
+		}
+		if monitor.URL == "" && monitor.OpenAPI == "" {
 			verr.Add(fmt.Sprintf("monitor '%s': must have a 'url' attribute", monitorName))
-		} else {
-			_, err := url.ParseRequestURI(monitor.URL)
+		} else if monitor.URL != "" {
+			// run variables are only known during the run, so a placeholder
+			// is validated instead.
+			_, err := url.ParseRequestURI(variableRegexp.ReplaceAllString(monitor.URL, "x"))
 			if err != nil {
 				verr.Add(fmt.Sprintf("monitor '%s': malformed url (%s)", monitorName, err))
 			}
@@ -109,21 +411,161 @@ func (c *Config) Validate(basePath string) error {
 			}
 		}
 
-		// try to open the file which is to be sent
-		if monitor.File != "" {
-			f := path.Join(basePath, monitor.File)
-			_, err := os.Stat(f)
+		// the credentials are given either way, not both.
+		if monitor.BasicAuth != nil && (monitor.Username != "" || monitor.Password != "") {
+			verr.Add(fmt.Sprintf("monitor '%s': can't have both 'basic_auth' and a 'username' or 'password'", monitorName))
+		}
+
+		if monitor.TLS != nil {
+			err := monitor.TLS.load()
+			if err != nil {
+				verr.Add(fmt.Sprintf("monitor '%s': tls %s", monitorName, err))
+			}
+		}
+
+		for _, pin := range monitor.PinSHA256 {
+			if err := validatePin(pin); err != nil {
+				verr.Add(fmt.Sprintf("monitor '%s': pin_sha256 %s", monitorName, err))
+			}
+		}
+		if len(monitor.PinSHA256) > 0 && strings.HasPrefix(monitor.URL, "http://") {
+			verr.Add(fmt.Sprintf("monitor '%s': 'pin_sha256' needs an https url", monitorName))
+		}
+
+		if monitor.Negotiation && !monitor.negotiates() {
+			verr.Add(fmt.Sprintf("monitor '%s': 'negotiation' needs 'accept' or 'accept_language'", monitorName))
+		}
+
+		if monitor.Notify != nil {
+			if err := monitor.Notify.validate(); err != nil {
+				verr.Add(fmt.Sprintf("monitor '%s': notify %s", monitorName, err))
+			}
+		}
+
+		if monitor.TotalTimeout != 0 && monitor.Timeout != 0 {
+			verr.Add(fmt.Sprintf("monitor '%s': can't have both 'timeout' and 'total_timeout'", monitorName))
+		}
+		if monitor.Timeout < 0 || monitor.ConnectTimeout < 0 || monitor.HeaderTimeout < 0 {
+			verr.Add(fmt.Sprintf("monitor '%s': timeouts can't be negative", monitorName))
+		}
+
+		if monitor.Retries < 0 || monitor.RetryDelay < 0 {
+			verr.Add(fmt.Sprintf("monitor '%s': 'retries' and 'retry_delay' can't be negative", monitorName))
+		}
+
+		if monitor.Proxy != "" {
+			if _, err := parseProxy(monitor.Proxy); err != nil {
+				verr.Add(fmt.Sprintf("monitor '%s': invalid proxy (%s)", monitorName, err))
+			}
+		}
+
+		if monitor.OAuth2 != nil {
+			err := monitor.OAuth2.validate()
+			if err != nil {
+				verr.Add(fmt.Sprintf("monitor '%s': oauth2 %s", monitorName, err))
+			}
+		}
+
+		// try to read the file which is to be sent, including any includes.
+		if monitor.File != "" && monitor.Body != "" {
+			verr.Add(fmt.Sprintf("monitor '%s': can't have both a 'file' and a 'body'", monitorName))
+		} else if monitor.BodyTemplate != "" && (monitor.File != "" || monitor.Body != "") {
+			verr.Add(fmt.Sprintf("monitor '%s': can't have a 'body_template' with a 'file' or 'body'", monitorName))
+		} else if monitor.Data != "" && monitor.BodyTemplate == "" {
+			verr.Add(fmt.Sprintf("monitor '%s': 'data' needs a 'body_template'", monitorName))
+		} else if monitor.File == stdinFile || isRemoteFile(monitor.File) {
+			// read at run time, so validating doesn't wait for stdin or the
+			// network.
+		} else if monitor.File != "" || monitor.BodyTemplate != "" {
+			_, err := monitor.RequestBody(basePath)
 			if err != nil {
 				verr.Add(fmt.Sprintf("monitor '%s': unable to use HTTP POST data: %s", monitorName, err))
 			}
 		}
 
-		for _, assertion := range monitor.Assertions {
-			_, err := regexp.Compile(assertion)
+		// the assertions share their backing array with the configuration,
+		// so the compiled regexes are kept.
+		for i := range monitor.Assertions {
+			err := monitor.Assertions[i].Validate()
+			if err != nil {
+				verr.Add(fmt.Sprintf("monitor '%s': assertion '%s': %s", monitorName, monitor.Assertions[i], err))
+			}
+		}
+
+		if monitor.ExpectStatus != "" && monitor.Status != "" {
+			verr.Add(fmt.Sprintf("monitor '%s': can't have both 'status' and 'expect_status'", monitorName))
+		}
+		if monitor.Status != "" {
+			err := monitor.Status.validate()
+			if err != nil {
+				verr.Add(fmt.Sprintf("monitor '%s': status needs %s", monitorName, err))
+			}
+		}
+
+		for variable, header := range monitor.Capture {
+			if !variableNameRegexp.MatchString(variable) {
+				verr.Add(fmt.Sprintf("monitor '%s': capture '%s' is not a valid variable name (letters, digits, '_', '-' and '.')", monitorName, variable))
+			}
+			if strings.TrimSpace(header) == "" {
+				verr.Add(fmt.Sprintf("monitor '%s': capture '%s' needs a header name", monitorName, variable))
+			}
+		}
+
+		if monitor.CompareURL != "" {
+			_, err := url.ParseRequestURI(monitor.CompareURL)
+			if err != nil {
+				verr.Add(fmt.Sprintf("monitor '%s': malformed compare_url (%s)", monitorName, err))
+			}
+		}
+
+		if monitor.Sample != nil {
+			err := monitor.Sample.validate()
+			if err != nil {
+				verr.Add(fmt.Sprintf("monitor '%s': sample: %s", monitorName, err))
+			}
+		}
+
+		if monitor.ReadLimit < 0 {
+			verr.Add(fmt.Sprintf("monitor '%s': read_limit cannot be negative", monitorName))
+		}
+
+		for _, step := range monitor.Normalize {
+			if step != NormalizeWhitespace && step != NormalizeLowercase {
+				verr.Add(fmt.Sprintf("monitor '%s': unknown normalization step '%s'", monitorName, step))
+			}
+		}
+
+		monitor.removeRegexps = nil
+		for _, remove := range monitor.Remove {
+			rex, err := regexp.Compile(remove)
 			if err != nil {
-				verr.Add(fmt.Sprintf("monitor '%s': assertion '%s' has an invalid regex: %s", monitorName, assertion, err))
+				verr.Add(fmt.Sprintf("monitor '%s': remove '%s' has an invalid regex: %s", monitorName, remove, err))
+				continue
 			}
+			monitor.removeRegexps = append(monitor.removeRegexps, rex)
+		}
+		monitor.removeXPaths = nil
+		for _, remove := range monitor.RemoveXPath {
+			p, err := parseXMLPath(remove)
+			if err != nil {
+				verr.Add(fmt.Sprintf("monitor '%s': remove_xpath '%s' is invalid: %s", monitorName, remove, err))
+				continue
+			}
+			monitor.removeXPaths = append(monitor.removeXPaths, p)
+		}
+
+		for i := range monitor.Scrub {
+			if err := monitor.Scrub[i].compile(); err != nil {
+				verr.Add(fmt.Sprintf("monitor '%s': scrub %s", monitorName, err))
+			}
+		}
+		for _, err := range validatePandoraStatus(monitor.PandoraStatus) {
+			verr.Add(fmt.Sprintf("monitor '%s': %s", monitorName, err))
 		}
+		if err := monitor.Transport.validate(); err != nil {
+			verr.Add(fmt.Sprintf("monitor '%s': transport %s", monitorName, err))
+		}
+		c.Monitor[monitorName] = monitor
 	}
 
 	// if we found 0 or more errors, return the verr, else ...
@@ -135,134 +577,690 @@ func (c *Config) Validate(basePath string) error {
 	return nil
 }
 
+// Warnings returns the problems of the configuration which don't make it
+// invalid, but are most likely mistakes.
+func (c *Config) Warnings() []string {
+	keys := make([]string, 0, len(c.Monitor))
+	for key := range c.Monitor {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var warnings []string
+	for _, key := range keys {
+		monitor := c.Monitor[key]
+		if monitor.basicAuth() != nil && hasAuthorizationHeader(monitor.Headers) {
+			warnings = append(warnings, fmt.Sprintf("monitor '%s': the Authorization header replaces the basic authentication", key))
+		}
+	}
+	return warnings
+}
+
 // Monitor node with its children. All slices can be zero or more,
 // technically, but logically some kind of validation can be done using
 // Validate().
 type Monitor struct {
-	Name        string
-	Description string
-	URL         string
-	File        string
-	Timeout     int
-	Headers     []Header
-	Assertions  []string
-	Callback    func(*Monitor, []byte, []byte) `json:"-"` // callback function to check input/output
+	Name             string
+	Description      string
+	Owner            string        // the team owning the monitor, shown in all outputs
+	Runbook          string        // URL of the runbook, shown with failures
+	Notes            string        // remediation notes, shown with failures
+	Notify           *NotifyTarget `json:"-"` // where failures are notified, instead of the notifiers of the command line
+	URL              string
+	File             string
+	Body             string // the inline request body, instead of a file
+	BodyTemplate     string `toml:"body_template" json:",omitempty"` // template of the request body, rendered with the data file
+	Data             string `json:",omitempty"`                      // JSON file with the data of the body template
+	OpenAPI          string `toml:"openapi" json:",omitempty"`       // URL (or file) of the OpenAPI document with the operation
+	Operation        string `json:",omitempty"`                      // the operationId of the operation of the OpenAPI document
+	Timeout          int    // the timeout of the whole exchange in ms
+	TotalTimeout     int    `toml:"total_timeout" json:"-"`                    // alias of timeout
+	ConnectTimeout   int    `toml:"connect_timeout" json:",omitempty"`         // the timeout of making the connection in ms
+	HeaderTimeout    int    `toml:"response_header_timeout" json:",omitempty"` // the timeout of receiving the response headers in ms, after sending the request
+	Retries          int    `json:",omitempty"`                                // the amount of times a failed check is retried
+	RetryDelay       int    `toml:"retry_delay" json:",omitempty"`             // the delay before the first retry in ms, doubled after every retry
+	Priority         int    // higher priorities are run (and reported) first
+	Order            int    // position of the monitor among monitors with the same priority
+	Disabled         bool   // disabled monitors are not run
+	Sweep            bool   // run the monitor against every address of the host, see SweepPools
+	Backend          string `toml:"-" json:",omitempty"` // the address the monitor connects to instead of the host, set by SweepPools
+	Proxy            string `json:",omitempty"`          // URL of the proxy to use, instead of the one of the environment
+	Headers          []Header
+	Accept           string                 `json:",omitempty"`                        // the Accept header sent
+	AcceptLanguage   string                 `toml:"accept_language" json:",omitempty"` // the Accept-Language header sent
+	Negotiation      bool                   `json:",omitempty"`                        // check the representation negotiated for accept and accept_language
+	BasicAuth        *BasicAuth             `toml:"basic_auth" json:"-"`               // credentials sent as basic authentication
+	Username         string                 `json:"-"`                                 // shorthand for the user of basic_auth
+	Password         string                 `json:"-"`                                 // shorthand for the password of basic_auth
+	TLS              *TLSOptions            `json:"-"`                                 // TLS settings, like a private CA
+	Transport        *TransportOptions      `json:"-"`                                 // settings of the HTTP transport, like tls_min_version
+	PinSHA256        []string               `toml:"pin_sha256" json:"-"`               // base64 SHA-256 fingerprints of the accepted public keys
+	OAuth2           *OAuth2                `toml:"oauth2" json:"-"`                   // client credentials to fetch a bearer token with
+	Environments     map[string]Environment `json:"-"`                                 // base URLs and headers per environment
+	Identities       map[string]Identity    `json:"-"`                                 // credentials to run the monitor with, one run per identity
+	PandoraStatus    map[string]string      `toml:"pandora_status" json:"-"`           // the statuses of the Pandora module, by failure code
+	Assertions       []Assertion
+	Negative         []string                       `toml:"negative_assertions" json:"-"` // regexes the response must not match, merged into the assertions
+	JSONPath         []string                       `toml:"jsonpath" json:"-"`            // JSONPath expressions the response must satisfy, merged into the assertions
+	HeaderAssertions []string                       `toml:"header_assertions" json:"-"`   // headers the response must have, merged into the assertions
+	Status           StatusCodes                    // the expected status codes, like "200" or "2xx,304"
+	ExpectStatus     StatusCodes                    `toml:"expect_status" json:"-"` // alias of status
+	ReadLimit        int64                          `toml:"read_limit"`             // max bytes of the body to read and assert
+	Normalize        []string                       // normalization steps applied before asserting
+	Remove           []string                       // regexes of volatile parts removed before asserting
+	RemoveXPath      []string                       `toml:"remove_xpath"`   // xpaths of elements whose text is removed before asserting
+	Scrub            []ScrubRule                    `json:"-"`              // rules masking sensitive parts of saved and shown bodies
+	SecurityAudit    bool                           `toml:"security_audit"` // check the security headers of the response
+	CacheBust        bool                           `toml:"cache_bust"`     // bypass caches with a random query parameter and no-cache headers
+	CompareURL       string                         `toml:"compare_url"`    // URL of which the response must be equivalent
+	Sample           *Sampling                      // repeats the request to check the distribution of a marker
+	TimingHeaders    []string                       `toml:"timing_headers"` // custom headers with a server reported timing
+	Capture          map[string]string              `json:",omitempty"`     // run variables captured from response headers (variable -> header)
+	Callback         func(*Monitor, []byte, []byte) `json:"-"`              // callback function to check input/output (only valid during the call)
+
+	removeRegexps  []*regexp.Regexp // the compiled 'remove' regexes, set by Validate
+	removeXPaths   []*xmlPath       // the parsed 'remove_xpath' paths, set by Validate
+	method         string           // the method of the OpenAPI operation, instead of GET or POST
+	securityPolicy *SecurityPolicy  // the policy of the security audit, if not the default
+	failureDir     string           // the directory to save failed exchanges to, if any
+	jar            http.CookieJar   // the cookie jar shared with the other monitors, if any
+}
+
+// Normalization steps which can be given in a monitor's 'normalize' list.
+const (
+	NormalizeWhitespace = "whitespace" // collapses all whitespace to single spaces
+	NormalizeLowercase  = "lowercase"  // converts everything to lowercase
+)
+
+// Matches one or more whitespace characters, for normalization.
+var whitespaceRegexp = regexp.MustCompile(`\s+`)
+
+// normalizeBody prepares a response body for the assertions. First, all
+// matches of the 'remove' regexes, and the text of the elements matching the
+// 'remove_xpath' paths, are removed. After that, the normalization steps are
+// applied in the configured order.
+func (m *Monitor) normalizeBody(body []byte) []byte {
+	if len(m.removeRegexps) == len(m.Remove) {
+		for _, rex := range m.removeRegexps {
+			body = rex.ReplaceAll(body, nil)
+		}
+	} else {
+		// not validated, so compile them on the spot.
+		for _, remove := range m.Remove {
+			body = regexp.MustCompile(remove).ReplaceAll(body, nil)
+		}
+	}
+	if len(m.removeXPaths) == len(m.RemoveXPath) {
+		for _, p := range m.removeXPaths {
+			body = p.scrub(body, nil)
+		}
+	} else {
+		for _, remove := range m.RemoveXPath {
+			if p, err := parseXMLPath(remove); err == nil {
+				body = p.scrub(body, nil)
+			}
+		}
+	}
+
+	for _, step := range m.Normalize {
+		switch step {
+		case NormalizeWhitespace:
+			body = bytes.TrimSpace(whitespaceRegexp.ReplaceAll(body, []byte(" ")))
+		case NormalizeLowercase:
+			body = bytes.ToLower(body)
+		}
+	}
+
+	return body
 }
 
 // notifyCallback will report the input and output when hmon is run in verbose mode.
 func (m *Monitor) notifyCallback(input, output []byte) {
 	if m.Callback != nil {
-		m.Callback(m, input, output)
+		m.Callback(m, m.scrub(input), m.scrub(output))
 	}
 }
 
-// Run runs a check for the given Monitor. There are a few things done in this function.
+// The delay before the first retry of a monitor without a retry_delay, in ms.
+const RetryDelayDefault = 1000
+
+// Run runs a check for the given Monitor, see runOnce. Failed checks are
+// retried up to 'retries' times, except when the request could not be created
+// at all. The delay between the attempts starts at the retry delay, and is
+// doubled after every retry. Every attempt has the full timeout. The result is
+// the one of the last attempt, with the time the first attempt started. Only
+// the last attempt saves its failure.
+func (m Monitor) Run(baseDir string, c chan Result) {
+	delay := time.Duration(m.RetryDelay) * time.Millisecond
+	if m.RetryDelay <= 0 {
+		delay = RetryDelayDefault * time.Millisecond
+	}
+
+	attempts := make(chan Result, 1)
+	var first time.Time
+	for attempt := 1; ; attempt++ {
+		last := attempt > m.Retries
+		a := m
+		if !last {
+			a.failureDir = ""
+		}
+		a.runOnce(baseDir, attempts)
+		r := <-attempts
+		if attempt == 1 {
+			first = r.Time
+		}
+		if r.Error == nil || r.Code == FailureConfig || last {
+			r.Time = first
+			r.Attempts = attempt
+			c <- r
+			return
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// runOnce runs a single check for the given Monitor. There are a few things done in this function.
 // If the given input file is empty (i.e. none), a http GET is issued to the given URL.
 // If a file is given though, this will become a http POST, with the post-data being the
 // file's contents. If there are any assertions configured, all the assertions are used
 // to test the content. If none are configured, it will just be a sort of 'ping-check',
 // i.e. checking if a connection could be made to the URL.
-func (m Monitor) Run(baseDir string, c chan Result) {
-	client := http.Client{}
+func (m Monitor) runOnce(baseDir string, c chan Result) {
+	started := time.Now()
+	counter := &byteCounter{}
 
-	var requestBody []byte
+	// the exchange so far, saved when the monitor fails (see SaveFailures).
 	var req *http.Request
-	var err error
+	var requestBody []byte
+	var resp *http.Response
+	var responseBody []byte
+	var timer *connectTimer // times the exchange, once the request is made
+
+	// reports the result to the channel, including the traffic so far.
+	var warnings []string
+	var audit []AuditCheck
+	var timings []ServerTiming
+	var assertions []AssertionResult
+	var captured map[string]string
+	var schedulerWait int64
+	report := func(latency int64, err error) {
+		r := Result{Monitor: m, Time: started, Latency: latency, SchedulerWait: schedulerWait, Warnings: warnings, Assertions: assertions, Audit: audit, ServerTimings: timings, Captured: captured, BytesSent: counter.Sent(), BytesReceived: counter.Received()}
+		if timer != nil {
+			r.Phases = timer.phases()
+		}
+		if resp != nil {
+			r.StatusCode = resp.StatusCode
+			r.CertNotAfter = certNotAfter(resp.TLS)
+			r.OCSPAge = ocspAge(resp.TLS, time.Now())
+		}
+		if err != nil {
+			r.Error = ResultError{err}
+			r.Code = failureCode(err)
+			if m.failureDir != "" {
+				file, serr := saveFailure(m.failureDir, m, started, req, requestBody, resp, responseBody, err)
+				if serr != nil {
+					r.Warnings = append(r.Warnings, serr.Error())
+				}
+				r.FailureFile = file
+			}
+		}
+		c <- r
+	}
+
+	tlsConfig, err := m.TLS.config()
+	if err != nil {
+		m.notifyCallback(nil, nil)
+		report(0, withCode(FailureConfig, err))
+		return
+	}
+	var proxy *url.URL
+	if m.Proxy != "" {
+		proxy, err = parseProxy(m.Proxy)
+		if err != nil {
+			m.notifyCallback(nil, nil)
+			report(0, withCode(FailureConfig, fmt.Errorf("invalid proxy `%s': %s", m.Proxy, err)))
+			return
+		}
+	}
 
-	if m.File == "" {
-		req, err = http.NewRequest("GET", m.URL, nil)
+	// the timeout of the exchange, and of fetching a token.
+	var timeout time.Duration
+	if m.Timeout <= 0 {
+		// if timeout is smaller/eq zero, use default timeout
+		timeout = time.Duration(TimeoutDefault) * time.Second
 	} else {
-		requestBody, err = ioutil.ReadFile(path.Join(baseDir, m.File))
+		timeout = time.Duration(int64(m.Timeout)) * time.Millisecond
+	}
+
+	// the request of an OpenAPI operation is taken from the document, which
+	// is fetched on every run to stay in sync with it. Its traffic is not
+	// counted.
+	if m.OpenAPI != "" {
+		specClient := http.Client{Transport: newTransport(&byteCounter{}, hostname(m.OpenAPI), "", proxy, tlsConfig, m.Transport)}
+		m, requestBody, err = m.withOperation(baseDir, &specClient, timeout)
+		if err != nil {
+			m.notifyCallback(nil, nil)
+			report(0, withCode(FailureConfig, err))
+			return
+		}
+	}
+
+	transport := newTransport(counter, hostname(m.URL), m.Backend, proxy, pinnedConfig(tlsConfig, m.PinSHA256), m.Transport)
+	setTimeouts(transport, time.Duration(m.ConnectTimeout)*time.Millisecond, time.Duration(m.HeaderTimeout)*time.Millisecond)
+	client := http.Client{Transport: transport, Jar: m.jar}
+	if m.expectsRedirect() {
+		// the redirect itself is checked, instead of where it leads to.
+		client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+	}
+
+	if m.OpenAPI == "" {
+		requestBody, err = m.RequestBody(baseDir)
 		if err != nil {
 			m.notifyCallback(requestBody, nil)
-			c <- Result{m, 0, ResultError{err}}
+			// a fetched request file has the code of the failed fetch.
+			if _, coded := err.(codedError); !coded {
+				err = withCode(FailureConfig, err)
+			}
+			report(0, err)
 			return
 		}
-		req, err = http.NewRequest("POST", m.URL, bytes.NewReader(requestBody))
 	}
 
+	req, err = m.newRequest(m.URL, requestBody)
 	if err != nil {
 		m.notifyCallback(requestBody, nil)
-		c <- Result{m, 0, ResultError{err}}
+		report(0, withCode(FailureConfig, err))
 		return
 	}
+	if requestBody != nil && m.Transport.expectContinue() {
+		req.Header.Set("Expect", "100-continue")
+	}
 
-	// add all optional headers. This uses the GetName() and GetValue on our Header
-	// type. By this time, the validator should have validated the headers in the
-	// configuration, so correct headers are sent.
-	for _, header := range m.Headers {
-		req.Header.Set(header.GetName(), header.GetValue())
+	// fetch the bearer token before the request, so it's not part of the
+	// latency. Explicit Authorization headers take precedence. The token is
+	// fetched through the proxy and with the TLS settings of the monitor,
+	// and its traffic is not counted.
+	if m.OAuth2 != nil && req.Header.Get("Authorization") == "" {
+		tokenClient := http.Client{
+			Transport: newTransport(&byteCounter{}, hostname(m.OAuth2.TokenURL), "", proxy, tlsConfig, m.Transport),
+			Timeout:   timeout,
+		}
+		token, err := m.OAuth2.Token(&tokenClient)
+		if err != nil {
+			m.notifyCallback(requestBody, nil)
+			report(0, withCode(FailureAuth, fmt.Errorf("unable to fetch OAuth2 token: %s", err)))
+			return
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
 	}
 
-	// start measuring time from this point:
+	// the latency is measured from the moment the transport starts getting
+	// a connection. The time until then, waiting for the goroutine to be
+	// scheduled, is reported separately.
+	timer = &connectTimer{}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), timer.trace()))
 	tstart := time.Now()
 
-	// This block enables us to timeout the HTTP call.
+	// This block enables us to timeout the HTTP call. The timeout covers the
+	// full exchange, including reading the response body.
 	type response struct {
 		Resp *http.Response
+		Body []byte
 		Err  error
+		buf  *bytes.Buffer // the pooled buffer holding the body, if any
 	}
 	timeoutChan := make(chan response, 1)
 
 	// run the Do in a goroutine, and write the response to the timeout channel.
 	go func() {
 		resp, err := client.Do(req)
-		timeoutChan <- response{resp, err}
+		if err != nil {
+			timeoutChan <- response{resp, nil, err, nil}
+			return
+		}
+		defer resp.Body.Close()
+
+		// Only read the body if any assertion checks it, or there's anything
+		// to compare it against, to save on failure or to show (-verbose).
+		// When a read limit is configured, no more than that is read.
+		needsBody := m.CompareURL != "" || m.failureDir != "" || m.Callback != nil
+		for _, assertion := range m.Assertions {
+			needsBody = needsBody || assertion.needsBody()
+		}
+		if !needsBody {
+			timeoutChan <- response{resp, nil, nil, nil}
+			return
+		}
+
+		var r io.Reader = resp.Body
+		if m.ReadLimit > 0 {
+			r = io.LimitReader(r, m.ReadLimit)
+		}
+		buf := bodyBuffers.Get().(*bytes.Buffer)
+		buf.Reset()
+		_, err = buf.ReadFrom(r)
+		timeoutChan <- response{resp, buf.Bytes(), err, buf}
 	}()
 
 	var theResponse response
 
 	// read from the channel, or until timeout
-	var timeout time.Duration
-	if m.Timeout <= 0 {
-		// if timeout is smaller/eq zero, use default timeout
-		timeout = time.Duration(TimeoutDefault) * time.Second
-	} else {
-		timeout = time.Duration(int64(m.Timeout)) * time.Millisecond
-	}
-
 	select {
 	case <-time.After(timeout):
 		m.notifyCallback(requestBody, nil)
-		c <- Result{m, 0, ResultError{fmt.Errorf("timeout after %d ms", timeout/time.Millisecond)}}
+		report(0, withCode(FailureTimeout, fmt.Errorf("timeout after %d ms", timeout/time.Millisecond)))
 		return
 	case theResponse = <-timeoutChan:
-		// OKAY! We got a response.
+		// OKAY! We got a response. The body is not used after this run, so
+		// the buffer can be reused. After a timeout, the buffer is left to
+		// the garbage collector, since the goroutine may still be using it.
+		if theResponse.buf != nil {
+			defer releaseBodyBuffer(theResponse.buf)
+		}
+		resp, responseBody = theResponse.Resp, theResponse.Body
+		schedulerWait = timer.wait(tstart)
 	}
 
 	// check any errors in the response itself
 	if theResponse.Err != nil {
-		m.notifyCallback(requestBody, nil)
-		c <- Result{m, 0, ResultError{theResponse.Err}}
+		m.notifyCallback(requestBody, theResponse.Body)
+		report(0, theResponse.Err)
 		return
 	}
 
-	// we got no errors now, i.e. we got an actual response body. Defer closing it,
-	// and read from it so we can process it further.
-	defer theResponse.Resp.Body.Close()
-	responseContents, err := ioutil.ReadAll(theResponse.Resp.Body)
+	// the captured headers are kept, whatever the outcome of the checks.
+	captured = captureHeaders(m.Capture, theResponse.Resp.Header)
+
+	responseContents := theResponse.Body
+	normalizedContents := m.normalizeBody(responseContents)
+
+	// an unexpected status code fails the monitor, whatever the body is.
+	if m.Status != "" {
+		err := checkStatus(string(m.Status), theResponse.Resp.StatusCode)
+		if err != nil {
+			millis := timer.latency(tstart)
+			m.notifyCallback(requestBody, responseContents)
+			report(millis, withCode(FailureStatus, err))
+			return
+		}
+	}
+
+	// the representation must be the one negotiated for the request.
+	if m.Negotiation {
+		err := checkNegotiation(req.Header, theResponse.Resp.Header)
+		if err != nil {
+			millis := timer.latency(tstart)
+			m.notifyCallback(requestBody, responseContents)
+			report(millis, withCode(FailureNegotiate, err))
+			return
+		}
+	}
+
+	// the timings reported by the server, to tell network latency from
+	// application latency.
+	timings = serverTimings(theResponse.Resp.Header, m.TimingHeaders)
+
+	// audit the security headers of the response, if requested.
+	if m.SecurityAudit {
+		policy := DefaultSecurityPolicy
+		if m.securityPolicy != nil {
+			policy = *m.securityPolicy
+		}
+		audit = auditHeaders(policy, m.URL, theResponse.Resp.Header)
+		if err := auditFailure(audit); err != nil {
+			if policy.Severity != SeverityWarning {
+				millis := timer.latency(tstart)
+				m.notifyCallback(requestBody, responseContents)
+				report(millis, withCode(FailureAudit, err))
+				return
+			}
+			warnings = append(warnings, err.Error())
+		}
+	}
 
 	// whether the response validates against the assertions.
 	// When no assertions are given, just check if the site/host is up.
-	for i := range m.Assertions {
-		// at this point, compilation of the regular expression must succeed,
-		// since we already executed a Validate() on the configuration itself.
-		// To make things sure, we do a MustCompile though.
-		rex := regexp.MustCompile(m.Assertions[i])
-		found := rex.Find(responseContents)
-		if found == nil {
-			millis := int64(time.Now().Sub(tstart) / time.Millisecond)
+	// All assertions are evaluated, so the result of each is reported. The
+	// first failing assertion fails the monitor. Failing assertions with a
+	// warning severity are collected, but don't fail the monitor.
+	var failure error
+	for _, assertion := range m.Assertions {
+		astart := time.Now()
+		err := assertion.CheckResponse(theResponse.Resp, responseContents, normalizedContents)
+		ar := AssertionResult{
+			Assertion: assertion.String(),
+			Passed:    err == nil,
+			Severity:  assertion.Severity,
+			Duration:  int64(time.Now().Sub(astart) / time.Microsecond),
+		}
+		if err != nil {
+			ar.Error = err.Error()
+		}
+		assertions = append(assertions, ar)
+
+		if err == nil {
+			continue
+		}
+		if assertion.IsWarning() {
+			warnings = append(warnings, err.Error())
+			continue
+		}
+		if failure == nil {
+			failure = withCode(assertionFailureCode(assertion), err)
+		}
+	}
+	if failure != nil {
+		millis := timer.latency(tstart)
+		m.notifyCallback(requestBody, responseContents)
+		report(millis, failure)
+		return
+	}
+
+	// passed all tests, return true to the channel
+	millis := timer.latency(tstart)
+
+	// compare the response with the one of the compare URL, if any. The
+	// latency only covers the first request to the monitor's own URL.
+	if m.CompareURL != "" {
+		err := m.compare(&client, requestBody, normalizedContents, timeout)
+		if err != nil {
 			m.notifyCallback(requestBody, responseContents)
-			c <- Result{m, millis, ResultError{fmt.Errorf("assertion failed for regex `%s'", m.Assertions[i])}}
+			report(millis, withCode(FailureCompare, err))
 			return
 		}
 	}
 
-	// passed all tests, return true to the channel
-	millis := int64(time.Now().Sub(tstart) / time.Millisecond)
+	// check the distribution of the marker over repeated requests, if any.
+	if m.Sample != nil {
+		err := m.sample(&client, requestBody, timeout)
+		if err != nil {
+			m.notifyCallback(requestBody, responseContents)
+			report(millis, withCode(FailureSample, err))
+			return
+		}
+	}
 
 	m.notifyCallback(requestBody, responseContents)
-	c <- Result{m, millis, nil}
+	report(millis, nil)
+}
+
+// Buffers for reading response bodies, reused between monitor runs to keep
+// the memory usage of large runs down.
+var bodyBuffers = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+
+// Buffers which grew larger than this are not reused, so a single huge
+// response doesn't stay around for the rest of the run.
+const maxPooledBuffer = 1 << 20
+
+// releaseBodyBuffer returns the buffer to the pool, if it's small enough.
+func releaseBodyBuffer(buf *bytes.Buffer) {
+	if buf.Cap() <= maxPooledBuffer {
+		bodyBuffers.Put(buf)
+	}
+}
+
+// SkipVerify makes all monitors skip the verification of the certificates of
+// the servers, like 'insecure_skip_verify' in their tls settings.
+func (c *Config) SkipVerify() {
+	for key, monitor := range c.Monitor {
+		options := TLSOptions{}
+		if monitor.TLS != nil {
+			options = *monitor.TLS
+		}
+		options.InsecureSkipVerify = true
+		monitor.TLS = &options
+		c.Monitor[key] = monitor
+	}
+}
+
+// LimitBodies sets the read limit of all monitors without a read limit of
+// their own to max bytes. This caps the memory used per monitor in large runs.
+func (c *Config) LimitBodies(max int64) {
+	for key, monitor := range c.Monitor {
+		if monitor.ReadLimit == 0 {
+			monitor.ReadLimit = max
+			c.Monitor[key] = monitor
+		}
+	}
+}
+
+// FailureContext returns the owner, runbook and notes of the monitor as a
+// single line, to include with failures. It's empty when none is set.
+func (m Monitor) FailureContext() string {
+	var parts []string
+	if m.Owner != "" {
+		parts = append(parts, "Owner: "+m.Owner)
+	}
+	if m.Runbook != "" {
+		parts = append(parts, "Runbook: "+m.Runbook)
+	}
+	if m.Notes != "" {
+		parts = append(parts, "Notes: "+m.Notes)
+	}
+	return strings.Join(parts, " - ")
+}
+
+// expectsRedirect returns true if the monitor expects a redirect (3xx) status
+// code, with its 'status' or a status assertion.
+func (m Monitor) expectsRedirect() bool {
+	if m.Status.redirects() {
+		return true
+	}
+	for _, a := range m.Assertions {
+		if a.Type == AssertionStatus && StatusCodes(a.Value).redirects() {
+			return true
+		}
+	}
+	return false
+}
+
+// basicAuth returns the credentials to send as basic authentication: the
+// basic_auth table, or the username and password attributes. It's nil when
+// neither is set.
+func (m Monitor) basicAuth() *BasicAuth {
+	if m.BasicAuth != nil {
+		return m.BasicAuth
+	}
+	if m.Username != "" || m.Password != "" {
+		return &BasicAuth{Username: m.Username, Password: m.Password}
+	}
+	return nil
+}
+
+// RequestBody returns the body the monitor POSTs: the inline body, or the
+// request file read relative to the base directory. A file of "-" is read from
+// stdin, and an http(s) URL is fetched. Without either, it's nil and the
+// monitor does a GET.
+func (m Monitor) RequestBody(baseDir string) ([]byte, error) {
+	if m.Body != "" {
+		return []byte(m.Body), nil
+	}
+	if m.File == stdinFile {
+		return readStdinBody()
+	}
+	if isRemoteFile(m.File) {
+		return m.fetchRequestFile()
+	}
+	if m.File != "" {
+		return ReadRequestFile(baseDir, m.File)
+	}
+	if m.BodyTemplate != "" {
+		return RenderRequestTemplate(baseDir, m.BodyTemplate, m.Data)
+	}
+	return nil, nil
+}
+
+// newRequest creates the request of the monitor to the given URL. Without a
+// request body, this is a GET. Otherwise, the body is POSTed. Monitors of an
+// OpenAPI operation use the method of the operation.
+func (m Monitor) newRequest(url string, requestBody []byte) (*http.Request, error) {
+	var req *http.Request
+	var err error
+	if m.method != "" {
+		var body io.Reader
+		if requestBody != nil {
+			body = bytes.NewReader(requestBody)
+		}
+		req, err = http.NewRequest(m.method, url, body)
+	} else if requestBody == nil {
+		req, err = http.NewRequest("GET", url, nil)
+	} else {
+		req, err = http.NewRequest("POST", url, bytes.NewReader(requestBody))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// an explicit Authorization header takes precedence over the basic
+	// authentication, since it's set after it.
+	if auth := m.basicAuth(); auth != nil {
+		req.SetBasicAuth(auth.Username, auth.Password)
+	}
+	if m.Accept != "" {
+		req.Header.Set("Accept", m.Accept)
+	}
+	if m.AcceptLanguage != "" {
+		req.Header.Set("Accept-Language", m.AcceptLanguage)
+	}
+
+	// add all optional headers. This uses the GetName() and GetValue on our Header
+	// type. By this time, the validator should have validated the headers in the
+	// configuration, so correct headers are sent.
+	for _, header := range m.Headers {
+		req.Header.Set(header.GetName(), header.GetValue())
+	}
+
+	if m.CacheBust {
+		bustCache(req)
+	}
+	return req, nil
+}
+
+// The query parameter added to the URL of monitors with 'cache_bust = true'.
+const cacheBustParam = "_hmon"
+
+// bustCache makes sure the request is not answered by a cache, by appending a
+// random query parameter to the URL and adding no-cache headers (unless the
+// monitor sets these headers itself).
+func bustCache(req *http.Request) {
+	token := make([]byte, 8)
+	rand.Read(token)
+	param := cacheBustParam + "=" + hex.EncodeToString(token)
+	if req.URL.RawQuery == "" {
+		req.URL.RawQuery = param
+	} else {
+		req.URL.RawQuery += "&" + param
+	}
+
+	if req.Header.Get("Cache-Control") == "" {
+		req.Header.Set("Cache-Control", "no-cache")
+	}
+	if req.Header.Get("Pragma") == "" {
+		req.Header.Set("Pragma", "no-cache")
+	}
 }
 
 // Returns the monitor as a string.
@@ -318,6 +1316,85 @@ func (h Header) Validate() error {
  * ===============================================================================
  */
 
+// The maximum depth of nested includes in request files. Anything deeper is
+// most likely an include cycle.
+const maxIncludeDepth = 16
+
+// includeAction matches an include in a request file. Only request files with
+// an include are rendered as a template, so bodies with literal braces (like
+// JSON holding a mustache template) are sent as is.
+var includeAction = regexp.MustCompile(`{{-?\s*include\s`)
+
+// ReadRequestFile reads a request (POST data) file relative to the base
+// directory. Request files may include other files relative to the base
+// directory using {{ include "file" }}, so shared boilerplate (like SOAP
+// envelopes) only has to be written once. Included files can include files
+// themselves.
+func ReadRequestFile(baseDir, file string) ([]byte, error) {
+	return readRequestFile(baseDir, file, nil, 0)
+}
+
+// RenderRequestTemplate renders the request template with the data of the
+// JSON data file, both relative to the base directory, so one template serves
+// the bodies of many monitors. Like request files, templates can include
+// other files. Without a data file, the template is rendered without data.
+// Referring to data which isn't in the data file is an error.
+func RenderRequestTemplate(baseDir, file, dataFile string) ([]byte, error) {
+	var data interface{} = map[string]interface{}{}
+	if dataFile != "" {
+		b, err := ioutil.ReadFile(resolveFile(baseDir, dataFile))
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(b, &data); err != nil {
+			return nil, fmt.Errorf("unable to parse data file `%s': %s", dataFile, err)
+		}
+	}
+	return readRequestFile(baseDir, file, data, 0)
+}
+
+// readRequestFile reads the request file, and renders it as a template with
+// the data. Without data, it's only rendered when it includes other files.
+func readRequestFile(baseDir, file string, data interface{}, depth int) ([]byte, error) {
+	if depth > maxIncludeDepth {
+		return nil, fmt.Errorf("includes nested too deep (cycle?) at `%s'", file)
+	}
+
+	b, err := ioutil.ReadFile(resolveFile(baseDir, file))
+	if err != nil {
+		return nil, err
+	}
+
+	if data == nil && !includeAction.Match(b) {
+		return b, nil
+	}
+
+	// included files get the same data.
+	funcs := template.FuncMap{
+		"include": func(name string) (string, error) {
+			included, err := readRequestFile(baseDir, name, data, depth+1)
+			return string(included), err
+		},
+	}
+
+	tmpl := template.New(file).Funcs(funcs)
+	if data != nil {
+		tmpl = tmpl.Option("missingkey=error")
+	}
+	tmpl, err = tmpl.Parse(string(b))
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, data)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
 // ReadConfig reads a single toml configuration file name. Returns a Config struct if OK,
 // or an error if anything has failed.
 func ReadConfig(file string) (Config, error) {
@@ -332,9 +1409,130 @@ func ReadConfig(file string) (Config, error) {
 		return Config{}, fmt.Errorf("`%s' is not a regular file", file)
 	}
 
+	return decodeConfig(file, finfo.Name())
+}
+
+// mergeAssertions adds the negative assertions, the JSONPath expressions and
+// the header assertions of all monitors to their assertions, as negated regex
+// assertions, jsonpath assertions and header assertions. The expect_status
+// of monitors becomes their status, and their total_timeout their timeout.
+func (c *Config) mergeAssertions() {
+	for key, monitor := range c.Monitor {
+		// when both are set, expect_status is kept for the validation
+		// to report. The same goes for total_timeout.
+		if monitor.ExpectStatus != "" && monitor.Status == "" {
+			monitor.Status, monitor.ExpectStatus = monitor.ExpectStatus, ""
+			c.Monitor[key] = monitor
+		}
+		if monitor.TotalTimeout != 0 && monitor.Timeout == 0 {
+			monitor.Timeout, monitor.TotalTimeout = monitor.TotalTimeout, 0
+			c.Monitor[key] = monitor
+		}
+		if len(monitor.Negative) == 0 && len(monitor.JSONPath) == 0 && len(monitor.HeaderAssertions) == 0 {
+			continue
+		}
+		monitor.Assertions = append([]Assertion{}, monitor.Assertions...)
+		for _, regex := range monitor.Negative {
+			monitor.Assertions = append(monitor.Assertions, Assertion{Type: AssertionRegex, Value: regex, Negate: true})
+		}
+		for _, expr := range monitor.JSONPath {
+			monitor.Assertions = append(monitor.Assertions, Assertion{Type: AssertionJSONPath, Value: expr})
+		}
+		for _, header := range monitor.HeaderAssertions {
+			monitor.Assertions = append(monitor.Assertions, Assertion{Type: AssertionHeader, Value: header})
+		}
+		monitor.Negative = nil
+		monitor.JSONPath = nil
+		monitor.HeaderAssertions = nil
+		c.Monitor[key] = monitor
+	}
+}
+
+// checkSchema returns an error if configurations with the schema version can't
+// be read. When a new schema is introduced, configurations of the previous
+// schema are still accepted here, and converted after decoding.
+func checkSchema(version int) error {
+	switch {
+	case version == 0 || version == CurrentSchema:
+		return nil
+	case version == LegacySchema:
+		return fmt.Errorf("schema %d is the XML format of older hmon versions, convert it with 'hmon migrate-config'", version)
+	case version > CurrentSchema:
+		return fmt.Errorf("schema %d is not supported by this version of hmon (up to schema %d), please upgrade hmon", version, CurrentSchema)
+	}
+	return fmt.Errorf("unknown schema %d", version)
+}
+
+// interpolateConfig replaces the references to other values (like
+// @{group.api.base}) in the toml document. Documents without references are
+// returned as-is, others are decoded, interpolated and encoded again.
+func interpolateConfig(b []byte) ([]byte, error) {
+	if !bytes.Contains(b, []byte("@{")) {
+		return b, nil
+	}
+
+	var doc map[string]interface{}
+	if _, err := toml.Decode(string(b), &doc); err != nil {
+		return nil, err
+	}
+	doc, err := interpolate(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(doc); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeConfig checks the schema of the toml file, resolves the references
+// to other values, decodes it to a Config, expands the monitors of all its
+// groups into the configuration's monitors, merges the negative, JSONPath and
+// header assertions, and expands the monitors with identities into one
+// monitor per identity.
+func decodeConfig(file, fileName string) (Config, error) {
+	// the schema is checked first, since a configuration of another schema
+	// could fail to decode in confusing ways, or be misread silently.
+	var header struct{ Schema int }
+	_, err := toml.DecodeFile(file, &header)
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to parse file `%s': %s", file, err)
+	}
+	err = checkSchema(header.Schema)
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to parse file `%s': %s", file, err)
+	}
+
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to parse file `%s': %s", file, err)
+	}
+	b, err = interpolateConfig(b)
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to parse file `%s': %s", file, err)
+	}
+
 	c := Config{}
-	c.FileName = finfo.Name()
-	_, err = toml.DecodeFile(file, &c)
+	c.FileName = fileName
+	_, err = toml.Decode(string(b), &c)
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to parse file `%s': %s", file, err)
+	}
+	c.Schema = CurrentSchema
+
+	err = c.expandGroups()
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to parse file `%s': %s", file, err)
+	}
+
+	c.mergeAssertions()
+	c.mergeScrubRules()
+	c.mergePandoraStatus()
+	c.mergeTransport()
+
+	err = c.expandIdentities()
 	if err != nil {
 		return Config{}, fmt.Errorf("failed to parse file `%s': %s", file, err)
 	}
@@ -366,16 +1564,13 @@ func FindConfigs(baseDir string) ([]Config, error) {
 		// only fetch files
 		if !fi.IsDir() {
 			if strings.HasSuffix(fi.Name(), "_hmon.toml") {
-				fullFile := path.Join(baseDir, fi.Name())
-
-				c := Config{}
-				c.FileName = fi.Name()
+				fullFile := filepath.Join(baseDir, fi.Name())
 
-				_, err := toml.DecodeFile(fullFile, &c)
+				c, err := decodeConfig(fullFile, fi.Name())
 				if err != nil {
 					// when one or more config files can't be
 					// parsed, bail out!
-					return nil, fmt.Errorf("failed to parse file `%s': %s", fullFile, err)
+					return nil, err
 				}
 
 				// else we can just add it to the parsed configurations
@@ -403,20 +1598,39 @@ type ConfigurationResult struct {
 
 // Result encapsulates information about a Monitor and its invocation result.
 type Result struct {
-	Monitor Monitor // the monitor which may or may not have failed.
-	Latency int64   // The latency of the call i.e. how long did it take (in ms)
-	Error   error   // An error, describing the possible failure. If nil, it's ok.
+	Monitor       Monitor           // the monitor which may or may not have failed.
+	Time          time.Time         // When the monitor started.
+	Latency       int64             // The latency of the call i.e. how long did it take (in ms)
+	SchedulerWait int64             // How long the request waited to be started by hmon, not part of the latency (in ms)
+	Phases        Phases            // The latency broken down into DNS, connect, TLS and time to first byte.
+	Error         error             // An error, describing the possible failure. If nil, it's ok.
+	Warnings      []string          // Failures of assertions with a warning severity.
+	Assertions    []AssertionResult // The outcome of every assertion, if the response was received.
+	Audit         []AuditCheck      // The checks of the security audit, if any.
+	ServerTimings []ServerTiming    // The timings reported by the server, if any.
+	FailureFile   string            // The file with the request and response of the failure, if saved.
+	Code          string            `json:",omitempty"` // The failure code of the error, like HM-TIMEOUT.
+	Attempts      int               // The amount of attempts made, more than one when the monitor was retried.
+	StatusCode    int               `json:",omitempty"` // The status code of the response, if received.
+	CertNotAfter  *time.Time        `json:",omitempty"` // When the certificate of the server expires, for HTTPS.
+	OCSPAge       *int64            `json:",omitempty"` // The age in seconds of the OCSP response stapled by the server, if any.
+	Captured      map[string]string `json:",omitempty"` // The variables captured from the response headers.
+	BytesSent     int64             // The amount of bytes sent over the wire.
+	BytesReceived int64             // The amount of bytes received over the wire.
 }
 
 // Returns the result as a string for some easy-peasy debuggin'.
 func (r Result) String() string {
+	if r.Error == nil && len(r.Warnings) > 0 {
+		return fmt.Sprintf("WARN  %s: %s (%d ms)", r.Monitor.Name, strings.Join(r.Warnings, "; "), r.Latency)
+	}
 	if r.Error == nil {
 		return fmt.Sprintf("ok    %s (%d ms)", r.Monitor.Name, r.Latency)
 	}
 
 	if r.Latency > 0 {
-		return fmt.Sprintf("FAIL  %s: %s (%d ms)", r.Monitor.Name, r.Error, r.Latency)
+		return fmt.Sprintf("FAIL  %s: %s (%d ms)", r.Monitor.Name, r.ErrorText(), r.Latency)
 	}
 
-	return fmt.Sprintf("FAIL  %s: %s", r.Monitor.Name, r.Error)
+	return fmt.Sprintf("FAIL  %s: %s", r.Monitor.Name, r.ErrorText())
 }
@@ -1,7 +1,17 @@
 package main
 
 import (
+	"bytes"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
 	"testing"
+	"time"
 )
 
 // Tests normal parsing of the configuration, and asserts that the
@@ -53,3 +63,579 @@ func TestHeaderValidate(t *testing.T) {
 		t.Errorf("expected error on header '%s'", header)
 	}
 }
+
+func TestNormalizeBody(t *testing.T) {
+	m := Monitor{
+		Remove:    []string{`<id>[^<]*</id>`},
+		Normalize: []string{NormalizeWhitespace, NormalizeLowercase},
+	}
+
+	body := []byte("  <Status>\n\t<ID>abc-123</ID>\n  <id>abc-123</id> OK\n</Status>  ")
+	result := string(m.normalizeBody(body))
+	if result != "<status> <id>abc-123</id> ok </status>" {
+		t.Errorf("Unexpected normalization result: '%s'", result)
+	}
+
+	m = Monitor{RemoveXPath: []string{"//Timestamp", "/Status/Request/*"}}
+	body = []byte("<Status><Timestamp>1700000000</Timestamp><Request><ID>abc</ID></Request>OK</Status>")
+	result = string(m.normalizeBody(body))
+	if result != "<Status><Timestamp></Timestamp><Request><ID></ID></Request>OK</Status>" {
+		t.Errorf("Unexpected xpath removal result: '%s'", result)
+	}
+}
+
+func TestRunReadLimit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s MARKER", strings.Repeat("x", 100))
+	}))
+	defer server.Close()
+
+	ch := make(chan Result, 1)
+	m := Monitor{Name: "limit", URL: server.URL, Assertions: []Assertion{{Value: "MARKER"}}}
+
+	go m.Run(".", ch)
+	if r := <-ch; r.Error != nil {
+		t.Errorf("expected success without read limit, got: %s", r.Error)
+	}
+
+	m.ReadLimit = 10
+	go m.Run(".", ch)
+	if r := <-ch; r.Error == nil {
+		t.Errorf("expected assertion failure beyond the read limit")
+	}
+}
+
+func TestRunVerboseWithoutAssertions(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "response")
+	}))
+	defer server.Close()
+
+	var output []byte
+	m := Monitor{Name: "verbose", URL: server.URL}
+	m.Callback = func(m *Monitor, in, out []byte) {
+		output = out
+	}
+	ch := make(chan Result, 1)
+	go m.Run(".", ch)
+	<-ch
+	if string(output) != "response" {
+		t.Errorf("expected the response body to be shown, got '%s'", output)
+	}
+}
+
+func TestRunWithoutBodyAssertions(t *testing.T) {
+	done := make(chan bool)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Status", "ok")
+		// a large body which doesn't end until the monitor is done.
+		w.Write(bytes.Repeat([]byte("x"), 1<<20))
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+		case <-done:
+		}
+	}))
+	defer server.Close()
+	defer close(done)
+
+	ch := make(chan Result, 1)
+	m := Monitor{Name: "headers", URL: server.URL, Timeout: 500, Assertions: []Assertion{
+		{Type: AssertionStatus, Value: "200"},
+		{Type: AssertionAll, Group: []Assertion{{Type: AssertionHeader, Value: "X-Status: ok"}}},
+	}}
+	go m.Run(".", ch)
+	if r := <-ch; r.Error != nil {
+		t.Errorf("expected the body not to be read for header and status assertions, got: %s", r.Error)
+	}
+
+	m.Assertions = append(m.Assertions, Assertion{Type: AssertionAny, Group: []Assertion{{Value: "x"}}})
+	go m.Run(".", ch)
+	if r := <-ch; r.Code != FailureTimeout {
+		t.Errorf("expected the body to be read for a regex in a group, got: %v", r.Error)
+	}
+}
+
+func TestLimitBodies(t *testing.T) {
+	c := Config{
+		Monitor: map[string]Monitor{
+			"a": {Name: "Unlimited"},
+			"b": {Name: "Own limit", ReadLimit: 10},
+		},
+	}
+	c.LimitBodies(1024)
+
+	if c.Monitor["a"].ReadLimit != 1024 {
+		t.Errorf("expected read limit 1024, got %d", c.Monitor["a"].ReadLimit)
+	}
+	if c.Monitor["b"].ReadLimit != 10 {
+		t.Errorf("expected own read limit to be kept, got %d", c.Monitor["b"].ReadLimit)
+	}
+}
+
+func TestRunCountsBytes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, strings.Repeat("x", 1000))
+	}))
+	defer server.Close()
+
+	ch := make(chan Result, 1)
+	m := Monitor{Name: "bytes", URL: server.URL, Assertions: []Assertion{{Value: "x"}}}
+	go m.Run(".", ch)
+	r := <-ch
+
+	if r.BytesSent == 0 {
+		t.Errorf("expected bytes sent to be counted")
+	}
+	if r.BytesReceived < 1000 {
+		t.Errorf("expected at least 1000 bytes received, got %d", r.BytesReceived)
+	}
+}
+
+func TestSortedMonitors(t *testing.T) {
+	c := Config{
+		Monitor: map[string]Monitor{
+			"a": {Name: "Low"},
+			"b": {Name: "Critical", Priority: 10},
+			"c": {Name: "Also low"},
+			"d": {Name: "Important", Priority: 5},
+		},
+	}
+
+	expected := []string{"Critical", "Important", "Also low", "Low"}
+	for i, m := range c.SortedMonitors() {
+		if m.Name != expected[i] {
+			t.Errorf("expected '%s' at position %d, got '%s'", expected[i], i, m.Name)
+		}
+	}
+}
+
+func TestExpandGroups(t *testing.T) {
+	var c Config
+	_, err := toml.Decode(`
+name = "Groups"
+
+[monitor.Plain]
+name = "Plain monitor"
+url = "http://example.org"
+
+[group.api]
+base_url = "https://api.example.org/v1/"
+headers = ["Accept: application/json"]
+
+[group.api.monitor.Health]
+name = "Health"
+url = "/health"
+headers = ["X-Debug: 1"]
+
+[group.api.monitor.Other]
+name = "Other host"
+url = "http://other.example.org/ping"
+`, &c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.expandGroups(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(c.Monitor) != 3 {
+		t.Fatalf("expected 3 monitors, got %d", len(c.Monitor))
+	}
+
+	health := c.Monitor["api/Health"]
+	if health.URL != "https://api.example.org/v1/health" {
+		t.Errorf("unexpected url '%s'", health.URL)
+	}
+	if len(health.Headers) != 2 || health.Headers[0] != "Accept: application/json" {
+		t.Errorf("unexpected headers %v", health.Headers)
+	}
+
+	if c.Monitor["api/Other"].URL != "http://other.example.org/ping" {
+		t.Errorf("absolute urls should not be changed, got '%s'", c.Monitor["api/Other"].URL)
+	}
+}
+
+func TestOverrideHosts(t *testing.T) {
+	c := Config{
+		Monitor: map[string]Monitor{
+			"a": {URL: "https://api.prod.example.com/health?x=1"},
+			"b": {URL: "http://api.prod.example.com:8080/status"},
+			"c": {URL: "http://db.prod.example.com:5000/"},
+			"d": {URL: "http://other.example.com/"},
+		},
+	}
+
+	c.OverrideHosts(map[string]string{
+		"api.prod.example.com":     "api.staging.example.com",
+		"db.prod.example.com:5000": "db.staging.example.com:6000",
+		"nothing.example.com":      "unused.example.com",
+	})
+
+	expected := map[string]string{
+		"a": "https://api.staging.example.com/health?x=1",
+		"b": "http://api.staging.example.com:8080/status",
+		"c": "http://db.staging.example.com:6000/",
+		"d": "http://other.example.com/",
+	}
+	for key, url := range expected {
+		if c.Monitor[key].URL != url {
+			t.Errorf("expected '%s', got '%s'", url, c.Monitor[key].URL)
+		}
+	}
+}
+
+func TestSelectEnvironment(t *testing.T) {
+	config := `
+name = "Environments"
+
+[monitor.Health]
+name = "Health"
+url = "/health"
+headers = ["Accept: text/plain"]
+
+[monitor.Health.environments]
+prod = "https://api.example.com"
+staging = { base_url = "https://stage.example.com", headers = ["Authorization: Basic c3RhZ2U6c3RhZ2U="] }
+
+[monitor.Plain]
+name = "Plain"
+url = "http://example.org"
+`
+	var c Config
+	if _, err := toml.Decode(config, &c); err != nil {
+		t.Fatal(err)
+	}
+	c.SelectEnvironment("staging")
+
+	health := c.Monitor["Health"]
+	if health.URL != "https://stage.example.com/health" {
+		t.Errorf("unexpected url '%s'", health.URL)
+	}
+	if len(health.Headers) != 2 || health.Headers[1] != "Authorization: Basic c3RhZ2U6c3RhZ2U=" {
+		t.Errorf("unexpected headers %v", health.Headers)
+	}
+	if c.Monitor["Plain"].URL != "http://example.org" {
+		t.Errorf("expected monitor without environments to be unchanged")
+	}
+
+	c = Config{}
+	if _, err := toml.Decode(config, &c); err != nil {
+		t.Fatal(err)
+	}
+	c.SelectEnvironment("")
+
+	if len(c.Monitor) != 3 {
+		t.Fatalf("expected 3 monitors, got %d", len(c.Monitor))
+	}
+	prod := c.Monitor["Health@prod"]
+	if prod.Name != "Health (prod)" || prod.URL != "https://api.example.com/health" || len(prod.Headers) != 1 {
+		t.Errorf("unexpected prod monitor %+v", prod)
+	}
+
+	c = Config{}
+	if _, err := toml.Decode(config, &c); err != nil {
+		t.Fatal(err)
+	}
+	c.SelectEnvironment("acceptance")
+	if !c.Monitor["Health"].Disabled {
+		t.Errorf("expected monitor without the environment to be disabled")
+	}
+}
+
+func TestSkip(t *testing.T) {
+	c := Config{
+		Monitor: map[string]Monitor{
+			"a":          {Name: "Partner login", URL: "http://example.com/"},
+			"b":          {Name: "Homepage", URL: "https://www.partner.example.com/"},
+			"api/Health": {Name: "Health", URL: "http://api.example.com/"},
+			"d":          {Name: "Other", URL: "http://example.com/other"},
+		},
+	}
+
+	skipped := c.Skip(Excludes{Names: []string{"Partner*", "api/*"}, Hosts: []string{"*.partner.example.com"}})
+	if skipped != 3 {
+		t.Errorf("expected 3 skipped monitors, got %d", skipped)
+	}
+	if c.Monitor["d"].Disabled {
+		t.Errorf("expected monitor 'd' to be kept")
+	}
+	if len(c.SortedMonitors()) != 1 {
+		t.Errorf("expected one monitor to run, got %d", len(c.SortedMonitors()))
+	}
+}
+
+func TestReadExcludes(t *testing.T) {
+	f, err := ioutil.TempFile("", "hmon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	fmt.Fprint(f, "# maintenance\n\nPartner*\nhost: *.partner.example.com\n")
+	f.Close()
+
+	e, err := ReadExcludes(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(e.Names) != 1 || e.Names[0] != "Partner*" {
+		t.Errorf("unexpected names %v", e.Names)
+	}
+	if len(e.Hosts) != 1 || e.Hosts[0] != "*.partner.example.com" {
+		t.Errorf("unexpected hosts %v", e.Hosts)
+	}
+}
+
+func TestReadRequestFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hmon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ioutil.WriteFile(path.Join(dir, "header.xml"), []byte(`<Envelope>{{ include "inner.xml" }}`), 0644)
+	ioutil.WriteFile(path.Join(dir, "inner.xml"), []byte(`<Header/>`), 0644)
+	ioutil.WriteFile(path.Join(dir, "request.xml"), []byte(`{{ include "header.xml" }}<Body/></Envelope>`), 0644)
+	ioutil.WriteFile(path.Join(dir, "cycle.xml"), []byte(`{{ include "cycle.xml" }}`), 0644)
+	ioutil.WriteFile(path.Join(dir, "literal.json"), []byte(`{"greeting": "Hello {{x}}"}`), 0644)
+
+	b, err := ReadRequestFile(dir, "request.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "<Envelope><Header/><Body/></Envelope>" {
+		t.Errorf("unexpected request: '%s'", b)
+	}
+
+	if _, err := ReadRequestFile(dir, "cycle.xml"); err == nil {
+		t.Errorf("expected error on include cycle")
+	}
+
+	// without an include, braces are sent as is.
+	b, err = ReadRequestFile(dir, "literal.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != `{"greeting": "Hello {{x}}"}` {
+		t.Errorf("expected the request file unchanged, got '%s'", b)
+	}
+}
+
+func TestRenderRequestTemplate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hmon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ioutil.WriteFile(path.Join(dir, "order.tmpl"), []byte(`{{ include "customer.tmpl" }}<Order>{{range .lines}}<Line sku="{{.sku}}"/>{{end}}</Order>`), 0644)
+	ioutil.WriteFile(path.Join(dir, "customer.tmpl"), []byte(`<Customer>{{.customer}}</Customer>`), 0644)
+	ioutil.WriteFile(path.Join(dir, "order1.json"), []byte(`{"customer": "ACME", "lines": [{"sku": "A1"}, {"sku": "B2"}]}`), 0644)
+	ioutil.WriteFile(path.Join(dir, "incomplete.json"), []byte(`{"lines": []}`), 0644)
+	ioutil.WriteFile(path.Join(dir, "invalid.json"), []byte(`{"customer": `), 0644)
+
+	m := Monitor{BodyTemplate: "order.tmpl", Data: "order1.json"}
+	b, err := m.RequestBody(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != `<Customer>ACME</Customer><Order><Line sku="A1"/><Line sku="B2"/></Order>` {
+		t.Errorf("unexpected request: '%s'", b)
+	}
+
+	for _, data := range []string{"incomplete.json", "invalid.json", "missing.json"} {
+		if _, err := RenderRequestTemplate(dir, "order.tmpl", data); err == nil {
+			t.Errorf("expected an error for data file '%s'", data)
+		}
+	}
+
+	c := Config{Name: "Templates", Monitor: map[string]Monitor{
+		"both": {Name: "Both", URL: "http://example.org", BodyTemplate: "order.tmpl", Body: "x"},
+		"data": {Name: "Data", URL: "http://example.org", Data: "order1.json"},
+	}}
+	verr, ok := c.Validate(dir).(ValidationError)
+	if !ok || len(verr.ErrorList) != 2 {
+		t.Errorf("expected 2 validation errors, got %v", verr)
+	}
+}
+
+func TestSortedMonitorsOrderAndDisabled(t *testing.T) {
+	c := Config{
+		Monitor: map[string]Monitor{
+			"a": {Name: "Step A", Order: 3},
+			"b": {Name: "Step B", Order: 1},
+			"c": {Name: "Step C", Order: 2, Disabled: true},
+			"d": {Name: "Step D", Order: 4, Priority: 1},
+		},
+	}
+
+	expected := []string{"Step D", "Step B", "Step A"}
+	monitors := c.SortedMonitors()
+	if len(monitors) != len(expected) {
+		t.Fatalf("expected %d monitors, got %d", len(expected), len(monitors))
+	}
+	for i, m := range monitors {
+		if m.Name != expected[i] {
+			t.Errorf("expected '%s' at position %d, got '%s'", expected[i], i, m.Name)
+		}
+	}
+}
+
+func TestFailureContext(t *testing.T) {
+	m := Monitor{Runbook: "https://wiki/login", Notes: "Check the session store"}
+	expected := "Runbook: https://wiki/login - Notes: Check the session store"
+	if m.FailureContext() != expected {
+		t.Errorf("expected '%s', got '%s'", expected, m.FailureContext())
+	}
+	if (Monitor{}).FailureContext() != "" {
+		t.Errorf("expected no failure context without runbook and notes")
+	}
+}
+
+func TestReadConfigSchema(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hmon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		schema string
+		valid  bool
+	}{
+		{"", true},
+		{"schema = 2\n", true},
+		{"schema = 1\n", false},
+		{"schema = 3\n", false},
+		{"schema = -1\n", false},
+	}
+	for _, test := range tests {
+		file := path.Join(dir, "schema_hmon.toml")
+		content := test.schema + "name = \"Schema\"\n\n[monitor.Home]\nurl = \"http://example.org\"\n"
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		c, err := ReadConfig(file)
+		if test.valid && (err != nil || c.Schema != CurrentSchema) {
+			t.Errorf("expected '%s' to be read as schema %d, got %d (%v)", test.schema, CurrentSchema, c.Schema, err)
+		}
+		if !test.valid && err == nil {
+			t.Errorf("expected an error for '%s'", test.schema)
+		}
+	}
+}
+
+func TestCacheBust(t *testing.T) {
+	m := Monitor{URL: "http://example.org/status?full=1", CacheBust: true, Headers: []Header{"Cache-Control: max-age=0"}}
+
+	first, err := m.newRequest(m.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _ := m.newRequest(m.URL, nil)
+
+	if first.URL.Query().Get("full") != "1" || first.URL.Query().Get(cacheBustParam) == "" {
+		t.Errorf("expected the original and the cache busting parameter, got '%s'", first.URL)
+	}
+	if first.URL.String() == second.URL.String() {
+		t.Errorf("expected a different URL for every request, got '%s' twice", first.URL)
+	}
+	if first.Header.Get("Cache-Control") != "max-age=0" || first.Header.Get("Pragma") != "no-cache" {
+		t.Errorf("unexpected headers %v", first.Header)
+	}
+}
+
+func TestInlineBody(t *testing.T) {
+	var c Config
+	_, err := toml.Decode(`
+name = "Inline"
+
+[monitor.Login]
+name = "Login"
+url = "http://example.org/login"
+body = """
+{"username": "probe"}
+"""
+
+[monitor.Both]
+name = "Both"
+url = "http://example.org/login"
+file = "login.json"
+body = "{}"
+`, &c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := c.Monitor["Login"].RequestBody("does-not-exist")
+	if err != nil || string(body) != "{\"username\": \"probe\"}\n" {
+		t.Errorf("expected the inline body, got '%s' (%v)", body, err)
+	}
+
+	err = c.Validate(".")
+	verr, ok := err.(ValidationError)
+	if !ok || len(verr.ErrorList) != 1 || !strings.Contains(verr.ErrorList[0], "both a 'file' and a 'body'") {
+		t.Errorf("expected an error for a monitor with a file and a body, got %v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		fmt.Fprintf(w, "%s %s", r.Method, b)
+	}))
+	defer server.Close()
+
+	m := c.Monitor["Login"]
+	m.URL = server.URL
+	m.Assertions = []Assertion{{Value: `POST \{"username": "probe"\}`}}
+	ch := make(chan Result, 1)
+	go m.Run(".", ch)
+	if r := <-ch; r.Error != nil {
+		t.Errorf("expected the inline body to be POSTed, got %s", r.Error)
+	}
+}
+
+func TestRunRetries(t *testing.T) {
+	// the first two requests fail.
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, "ok")
+	}))
+	defer server.Close()
+
+	m := Monitor{URL: server.URL, Status: "200", Retries: 3, RetryDelay: 10}
+	ch := make(chan Result, 1)
+	started := time.Now()
+	go m.Run(".", ch)
+	r := <-ch
+	if r.Error != nil || r.Attempts != 3 {
+		t.Errorf("expected success after 3 attempts, got %v after %d", r.Error, r.Attempts)
+	}
+	// the delays are 10 and 20 ms.
+	if elapsed := time.Since(started); elapsed < 30*time.Millisecond {
+		t.Errorf("expected the retries to back off, took %s", elapsed)
+	}
+	if r.Time.After(started.Add(5 * time.Millisecond)) {
+		t.Errorf("expected the time of the first attempt, got %s (started %s)", r.Time, started)
+	}
+
+	requests = 0
+	m.Retries = 1
+	go m.Run(".", ch)
+	if r := <-ch; r.Error == nil || r.Attempts != 2 || r.Code != FailureStatus {
+		t.Errorf("expected a status failure after 2 attempts, got %v (%s) after %d", r.Error, r.Code, r.Attempts)
+	}
+
+	// requests which can't be created aren't retried.
+	m = Monitor{URL: server.URL, File: "missing.xml", Retries: 3, RetryDelay: 10}
+	go m.Run(".", ch)
+	if r := <-ch; r.Attempts != 1 {
+		t.Errorf("expected a single attempt, got %d", r.Attempts)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/krpors/hmon/soapui"
+	"os"
+	"path"
+)
+
+// parseInterspersed parses the flags in args, allowing flags to come after
+// positional arguments (the flag package stops parsing at the first non-flag
+// argument). Returns the positional arguments, or the error of parsing the
+// flags.
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+// Runs the 'convert' subcommand with the given arguments. Converts a SoapUI
+// project to hmon configurations and postdata, and validates the generated
+// configurations right away. Returns the exit code.
+func runConvert(args []string) int {
+	fs := flag.NewFlagSet("convert", flag.ContinueOnError)
+	outDir := fs.String("out", "_generated", "The directory to write the generated files to.")
+	splitBy := fs.String("split-by", soapui.SplitByTestSuite, "Generate one configuration file per 'project', 'testsuite' or 'testcase'.")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: hmon convert soapui project.xml [flags]\n\n")
+		fmt.Fprintf(os.Stderr, "Converts a SoapUI project to hmon configurations in <out>/configs and\n")
+		fmt.Fprintf(os.Stderr, "request files in <out>/postdata, and validates the result.\n\n")
+		fs.PrintDefaults()
+	}
+
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return flagExitCode(err)
+	}
+	if len(positional) != 2 || positional[0] != "soapui" {
+		fs.Usage()
+		return ExitUsage
+	}
+
+	switch *splitBy {
+	case soapui.SplitByProject, soapui.SplitByTestSuite, soapui.SplitByTestCase:
+	default:
+		fmt.Printf("Invalid -split-by '%s' (must be project, testsuite or testcase)\n", *splitBy)
+		return ExitUsage
+	}
+
+	project, err := soapui.ParseFile(positional[1])
+	if err != nil {
+		fmt.Printf("Can't parse project file: %s\n", err)
+		return ExitUsage
+	}
+
+	report, err := soapui.Process(project, soapui.DirOutput(*outDir), soapui.Options{SplitBy: *splitBy})
+	if err != nil {
+		fmt.Printf("Conversion failed: %s\n", err)
+		return ExitInternal
+	}
+	report.Print(os.Stdout)
+	if len(report.Problems) > 0 {
+		return ExitValidation
+	}
+
+	// validate the generated configurations, like a regular run would.
+	configsDir := path.Join(*outDir, "configs")
+	postdataDir := path.Join(*outDir, "postdata")
+
+	configurations, err := FindConfigs(configsDir)
+	if err != nil {
+		fmt.Printf("Generated configurations can't be parsed: %s\n", err)
+		return ExitInternal
+	}
+
+	code := ExitOK
+	for _, c := range configurations {
+		err := c.Validate(postdataDir)
+		if err != nil {
+			verr := err.(ValidationError)
+			fmt.Printf("%s: %s\n", c.FileName, verr)
+			for _, e := range verr.ErrorList {
+				fmt.Printf("  %s\n", e)
+			}
+			code = ExitValidation
+		}
+	}
+
+	fmt.Printf("Converted to %d configuration(s) in `%s'\n", len(configurations), configsDir)
+	if code == ExitOK {
+		fmt.Printf("Run them using: hmon -confdir \"%s\" -filedir \"%s\"\n", configsDir, postdataDir)
+	}
+	return code
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"strings"
+	"time"
+)
+
+// ShareCookies gives all monitors of the configuration a single cookie jar,
+// so cookies set in the response of one monitor are sent by the monitors run
+// after it, like the session cookie of a login. Monitors sharing cookies must
+// run one after another, in order of priority.
+func (c *Config) ShareCookies() {
+	// creating a jar without options can't fail.
+	jar, _ := cookiejar.New(nil)
+	for key, monitor := range c.Monitor {
+		monitor.jar = jar
+		c.Monitor[key] = monitor
+	}
+}
+
+// CookieRules are the attributes a cookie set by the response must have. Empty
+// (or false) rules are not checked. The expiry window is given as durations,
+// like "1h", and is checked against the Max-Age or Expires of the cookie.
+type CookieRules struct {
+	Secure    bool   `json:"secure,omitempty"`
+	HTTPOnly  bool   `json:"http_only,omitempty"`
+	SameSite  string `json:"same_site,omitempty"` // Strict, Lax or None
+	Domain    string `json:"domain,omitempty"`
+	Path      string `json:"path,omitempty"`
+	MinExpiry string `json:"min_expiry,omitempty"` // the cookie must be valid at least this long
+	MaxExpiry string `json:"max_expiry,omitempty"` // the cookie must expire within this duration
+}
+
+// The attributes of a cookie assertion table which are CookieRules.
+var cookieAttributes = map[string]bool{
+	"secure": true, "http_only": true, "same_site": true, "domain": true,
+	"path": true, "min_expiry": true, "max_expiry": true,
+}
+
+func isCookieAttribute(key string) bool {
+	return cookieAttributes[key]
+}
+
+// set sets a rule from an attribute of the assertion table.
+func (r *CookieRules) set(key string, value interface{}) error {
+	if key == "secure" || key == "http_only" {
+		b, ok := value.(bool)
+		if !ok {
+			return fmt.Errorf("assertion attribute '%s' must be a boolean", key)
+		}
+		if key == "secure" {
+			r.Secure = b
+		} else {
+			r.HTTPOnly = b
+		}
+		return nil
+	}
+
+	str, ok := value.(string)
+	if !ok {
+		return fmt.Errorf("assertion attribute '%s' must be a string", key)
+	}
+	switch key {
+	case "same_site":
+		r.SameSite = str
+	case "domain":
+		r.Domain = str
+	case "path":
+		r.Path = str
+	case "min_expiry":
+		r.MinExpiry = str
+	case "max_expiry":
+		r.MaxExpiry = str
+	}
+	return nil
+}
+
+// validate checks the SameSite value and the expiry durations.
+func (r CookieRules) validate() error {
+	switch strings.ToLower(r.SameSite) {
+	case "", "strict", "lax", "none":
+	default:
+		return fmt.Errorf("same_site must be Strict, Lax or None, got '%s'", r.SameSite)
+	}
+	for _, d := range []string{r.MinExpiry, r.MaxExpiry} {
+		if d == "" {
+			continue
+		}
+		if _, err := time.ParseDuration(d); err != nil {
+			return fmt.Errorf("invalid expiry duration: %s", err)
+		}
+	}
+	return nil
+}
+
+// The names of the SameSite modes, as they're written in a Set-Cookie header.
+var sameSiteNames = map[http.SameSite]string{
+	http.SameSiteDefaultMode: "",
+	http.SameSiteLaxMode:     "lax",
+	http.SameSiteStrictMode:  "strict",
+	http.SameSiteNoneMode:    "none",
+}
+
+// checkCookie checks whether the response headers set the named cookie, and
+// whether it follows the rules (if any). All violated rules are reported.
+func checkCookie(name string, rules *CookieRules, header http.Header) error {
+	var cookie *http.Cookie
+	for _, c := range (&http.Response{Header: header}).Cookies() {
+		if c.Name == name {
+			cookie = c
+		}
+	}
+	if cookie == nil {
+		return fmt.Errorf("cookie `%s' is not set", name)
+	}
+	if rules == nil {
+		return nil
+	}
+
+	var problems []string
+	if rules.Secure && !cookie.Secure {
+		problems = append(problems, "not Secure")
+	}
+	if rules.HTTPOnly && !cookie.HttpOnly {
+		problems = append(problems, "not HttpOnly")
+	}
+	if rules.SameSite != "" && sameSiteNames[cookie.SameSite] != strings.ToLower(rules.SameSite) {
+		problems = append(problems, fmt.Sprintf("SameSite is '%s' instead of '%s'", sameSiteNames[cookie.SameSite], rules.SameSite))
+	}
+	if rules.Domain != "" && strings.TrimPrefix(cookie.Domain, ".") != strings.TrimPrefix(rules.Domain, ".") {
+		problems = append(problems, fmt.Sprintf("Domain is '%s' instead of '%s'", cookie.Domain, rules.Domain))
+	}
+	if rules.Path != "" && cookie.Path != rules.Path {
+		problems = append(problems, fmt.Sprintf("Path is '%s' instead of '%s'", cookie.Path, rules.Path))
+	}
+
+	if rules.MinExpiry != "" || rules.MaxExpiry != "" {
+		// Max-Age takes precedence over Expires. A negative MaxAge means
+		// the cookie is deleted right away.
+		var lifetime time.Duration
+		session := false
+		switch {
+		case cookie.MaxAge > 0:
+			lifetime = time.Duration(cookie.MaxAge) * time.Second
+		case cookie.MaxAge < 0:
+			lifetime = 0
+		case !cookie.Expires.IsZero():
+			lifetime = time.Until(cookie.Expires)
+		default:
+			session = true
+		}
+
+		// the durations are validated beforehand.
+		min, _ := time.ParseDuration(rules.MinExpiry)
+		max, _ := time.ParseDuration(rules.MaxExpiry)
+		switch {
+		case session:
+			problems = append(problems, "is a session cookie without expiry")
+		case rules.MinExpiry != "" && lifetime < min:
+			problems = append(problems, fmt.Sprintf("expires in %s, before %s", lifetime.Round(time.Second), rules.MinExpiry))
+		case rules.MaxExpiry != "" && lifetime > max:
+			problems = append(problems, fmt.Sprintf("expires in %s, after %s", lifetime.Round(time.Second), rules.MaxExpiry))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("cookie `%s': %s", name, strings.Join(problems, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCheckCookie(t *testing.T) {
+	header := http.Header{}
+	header.Add("Set-Cookie", "SESSION=abc; Path=/; Domain=example.org; Max-Age=3600; Secure; HttpOnly; SameSite=Strict")
+	header.Add("Set-Cookie", "tracking=1; Path=/")
+
+	type Exp struct {
+		Name  string
+		Rules *CookieRules
+		Error string // empty when ok, else a part of the error
+	}
+
+	tests := []Exp{
+		{"SESSION", nil, ""},
+		{"missing", nil, "not set"},
+		{"SESSION", &CookieRules{Secure: true, HTTPOnly: true, SameSite: "Strict", Domain: "example.org", Path: "/"}, ""},
+		{"SESSION", &CookieRules{MinExpiry: "30m", MaxExpiry: "2h"}, ""},
+		{"SESSION", &CookieRules{MaxExpiry: "30m"}, "after 30m"},
+		{"tracking", &CookieRules{Secure: true, HTTPOnly: true}, "not Secure, not HttpOnly"},
+		{"tracking", &CookieRules{SameSite: "Lax"}, "SameSite"},
+		{"tracking", &CookieRules{MinExpiry: "1h"}, "session cookie"},
+	}
+
+	for _, test := range tests {
+		err := checkCookie(test.Name, test.Rules, header)
+		if test.Error == "" && err != nil {
+			t.Errorf("%s: expected no error, got: %s", test.Name, err)
+		}
+		if test.Error != "" && (err == nil || !strings.Contains(err.Error(), test.Error)) {
+			t.Errorf("%s: expected error containing '%s', got: %v", test.Name, test.Error, err)
+		}
+	}
+}
+
+func TestDecodeCookieAssertion(t *testing.T) {
+	var m Monitor
+	_, err := toml.Decode(`
+assertions = [
+	{ type = "cookie", value = "SESSION", secure = true, http_only = true, same_site = "Lax", max_expiry = "24h" },
+]
+`, &m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := m.Assertions[0]
+	expected := CookieRules{Secure: true, HTTPOnly: true, SameSite: "Lax", MaxExpiry: "24h"}
+	if a.Type != AssertionCookie || a.Value != "SESSION" || a.Cookie == nil || *a.Cookie != expected {
+		t.Errorf("unexpected assertion %+v", a)
+	}
+	if err := a.Validate(); err != nil {
+		t.Errorf("expected a valid assertion, got: %s", err)
+	}
+
+	invalid := []Assertion{
+		{Type: AssertionCookie},
+		{Type: AssertionCookie, Value: "x", Cookie: &CookieRules{SameSite: "Sometimes"}},
+		{Type: AssertionCookie, Value: "x", Cookie: &CookieRules{MinExpiry: "a day"}},
+		{Value: "x", Cookie: &CookieRules{Secure: true}},
+	}
+	for _, a := range invalid {
+		if err := a.Validate(); err == nil {
+			t.Errorf("expected error for assertion %+v", a)
+		}
+	}
+}
+
+func TestShareCookies(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login" {
+			http.SetCookie(w, &http.Cookie{Name: "SESSION", Value: "abc", Path: "/"})
+			fmt.Fprint(w, "logged in")
+			return
+		}
+		if c, err := r.Cookie("SESSION"); err == nil {
+			fmt.Fprintf(w, "session %s", c.Value)
+			return
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	var c Config
+	_, err := toml.Decode(fmt.Sprintf(`
+name = "Session"
+cookie_jar = true
+
+[monitor.Login]
+name = "Login"
+url = "%s/login"
+order = 1
+
+[monitor.Account]
+name = "Account"
+url = "%s/account"
+order = 2
+assertions = ["session abc"]
+`, server.URL, server.URL), &c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.CookieJar {
+		t.Fatalf("expected cookie_jar to be decoded")
+	}
+
+	c.ShareCookies()
+	cr := runSequential(ioutil.Discard, ".", c, false, make(map[string]string), nil)
+	for _, r := range cr.Results {
+		if r.Error != nil {
+			t.Errorf("%s: expected the session cookie to be shared, got %s", r.Monitor.Name, r.Error)
+		}
+	}
+
+	// without a shared jar, the account monitor has no session.
+	m := c.Monitor["Account"]
+	m.jar = nil
+	ch := make(chan Result, 1)
+	go m.Run(".", ch)
+	if r := <-ch; r.Error == nil {
+		t.Errorf("expected an error without the session cookie")
+	}
+}
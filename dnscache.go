@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// The amount of hosts resolved at the same time by a prefetch.
+const prefetchWorkers = 16
+
+// dnsCache holds the addresses of hosts, shared by all monitors of a run, so
+// a host is resolved once instead of by every monitor targeting it.
+type dnsCache struct {
+	sync.Mutex
+	ttl     time.Duration // how long addresses are used, forever when zero
+	entries map[string]dnsEntry
+}
+
+type dnsEntry struct {
+	addrs    []string
+	resolved time.Time
+}
+
+// The cache used by the transports of the monitors, nil when hosts are
+// resolved by every connection (the default). Set by -dns-prefetch.
+var resolveCache *dnsCache
+
+// newDNSCache creates a cache keeping addresses for the ttl, or for the whole
+// run when the ttl is zero.
+func newDNSCache(ttl time.Duration) *dnsCache {
+	return &dnsCache{ttl: ttl, entries: make(map[string]dnsEntry)}
+}
+
+// resolve looks up the addresses of the host, and caches them. Hosts which
+// can't be resolved aren't cached, so their monitors report the error.
+func (d *dnsCache) resolve(host string) ([]string, error) {
+	ips, err := lookupIP(host)
+	if err != nil {
+		return nil, err
+	}
+	addrs := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		addrs = append(addrs, ip.String())
+	}
+
+	d.Lock()
+	defer d.Unlock()
+	d.entries[host] = dnsEntry{addrs, time.Now()}
+	return addrs, nil
+}
+
+// lookup returns the addresses of the host, from the cache when they're not
+// expired, and resolved (and cached) otherwise.
+func (d *dnsCache) lookup(host string) ([]string, error) {
+	d.Lock()
+	entry, ok := d.entries[host]
+	d.Unlock()
+	if ok && (d.ttl == 0 || time.Since(entry.resolved) < d.ttl) {
+		return entry.addrs, nil
+	}
+	return d.resolve(host)
+}
+
+// prefetch resolves the hosts in parallel. Returns the amount of hosts which
+// were resolved.
+func (d *dnsCache) prefetch(hosts []string) int {
+	queue := make(chan string)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	resolved := 0
+	for i := 0; i < prefetchWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for host := range queue {
+				if _, err := d.resolve(host); err == nil {
+					mu.Lock()
+					resolved++
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for _, host := range hosts {
+		queue <- host
+	}
+	close(queue)
+	wg.Wait()
+	return resolved
+}
+
+// dial connects to the address, of which the host is looked up in the cache.
+// The addresses of the host are tried in order, until one accepts the
+// connection. When the host can't be resolved, it's dialed as-is, so the
+// error of the resolver is reported.
+func (d *dnsCache) dial(ctx context.Context, dialer *net.Dialer, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || net.ParseIP(host) != nil {
+		return dialer.DialContext(ctx, network, addr)
+	}
+	addrs, err := d.lookup(host)
+	if err != nil || len(addrs) == 0 {
+		return dialer.DialContext(ctx, network, addr)
+	}
+
+	var conn net.Conn
+	for _, a := range addrs {
+		conn, err = dialer.DialContext(ctx, network, net.JoinHostPort(a, port))
+		if err == nil || ctx.Err() != nil {
+			break
+		}
+	}
+	return conn, err
+}
+
+// prefetchHosts returns the hosts the monitors of the configurations connect
+// to by name, sorted. Monitors connecting to an address (see SweepPools) or
+// through a proxy (which resolves the host itself) are left out.
+func prefetchHosts(configurations []Config) []string {
+	seen := make(map[string]bool)
+	var hosts []string
+	for _, c := range configurations {
+		for _, m := range c.Monitor {
+			if m.Disabled || m.Backend != "" || m.Proxy != "" {
+				continue
+			}
+			host := hostname(m.URL)
+			if host == "" || net.ParseIP(host) != nil || seen[host] {
+				continue
+			}
+			seen[host] = true
+			hosts = append(hosts, host)
+		}
+	}
+	sort.Strings(hosts)
+	return hosts
+}
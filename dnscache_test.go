@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeResolver resolves hmon.test to the loopback address, and counts the
+// lookups.
+type fakeResolver struct {
+	sync.Mutex
+	lookups int
+}
+
+func (f *fakeResolver) lookupIP(host string) ([]net.IP, error) {
+	f.Lock()
+	defer f.Unlock()
+	f.lookups++
+	if host != "hmon.test" {
+		return nil, fmt.Errorf("no such host")
+	}
+	return []net.IP{net.ParseIP("127.0.0.1")}, nil
+}
+
+func TestPrefetchHosts(t *testing.T) {
+	configurations := []Config{
+		{Monitor: map[string]Monitor{
+			"a": {URL: "https://b.example.org/a"},
+			"b": {URL: "https://b.example.org/b"},
+			"c": {URL: "http://127.0.0.1/"},
+			"d": {URL: "https://proxied.example.org/", Proxy: "http://proxy:3128"},
+			"e": {URL: "https://swept.example.org/", Backend: "10.0.0.1"},
+		}},
+		{Monitor: map[string]Monitor{
+			"a": {URL: "https://a.example.org/a"},
+			"b": {URL: "https://disabled.example.org/", Disabled: true},
+		}},
+	}
+	expected := []string{"a.example.org", "b.example.org"}
+	if hosts := prefetchHosts(configurations); !reflect.DeepEqual(hosts, expected) {
+		t.Errorf("expected %v, got %v", expected, hosts)
+	}
+}
+
+func TestDNSCache(t *testing.T) {
+	resolver := &fakeResolver{}
+	defer func(f func(string) ([]net.IP, error)) { lookupIP = f }(lookupIP)
+	lookupIP = resolver.lookupIP
+
+	cache := newDNSCache(0)
+	if resolved := cache.prefetch([]string{"hmon.test", "unknown.test"}); resolved != 1 {
+		t.Errorf("expected 1 host to be resolved, got %d", resolved)
+	}
+	for i := 0; i < 3; i++ {
+		addrs, err := cache.lookup("hmon.test")
+		if err != nil || !reflect.DeepEqual(addrs, []string{"127.0.0.1"}) {
+			t.Errorf("expected the cached address, got %v (%v)", addrs, err)
+		}
+	}
+	if resolver.lookups != 2 {
+		t.Errorf("expected only the lookups of the prefetch, got %d", resolver.lookups)
+	}
+
+	// expired addresses are resolved again.
+	cache = newDNSCache(time.Nanosecond)
+	cache.prefetch([]string{"hmon.test"})
+	time.Sleep(time.Millisecond)
+	cache.lookup("hmon.test")
+	if resolver.lookups != 4 {
+		t.Errorf("expected the expired host to be resolved again, got %d lookups", resolver.lookups)
+	}
+}
+
+func TestRunDNSCache(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+
+	resolver := &fakeResolver{}
+	defer func(f func(string) ([]net.IP, error)) { lookupIP = f }(lookupIP)
+	lookupIP = resolver.lookupIP
+	defer func() { resolveCache = nil }()
+	resolveCache = newDNSCache(0)
+	resolveCache.prefetch([]string{"hmon.test"})
+
+	m := Monitor{URL: "http://hmon.test:" + u.Port() + "/", Assertions: []Assertion{{Value: "ok"}}}
+	ch := make(chan Result, 1)
+	for i := 0; i < 2; i++ {
+		go m.Run(".", ch)
+		if r := <-ch; r.Error != nil {
+			t.Errorf("expected no error, got %s", r.Error)
+		}
+	}
+	if resolver.lookups != 1 {
+		t.Errorf("expected the host to be resolved once, got %d lookups", resolver.lookups)
+	}
+}
@@ -13,6 +13,7 @@ _hmon.toml.  Multiple configuration files can be created (must be in one
 directory). Hmon will then read all _hmon.toml files, parse them, and validate
 them. Example configuration file:
 
+	schema = 2
 	name = "Common tests"
 
 	[monitor.Github]
@@ -21,7 +22,7 @@ them. Example configuration file:
 	desc = "Optional description"
 	timeout = 30000
 	assertions = [
-		"html"
+		"wellformed:html"
 	]
 
 	[monitor.ZoWonen test]
@@ -47,7 +48,147 @@ them. Example configuration file:
 	]
 
 Each configuration file which is included in a run must have a unique
-top level name attribute.
+top level name attribute. The optional 'schema' attribute is the version of
+the configuration format, which is 2 for the current format. Files without it
+are read as the current format. When the format changes in an incompatible
+way, the schema is raised, so older files are recognized instead of silently
+misread. Files with an unknown schema (e.g. written for a newer hmon) are
+rejected with an error. Schema 1 is the XML format of older hmon versions,
+see 'Migrating XML configurations'.
+
+Monitors of a configuration can share their cookies with 'cookie_jar = true'
+at the top level. Cookies set in a response are then sent by the monitors
+run after it, like the session cookie of a login monitor. Since the order
+matters, these monitors run one after another in order of priority (and of
+'order' within a priority), whatever -sequential, -workers or -per-host say:
+
+	name = "Shop"
+	cookie_jar = true
+
+	[monitor.Login]
+	name = "Login"
+	url = "https://shop.example.org/login"
+	body = "user=probe&password=secret"
+	headers = ["Content-Type: application/x-www-form-urlencoded"]
+	priority = 10
+
+	[monitor.Cart]
+	name = "Cart"
+	url = "https://shop.example.org/cart"
+	assertions = ["Your cart"]
+
+A monitor can point to a runbook and carry notes for whoever handles its
+failures. Both are shown with the failure in the output of hmon, in the
+notifications and in the description of the Pandora module. In a shared
+configuration tree, the team owning a monitor is given with 'owner'. The
+owner is shown with failures like the runbook, and is part of all outputs:
+the 'Owner' of the monitor in 'json' and 'jsonl', the column before the
+failure code in 'csv', the 'owner' parameter in 'syslog', the 'owner' label
+in 'prometheus' (for monitors with an owner), object <base>.1.7 of SNMP
+traps and the 'owner' of the failures posted to -notify-webhook:
+
+	[monitor.Login]
+	name = "Login page"
+	url = "https://example.org/login"
+	owner = "team-identity"
+	runbook = "https://wiki.example.org/runbooks/login"
+	notes = "Check the session store first"
+
+The failures of a monitor can be notified to a target of its own, like the
+Slack channel of the team owning it, instead of to -notify-teams and
+-notify-webhook. Any combination of a 'slack', 'teams' and 'webhook' URL can
+be given. The target gets a summary of the failures of its monitors only, in
+the format of the -notify-template:
+
+	[monitor.Login]
+	name = "Login page"
+	url = "https://example.org/login"
+	notify = { slack = "https://hooks.slack.com/services/T000/B000/XXXX" }
+
+Monitors targeting the same host can be put in a group. A group defines a
+'base_url' and optional 'headers', shared by all monitors in the group. The
+monitors then specify their 'url' relative to the base URL, and the group's
+headers are sent in addition to the monitor's own headers:
+
+	[group.api]
+	base_url = "https://api.example.org/v1"
+	headers = [
+		"Accept: application/json"
+	]
+
+	[group.api.monitor.Health]
+	name = "API health"
+	url = "/health"
+
+	[group.api.monitor.Users]
+	name = "API users"
+	url = "/users?limit=1"
+
+Moving all monitors to another host is then a matter of changing the base
+URL. Monitors in a group are identified as 'group/monitor', e.g. 'api/Health'.
+
+Values can refer to other values of the same configuration with @{path},
+where the path is the dotted list of keys from the root of the file. Any key
+can be referenced, including keys hmon doesn't use itself, so shared values
+can be defined once:
+
+	[group.api]
+	base_url = "https://api.example.org/v1"
+	token = "0123456789"
+
+	[group.api.monitor.Users]
+	name = "API users"
+	url = "/users"
+	headers = ["Authorization: Bearer @{group.api.token}"]
+
+	[monitor.Status]
+	name = "Status"
+	url = "@{group.api.base_url}/status"
+
+References must point to a string, number or boolean. Referenced strings can
+contain references themselves, but not to the value which refers to them: a
+reference cycle is reported as an error. Write @@{ for a literal @{.
+
+A monitor can be run against several environments, like production and
+staging, using 'environments'. Its URL is then relative to the base URL of
+the environment. An environment is either just the base URL, or a table with
+a 'base_url' and 'headers' (for instance, environment specific credentials):
+
+	[monitor.Health]
+	name = "Health"
+	url = "/health"
+
+	[monitor.Health.environments]
+	prod = "https://api.example.com"
+	staging = { base_url = "https://stage.example.com", headers = ["Authorization: Basic c3RhZ2U6c3RhZ2U="] }
+
+With the -env flag, the monitor only runs in that environment. Without it, the
+monitor is run once per environment, named like 'Health (staging)'.
+
+To check authorization, a monitor can be run with several identities, like
+an administrator, a regular user and an anonymous user. The monitor is then
+run once per identity, named like 'Admin page [anonymous]'. An identity has a
+'username' and 'password' (sent as basic authentication) and/or 'headers',
+like a bearer token. These replace all credentials of the monitor (its
+basic authentication, oauth2 and Authorization headers), so an identity
+without any is anonymous. When an identity has 'assertions', these replace
+the assertions of the monitor, so each identity can expect its own outcome:
+
+	[monitor.Admin]
+	name = "Admin page"
+	url = "https://example.org/admin"
+	assertions = ["Dashboard"]
+
+	[monitor.Admin.identities.admin]
+	username = "admin"
+	password = "secret"
+
+	[monitor.Admin.identities.user]
+	headers = ["Authorization: Bearer eyJhbGciOi..."]
+	assertions = [ { type = "status", value = "403" } ]
+
+	[monitor.Admin.identities.anonymous]
+	assertions = [ { type = "status", value = "401" } ]
 
 In each monitor node, you must specify a mandatory URL to send the request to
 using the attribute 'url'. If a <file> element is specified, the contents of
@@ -60,14 +201,544 @@ SOAP action.  Lastly, the 'assertions' attribute can be used to specify regular
 expressions. The response is asserted against each of these regexes. If an
 assertion fails, hmon will report an error for that monitor.
 
+The 'timeout' covers the whole exchange, and can also be written as
+'total_timeout'. A slow connection and a slow backend need different
+remediation, so their parts can have timeouts of their own, also in
+milliseconds: 'connect_timeout' for making the connection, including the
+TLS handshake (30 seconds by default), and 'response_header_timeout' for
+receiving the response headers after the request was sent (by default, only
+the total timeout applies). They fail with HM-CONNECT-TIMEOUT and
+HM-HEADER-TIMEOUT respectively, while the total timeout fails with
+HM-TIMEOUT:
+
+	[monitor.Search]
+	name = "Search"
+	url = "https://www.example.org/search?q=hmon"
+	connect_timeout = 2000
+	response_header_timeout = 8000
+	total_timeout = 10000
+
+To keep transient network blips from raising alerts, a failed monitor can be
+retried with 'retries'. The first retry is done after 'retry_delay'
+milliseconds (one second by default), and the delay is doubled after every
+retry. Every attempt has the full timeout. The result is the one of the last
+attempt, with its latency, and 'Attempts' tells how many attempts were made.
+Monitors of which the request can't be created, like with a missing request
+file, are not retried:
+
+	retries = 2
+	retry_delay = 500
+
+Credentials for basic authentication are given with 'basic_auth' (or the
+'username' and 'password' attributes), so they don't have to be base64
+encoded in an Authorization header. An explicit Authorization header in the
+'headers' replaces the basic authentication, which is reported as a warning
+when the configuration is validated:
+
+	basic_auth = { user = "probe", password = "secret" }
+
+APIs protected with OAuth2 can be monitored with the client credentials
+grant. Before the request, hmon fetches a bearer token from the 'token_url',
+authenticating with the client id and secret, and sends it in the
+Authorization header. Tokens are cached until they expire, and shared by all
+monitors with the same credentials, so a run fetches each token only once.
+The token is fetched with the proxy, TLS settings and timeout of the monitor.
+Fetching the token is not part of the latency of the monitor:
+
+	[monitor.API.oauth2]
+	token_url = "https://login.example.org/oauth2/token"
+	client_id = "hmon"
+	client_secret = "secret"
+	scopes = ["api.read"]
+
+Servers with a certificate of a private certificate authority are checked
+by giving the PEM encoded CA certificates in 'ca_file'. These are trusted in
+addition to the certificates of the system. With 'insecure_skip_verify', the
+certificate of the server isn't verified at all, which is meant for test
+environments with self-signed certificates only:
+
+	tls = { ca_file = "/etc/ssl/private-ca.pem" }
+
+The HTTP transport of the monitors is tuned with a 'transport' table at the
+top of a configuration, for all its monitors, or per monitor, where the
+settings of the monitor take precedence:
+
+	[transport]
+	tls_min_version = "1.2"       # 1.0, 1.1, 1.2 or 1.3
+	dial_timeout = 5000           # ms to make the TCP connection (default 30s)
+	expect_continue_timeout = 1000
+	disable_compression = true
+
+Every monitor run has a transport of its own, which counts the bytes of that
+run, so connections aren't kept alive between monitors. With
+'expect_continue_timeout' (in ms), monitors with a request body send 'Expect:
+100-continue', and wait that long for the server before sending the body.
+With 'disable_compression', responses aren't requested gzipped. A server
+without the 'tls_min_version' fails with HM-TLS.
+
+Critical endpoints can pin the public keys of their certificates with
+'pin_sha256': the base64 encoded SHA-256 hashes of the SubjectPublicKeyInfo
+of the accepted certificates. The connection is refused before the request is
+sent when none of the certificates served (the server's, or an intermediate)
+matches one of the pins, which detects intercepting proxies and unexpected
+certificate rotations. The monitor then fails with HM-TLS-PIN, and the error
+contains the fingerprint of the key of the served certificate. Pin the
+current and the next key, to rotate without failures. The fingerprint of a
+certificate is computed with:
+
+	openssl x509 -in cert.pem -pubkey -noout | openssl pkey -pubin -outform der |
+		openssl dgst -sha256 -binary | base64
+
+	pin_sha256 = ["x4QzPSC810K5/cMjb05Qm4k3Bw5zBn4lTdO/nEW/Td4="]
+
+By default, requests go through the proxies given by the HTTP_PROXY,
+HTTPS_PROXY and NO_PROXY environment variables (see -no-env-proxy). Hosts
+which are only reachable through a specific proxy are monitored by giving the
+URL of that proxy with 'proxy'. Both http(s) and socks5 proxies are supported:
+
+	proxy = "http://proxy.corp.example.org:3128"
+
+The regular expressions use the Go syntax (RE2). Matching flags are given at
+the start of the expression: (?i) makes it case-insensitive, (?s) lets '.'
+match newlines too, and (?m) makes ^ and $ match at the start and end of
+every line instead of the whole response. Flags can be combined, like
+"(?is)<fault>.*</fault>".
+
+Small request bodies can be written in the configuration itself with 'body',
+instead of in a separate file in the -filedir directory. The body is sent as
+HTTP POST data as-is. A monitor can't have both a 'file' and a 'body':
+
+	[monitor.Login]
+	name = "Login"
+	url = "https://www.example.org/api/login"
+	headers = ["Content-Type: application/json"]
+	body = """
+	{"username": "probe", "password": "secret"}
+	"""
+
+A 'file' of "-" is read from stdin, so the request body can be piped into
+hmon, and a 'file' with an http(s) URL is fetched at run time, like from an
+artifact store. Both are read once per run, even when several monitors use
+them, and aren't read by -validate. The URL is fetched with the proxy, TLS
+settings and timeout of the monitor, and a failed fetch fails all monitors
+using it for the rest of the run, with the code of the failure (like
+HM-TIMEOUT), or HM-CONFIG when the URL doesn't return the file:
+
+	[monitor.Order]
+	name = "Order"
+	url = "https://www.example.org/api/orders"
+	file = "https://artifacts.example.org/payloads/order.xml"
+
+Instead of a copy of a request, a monitor can run an operation of an
+OpenAPI 3 document (in JSON), so it stays in sync with the specification. The
+document is given with 'openapi', as a URL or a file in the -filedir
+directory, and is read on every run. The 'operation' is the operationId of
+the operation to run:
+
+	[monitor.UpdateUser]
+	name = "Update user"
+	openapi = "https://api.example.org/openapi.json"
+	operation = "updateUser"
+	status = "2xx"
+
+The request gets the method of the operation. Path parameters and required
+query parameters are filled in with their examples (the 'example', the first
+of the 'examples', or the example or default of the schema). The body is the
+example of the request body, preferably of 'application/json', and is sent
+with its Content-Type. The request goes to the first server of the document,
+unless the monitor has a 'url', which then replaces the server, for instance
+to run the operation against a test environment. References ($ref) are not
+followed. When the document can't be read, or the operation or one of its
+examples is missing, the monitor fails with HM-CONFIG. A monitor with an
+operation can't have a 'file' or 'body'.
+
+Assertions can also be written as tables, to give a human-friendly message
+which is reported instead of the regex when the assertion fails:
+
+	assertions = [
+		{ value = "Release [0-9.]+", message = "Homepage must show release banner" },
+		{ type = "wellformed", value = "xml", severity = "warning" },
+	]
+
+The 'type' is either 'regex' (the default), 'wellformed', in which case the
+value is xml, json or html, 'cookie', 'clock', 'status', 'jsonpath' or
+'header'. With 'severity = "warning"', a failing assertion does not fail the
+monitor, but is reported as a warning of the result. Note that plain strings
+and tables can't be mixed in a single list.
+
+Some services report errors with a successful response, like SOAP services
+returning a fault with status 200. The 'negative_assertions' are regexes the
+response must not match; the monitor fails when one of them does. In a table,
+the same is done with 'negate = true':
+
+	negative_assertions = ["faultstring", "Exception"]
+	assertions = [
+		{ value = "(?i)internal error", negate = true, severity = "warning" },
+	]
+
+Responses of which the valid forms vary, like those of multiple acceptable
+backends, are checked with groups of assertions. A table with 'all', 'any'
+or 'none' has a list of assertions instead of a value: all of them must pass,
+at least one of them must pass, or none of them may pass. Groups can be
+nested, so 'A and (B or C) and not D' is written as:
+
+	assertions = [
+		{ all = [
+			{ value = "A" },
+			{ any = [ "B", "C" ] },
+			{ none = [ "D" ] },
+		], message = "Unexpected response" },
+	]
+
+The list of a group holds any kind of assertion, but since strings and tables
+can't be mixed, a list with a nested group has tables only. A message and a
+severity apply to the whole group, and can't be given to the assertions in it.
+
+JSON APIs can be checked structurally with JSONPath expressions in the
+'jsonpath' list (or as assertions with 'type = "jsonpath"'), instead of with
+regexes depending on the formatting of the response:
+
+	jsonpath = [
+		"$.status == 'ok'",
+		"$.items | length > 0",
+		"$['data'].users[0].active == true",
+		"$.version",
+	]
+
+A path starts at the root ($), and selects members with .name or ['name'],
+and array elements with [0] ([-1] is the last element). '| length' takes the
+length of an array, object or string. The value is compared with a quoted
+string, a number, true, false or null using ==, !=, >, >=, < or <=. Without
+a comparison, the value must exist and not be null.
+
+Response headers are checked with 'header_assertions' (or assertions with
+'type = "header"'). Each is a header name, optionally followed by a colon and
+a regex the value of the header must match. Without a regex the header only
+has to be present. Header names are case insensitive. With 'negate = true',
+the header must be absent (or not match the regex):
+
+	header_assertions = [
+		"Content-Type: application/json",
+		"X-Cache: ^HIT$",
+		"Strict-Transport-Security",
+	]
+	assertions = [
+		{ type = "header", value = "X-Powered-By", negate = true },
+	]
+
+All assertions of a monitor are evaluated, also after one failed. The first
+failing assertion is the error of the monitor. The outcome of every assertion
+(passed or not, the error, and the evaluation time in microseconds) is part
+of the result in the 'json' and 'jsonl' output, so dashboards can show the
+health of the individual assertions.
+
+Cookie assertions check the cookies set by the response. The value is the
+name of the cookie which must be set. Optionally, its attributes can be
+checked with 'secure' and 'http_only' (booleans), 'same_site' (Strict, Lax or
+None), 'domain' and 'path'. The expiry window is checked with 'min_expiry'
+and 'max_expiry', as durations like "30m" or "24h", against the Max-Age or
+Expires of the cookie. All attributes which don't match are reported:
+
+	assertions = [
+		{ type = "cookie", value = "SESSION", secure = true, http_only = true, same_site = "Strict", max_expiry = "8h" },
+	]
+
+Clock assertions compare the Date header of the response with the local
+time, to catch servers with a skewed clock (a frequent cause of token
+validation failures). The value is the maximum allowed difference:
+
+	assertions = [
+		{ type = "clock", value = "30s" },
+	]
+
+Content negotiation is checked by sending 'accept' and 'accept_language'
+(as the Accept and Accept-Language headers), and asserting the representation
+of the response. The value of a 'content_language' assertion is a list of
+language ranges, of which the Content-Language must match one ("nl" matches
+"nl-BE" too). A 'vary' assertion lists the headers the Vary header must
+contain. With 'negotiation = true', the Content-Type and Content-Language
+must be acceptable for the Accept and Accept-Language of the request, and
+the response must vary on them, so a CDN doesn't serve one language to all:
+
+	accept = "text/html"
+	accept_language = "nl-NL, nl;q=0.9"
+	negotiation = true
+	assertions = [
+		{ type = "content_language", value = "nl" },
+		{ type = "vary", value = "Accept-Language" },
+	]
+
+Certificate expiry assertions check that the certificate of the server is
+still valid for at least the given amount of days. Over plain HTTP, the
+assertion fails. Use a warning severity to be reminded of renewals without
+failing the monitor. The expiry of the server certificate is
+included in the results of all HTTPS monitors, as 'CertNotAfter':
+
+	assertions = [
+		{ type = "cert_expiry_days", value = "30", severity = "warning" },
+	]
+
+OCSP assertions check that the server staples an OCSP response to the TLS
+handshake, which tells whether its certificate has been revoked. The response
+must be signed by the issuer of the certificate (or a responder it
+delegated to), must not be expired, and may not be older than the duration
+given as value. The assertion fails with HM-OCSP when the server doesn't
+staple a response, or when the certificate is revoked or unknown to the
+responder. The age in seconds of the stapled response is included in the
+results of all HTTPS monitors, as 'OCSPAge', so the checks double as
+evidence for compliance:
+
+	assertions = [
+		{ type = "ocsp", value = "96h" },
+	]
+
+Status assertions check the status code of the response. The value is a
+comma separated list of codes, where a class of codes is written like '2xx':
+
+	assertions = [
+		{ type = "status", value = "2xx,304" },
+	]
+
+Since the status code matters for almost every monitor, it can also be given
+with the 'status' attribute of the monitor, as a number, a string or a list.
+By default, any status code is accepted, so an error page which happens to
+match the assertions passes. With 'status', an unexpected status code fails
+the monitor, before the assertions are evaluated:
+
+	[monitor.Orders]
+	url = "https://api.example.org/orders"
+	status = ["200", "201", "3xx"]
+
+The status attribute can also be written as 'expect_status'. Monitors of
+which the expected outcome is an error, like a 404 of a removed endpoint or a
+401 of a protected resource, just list that status, and the assertions are
+evaluated on the error page. Such a monitor is OK in all outputs when the
+status and assertions match. When a redirect (3xx) is expected, redirects
+are not followed, so the redirect itself is checked, for instance its
+Location header. Otherwise, redirects are followed, and the status code of
+the last response is checked. The status code is part of the result in the
+'json' and 'jsonl' output.
+
+	[monitor.Removed]
+	url = "https://api.example.org/v1/orders"
+	expect_status = 404
+	assertions = ["moved to /v2"]
+
+Instead of a regular expression, an assertion can also check whether the
+response is a well-formed document: 'wellformed:xml', 'wellformed:json' and
+'wellformed:html'. The response is parsed, and if that fails, the assertion
+fails with the location of the parse error. The html variant is lenient on
+unclosed elements (like <br>) and HTML entities.
+
+Caches between hmon and the origin (like a CDN or a caching proxy) can hide
+the behavior of the origin. With 'cache_bust = true', every request of the
+monitor gets a random '_hmon' query parameter, and 'Cache-Control: no-cache'
+and 'Pragma: no-cache' headers (unless the monitor's headers set these), so
+the check measures the origin instead of the cache.
+
+Response headers can be captured into run variables with 'capture', a table
+of variable names and the header to capture. The variables are listed in the
+execution summary. When monitors captured different values for a variable,
+like different versions deployed on the nodes of an environment, all values
+are listed with the monitors which captured them:
+
+	[monitor.Version]
+	name = "Version"
+	url = "https://node1.example.org/health"
+	capture = { version = "X-Deployed-Version" }
+
+	[monitor.Release]
+	name = "Release notes"
+	url = "https://www.example.org/releases/${version}"
+	header_assertions = ["X-Deployed-Version: ^${version}$"]
+
+Monitors refer to run variables with ${name} in their URL, headers, and regex
+and header assertions. In assertions, the value is matched literally. A
+variable is available to the monitors which are started after it was
+captured: with -sequential, that's every next monitor (use 'priority' to run
+the capturing monitor first), otherwise only the monitors of the next
+configurations. References to variables which weren't captured are left as
+they are.
+
+A host behind round-robin DNS is served by whichever backend the resolver
+returns first, so a single sick backend only fails the monitor now and then.
+With 'sweep = true', all addresses (A and AAAA records) of the host are
+resolved before the run, and the monitor is run against each of them. These
+monitors are identified as 'monitor%address', and have the address appended
+to their name, like 'Health @ 10.0.0.2'. The requests still carry the Host
+header and TLS server name of the URL, and don't use a proxy. When the host
+can't be resolved, the monitor is run once, and fails with the resolve error.
+
+With 'security_audit = true', the security headers of the response are
+checked as well. By default, the audit requires a Strict-Transport-Security
+header with a max-age of at least 180 days (for https URLs only), an
+'X-Content-Type-Options: nosniff' header and a Content-Security-Policy, and
+fails when the Server or X-Powered-By headers contain a version number. The
+result of every check is printed below the result of the monitor, and is
+part of the json output. The checks can be changed with a policy file, see
+the -security-policy flag.
+
+With 'compare_url', the same request is also sent to another URL, like the
+green environment of a blue/green deployment. The responses must then be
+equal after applying 'remove' and 'normalize' to both, or the monitor fails
+with a summary of the first difference:
+
+	[monitor.Release]
+	name = "Release check"
+	url = "https://blue.example.com/api/catalog"
+	compare_url = "https://green.example.com/api/catalog"
+	remove = ["<timestamp>[^<]*</timestamp>"]
+	normalize = ["whitespace"]
+
+To verify weighted canary routing, a monitor can repeat its request and check
+how often a marker is in the responses. The marker is a regex matched against
+the given header, or against the body when no header is given. The monitor
+fails when the observed percentage deviates more than the tolerance (in
+percentage points) from the expected percentage:
+
+	[monitor.Canary]
+	name = "Canary routing"
+	url = "https://www.example.com/"
+
+	[monitor.Canary.sample]
+	requests = 200
+	header = "X-Version"
+	match = "^2\\."
+	percentage = 10.0
+	tolerance = 3.0
+
+Every sample request uses a new connection. The sampling is done after the
+regular checks of the monitor have passed.
+
+Timings reported by the server in the Server-Timing header are included in
+the results, so network latency can be told apart from application latency.
+Other headers with a timing can be given with 'timing_headers'. Their value
+is either a number of milliseconds, or a duration like "120ms":
+
+	timing_headers = ["X-Backend-Time"]
+
+The latency of a monitor is measured from the moment a connection to the
+server is started, until the response is read and checked. With many
+monitors running in parallel, requests can wait for hmon itself before they
+are started. That wait is not part of the latency, but is reported
+separately as the 'SchedulerWait' of the result (in milliseconds).
+
+To tell a slow DNS server from a slow backend, the latency is also broken
+down into its phases, as the 'Phases' of the result: resolving the host
+('DNS'), connecting ('Connect'), the TLS handshake ('TLS') and the time from
+sending the request until the first byte of the response ('FirstByte'), all
+in milliseconds. Phases which didn't happen, like the TLS handshake of a
+plain HTTP request, are zero. When redirected, only the first request is
+broken down. In the 'csv' output, the phases are the four columns before the
+owner and the failure code.
+
+Request files can include other files, so boilerplate like a SOAP envelope
+only has to be written once. An include is written as
+
+	{{ include "envelope_header.xml" }}
+
+and is resolved relative to the -filedir directory. Included files can
+include other files themselves. Only request files with an include are
+rendered as a template, so other files are sent as is, even when they
+contain "{{".
+
+When many monitors send the same request with different values, one template
+can render the bodies of all of them. The 'body_template' is a Go template in
+the -filedir directory, rendered with the data of the JSON file given with
+'data' (also relative to -filedir). Templates can include other files, which
+get the same data. Referring to data which isn't in the data file fails the
+monitor. A monitor with a 'body_template' can't have a 'file' or 'body':
+
+	[monitor.Order1]
+	name = "Order for ACME"
+	url = "https://shop.example.org/orders"
+	body_template = "order.tmpl"
+	data = "order1.json"
+
+With an order.tmpl like
+
+	<Order customer="{{.customer}}">{{range .lines}}<Line sku="{{.sku}}"/>{{end}}</Order>
+
+Monitors have an optional 'priority' attribute (default 0). Monitors with a
+higher priority are started first, and are reported first in the output.
+This is mostly useful in combination with the -workers flag, so critical
+monitors are not waiting for the long tail of other monitors. Monitors with
+the same priority are ordered by their optional 'order' attribute, and then
+by name. A monitor can be switched off by setting 'disabled = true'.
+
+The response body is only read when an assertion of the monitor checks it
+(a regex, wellformed or jsonpath assertion, also within a group), or the
+monitor has a compare_url, saves failures, or runs with -verbose. Status,
+header and certificate assertions don't need the body. For large responses,
+'read_limit' limits the amount of bytes read from the body; the assertions
+are then matched against that first part of the response only. Matching on a
+window streamed through the whole body is not supported.
+Note that the timeout covers the complete exchange, including reading the
+response body.
+
+Responses often contain volatile fragments like timestamps or request IDs.
+Before asserting, these can be removed from the response using the 'remove'
+attribute, a list of regular expressions of which all matches are removed.
+For XML responses, 'remove_xpath' lists paths of elements whose text is
+removed, with the same paths as the 'xpath' of scrub rules (see below).
+After that, the 'normalize' attribute lists normalization steps, applied in
+order: 'whitespace' collapses all whitespace to single spaces, and
+'lowercase' converts the response to lowercase. For example:
+
+	[monitor.Status]
+	name = "Status page"
+	url = "http://example.org/status"
+	remove = [
+		"<timestamp>[^<]*</timestamp>"
+	]
+	normalize = ["whitespace", "lowercase"]
+	assertions = [
+		"<status> ok </status>"
+	]
+
+Responses of production systems can contain personal data, which shouldn't
+end up on the disk of the monitoring host. The 'scrub' rules mask parts of
+the request and response bodies before they are saved (see -save-failures)
+or shown (-verbose). The assertions still see the original body. A rule has
+one of 'regex' (masks the matches, or only the groups of the regex when it
+has any), 'jsonpath' (masks the value at the path of a JSON body) or 'xpath'
+(masks the text within the matching elements of an XML body; only element
+names and '*' are supported, like "/Envelope/Body/*" or "//CardNumber").
+The replacement is "***", unless a 'mask' is given. Rules given at the top
+level of the configuration apply to all its monitors:
+
+	scrub = [
+		{ regex = '"password":\s*"([^"]*)"' },
+		{ jsonpath = "$.customer.email", mask = "<email>" },
+		{ xpath = "//CardNumber" },
+	]
+
 Output
 
 Generally, all output is reported to stdout. Additionally, other output
-formats to file can be specified. Currently three different formats are
-supported: JSON, CSV and PandoraFMS agent data. PandoraFMS (see
+formats to file can be specified. Currently four different formats are
+supported: JSON, CSV, PandoraFMS agent data and syslog. PandoraFMS (see
 http://pandorafms.org) is a specialized output format in XML so the agent can
 interprete it, and display it in the Pandora Web console.
 
+The modules of failed monitors are CRITICAL in Pandora, and those of monitors
+which succeeded (even with warnings) NORMAL. The 'pandora_status' table maps
+failure codes (see -format) to another status: NORMAL, WARNING or CRITICAL.
+The key 'failure' sets the status of all other failures, and 'warning' the
+status of monitors with failed assertions of severity warning. The table can
+be given for all monitors of a configuration, and per monitor, where the
+statuses of the monitor take precedence:
+
+	[pandora_status]
+	HM-TIMEOUT = "WARNING"
+	warning = "WARNING"
+
+For every monitor, the amount of bytes sent and received over the wire
+(including headers and TLS overhead) is recorded. The totals are shown in
+the execution summary, and the per monitor amounts are part of the JSON and
+CSV output. The syslog format
+is not written to a file, but sent to a syslog server instead.
+
 Usable flags
 
 The following flags can be used (defaults after the = sign):
@@ -85,19 +756,344 @@ and validated, and are used to run all monitors within these files.
 	-filedir="."
 
 The base directory where all HTTP POST request data resides. The <file>
-node in the monitors will use this as base.
+node in the monitors will use this as base. Files may use forward slashes
+on every platform. The directory may be a UNC path (like \\server\share), and
+files which are absolute, a UNC path or start with a drive letter (like
+C:\postdata\login.xml) are used as-is.
 
 	-format=""
 
-Output format. Three values can be given: 'json', 'csv', or 'pandora'.
-The 'json' value will render the output to json, 'csv' will write the
-results to comma separated values, and 'pandora' will write the results
-to PandoraFMS agent specific XML data.
+Output format. Eight values can be given: 'json', 'jsonl', 'ndjson', 'csv',
+'pandora', 'syslog', 'prometheus' or 'template'. The 'json' value will render the output to json, 'csv' will write
+the results to comma separated values, and 'pandora' will write the results
+to PandoraFMS agent specific XML data. The 'syslog' value sends one RFC 5424
+syslog message per result, with the result details as structured data.
+The 'prometheus' value writes the Prometheus text format, see below. The
+'template' value renders the results with the template of -template.
+
+The 'csv' and 'jsonl' formats are written while running: every result is
+appended to the output file as soon as its monitor completes, so long runs
+produce usable partial output. With 'jsonl', every line is a JSON object with
+the configuration name and the result. The results are written in the order
+the monitors complete, instead of in order of priority. 'ndjson' is the same
+as 'jsonl'.
+
+With -output -, the streaming formats are written to stdout, and all other
+output goes to stderr. This way, a run can be piped into jq or a log shipper
+while it's running (see -output):
+
+	./hmon -confdir ./hmonconfigs -format ndjson -output - | jq -c 'select(.Result.Error != null)'
+
+Every failure has a stable code, so automation can route and deduplicate
+failures without matching the error text. The code is the 'Code' of the
+result in 'json' and 'jsonl', the last column of 'csv', the 'code' parameter
+in 'syslog', object <base>.1.6 of SNMP traps and the 'code' of the failures
+posted to -notify-webhook. Outputs and notifications with only text, like
+the console and 'pandora', put the code before the error, like
+"[HM-TIMEOUT] timeout after 5000 ms". The codes are:
+
+	HM-CONFIG           the request could not be created, like a missing request file
+	HM-AUTH             the OAuth2 token could not be fetched
+	HM-TIMEOUT          no (complete) response within the timeout
+	HM-CONNECT-TIMEOUT  no connection within the connect_timeout
+	HM-HEADER-TIMEOUT   no response headers within the response_header_timeout
+	HM-DNS              the host could not be resolved
+	HM-CONNECT          no connection could be made to the host
+	HM-TLS              the TLS handshake or certificate verification failed
+	HM-TLS-EXPIRED      the certificate has expired, or expires too soon (cert_expiry_days)
+	HM-TLS-PIN          no served certificate matches the pin_sha256 fingerprints
+	HM-OCSP             no valid stapled OCSP response, or the certificate is revoked (ocsp)
+	HM-HTTP             any other failure of the exchange, like a dropped connection
+	HM-STATUS           an unexpected status code ('status' or status assertions)
+	HM-AUDIT            the security audit of the response headers failed
+	HM-NEGOTIATION      the response doesn't match the Accept or Accept-Language (negotiation)
+	HM-ASSERT           an assertion failed
+	HM-COMPARE          the response differs from the one of the compare URL
+	HM-SAMPLE           the distribution of the sampled marker is off
+
+The 'prometheus' format writes per-monitor gauges: hmon_monitor_up (1 or 0),
+hmon_monitor_latency_seconds, hmon_monitor_scheduler_wait_seconds,
+hmon_monitor_warnings, hmon_monitor_bytes_sent and
+hmon_monitor_bytes_received, labeled with the configuration, monitor and
+URL, and hmon_last_run_timestamp_seconds. Since hmon runs once and exits, the
+file is meant for the textfile collector of the Prometheus node exporter; it
+is replaced atomically, so it's never scraped half written:
+
+	./hmon -confdir ./hmonconfigs -format prometheus -output /var/lib/node_exporter/hmon.prom
+
+Alert on a stale hmon_last_run_timestamp_seconds to notice runs which stopped.
+
+	-save-failures=""
+
+Directory to save the full request and response of failed monitors to, one
+file per failure, named after the time and the monitor. Unlike -verbose, this
+only writes failures, and includes the headers and status of the exchange.
+The response body is read up to the read limit of the monitor (see
+-max-body). The file is listed below the result of the monitor.
+
+	-timezone=""
+
+The time zone of the timestamps in the output, like 'UTC' or
+'Europe/Amsterdam'. When empty, the local time zone of the machine is used.
+Every result has the time its monitor started: 'csv' writes it as the
+seventh column, followed by the expiry of the server certificate for HTTPS, 'json' and 'jsonl' include it with the result, 'syslog' uses it as the
+time of the message and 'pandora' writes the time of the run in the agent data.
+
+	-time-format="rfc3339"
+
+The format of the timestamps in the 'csv' and 'jsonl' output: 'rfc3339',
+'unix' (seconds since the epoch), 'unixms' (milliseconds since the epoch) or a
+Go time layout like "2006-01-02 15:04:05". The 'json', 'syslog' and 'pandora'
+formats always use the timestamp formats their consumers expect.
+
+	-env=""
+
+Selects the environment for monitors with 'environments'. These monitors are
+run against the base URL of the selected environment, with its headers added.
+Monitors which don't have the environment are disabled. When no environment
+is given, these monitors are run in every environment they have.
+
+	-host-override=""
+
+Rewrites the host in the URLs of all monitors for this run, given as
+'original=replacement'. The flag can be given multiple times, or with
+comma separated pairs. When the original host has no port, the port in the
+URL is kept. This allows pointing a production suite at a staging
+environment without duplicating the configurations:
+
+	./hmon -host-override "api.prod.example.com=api.staging.example.com"
+
+	-security-policy=""
+
+A TOML file with the policy for monitors with 'security_audit = true'. Only
+the settings which differ from the default policy have to be given:
+
+	hsts = true                      # require Strict-Transport-Security
+	hsts_min_max_age = 31536000      # with at least this max-age (seconds)
+	content_type_options = true      # require X-Content-Type-Options: nosniff
+	csp = true                       # require Content-Security-Policy
+	frame_options = true             # require X-Frame-Options or CSP frame-ancestors
+	no_server_version = true         # no versions in Server and X-Powered-By
+	required_headers = ["Referrer-Policy"]
+	forbidden_headers = ["X-AspNet-Version"]
+	severity = "warning"             # report failed checks as warnings
+
+	-insecure=false
+
+Skip the verification of server certificates for all monitors, like
+'insecure_skip_verify' in their 'tls' settings.
+
+	-no-env-proxy=false
+
+Don't use the proxies of the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment
+variables. Monitors with a 'proxy' of their own still use that proxy.
+
+	-skip=""
+	-skip-host=""
+	-exclude=""
+
+Skips monitors for this run, without editing the configurations. With -skip,
+monitors are skipped when their name (or their key in the configuration, like
+'api/Health' for grouped monitors) matches the glob. With -skip-host, monitors
+are skipped when the host of their URL matches the glob. Both flags can be
+given multiple times, or with comma separated globs. The syntax of the globs
+is that of Go's path.Match, so '*' doesn't match a '/':
+
+	./hmon -skip "Partner*" -skip-host "*.partner.example.com"
+
+The -exclude flag reads the globs from a file instead, one per line. Lines
+prefixed with 'host:' are host globs, and lines starting with '#' are
+comments:
+
+	# partner in maintenance until friday
+	host: *.partner.example.com
+	Partner*
+
+Skipped monitors are treated as disabled monitors.
+
+	-notify-teams=""
+
+A Microsoft Teams incoming webhook URL. When one or more monitors failed, an
+adaptive card with the run summary and the failing monitors is posted to it.
+
+	-notify-webhook=""
+
+Any URL to post a generic JSON notification to when one or more monitors
+failed. The document contains the title, rendered text, totals and failures.
+
+	-notify-template=""
+
+A file containing a Go text/template to render the text of notifications
+with. The template is executed with the run summary, which has the fields
+Total, Successes, Failures and Failed (a list of ConfigurationName and
+Result pairs).
+
+	-mail-to=""
+
+Comma separated e-mail addresses to send a run report to, after every run. The
+report is an HTML summary with the totals, the failures and the slowest
+monitors, with the results attached as JSON and CSV. To send a daily digest,
+schedule a run with -mail-to once a day (e.g. with cron).
+
+	-mail-from="hmon@localhost"
+
+The sender address of the report.
+
+	-mail-smtp="localhost:25"
+
+The SMTP server to send the report through, as host:port.
+
+	-mail-user=""
+
+The user to authenticate to the SMTP server with. The password is read from
+the HMON_MAIL_PASSWORD environment variable. Authentication is only done over
+TLS (when the server supports STARTTLS), or to localhost.
+
+	-mail-previous=""
+
+The JSON results (-format json) of a previous run. The report then lists the
+new failures apart from the monitors which were failing already. The report is
+sent before the output is written, so this can be the -output file of the run
+itself, which then holds the results of the previous run.
+
+	-template=""
+
+A file with a Go text/template for the 'template' format, to write the
+results in any text format, like a Markdown table or wiki markup. The
+template is executed with the list of configuration results, which have the
+ConfigurationName and the Results (as in the 'json' format). Besides the
+methods of the results, like ErrorText, the functions 'timestamp' (formats a
+time like -timeformat) and 'join' are available:
+
+	| Monitor | Status | Latency |
+	|---------|--------|---------|
+	{{range .}}{{range .Results}}| {{.Monitor.Name}} | {{if .Error}}{{.ErrorText}}{{else}}ok{{end}} | {{.Latency}} ms |
+	{{end}}{{end}}
+
+	-history=""
+
+A JSON file keeping the results of the last run, in the -format json format.
+When it exists, the execution summary ends with a comparison with the last
+run, for context without opening dashboards:
+
+	Trend:     2 new failures, 1 recovered, median latency +12%
+
+New failures are monitors failing now which didn't fail in the last run, and
+recovered monitors failed in the last run but succeed now. After the run, the
+file is replaced with the results of this run. Chaos runs leave it untouched.
+
+	-heartbeat=""
+
+A URL which is requested (with a GET) after every completed run, whether
+monitors failed or not, like the ping URL of a dead man's switch service such
+as healthchecks.io. When hmon itself stops running, the pings stop, and the
+service alerts. A run which fails before the end, like on an invalid
+configuration or an unwritable output file, doesn't ping. Neither does a
+chaos run (see -chaos-tolerance).
+
+	-chaos-tolerance=0
+
+Runs a chaos test instead of a regular run, to check that timeouts are
+handled, and that failures reach the right people, without touching the
+servers of the monitors. All monitors are sent through a local proxy which
+never answers, and their timeouts are lowered to the given amount of
+milliseconds. Retries and OAuth2 tokens are skipped. Every monitor must then
+fail with HM-TIMEOUT (or HM-CONFIG, for monitors of which the OpenAPI
+document can't be fetched). Otherwise, the problems are listed and the exit
+code is 1. The failures are reported like those of a regular run, through
+the output, notifications, traps and e-mail, so the routing of alerts can be
+verified end-to-end. Let the receivers know beforehand:
+
+	./hmon -confdir ./hmonconfigs -chaos-tolerance 500 -notify-webhook https://alerts.example.org/hmon
+
+	-sign=""
+
+A PEM encoded (PKCS #8) ed25519 private key, for instance generated with
+`openssl genpkey -algorithm ed25519 -out private.pem`. When given, the JSON
+output file is signed, and the base64 encoded signature is written next to
+it with a .sig suffix. Only valid in combination with -format json.
+
+	-snmp-trap=""
+
+Host, with optional port (default 162), of an SNMP manager. For every failed
+monitor a SNMPv2c trap is sent, carrying the configuration name, monitor name,
+status, latency and error description. Only v2c is supported.
+
+	-snmp-community="public"
+
+The community string to send the traps with.
+
+	-snmp-oid=""
+
+The base OID of the traps and objects. Traps are sent as <base>.0.1 (failed)
+and <base>.0.2 (ok), objects are <base>.1.1 through <base>.1.7. By default, an
+OID below the netSnmpPlaypen (1.3.6.1.4.1.8072.9999) arc is used.
+
+	-snmp-clear=false
+
+Also send traps for successful monitors. Trap receivers can use these to
+clear the events of earlier failures.
+
+	-statsd=""
+
+Host, with optional port (default 8125), of a StatsD server. As soon as a
+monitor completes, its latency is sent as a timer, and a success or failure
+counter is incremented, so the results show up in existing dashboards:
+
+	hmon.<configuration>.<monitor>.latency:120|ms
+	hmon.<configuration>.<monitor>.failure:1|c
+
+Characters with a meaning in metric names, like dots and spaces, are replaced
+by underscores. Metrics are sent over UDP, so a missing server doesn't fail
+the run. Chaos runs (-chaos-tolerance) send no metrics.
+
+	-statsd-prefix="hmon"
+
+The prefix of the names of the metrics.
+
+	-dogstatsd=false
+
+Send the configuration, monitor, owner and failure code as DogStatsD tags,
+instead of in the metric names:
+
+	hmon.latency:120|ms|#config:orders,monitor:status
+	hmon.failure:1|c|#config:orders,monitor:status,code:HM-TIMEOUT
+
+	-otlp=""
+
+Base URL of an OpenTelemetry collector, like http://localhost:4318, to export
+the runs of the monitors to with OTLP over HTTP (JSON). Every monitor run is
+a span named after the monitor, with the dns, connect, tls and first_byte
+phases as child spans. Failed runs get an error status and the hmon.code
+attribute. The gauges hmon.monitor.up (1 or 0) and hmon.monitor.latency (ms)
+are exported with the configuration, monitor and owner as attributes. Chaos
+runs (-chaos-tolerance) export nothing.
+
+	-otlp-signals="traces,metrics"
+
+Comma separated signals to export with -otlp: traces, metrics or both.
 
 	-output=""
 
 The output directory (in case of 'pandora' format) or output file (in case
-of 'json' or 'csv').
+of 'json', 'jsonl', 'ndjson', 'csv' or 'prometheus'). For 'syslog', this is the address of the syslog server,
+as host:port for UDP or tcp://host:port for TCP.
+
+An output of - writes the 'json', 'csv', 'jsonl', 'ndjson' and 'prometheus'
+formats to stdout, to pipe them into other tools. The regular output of hmon
+is then written to stderr:
+
+	./hmon -confdir ./hmonconfigs -format json -output - | jq '.[].Results[] | select(.Error != null)'
+
+For 'json', 'jsonl', 'ndjson' and 'csv', the output file can be a template (a Go
+text/template), to write one file per configuration instead of a single file
+with all results. The template has the configuration name as {{.Config}}
+(with characters unsuitable for filenames replaced) and the format as
+{{.Format}}:
+
+	./hmon -confdir ./hmonconfigs -format json -output "results/{{.Config}}.json"
+
+With -sign, every file gets its own signature.
 
 	-sequential=false
 
@@ -106,6 +1102,51 @@ executed sequentially, instead of spawning goroutines for each monitor. This
 means every monitor waits for execution until the previous monitor is done.
 Setting this flag is not recommended for monitor execution speed :)
 
+	-workers=0
+
+The maximum amount of monitors of a configuration running at the same time.
+When zero (the default), all monitors are started at once. Monitors are
+started in order of their priority.
+
+	-per-host=false
+
+Run the monitors of a single host one at a time, while monitors of
+different hosts still run in parallel. This keeps bursts of requests from
+tripping the rate limits or WAF rules of a backend, without running the whole
+configuration sequentially. Monitors of the same host run in order of
+priority. Swept monitors (see 'sweep') are grouped by their address. Can be
+combined with -workers.
+
+	-dns-prefetch=false
+
+Resolves the hosts of all monitors once before the run, in parallel, and
+shares the addresses between the monitors targeting the same host, instead
+of every connection resolving its host. This keeps hundreds of duplicate
+lookups from hitting the resolver at the start of a run. Hosts which can't be
+resolved are resolved again by their monitors, which then report the error.
+Monitors going through a proxy, or connecting to an address (see 'sweep'),
+are left out. Since the lookups are done before the run, the 'DNS' phase of
+the results is zero.
+
+	-dns-ttl=0
+
+The amount of seconds the addresses resolved with -dns-prefetch are used,
+after which a host is resolved again when a monitor connects to it. The
+resolver of the system doesn't tell the TTL of the DNS records, so it's set
+here. Zero, the default, uses the addresses for the whole run.
+
+	-max-body=0
+
+The maximum amount of bytes read from a response body, for monitors without
+a 'read_limit' of their own. When zero (the default), bodies are read fully.
+
+For runs with many thousands of monitors, use -workers to limit the amount of
+connections and response bodies in memory at the same time, -max-body to cap
+the size of those bodies, and a streaming format like 'jsonl' so results are
+written to disk as the monitors complete:
+
+	./hmon -confdir ./inventory -workers 50 -max-body 65536 -format jsonl -output results.jsonl
+
 	-validate=false
 
 Validate configuration file(s) only.
@@ -118,6 +1159,128 @@ Adds verbosity. Will print out request and responses for each monitor.
 
 Prints out version information and exits.
 
+Verifying signatures
+
+Signed result files can be verified with the verify subcommand, using the
+public key belonging to the signing key (`openssl pkey -in private.pem
+-pubout -out public.pem`):
+
+	./hmon verify -key public.pem results.json
+
+Each given file is checked against its .sig file. The exit code is 2 when
+any of the signatures does not match.
+
+Converting SoapUI projects
+
+SoapUI projects can be converted to hmon configurations with the convert
+subcommand. This does the same as the separate stoh tool, but validates the
+generated configurations immediately afterwards:
+
+	./hmon convert soapui project.xml -out ./generated -split-by testsuite
+
+The configurations are written to ./generated/configs, and the request
+files to ./generated/postdata. Problems in the generated configurations,
+like malformed URLs or invalid assertions, are reported and make the
+subcommand exit with a non-zero code. The conversion itself is done by the package
+github.com/krpors/hmon/soapui.
+
+Converting into a directory with earlier generated configurations merges
+them, like stoh does: the settings between the generated markers are
+replaced, and lines added by hand after them (and keys overriding generated
+ones) are kept, per monitor. Monitors of removed test steps are reported.
+
+Showing monitors
+
+The show subcommand prints the monitors with a given name or key. With
+-as-curl, they're printed as an equivalent curl command, with the rendered
+request file and all headers, so anyone can reproduce a failing check
+manually:
+
+	./hmon show -confdir ./hmonconfigs -filedir ./requests -as-curl "Login"
+
+It accepts the -conf, -confdir, -filedir and -env flags of a regular run.
+
+Ad-hoc assertions
+
+The assert subcommand checks a single URL against assertions given on the
+command line, without a configuration file, and prints the result like a
+regular run, with the outcome of every assertion. It's meant for trying
+assertions before adding them to a configuration:
+
+	./hmon assert -url https://www.example.org -e 'regex:Welcome' -e 'status:200'
+
+Assertions are written as 'type:value', with the types of the assertions in
+a configuration: regex, wellformed, cookie, clock, status, jsonpath, header,
+cert_expiry_days, ocsp, content_language and vary. A '!' before regex or header
+negates the assertion. Expressions without a type are regexes. Headers are
+given with -H, a request body to POST with -data. The exit code is 3 when
+the check fails, and 2 when an assertion is invalid.
+
+Reports per owner
+
+The report subcommand prints the totals and the failures of the JSON results
+(-format json) of a run, per configuration. With -by-owner, they are
+aggregated per owner instead, so every team sees its own failures. Monitors
+without an owner are reported as "(no owner)". With -owner, only the
+monitors of the given owner are reported:
+
+	./hmon report -by-owner results.json
+	./hmon report -owner team-payments results.json
+
+Importing curl commands
+
+Curl command lines can be imported as monitors with the import subcommand.
+Each command is given as a single (quoted) argument, or read from a file with
+-file, one command per line:
+
+	./hmon import curl -name "Login" "curl -H 'Accept: application/json' -d 'user=x' https://example.org/login"
+	./hmon import curl -file commands.txt -data-dir ./requests -out imported_hmon.toml
+
+Headers, basic authentication (-u), cookies, the user agent, the proxy (-x),
+the TLS options (-k and --cacert), the maximum time and the connect timeout
+are converted to the monitor. Inline data (-d, --data-raw and such) is
+written to a request file in the -data-dir directory, while '-d @file'
+refers to the file as-is. Both are relative to the -filedir of the run.
+Options without an equivalent in hmon are reported as warnings. The
+generated monitors have no assertions yet.
+
+Migrating XML configurations
+
+Configurations of older hmon versions were XML files (*_hmon.xml), with a
+<hmonconfig name="..."> root and <monitor> elements. These are converted to
+the TOML format with the migrate-config subcommand:
+
+	./hmon migrate-config -out common_hmon.toml common_hmon.xml
+
+The name, description, url, file, timeout, headers and assertions of the
+monitors are converted, whether given as attributes or as elements. All
+elements and attributes which can't be converted are listed afterwards, and
+the exit code is then 1, so the result can be completed by hand.
+
+Selftest
+
+Before pointing hmon at production on a new host, the installation can be
+verified with the selftest subcommand:
+
+	./hmon selftest
+
+It starts an embedded HTTP server, and runs a bundled configuration against
+it with GET and POST requests, passing, failing and warning assertions, a
+timeout and monitors with identities. The selftest passes when every monitor
+has the expected outcome, and the csv, jsonl and json outputs contain all
+results. Otherwise, the problems are listed and the exit code is 3.
+
+Exit codes
+
+hmon and its subcommands exit with a code telling why they failed, so
+wrapper scripts can branch on it:
+
+	0   all monitors succeeded
+	1   usage or configuration error, like an unknown flag or an unreadable configuration
+	2   validation failure of the configurations (or of signatures, with verify)
+	3   one or more monitors failed (or a chaos run or selftest failed)
+	4   internal error, like failing to write the output
+
 Examples
 
 A list of examples of running hmon:
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"regexp"
+	"time"
+)
+
+// Matches the characters which are replaced in the file names of saved
+// failures.
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// saveFailure writes the request and response of a failed monitor run to a
+// file in dir, and returns the name of the file. The response is nil when no
+// response was received (e.g. after a timeout). The bodies are scrubbed by the
+// scrub rules of the monitor.
+func saveFailure(dir string, m Monitor, t time.Time, req *http.Request, requestBody []byte, resp *http.Response, responseBody []byte, failure error) (string, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "Monitor: %s\n", m.Name)
+	fmt.Fprintf(&buf, "URL: %s\n", m.URL)
+	fmt.Fprintf(&buf, "Time: %s\n", t.Format(time.RFC3339))
+	fmt.Fprintf(&buf, "Error: %s\n", failure)
+	fmt.Fprintf(&buf, "Code: %s\n", failureCode(failure))
+
+	fmt.Fprintf(&buf, "\n=== REQUEST ===\n")
+	if req != nil {
+		fmt.Fprintf(&buf, "%s %s\n", req.Method, req.URL)
+		req.Header.Write(&buf)
+		fmt.Fprintf(&buf, "\n")
+		buf.Write(m.scrub(requestBody))
+		fmt.Fprintf(&buf, "\n")
+	} else {
+		fmt.Fprintf(&buf, "(not sent)\n")
+	}
+
+	fmt.Fprintf(&buf, "\n=== RESPONSE ===\n")
+	if resp != nil {
+		fmt.Fprintf(&buf, "%s %s\n", resp.Proto, resp.Status)
+		resp.Header.Write(&buf)
+		fmt.Fprintf(&buf, "\n")
+		buf.Write(m.scrub(responseBody))
+		fmt.Fprintf(&buf, "\n")
+	} else {
+		fmt.Fprintf(&buf, "(none)\n")
+	}
+
+	name := fmt.Sprintf("%s_%s.txt", t.Format("20060102T150405.000"), unsafeFileChars.ReplaceAllString(m.Name, "_"))
+	file := path.Join(dir, name)
+	err := ioutil.WriteFile(file, buf.Bytes(), 0644)
+	if err != nil {
+		return "", fmt.Errorf("unable to save failure to `%s': %s", file, err)
+	}
+	return file, nil
+}
+
+// SaveFailures makes all monitors save the request and response of a failed
+// run to a file in dir.
+func (c *Config) SaveFailures(dir string) {
+	for key, monitor := range c.Monitor {
+		monitor.failureDir = dir
+		c.Monitor[key] = monitor
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSaveFailures(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Backend", "node-3")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintf(w, "maintenance")
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "hmon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := Config{Monitor: map[string]Monitor{
+		"ok":   {Name: "Up", URL: server.URL},
+		"fail": {Name: "Status page", URL: server.URL, Assertions: []Assertion{{Type: AssertionStatus, Value: "200"}}},
+	}}
+	c.SaveFailures(dir)
+
+	ch := make(chan Result)
+	for _, m := range c.Monitor {
+		go m.Run(".", ch)
+		r := <-ch
+		if r.Error == nil {
+			if r.FailureFile != "" {
+				t.Errorf("expected nothing saved for a successful monitor, got '%s'", r.FailureFile)
+			}
+			continue
+		}
+
+		b, err := ioutil.ReadFile(r.FailureFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, expected := range []string{"Monitor: Status page", "GET " + server.URL, "503 Service Unavailable", "X-Backend: node-3", "maintenance"} {
+			if !strings.Contains(string(b), expected) {
+				t.Errorf("expected '%s' in the saved failure, got:\n%s", expected, b)
+			}
+		}
+	}
+
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 1 {
+		t.Errorf("expected 1 saved failure, got %d", len(files))
+	}
+}
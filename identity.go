@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+)
+
+// Identity is a set of credentials a monitor is run with. A monitor with
+// identities is run once per identity, to check the authorization of each:
+//
+//	[monitor.Admin.identities.admin]
+//	username = "admin"
+//	password = "secret"
+//
+//	[monitor.Admin.identities.anonymous]
+//	assertions = [ { type = "status", value = "401" } ]
+//
+// The credentials are either a username and password (sent as basic
+// authentication), or headers like a bearer token. They replace all
+// credentials of the monitor, so an identity without any is anonymous. When
+// an identity has assertions, they replace the assertions of the monitor.
+type Identity struct {
+	Username   string
+	Password   string
+	Headers    []Header
+	Assertions []Assertion
+}
+
+// expandIdentities replaces every monitor with identities by one monitor per
+// identity, with the key 'monitor#identity' and the identity appended to its
+// name.
+func (c *Config) expandIdentities() error {
+	for key, monitor := range c.Monitor {
+		if len(monitor.Identities) == 0 {
+			continue
+		}
+
+		identities := monitor.Identities
+		monitor.Identities = nil
+
+		delete(c.Monitor, key)
+		for name, identity := range identities {
+			identityKey := key + "#" + name
+			if _, found := c.Monitor[identityKey]; found {
+				return fmt.Errorf("monitor '%s' is defined more than once", identityKey)
+			}
+			m := monitor.asIdentity(identity)
+			m.Name = fmt.Sprintf("%s [%s]", monitor.Name, name)
+			c.Monitor[identityKey] = m
+		}
+	}
+	return nil
+}
+
+// asIdentity returns a copy of the monitor sending the credentials of the
+// identity instead of its own, and asserting the identity's assertions (if
+// any). All credentials of the monitor are dropped, so an identity without
+// credentials is anonymous.
+func (m Monitor) asIdentity(id Identity) Monitor {
+	m.BasicAuth, m.Username, m.Password, m.OAuth2 = nil, "", "", nil
+	headers := make([]Header, 0, len(m.Headers)+len(id.Headers)+1)
+	for _, h := range m.Headers {
+		if !hasAuthorizationHeader([]Header{h}) {
+			headers = append(headers, h)
+		}
+	}
+	m.Headers = headers
+	if id.Username != "" {
+		auth := base64.StdEncoding.EncodeToString([]byte(id.Username + ":" + id.Password))
+		m.Headers = append(m.Headers, Header("Authorization: Basic "+auth))
+	}
+	m.Headers = append(m.Headers, id.Headers...)
+	if len(id.Assertions) > 0 {
+		m.Assertions = append([]Assertion{}, id.Assertions...)
+	}
+	return m
+}
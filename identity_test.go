@@ -0,0 +1,77 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/BurntSushi/toml"
+)
+
+func TestExpandIdentities(t *testing.T) {
+	config := `
+name = "Identities"
+
+[monitor.Admin]
+name = "Admin page"
+url = "http://example.org/admin"
+headers = ["Accept: text/html"]
+assertions = ["Dashboard"]
+
+[monitor.Admin.identities.admin]
+username = "admin"
+password = "secret"
+
+[monitor.Admin.identities.anonymous]
+assertions = [ { type = "status", value = "401" } ]
+`
+	var c Config
+	if _, err := toml.Decode(config, &c); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.expandIdentities(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(c.Monitor) != 2 {
+		t.Fatalf("expected 2 monitors, got %d", len(c.Monitor))
+	}
+
+	admin := c.Monitor["Admin#admin"]
+	if admin.Name != "Admin page [admin]" {
+		t.Errorf("unexpected name '%s'", admin.Name)
+	}
+	if len(admin.Headers) != 2 || admin.Headers[1] != "Authorization: Basic YWRtaW46c2VjcmV0" {
+		t.Errorf("unexpected headers %v", admin.Headers)
+	}
+	if len(admin.Assertions) != 1 || admin.Assertions[0].Value != "Dashboard" {
+		t.Errorf("expected the assertions of the monitor, got %v", admin.Assertions)
+	}
+
+	anonymous := c.Monitor["Admin#anonymous"]
+	if len(anonymous.Headers) != 1 {
+		t.Errorf("expected no credentials for anonymous, got %v", anonymous.Headers)
+	}
+	if len(anonymous.Assertions) != 1 || anonymous.Assertions[0].Type != AssertionStatus {
+		t.Errorf("expected the assertions of the identity, got %v", anonymous.Assertions)
+	}
+}
+
+func TestIdentityDropsCredentials(t *testing.T) {
+	m := Monitor{
+		Name:      "Admin",
+		URL:       "http://example.org/admin",
+		BasicAuth: &BasicAuth{Username: "admin", Password: "secret"},
+		OAuth2:    &OAuth2{TokenURL: "http://example.org/token", ClientID: "id"},
+		Headers:   []Header{"Accept: text/html", "authorization: Bearer token"},
+	}
+
+	anonymous := m.asIdentity(Identity{})
+	if anonymous.basicAuth() != nil || anonymous.OAuth2 != nil {
+		t.Errorf("expected no credentials for an identity without any, got %+v", anonymous)
+	}
+	if len(anonymous.Headers) != 1 || anonymous.Headers[0] != "Accept: text/html" {
+		t.Errorf("expected the Authorization header to be dropped, got %v", anonymous.Headers)
+	}
+	if len(m.Headers) != 2 {
+		t.Errorf("expected the headers of the monitor to be kept, got %v", m.Headers)
+	}
+}
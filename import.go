@@ -0,0 +1,501 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/krpors/hmon/soapui"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// curlCommand is a request parsed from a curl command line.
+type curlCommand struct {
+	Method   string   // explicit method given with -X, if any
+	URL      string   // the URL to request
+	Headers  []string // headers in 'Name: value' form
+	Data     []string // inline request bodies, joined with '&' like curl does
+	DataFile string   // request body read from a file (-d @file)
+	Get      bool     // -G: put the data in the query string instead
+	Timeout  int      // the maximum time in milliseconds, or zero
+	Connect  int      // the connect timeout in milliseconds, or zero
+	Pins     []string // the pinned public key fingerprints (--pinnedpubkey)
+	Proxy    string   // the proxy to connect through (-x)
+	User     string   // the credentials of basic authentication as 'user:password' (-u)
+	Insecure bool     // -k: certificates aren't verified
+	CACert   string   // the file with the CA certificates to verify with (--cacert)
+	Warnings []string // options which have no equivalent in hmon
+}
+
+// The curl options which take a value, by their short and long names.
+var curlValueOptions = map[string]string{
+	"-X": "--request",
+	"-H": "--header",
+	"-d": "--data",
+	"-u": "--user",
+	"-A": "--user-agent",
+	"-e": "--referer",
+	"-b": "--cookie",
+	"-m": "--max-time",
+	"-F": "--form",
+	"-o": "--output",
+	"-x": "--proxy",
+}
+
+// The curl options without a value which don't matter for a monitor.
+var curlIgnoredOptions = map[string]bool{
+	"-s": true, "--silent": true,
+	"-S": true, "--show-error": true,
+	"-v": true, "--verbose": true,
+	"-i": true, "--include": true,
+	"-L": true, "--location": true, // redirects are always followed
+	"--compressed": true, // compression is handled transparently
+}
+
+// splitShellWords splits a (bash) command line into words. Single quotes,
+// double quotes, $'...' quotes, backslash escapes and line continuations are
+// supported, which covers the commands copied from browsers and API docs.
+func splitShellWords(s string) ([]string, error) {
+	var words []string
+	var word bytes.Buffer
+	inWord := false
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		case c == '\\':
+			if i+1 < len(s) {
+				i++
+				if s[i] == '\n' {
+					continue // line continuation
+				}
+				inWord = true
+				word.WriteByte(s[i])
+			}
+		case c == '\'':
+			inWord = true
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated single quote")
+			}
+			word.WriteString(s[i+1 : i+1+end])
+			i += end + 1
+		case c == '$' && i+1 < len(s) && s[i+1] == '\'':
+			inWord = true
+			i += 2
+			for ; i < len(s) && s[i] != '\''; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+					switch s[i] {
+					case 'n':
+						word.WriteByte('\n')
+					case 't':
+						word.WriteByte('\t')
+					case 'r':
+						word.WriteByte('\r')
+					default:
+						word.WriteByte(s[i])
+					}
+					continue
+				}
+				word.WriteByte(s[i])
+			}
+			if i >= len(s) {
+				return nil, fmt.Errorf("unterminated $' quote")
+			}
+		case c == '"':
+			inWord = true
+			i++
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) && strings.IndexByte("\"\\$`\n", s[i+1]) >= 0 {
+					i++
+					if s[i] == '\n' {
+						continue
+					}
+				}
+				word.WriteByte(s[i])
+			}
+			if i >= len(s) {
+				return nil, fmt.Errorf("unterminated double quote")
+			}
+		default:
+			inWord = true
+			word.WriteByte(c)
+		}
+	}
+
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// parseCurl parses the words of a curl command line. The first word may be
+// 'curl' itself.
+func parseCurl(words []string) (curlCommand, error) {
+	var cmd curlCommand
+	if len(words) > 0 && words[0] == "curl" {
+		words = words[1:]
+	}
+
+	for i := 0; i < len(words); i++ {
+		word := words[i]
+
+		if !strings.HasPrefix(word, "-") || word == "-" {
+			if cmd.URL != "" {
+				return cmd, fmt.Errorf("more than one URL given: `%s' and `%s'", cmd.URL, word)
+			}
+			cmd.URL = word
+			continue
+		}
+
+		// split into the option name and its value, if the value is attached
+		// to the option (like '-XPOST' or '--data=x').
+		name, value, hasValue := word, "", false
+		if strings.HasPrefix(word, "--") {
+			if idx := strings.Index(word, "="); idx > 0 {
+				name, value, hasValue = word[:idx], word[idx+1:], true
+			}
+		} else if len(word) > 2 {
+			if _, takesValue := curlValueOptions[word[:2]]; takesValue {
+				name, value, hasValue = word[:2], word[2:], true
+			} else {
+				// a bundle of options without values, like -sSL.
+				for _, c := range word[1:] {
+					cmd.flag("-" + string(c))
+				}
+				continue
+			}
+		}
+		if long, ok := curlValueOptions[name]; ok {
+			name = long
+		}
+
+		// the options with a value take the next word, if not attached.
+		needsValue := false
+		for _, long := range curlValueOptions {
+			if name == long {
+				needsValue = true
+			}
+		}
+		switch name {
+		case "--data-raw", "--data-binary", "--data-ascii", "--data-urlencode", "--url", "--connect-timeout", "--pinnedpubkey", "--cacert":
+			needsValue = true
+		}
+		if needsValue && !hasValue {
+			if i+1 >= len(words) {
+				return cmd, fmt.Errorf("option %s needs a value", word)
+			}
+			i++
+			value = words[i]
+		}
+
+		switch name {
+		case "--request":
+			cmd.Method = strings.ToUpper(value)
+		case "--header":
+			cmd.Headers = append(cmd.Headers, value)
+		case "--data", "--data-ascii", "--data-binary":
+			if strings.HasPrefix(value, "@") {
+				cmd.DataFile = value[1:]
+				continue
+			}
+			cmd.Data = append(cmd.Data, value)
+		case "--data-raw":
+			cmd.Data = append(cmd.Data, value)
+		case "--data-urlencode":
+			if idx := strings.Index(value, "="); idx >= 0 {
+				value = value[:idx+1] + url.QueryEscape(value[idx+1:])
+			} else {
+				value = url.QueryEscape(value)
+			}
+			cmd.Data = append(cmd.Data, value)
+		case "--user":
+			cmd.User = value
+		case "--user-agent":
+			cmd.Headers = append(cmd.Headers, "User-Agent: "+value)
+		case "--referer":
+			cmd.Headers = append(cmd.Headers, "Referer: "+value)
+		case "--cookie":
+			cmd.Headers = append(cmd.Headers, "Cookie: "+value)
+		case "--max-time":
+			seconds, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return cmd, fmt.Errorf("invalid --max-time `%s'", value)
+			}
+			cmd.Timeout = int(seconds * 1000)
+		case "--connect-timeout":
+			seconds, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return cmd, fmt.Errorf("invalid --connect-timeout `%s'", value)
+			}
+			cmd.Connect = int(seconds * 1000)
+		case "--url":
+			cmd.URL = value
+		case "--proxy":
+			// like curl, a proxy without a scheme is an HTTP proxy.
+			if !strings.Contains(value, "://") {
+				value = "http://" + value
+			}
+			cmd.Proxy = value
+		case "--cacert":
+			cmd.CACert = value
+		case "--pinnedpubkey":
+			for _, pin := range strings.Split(value, ";") {
+				if !strings.HasPrefix(pin, "sha256//") {
+					return cmd, fmt.Errorf("--pinnedpubkey `%s' is not a sha256// hash (files aren't supported)", pin)
+				}
+				cmd.Pins = append(cmd.Pins, strings.TrimPrefix(pin, "sha256//"))
+			}
+		case "--form":
+			return cmd, fmt.Errorf("multipart forms (%s) are not supported", word)
+		default:
+			cmd.flag(name)
+		}
+	}
+
+	if cmd.URL == "" {
+		return cmd, fmt.Errorf("no URL given")
+	}
+
+	if cmd.Get && len(cmd.Data) > 0 {
+		sep := "?"
+		if strings.Contains(cmd.URL, "?") {
+			sep = "&"
+		}
+		cmd.URL += sep + strings.Join(cmd.Data, "&")
+		cmd.Data = nil
+	}
+
+	// hmon uses a GET, or a POST when there's a request file.
+	if cmd.Method != "" && cmd.Method != cmd.method() {
+		cmd.Warnings = append(cmd.Warnings, fmt.Sprintf("method %s is imported as %s, hmon only POSTs when there's data", cmd.Method, cmd.method()))
+	}
+
+	return cmd, nil
+}
+
+// flag handles a curl option without a value.
+func (cmd *curlCommand) flag(name string) {
+	switch {
+	case name == "-G" || name == "--get":
+		cmd.Get = true
+	case name == "-k" || name == "--insecure":
+		cmd.Insecure = true
+	case !curlIgnoredOptions[name]:
+		cmd.Warnings = append(cmd.Warnings, fmt.Sprintf("option %s is not supported, ignored", name))
+	}
+}
+
+// Returns the method hmon will use for the command.
+func (cmd curlCommand) method() string {
+	if len(cmd.Data) > 0 || cmd.DataFile != "" {
+		return "POST"
+	}
+	return "GET"
+}
+
+// Returns a default name for the monitor of the command, like 'POST example.org/login'.
+func (cmd curlCommand) defaultName() string {
+	u, err := url.Parse(cmd.URL)
+	if err != nil || u.Host == "" {
+		return cmd.method() + " " + cmd.URL
+	}
+	return cmd.method() + " " + u.Host + u.Path
+}
+
+// splitCommands splits text into curl command lines. A line ending with a
+// backslash continues on the next line. Empty lines and lines starting with
+// '#' are ignored.
+func splitCommands(text string) []string {
+	var commands []string
+	var current string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if current == "" && (strings.TrimSpace(line) == "" || strings.HasPrefix(strings.TrimSpace(line), "#")) {
+			continue
+		}
+		if strings.HasSuffix(line, "\\") {
+			current += strings.TrimSuffix(line, "\\") + " "
+			continue
+		}
+		commands = append(commands, current+line)
+		current = ""
+	}
+	if strings.TrimSpace(current) != "" {
+		commands = append(commands, current)
+	}
+	return commands
+}
+
+// writeImportedConfig writes a configuration with a monitor per command.
+// Inline request bodies are written to files in dataDir, which should be
+// used as the -filedir of the run.
+func writeImportedConfig(w io.Writer, configName string, names []string, commands []curlCommand, dataDir string) error {
+	fmt.Fprintf(w, "schema = %d\n", CurrentSchema)
+	fmt.Fprintf(w, "name = %s\n", soapui.TOMLString(configName))
+
+	usedKeys := make(map[string]bool)
+	for i, cmd := range commands {
+		key := soapui.UniqueKey(strings.Replace(names[i], ".", "", -1), usedKeys)
+
+		fmt.Fprintf(w, "\n[monitor.%s]\n", soapui.TOMLString(key))
+		fmt.Fprintf(w, "name = %s\n", soapui.TOMLString(names[i]))
+		fmt.Fprintf(w, "url = %s\n", soapui.TOMLString(cmd.URL))
+
+		file := cmd.DataFile
+		if len(cmd.Data) > 0 {
+			file = strings.NewReplacer("/", "_", " ", "_").Replace(key) + ".txt"
+			err := ioutil.WriteFile(path.Join(dataDir, file), []byte(strings.Join(cmd.Data, "&")), 0644)
+			if err != nil {
+				return fmt.Errorf("unable to write request file: %s", err)
+			}
+		}
+		if file != "" {
+			fmt.Fprintf(w, "file = %s\n", soapui.TOMLString(file))
+		}
+		if cmd.Timeout > 0 {
+			fmt.Fprintf(w, "timeout = %d\n", cmd.Timeout)
+		}
+		if cmd.Connect > 0 {
+			fmt.Fprintf(w, "connect_timeout = %d\n", cmd.Connect)
+		}
+		if cmd.Proxy != "" {
+			fmt.Fprintf(w, "proxy = %s\n", soapui.TOMLString(cmd.Proxy))
+		}
+		if cmd.User != "" {
+			// curl asks for the password when it's not given.
+			user, password := cmd.User, ""
+			if idx := strings.Index(cmd.User, ":"); idx >= 0 {
+				user, password = cmd.User[:idx], cmd.User[idx+1:]
+			}
+			fmt.Fprintf(w, "basic_auth = { user = %s, password = %s }\n", soapui.TOMLString(user), soapui.TOMLString(password))
+		}
+		if cmd.Insecure || cmd.CACert != "" {
+			var options []string
+			if cmd.Insecure {
+				options = append(options, "insecure_skip_verify = true")
+			}
+			if cmd.CACert != "" {
+				options = append(options, "ca_file = "+soapui.TOMLString(cmd.CACert))
+			}
+			fmt.Fprintf(w, "tls = { %s }\n", strings.Join(options, ", "))
+		}
+		if len(cmd.Pins) > 0 {
+			var pins []string
+			for _, pin := range cmd.Pins {
+				pins = append(pins, soapui.TOMLString(pin))
+			}
+			fmt.Fprintf(w, "pin_sha256 = [%s]\n", strings.Join(pins, ", "))
+		}
+		if len(cmd.Headers) > 0 {
+			fmt.Fprintf(w, "headers = [\n")
+			for _, h := range cmd.Headers {
+				fmt.Fprintf(w, "  %s,\n", soapui.TOMLString(h))
+			}
+			fmt.Fprintf(w, "]\n")
+		}
+		fmt.Fprintf(w, "assertions = []\n")
+	}
+	return nil
+}
+
+// Runs the 'import' subcommand with the given arguments. Converts curl
+// command lines to a hmon configuration. Returns the exit code.
+func runImport(args []string) int {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	name := fs.String("name", "", "Name of the monitor, when importing a single command. Derived from the URL if empty.")
+	configName := fs.String("config-name", "Imported", "Name of the generated configuration.")
+	file := fs.String("file", "", "File with curl commands to import, one per line (lines can be continued with a backslash).")
+	dataDir := fs.String("data-dir", ".", "Directory to write the request files of commands with inline data to.")
+	out := fs.String("out", "", "The configuration file to write. If empty, it's written to stdout.")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: hmon import curl [flags] \"curl -H ... https://...\"\n")
+		fmt.Fprintf(os.Stderr, "       hmon import curl [flags] -file commands.txt\n\n")
+		fmt.Fprintf(os.Stderr, "Converts curl command lines to a hmon configuration with one monitor\n")
+		fmt.Fprintf(os.Stderr, "per command.\n\n")
+		fs.PrintDefaults()
+	}
+
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return flagExitCode(err)
+	}
+	if len(positional) == 0 || positional[0] != "curl" {
+		fs.Usage()
+		return ExitUsage
+	}
+
+	var lines []string
+	if *file != "" {
+		b, err := ioutil.ReadFile(*file)
+		if err != nil {
+			fmt.Printf("Unable to read curl commands: %s\n", err)
+			return ExitUsage
+		}
+		lines = splitCommands(string(b))
+	}
+	// every other argument is a (quoted) command line.
+	lines = append(lines, positional[1:]...)
+	if len(lines) == 0 {
+		fs.Usage()
+		return ExitUsage
+	}
+	if *name != "" && len(lines) > 1 {
+		fmt.Printf("The -name flag can only be used when importing a single command\n")
+		return ExitUsage
+	}
+
+	var commands []curlCommand
+	var names []string
+	for i, line := range lines {
+		words, err := splitShellWords(line)
+		if err == nil {
+			var cmd curlCommand
+			cmd, err = parseCurl(words)
+			if err == nil {
+				for _, warning := range cmd.Warnings {
+					fmt.Fprintf(os.Stderr, "Warning: command %d: %s\n", i+1, warning)
+				}
+				commands = append(commands, cmd)
+				names = append(names, cmd.defaultName())
+				continue
+			}
+		}
+		fmt.Printf("Unable to import command %d: %s\n", i+1, err)
+		return ExitUsage
+	}
+	if *name != "" {
+		names[0] = *name
+	}
+
+	var buf bytes.Buffer
+	err = writeImportedConfig(&buf, *configName, names, commands, *dataDir)
+	if err != nil {
+		fmt.Println(err)
+		return ExitUsage
+	}
+
+	if *out == "" {
+		os.Stdout.Write(buf.Bytes())
+		return ExitOK
+	}
+	err = ioutil.WriteFile(*out, buf.Bytes(), 0644)
+	if err != nil {
+		fmt.Printf("Unable to write configuration `%s': %s\n", *out, err)
+		return ExitInternal
+	}
+	fmt.Printf("Imported %d monitor(s) to `%s'\n", len(commands), *out)
+	return ExitOK
+}
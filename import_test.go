@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestSplitShellWords(t *testing.T) {
+	tests := map[string][]string{
+		`curl -H 'Accept: */*' "http://x/?a=1&b=2"`: {"curl", "-H", "Accept: */*", "http://x/?a=1&b=2"},
+		"curl \\\n  -d \"say \\\"hi\\\"\" url":      {"curl", "-d", `say "hi"`, "url"},
+		`curl --data-raw $'line1\nline2' a\ b`:      {"curl", "--data-raw", "line1\nline2", "a b"},
+	}
+	for in, expected := range tests {
+		words, err := splitShellWords(in)
+		if err != nil {
+			t.Errorf("unexpected error for %s: %s", in, err)
+			continue
+		}
+		if !reflect.DeepEqual(words, expected) {
+			t.Errorf("expected %q, got %q", expected, words)
+		}
+	}
+
+	if _, err := splitShellWords(`curl 'unterminated`); err == nil {
+		t.Errorf("expected error for unterminated quote")
+	}
+}
+
+func TestParseCurl(t *testing.T) {
+	words, _ := splitShellWords(`curl -sSL -XPOST 'https://api.example.org/login' -H 'Content-Type: application/json' -u user:pass --data '{"a":1}' -m 2.5 -k`)
+	cmd, err := parseCurl(words)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cmd.URL != "https://api.example.org/login" || cmd.method() != "POST" {
+		t.Errorf("unexpected url or method: %s %s", cmd.method(), cmd.URL)
+	}
+	expected := []string{"Content-Type: application/json"}
+	if !reflect.DeepEqual(cmd.Headers, expected) {
+		t.Errorf("expected headers %q, got %q", expected, cmd.Headers)
+	}
+	if cmd.User != "user:pass" {
+		t.Errorf("expected basic authentication, got '%s'", cmd.User)
+	}
+	if len(cmd.Data) != 1 || cmd.Data[0] != `{"a":1}` {
+		t.Errorf("unexpected data %q", cmd.Data)
+	}
+	if cmd.Timeout != 2500 {
+		t.Errorf("expected timeout 2500, got %d", cmd.Timeout)
+	}
+	if !cmd.Insecure || len(cmd.Warnings) != 0 {
+		t.Errorf("expected -k to skip verification without warnings, got %+v", cmd)
+	}
+
+	cmd, err = parseCurl([]string{"curl", "-G", "-d", "q=go", "--data-urlencode", "x=a b", "http://example.org/search"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmd.URL != "http://example.org/search?q=go&x=a+b" || cmd.method() != "GET" {
+		t.Errorf("unexpected url or method: %s %s", cmd.method(), cmd.URL)
+	}
+
+	cmd, err = parseCurl([]string{"curl", "-x", "proxy:3128", "https://example.org/x"})
+	if err != nil || cmd.Proxy != "http://proxy:3128" || cmd.URL != "https://example.org/x" {
+		t.Errorf("expected the proxy and the URL, got %+v (%v)", cmd, err)
+	}
+
+	if _, err := parseCurl([]string{"curl", "-H", "X: y"}); err == nil {
+		t.Errorf("expected error without URL")
+	}
+}
+
+func TestWriteImportedConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hmon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var commands []curlCommand
+	var names []string
+	for _, line := range splitCommands("# login\ncurl -u 'probe:s3cr:et' -d 'user=x' \\\n  http://example.org/login\n\ncurl -k http://example.org/health\n") {
+		words, _ := splitShellWords(line)
+		cmd, err := parseCurl(words)
+		if err != nil {
+			t.Fatal(err)
+		}
+		commands = append(commands, cmd)
+		names = append(names, cmd.defaultName())
+	}
+	if len(commands) != 2 {
+		t.Fatalf("expected 2 commands, got %d", len(commands))
+	}
+
+	var buf bytes.Buffer
+	if err := writeImportedConfig(&buf, "Imported", names, commands, dir); err != nil {
+		t.Fatal(err)
+	}
+	config := path.Join(dir, "imported_hmon.toml")
+	ioutil.WriteFile(config, buf.Bytes(), 0644)
+
+	c, err := ReadConfig(config)
+	if err != nil {
+		t.Fatalf("expected a parsable configuration, got: %s\n%s", err, buf.String())
+	}
+	if err := c.Validate(dir); err != nil {
+		t.Fatalf("expected a valid configuration, got: %s", err)
+	}
+	login := c.Monitor["POST exampleorg/login"]
+	if login.URL != "http://example.org/login" || login.File == "" || login.basicAuth() == nil || login.basicAuth().Password != "s3cr:et" {
+		t.Errorf("unexpected monitors %+v", c.Monitor)
+	}
+	if health := c.Monitor["GET exampleorg/health"]; health.TLS == nil || !health.TLS.InsecureSkipVerify {
+		t.Errorf("expected -k to skip verification, got:\n%s", buf.String())
+	}
+}
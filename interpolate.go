@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Matches a reference to another value of the configuration, like
+// @{group.api.base}, or an escaped reference (@@{...}) which is kept as-is.
+var referenceRegexp = regexp.MustCompile(`@?@\{([^}]*)\}`)
+
+// interpolator resolves the references in the values of a decoded
+// configuration. References are dotted paths of keys from the root of the
+// configuration, and may point to strings, numbers or booleans. Strings which
+// are referenced may contain references themselves.
+type interpolator struct {
+	doc      map[string]interface{}
+	resolved map[string]string
+	stack    []string // the references being resolved, to detect cycles
+}
+
+// interpolate returns a copy of the decoded configuration, with all
+// references in its string values replaced by the values they refer to.
+func interpolate(doc map[string]interface{}) (map[string]interface{}, error) {
+	in := interpolator{doc: doc, resolved: make(map[string]string)}
+	v, err := in.walk(doc)
+	if err != nil {
+		return nil, err
+	}
+	return v.(map[string]interface{}), nil
+}
+
+// walk returns a copy of v with the references in all strings expanded. The
+// original is left alone, so references are always resolved against the
+// values as written.
+func (in *interpolator) walk(v interface{}) (interface{}, error) {
+	switch t := v.(type) {
+	case string:
+		return in.expand(t)
+	case map[string]interface{}:
+		table := make(map[string]interface{}, len(t))
+		for key, value := range t {
+			expanded, err := in.walk(value)
+			if err != nil {
+				return nil, err
+			}
+			table[key] = expanded
+		}
+		return table, nil
+	case []map[string]interface{}:
+		tables := make([]map[string]interface{}, len(t))
+		for i, value := range t {
+			expanded, err := in.walk(value)
+			if err != nil {
+				return nil, err
+			}
+			tables[i] = expanded.(map[string]interface{})
+		}
+		return tables, nil
+	case []interface{}:
+		list := make([]interface{}, len(t))
+		for i, value := range t {
+			expanded, err := in.walk(value)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = expanded
+		}
+		return list, nil
+	}
+	return v, nil
+}
+
+// expand replaces the references in s.
+func (in *interpolator) expand(s string) (string, error) {
+	if !strings.Contains(s, "@{") {
+		return s, nil
+	}
+
+	var err error
+	expanded := referenceRegexp.ReplaceAllStringFunc(s, func(ref string) string {
+		if strings.HasPrefix(ref, "@@") {
+			return ref[1:]
+		}
+		if err != nil {
+			return ref
+		}
+		var value string
+		value, err = in.lookup(strings.TrimSpace(ref[2 : len(ref)-1]))
+		return value
+	})
+	return expanded, err
+}
+
+// lookup returns the value of the reference, with the references within
+// that value expanded.
+func (in *interpolator) lookup(ref string) (string, error) {
+	if value, found := in.resolved[ref]; found {
+		return value, nil
+	}
+	for i, r := range in.stack {
+		if r == ref {
+			cycle := append(append([]string{}, in.stack[i:]...), ref)
+			return "", fmt.Errorf("reference cycle: @{%s}", strings.Join(cycle, "} -> @{"))
+		}
+	}
+
+	var v interface{} = in.doc
+	for _, key := range strings.Split(ref, ".") {
+		table, ok := v.(map[string]interface{})
+		if !ok {
+			return "", fmt.Errorf("reference @{%s} does not exist", ref)
+		}
+		if v, ok = table[key]; !ok {
+			return "", fmt.Errorf("reference @{%s} does not exist", ref)
+		}
+	}
+
+	var value string
+	switch t := v.(type) {
+	case string:
+		in.stack = append(in.stack, ref)
+		expanded, err := in.expand(t)
+		in.stack = in.stack[:len(in.stack)-1]
+		if err != nil {
+			return "", err
+		}
+		value = expanded
+	case int64, float64, bool:
+		value = fmt.Sprint(t)
+	default:
+		return "", fmt.Errorf("reference @{%s} must refer to a string, number or boolean", ref)
+	}
+	in.resolved[ref] = value
+	return value, nil
+}
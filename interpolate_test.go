@@ -0,0 +1,109 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestInterpolate(t *testing.T) {
+	doc := map[string]interface{}{
+		"host": "api.example.org",
+		"port": int64(8443),
+		"group": map[string]interface{}{
+			"api": map[string]interface{}{
+				"base": "https://@{host}:@{port}/v1",
+			},
+		},
+		"monitor": map[string]interface{}{
+			"Health": map[string]interface{}{
+				"url":     "@{group.api.base}/health",
+				"headers": []interface{}{"Host: @{ host }", "X-Literal: @@{host}"},
+			},
+		},
+	}
+
+	expanded, err := interpolate(doc)
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	health := expanded["monitor"].(map[string]interface{})["Health"].(map[string]interface{})
+	if url := health["url"]; url != "https://api.example.org:8443/v1/health" {
+		t.Errorf("expected the url to be interpolated, got '%s'", url)
+	}
+	headers := health["headers"].([]interface{})
+	if headers[0] != "Host: api.example.org" || headers[1] != "X-Literal: @{host}" {
+		t.Errorf("expected the headers to be interpolated, got %v", headers)
+	}
+	if base := doc["group"].(map[string]interface{})["api"].(map[string]interface{})["base"]; base != "https://@{host}:@{port}/v1" {
+		t.Errorf("expected the original document to be left alone, got '%s'", base)
+	}
+}
+
+func TestInterpolateErrors(t *testing.T) {
+	tests := []struct {
+		doc      map[string]interface{}
+		expected string
+	}{
+		{map[string]interface{}{"a": "@{b}", "b": "@{c}", "c": "@{a}"}, "reference cycle"},
+		{map[string]interface{}{"a": "@{a}"}, "reference cycle: @{a} -> @{a}"},
+		{map[string]interface{}{"a": "@{missing.key}"}, "reference @{missing.key} does not exist"},
+		{map[string]interface{}{"a": "@{b}", "b": map[string]interface{}{}}, "must refer to a string, number or boolean"},
+	}
+	for _, test := range tests {
+		_, err := interpolate(test.doc)
+		if err == nil || !strings.Contains(err.Error(), test.expected) {
+			t.Errorf("expected an error containing '%s', got %v", test.expected, err)
+		}
+	}
+}
+
+func TestReadConfigInterpolation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hmon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := path.Join(dir, "refs_hmon.toml")
+	content := `name = "References"
+
+[group.api]
+base_url = "https://api.example.org"
+token = "secret"
+
+[group.api.monitor.Health]
+name = "Health"
+url = "/health"
+headers = ["Authorization: Bearer @{group.api.token}"]
+
+[monitor.Mirror]
+name = "Mirror of @{group.api.monitor.Health.name}"
+url = "@{group.api.base_url}/mirror"
+`
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := ReadConfig(file)
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	mirror := c.Monitor["Mirror"]
+	if mirror.Name != "Mirror of Health" || mirror.URL != "https://api.example.org/mirror" {
+		t.Errorf("expected the mirror to be interpolated, got '%s' at '%s'", mirror.Name, mirror.URL)
+	}
+	if h := c.Monitor["api/Health"].Headers; len(h) != 1 || h[0] != "Authorization: Bearer secret" {
+		t.Errorf("expected the header to be interpolated, got %v", h)
+	}
+
+	content = "name = \"Cycle\"\n\n[monitor.A]\nurl = \"@{monitor.A.url}\"\n"
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadConfig(file); err == nil || !strings.Contains(err.Error(), "reference cycle") {
+		t.Errorf("expected a reference cycle error, got %v", err)
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// jsonPath is a parsed JSONPath assertion. Only a subset of JSONPath is
+// supported: a path from the root ($) through members (.name or ['name'])
+// and array indices ([0], or [-1] for the last element), optionally followed
+// by '| length', and optionally compared with a literal:
+//
+//	$.status == 'ok'
+//	$.items | length > 0
+//	$['data'].users[0].active == true
+//
+// Without a comparison, the value must exist and not be null.
+type jsonPath struct {
+	path   []interface{} // member names (string) and array indices (int)
+	length bool          // whether the length of the value is used
+	op     string        // the comparison operator, if any
+	value  interface{}   // the literal compared with: string, float64, bool or nil
+}
+
+// The comparison operators, longest first so '>=' isn't read as '>'.
+var jsonPathOperators = []string{"==", "!=", ">=", "<=", ">", "<"}
+
+// Returns true if c can be part of a member name after a dot.
+func isJSONPathNameChar(c byte) bool {
+	return c == '_' || c == '-' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// parseJSONPath parses a JSONPath assertion.
+func parseJSONPath(expr string) (*jsonPath, error) {
+	s := strings.TrimSpace(expr)
+	if !strings.HasPrefix(s, "$") {
+		return nil, fmt.Errorf("path must start with '$'")
+	}
+
+	p := &jsonPath{}
+	i := 1
+path:
+	for i < len(s) {
+		switch s[i] {
+		case '.':
+			j := i + 1
+			for j < len(s) && isJSONPathNameChar(s[j]) {
+				j++
+			}
+			if j == i+1 {
+				return nil, fmt.Errorf("expected a member name after '.' at position %d", i+1)
+			}
+			p.path = append(p.path, s[i+1:j])
+			i = j
+		case '[':
+			end := strings.IndexByte(s[i:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed '[' at position %d", i+1)
+			}
+			inner := strings.TrimSpace(s[i+1 : i+end])
+			if len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0] {
+				p.path = append(p.path, inner[1:len(inner)-1])
+			} else if index, err := strconv.Atoi(inner); err == nil {
+				p.path = append(p.path, index)
+			} else {
+				return nil, fmt.Errorf("expected a quoted name or an index in '[%s]'", inner)
+			}
+			i += end + 1
+		default:
+			break path
+		}
+	}
+
+	rest := strings.TrimSpace(s[i:])
+	if strings.HasPrefix(rest, "|") {
+		rest = strings.TrimSpace(rest[1:])
+		if !strings.HasPrefix(rest, "length") {
+			return nil, fmt.Errorf("unknown function after '|' (only 'length' is supported)")
+		}
+		p.length = true
+		rest = strings.TrimSpace(strings.TrimPrefix(rest, "length"))
+	}
+	if rest == "" {
+		return p, nil
+	}
+
+	for _, op := range jsonPathOperators {
+		if strings.HasPrefix(rest, op) {
+			p.op = op
+			value, err := parseJSONPathLiteral(strings.TrimSpace(rest[len(op):]))
+			if err != nil {
+				return nil, err
+			}
+			p.value = value
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("unexpected '%s' (expected an operator like == or >)", rest)
+}
+
+// parseJSONPathLiteral parses a quoted string, number, true, false or null.
+func parseJSONPathLiteral(s string) (interface{}, error) {
+	switch {
+	case len(s) >= 2 && (s[0] == '\'' || s[0] == '"') && s[len(s)-1] == s[0]:
+		return s[1 : len(s)-1], nil
+	case s == "true":
+		return true, nil
+	case s == "false":
+		return false, nil
+	case s == "null":
+		return nil, nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value '%s' (must be a quoted string, number, true, false or null)", s)
+	}
+	return f, nil
+}
+
+// eval evaluates the path against the decoded JSON document.
+func (p *jsonPath) eval(doc interface{}) error {
+	v := doc
+	at := "$"
+	for _, step := range p.path {
+		switch s := step.(type) {
+		case string:
+			obj, ok := v.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("%s is not an object", at)
+			}
+			at += "." + s
+			if v, ok = obj[s]; !ok {
+				return fmt.Errorf("%s does not exist", at)
+			}
+		case int:
+			arr, ok := v.([]interface{})
+			if !ok {
+				return fmt.Errorf("%s is not an array", at)
+			}
+			at += fmt.Sprintf("[%d]", s)
+			index := s
+			if index < 0 {
+				index += len(arr)
+			}
+			if index < 0 || index >= len(arr) {
+				return fmt.Errorf("%s does not exist (length %d)", at, len(arr))
+			}
+			v = arr[index]
+		}
+	}
+
+	if p.length {
+		switch t := v.(type) {
+		case []interface{}:
+			v = float64(len(t))
+		case map[string]interface{}:
+			v = float64(len(t))
+		case string:
+			v = float64(utf8.RuneCountInString(t))
+		default:
+			return fmt.Errorf("%s has no length", at)
+		}
+		at += " | length"
+	}
+
+	if p.op == "" {
+		if v == nil {
+			return fmt.Errorf("%s is null", at)
+		}
+		return nil
+	}
+
+	ok, err := compareJSONValues(v, p.op, p.value)
+	if err != nil {
+		return fmt.Errorf("%s: %s", at, err)
+	}
+	if !ok {
+		actual, _ := json.Marshal(v)
+		return fmt.Errorf("%s is %s", at, excerpt(actual, 0))
+	}
+	return nil
+}
+
+// compareJSONValues compares a value of the document with a literal. Numbers
+// and strings can be ordered, other values only be tested for equality.
+func compareJSONValues(a interface{}, op string, b interface{}) (bool, error) {
+	var cmp int
+	switch x := a.(type) {
+	case float64:
+		y, ok := b.(float64)
+		if !ok {
+			return op == "!=", nil
+		}
+		switch {
+		case x < y:
+			cmp = -1
+		case x > y:
+			cmp = 1
+		}
+	case string:
+		y, ok := b.(string)
+		if !ok {
+			return op == "!=", nil
+		}
+		cmp = strings.Compare(x, y)
+	default:
+		if op != "==" && op != "!=" {
+			return false, fmt.Errorf("can't compare %T with %s", a, op)
+		}
+		return (a == b) == (op == "=="), nil
+	}
+
+	switch op {
+	case "==":
+		return cmp == 0, nil
+	case "!=":
+		return cmp != 0, nil
+	case ">":
+		return cmp > 0, nil
+	case ">=":
+		return cmp >= 0, nil
+	case "<":
+		return cmp < 0, nil
+	}
+	return cmp <= 0, nil
+}
+
+// checkJSONPath decodes the body as JSON, and evaluates the path against it.
+func checkJSONPath(p *jsonPath, expr string, body []byte) error {
+	var doc interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return fmt.Errorf("assertion failed for jsonpath `%s': response is not JSON (%s)", expr, err)
+	}
+	if err := p.eval(doc); err != nil {
+		return fmt.Errorf("assertion failed for jsonpath `%s': %s", expr, err)
+	}
+	return nil
+}
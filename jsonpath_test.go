@@ -0,0 +1,80 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestJSONPath(t *testing.T) {
+	body := []byte(`{"status": "ok", "count": 3, "items": [{"name": "a"}, {"name": "b"}],
+		"data": {"users": [{"active": true, "email": null}]}, "empty": []}`)
+
+	tests := []struct {
+		expr  string
+		valid bool
+	}{
+		{"$.status == 'ok'", true},
+		{`$.status == "down"`, false},
+		{"$.status != 'down'", true},
+		{"$.count >= 3", true},
+		{"$.count > 3", false},
+		{"$.items | length > 0", true},
+		{"$.empty | length > 0", false},
+		{"$.items[1].name == 'b'", true},
+		{"$.items[-1].name == 'b'", true},
+		{"$.items[2].name", false},
+		{"$['data'].users[0].active == true", true},
+		{"$.data.users[0].email", false},
+		{"$.data.users[0].email == null", true},
+		{"$.version", false},
+		{"$.status | length == 2", true},
+		{"$.count == '3'", false},
+	}
+	for _, test := range tests {
+		p, err := parseJSONPath(test.expr)
+		if err != nil {
+			t.Errorf("unexpected parse error for '%s': %s", test.expr, err)
+			continue
+		}
+		err = checkJSONPath(p, test.expr, body)
+		if test.valid && err != nil {
+			t.Errorf("expected '%s' to pass, got: %s", test.expr, err)
+		}
+		if !test.valid && err == nil {
+			t.Errorf("expected '%s' to fail", test.expr)
+		}
+	}
+
+	p, _ := parseJSONPath("$.status == 'ok'")
+	if err := checkJSONPath(p, "$.status == 'ok'", []byte("<html/>")); err == nil || !strings.Contains(err.Error(), "not JSON") {
+		t.Errorf("expected an error for a body which is not JSON, got %v", err)
+	}
+
+	invalid := []string{"status == 'ok'", "$.", "$[abc]", "$.items | count", "$.status = 'ok'", "$.status == ok", "$.items[0"}
+	for _, expr := range invalid {
+		if _, err := parseJSONPath(expr); err == nil {
+			t.Errorf("expected a parse error for '%s'", expr)
+		}
+	}
+}
+
+func TestJSONPathAssertion(t *testing.T) {
+	c := Config{Monitor: map[string]Monitor{
+		"api": {Name: "API", URL: "http://example.org", JSONPath: []string{"$.status == 'ok'"}},
+	}}
+	c.mergeAssertions()
+
+	a := c.Monitor["api"].Assertions[0]
+	if err := a.Validate(); err != nil || a.path == nil {
+		t.Fatalf("expected the jsonpath to be parsed, got %v", err)
+	}
+	body := []byte(`{"status": "down"}`)
+	if err := a.Check(200, nil, body, body); err == nil || !strings.Contains(err.Error(), `$.status is "down"`) {
+		t.Errorf("expected the actual value in the error, got %v", err)
+	}
+
+	invalid := Assertion{Type: AssertionJSONPath, Value: "status == 'ok'"}
+	if err := invalid.Validate(); err == nil {
+		t.Errorf("expected an error for an invalid jsonpath")
+	}
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The amount of slowest monitors listed in the report.
+const reportSlowest = 10
+
+// Report is the run report sent by e-mail: the totals, the slowest monitors,
+// and the failures. With the results of a previous run, failures are split in
+// new failures and monitors which are still failing.
+type Report struct {
+	RunSummary
+	Warnings      int
+	Slowest       []FailedMonitor // the slowest monitors, also when they succeeded
+	New           []FailedMonitor // failures which weren't failing in the previous run
+	StillFailing  []FailedMonitor // failures which were failing in the previous run as well
+	HasPrevious   bool            // whether the results of a previous run were given
+	ConfigResults []ConfigurationResult
+}
+
+// Returns the key of a monitor in the results of runs.
+func reportKey(configName, monitorName string) string {
+	return configName + "\n" + monitorName
+}
+
+// ReadPreviousFailures reads the JSON output (-format json) of a previous run,
+// and returns the monitors which failed in it.
+func ReadPreviousFailures(file string) (map[string]bool, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var previous []struct {
+		ConfigurationName string
+		Results           []struct {
+			Monitor struct{ Name string }
+			Error   *string
+		}
+	}
+	if err := json.Unmarshal(b, &previous); err != nil {
+		return nil, fmt.Errorf("unable to parse previous results `%s': %s", file, err)
+	}
+
+	failed := make(map[string]bool)
+	for _, cr := range previous {
+		for _, r := range cr.Results {
+			if r.Error != nil {
+				failed[reportKey(cr.ConfigurationName, r.Monitor.Name)] = true
+			}
+		}
+	}
+	return failed, nil
+}
+
+// NewReport creates the report of the results. The previous failures are nil
+// when there are no results of a previous run.
+func NewReport(configResults []ConfigurationResult, previous map[string]bool) Report {
+	r := Report{RunSummary: NewRunSummary(configResults), HasPrevious: previous != nil, ConfigResults: configResults}
+
+	for _, cr := range configResults {
+		for _, res := range cr.Results {
+			if len(res.Warnings) > 0 {
+				r.Warnings++
+			}
+			r.Slowest = append(r.Slowest, FailedMonitor{cr.ConfigurationName, res})
+		}
+	}
+	sort.SliceStable(r.Slowest, func(i, j int) bool {
+		return r.Slowest[i].Result.Latency > r.Slowest[j].Result.Latency
+	})
+	if len(r.Slowest) > reportSlowest {
+		r.Slowest = r.Slowest[:reportSlowest]
+	}
+
+	for _, f := range r.Failed {
+		if previous[reportKey(f.ConfigurationName, f.Result.Monitor.Name)] {
+			r.StillFailing = append(r.StillFailing, f)
+		} else {
+			r.New = append(r.New, f)
+		}
+	}
+	return r
+}
+
+// The HTML of the report e-mail.
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif">
+<h2>{{.Title}}</h2>
+<table cellpadding="4">
+<tr><td>Monitors</td><td>{{.Total}}</td></tr>
+<tr><td>Successes</td><td>{{.Successes}}</td></tr>
+<tr><td>Failures</td><td>{{.Failures}}</td></tr>
+<tr><td>Warnings</td><td>{{.Warnings}}</td></tr>
+</table>
+{{- define "failures"}}
+<table cellpadding="4" border="1" style="border-collapse: collapse">
+<tr><th>Configuration</th><th>Monitor</th><th>Owner</th><th>Code</th><th>Error</th></tr>
+{{- range .}}
+<tr><td>{{.ConfigurationName}}</td><td>{{.Result.Monitor.Name}}</td><td>{{.Result.Monitor.Owner}}</td><td>{{.Result.Code}}</td><td>{{.Result.Error}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+{{- if .HasPrevious}}
+<h3>New failures</h3>
+{{- if .New}}{{template "failures" .New}}{{else}}
+<p>None</p>
+{{- end}}
+<h3>Still failing</h3>
+{{- if .StillFailing}}{{template "failures" .StillFailing}}{{else}}
+<p>None</p>
+{{- end}}
+{{- else if .Failed}}
+<h3>Failures</h3>
+{{- template "failures" .Failed}}
+{{- end}}
+<h3>Slowest monitors</h3>
+<table cellpadding="4" border="1" style="border-collapse: collapse">
+<tr><th>Configuration</th><th>Monitor</th><th>Latency</th></tr>
+{{- range .Slowest}}
+<tr><td>{{.ConfigurationName}}</td><td>{{.Result.Monitor.Name}}</td><td>{{.Result.Latency}} ms</td></tr>
+{{- end}}
+</table>
+</body>
+</html>
+`))
+
+// HTML renders the report as an HTML document.
+func (r Report) HTML() (string, error) {
+	var buf bytes.Buffer
+	err := reportTemplate.Execute(&buf, r)
+	return buf.String(), err
+}
+
+// Attachments returns the results as JSON and CSV files, by file name.
+func (r Report) Attachments() (map[string][]byte, error) {
+	results := make([]ConfigurationResult, len(r.ConfigResults))
+	for i, cr := range r.ConfigResults {
+		results[i] = ConfigurationResult{ConfigurationName: cr.ConfigurationName, Results: make([]Result, len(cr.Results))}
+		for j, res := range cr.Results {
+			res.Time = timestamps.In(res.Time)
+			results[i].Results[j] = res
+		}
+	}
+	b, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling json: %s", err)
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	for _, cr := range r.ConfigResults {
+		for _, res := range cr.Results {
+			w.Write(csvRecord(res))
+		}
+	}
+	w.Flush()
+
+	return map[string][]byte{"results.json": b, "results.csv": buf.Bytes()}, w.Error()
+}
+
+// Returns b base64 encoded, in lines of 76 characters as required by MIME.
+func base64Lines(b []byte) []byte {
+	s := base64.StdEncoding.EncodeToString(b)
+	var buf bytes.Buffer
+	for len(s) > 76 {
+		buf.WriteString(s[:76] + "\r\n")
+		s = s[76:]
+	}
+	buf.WriteString(s + "\r\n")
+	return buf.Bytes()
+}
+
+// The content types of the attachments, by extension.
+var attachmentTypes = map[string]string{
+	".json": "application/json",
+	".csv":  "text/csv; charset=utf-8",
+}
+
+// buildMail creates a MIME message with the HTML as body, and the given
+// attachments.
+func buildMail(from string, to []string, subject, html string, attachments map[string][]byte, date time.Time) ([]byte, error) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+
+	pw, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/html; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	qw := quotedprintable.NewWriter(pw)
+	qw.Write([]byte(html))
+	qw.Close()
+
+	names := make([]string, 0, len(attachments))
+	for name := range attachments {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		contentType, found := attachmentTypes[path.Ext(name)]
+		if !found {
+			contentType = "application/octet-stream"
+		}
+		pw, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {contentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": name})},
+		})
+		if err != nil {
+			return nil, err
+		}
+		pw.Write(base64Lines(attachments[name]))
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: multipart/mixed; boundary=%s\r\n", mw.Boundary())
+	fmt.Fprintf(&msg, "\r\n")
+	msg.Write(body.Bytes())
+	return msg.Bytes(), nil
+}
+
+// Mailer sends the run report by e-mail over SMTP. When a user is given,
+// it authenticates with PLAIN authentication, which Go only allows over TLS
+// (STARTTLS) or to localhost.
+type Mailer struct {
+	Addr     string // host:port of the SMTP server
+	From     string
+	To       []string
+	User     string
+	Password string
+}
+
+// Send sends the report, with the results attached.
+func (m Mailer) Send(r Report) error {
+	html, err := r.HTML()
+	if err != nil {
+		return fmt.Errorf("unable to render the report: %s", err)
+	}
+	attachments, err := r.Attachments()
+	if err != nil {
+		return err
+	}
+	msg, err := buildMail(m.From, m.To, r.Title(), html, attachments, time.Now())
+	if err != nil {
+		return fmt.Errorf("unable to create the report e-mail: %s", err)
+	}
+
+	var auth smtp.Auth
+	if m.User != "" {
+		host, _, err := net.SplitHostPort(m.Addr)
+		if err != nil {
+			return fmt.Errorf("invalid SMTP server `%s': %s", m.Addr, err)
+		}
+		auth = smtp.PlainAuth("", m.User, m.Password, host)
+	}
+	err = smtp.SendMail(m.Addr, auth, m.From, m.To, msg)
+	if err != nil {
+		return fmt.Errorf("unable to send the report e-mail via `%s': %s", m.Addr, err)
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func reportResults() []ConfigurationResult {
+	return []ConfigurationResult{
+		{ConfigurationName: "Shop", Results: []Result{
+			{Monitor: Monitor{Name: "Home"}, Latency: 120},
+			{Monitor: Monitor{Name: "Cart"}, Latency: 900, Error: ResultError{errors.New("timeout after 900 ms")}},
+			{Monitor: Monitor{Name: "Search"}, Latency: 300, Error: ResultError{errors.New("assertion failed for regex `<results>'")}},
+		}},
+	}
+}
+
+func TestNewReport(t *testing.T) {
+	r := NewReport(reportResults(), map[string]bool{reportKey("Shop", "Cart"): true})
+	if r.Total != 3 || r.Failures != 2 || !r.HasPrevious {
+		t.Errorf("unexpected totals %+v", r.RunSummary)
+	}
+	if len(r.New) != 1 || r.New[0].Result.Monitor.Name != "Search" {
+		t.Errorf("expected Search to be a new failure, got %+v", r.New)
+	}
+	if len(r.StillFailing) != 1 || r.StillFailing[0].Result.Monitor.Name != "Cart" {
+		t.Errorf("expected Cart to be still failing, got %+v", r.StillFailing)
+	}
+	if r.Slowest[0].Result.Monitor.Name != "Cart" || r.Slowest[2].Result.Monitor.Name != "Home" {
+		t.Errorf("expected the monitors ordered by latency, got %+v", r.Slowest)
+	}
+
+	html, err := r.HTML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"New failures", "Still failing", "<td>900 ms</td>", "regex `&lt;results&gt;&#39;"} {
+		if !strings.Contains(html, expected) {
+			t.Errorf("expected '%s' in the report, got:\n%s", expected, html)
+		}
+	}
+
+	// without previous results, there's just a list of failures.
+	html, _ = NewReport(reportResults(), nil).HTML()
+	if strings.Contains(html, "New failures") || !strings.Contains(html, "<h3>Failures</h3>") {
+		t.Errorf("expected a plain list of failures, got:\n%s", html)
+	}
+}
+
+func TestReadPreviousFailures(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hmon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := path.Join(dir, "previous.json")
+	results := reportResults()
+	if err := writeJSON(file, &results); err != nil {
+		t.Fatal(err)
+	}
+	failed, err := ReadPreviousFailures(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failed) != 2 || !failed[reportKey("Shop", "Cart")] || !failed[reportKey("Shop", "Search")] {
+		t.Errorf("expected Cart and Search to have failed, got %v", failed)
+	}
+}
+
+func TestBuildMail(t *testing.T) {
+	attachments := map[string][]byte{"results.csv": []byte("OK,Home\n"), "results.json": []byte(strings.Repeat("[]", 100))}
+	b, err := buildMail("hmon@example.org", []string{"ops@example.org", "dev@example.org"}, "hmon: 1 of 3 monitors failed", "<p>Réport</p>", attachments, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(string(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if to, _ := msg.Header.AddressList("To"); len(to) != 2 {
+		t.Errorf("expected two recipients, got %v", to)
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/mixed" {
+		t.Fatalf("expected a multipart message, got %s (%v)", mediaType, err)
+	}
+
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	var parts []string
+	for {
+		p, err := mr.NextPart()
+		if err != nil {
+			break
+		}
+		content, _ := ioutil.ReadAll(p)
+		if p.Header.Get("Content-Transfer-Encoding") == "base64" {
+			content, _ = base64.StdEncoding.DecodeString(strings.Replace(string(content), "\r\n", "", -1))
+		}
+		parts = append(parts, p.FileName()+"|"+string(content))
+	}
+	if len(parts) != 3 || parts[0] != "|<p>Réport</p>" || parts[1] != "results.csv|OK,Home\n" || !strings.HasPrefix(parts[2], "results.json|[][]") {
+		t.Errorf("unexpected parts %q", parts)
+	}
+}
+
+// Runs an SMTP server accepting a single message, which is sent to the
+// returned channel.
+func fakeSMTPServer(t *testing.T) (string, chan string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages := make(chan string, 1)
+	go func() {
+		defer l.Close()
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		conn.Write([]byte("220 localhost ESMTP\r\n"))
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+			case cmd == "DATA":
+				conn.Write([]byte("354 go ahead\r\n"))
+				var data strings.Builder
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil || line == ".\r\n" {
+						break
+					}
+					data.WriteString(line)
+				}
+				messages <- data.String()
+				conn.Write([]byte("250 queued\r\n"))
+			case cmd == "QUIT":
+				conn.Write([]byte("221 bye\r\n"))
+				return
+			default:
+				conn.Write([]byte("250 ok\r\n"))
+			}
+		}
+	}()
+	return l.Addr().String(), messages
+}
+
+func TestMailerSend(t *testing.T) {
+	addr, messages := fakeSMTPServer(t)
+
+	m := Mailer{Addr: addr, From: "hmon@example.org", To: []string{"ops@example.org"}}
+	if err := m.Send(NewReport(reportResults(), nil)); err != nil {
+		t.Fatal(err)
+	}
+	msg := <-messages
+	if !strings.Contains(msg, "Subject: hmon: 2 of 3 monitors failed") || !strings.Contains(msg, "filename=results.json") {
+		t.Errorf("unexpected message:\n%s", msg)
+	}
+}
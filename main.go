@@ -1,42 +1,148 @@
 package main
 
 import (
-	"encoding/csv"
+	"bytes"
+	"crypto/ed25519"
 	"encoding/json"
 	"encoding/xml"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"net"
+	"net/http/httptest"
 	"os"
 	"path"
+	"sort"
 	"strconv"
 	"strings"
+	"text/template"
 	"time"
 )
 
 // the version string for hmon.
 const VERSION string = "1.2.0"
 
+// The exit codes of hmon, so wrapper scripts can tell why a run failed.
+const (
+	ExitOK         = 0 // all monitors succeeded
+	ExitUsage      = 1 // invalid flags or arguments, or configurations which can't be read
+	ExitValidation = 2 // the configurations are invalid
+	ExitFailures   = 3 // one or more monitors failed
+	ExitInternal   = 4 // hmon itself failed, like writing the output
+)
+
 // cmdline flag variables
 var (
-	flagConf         = flag.String("conf", "", "Single configuration file. This param takes precedence over -confdir.")
-	flagConfdir      = flag.String("confdir", ".", "Directory with configurations of *_hmon.xml files.")
-	flagFiledir      = flag.String("filedir", ".", "Base directory to search for request files. If ommited, the current working directory is used.")
-	flagValidateOnly = flag.Bool("validate", false, "When specified, only validate the configuration file(s), but don't run the monitors.")
-	flagOutput       = flag.String("output", "", "Output file or directory. If empty, output will be done to stdout only.")
-	flagFormat       = flag.String("format", "", "Output format ('csv', 'json', 'pandora'). Only suitable in combination with -output.")
-	flagVersion      = flag.Bool("version", false, "Prints out version number and exits (discards other flags).")
-	flagSequential   = flag.Bool("sequential", false, "When set, execute monitors in sequential order (not recommended for speed).")
-	flagVerbose      = flag.Bool("verbose", false, "Set verbose output. Helpful to see input and output being sent and received.")
+	flagConf           = flag.String("conf", "", "Single configuration file. This param takes precedence over -confdir.")
+	flagConfdir        = flag.String("confdir", ".", "Directory with configurations of *_hmon.toml files.")
+	flagFiledir        = flag.String("filedir", ".", "Base directory to search for request files. If ommited, the current working directory is used.")
+	flagValidateOnly   = flag.Bool("validate", false, "When specified, only validate the configuration file(s), but don't run the monitors.")
+	flagOutput         = flag.String("output", "", "Output file or directory. If empty, output will be done to stdout only.")
+	flagFormat         = flag.String("format", "", "Output format ('csv', 'json', 'jsonl', 'ndjson', 'pandora', 'syslog', 'prometheus', 'template'). Only suitable in combination with -output.")
+	flagVersion        = flag.Bool("version", false, "Prints out version number and exits (discards other flags).")
+	flagSequential     = flag.Bool("sequential", false, "When set, execute monitors in sequential order (not recommended for speed).")
+	flagInsecure       = flag.Bool("insecure", false, "When set, the certificates of servers are not verified.")
+	flagNoEnvProxy     = flag.Bool("no-env-proxy", false, "When set, the proxies of HTTP_PROXY, HTTPS_PROXY and NO_PROXY are not used.")
+	flagPerHost        = flag.Bool("per-host", false, "When set, monitors of the same host run one at a time, while different hosts run in parallel.")
+	flagWorkers        = flag.Int("workers", 0, "Maximum amount of monitors running in parallel. Zero means no limit.")
+	flagVerbose        = flag.Bool("verbose", false, "Set verbose output. Helpful to see input and output being sent and received.")
+	flagNotifyTeams    = flag.String("notify-teams", "", "Microsoft Teams webhook URL to post a card to when monitors have failed.")
+	flagNotifyWebhook  = flag.String("notify-webhook", "", "URL to post a generic JSON notification to when monitors have failed.")
+	flagNotifyTemplate = flag.String("notify-template", "", "File with a Go text/template used to render the notification text.")
+	flagMailTo         = flag.String("mail-to", "", "Comma separated e-mail addresses to send the run report to.")
+	flagMailFrom       = flag.String("mail-from", "hmon@localhost", "Sender address of the run report e-mail.")
+	flagMailSMTP       = flag.String("mail-smtp", "localhost:25", "SMTP server (host:port) to send the run report e-mail through.")
+	flagMailUser       = flag.String("mail-user", "", "User to authenticate to the SMTP server with. The password is read from HMON_MAIL_PASSWORD.")
+	flagMailPrevious   = flag.String("mail-previous", "", "JSON results (-format json) of a previous run, to tell new failures apart in the report.")
+	flagHeartbeat      = flag.String("heartbeat", "", "URL to request after every completed run, to be alerted when hmon stops running.")
+	flagSnmpTrap       = flag.String("snmp-trap", "", "Host (and optional port) of an SNMP manager to send v2c traps for failed monitors to.")
+	flagSnmpCommunity  = flag.String("snmp-community", "public", "SNMP community string used for traps.")
+	flagSnmpOID        = flag.String("snmp-oid", "", "Base OID for traps and objects. If empty, an OID in the netSnmpPlaypen arc is used.")
+	flagSnmpClear      = flag.Bool("snmp-clear", false, "When set, also send traps for successful monitors, to clear earlier failures.")
+	flagStatsd         = flag.String("statsd", "", "Host (and optional port) of a StatsD server to send the latency and a success or failure counter of every monitor to.")
+	flagStatsdPrefix   = flag.String("statsd-prefix", "hmon", "Prefix of the names of the StatsD metrics.")
+	flagDogStatsD      = flag.Bool("dogstatsd", false, "When set, the configuration, monitor, owner and failure code are sent as DogStatsD tags, instead of in the metric names.")
+	flagSign           = flag.String("sign", "", "PEM encoded ed25519 private key to sign the JSON output with. The signature is written to <output>.sig.")
+	flagEnv            = flag.String("env", "", "Environment to run monitors with environments in. If empty, they run in all their environments.")
+	flagMaxBody        = flag.Int64("max-body", 0, "Maximum amount of bytes of a response body to read, for monitors without a read_limit. Zero means no limit.")
+	flagSecurityPolicy = flag.String("security-policy", "", "TOML file with the policy for monitors with 'security_audit = true'. If empty, the default policy is used.")
+	flagTimezone       = flag.String("timezone", "", "Time zone of the timestamps in the output, like 'UTC' or 'Europe/Amsterdam'. If empty, the local time zone is used.")
+	flagTimeFormat     = flag.String("time-format", TimeFormatRFC3339, "Format of the timestamps in the output: 'rfc3339', 'unix', 'unixms' or a Go time layout.")
+	flagSaveFailures   = flag.String("save-failures", "", "Directory to save the full request and response of failed monitors to.")
+	flagExclude        = flag.String("exclude", "", "File with monitor name globs (or 'host:' prefixed host globs) to skip for this run.")
+	flagDNSPrefetch    = flag.Bool("dns-prefetch", false, "When set, all hosts are resolved once before the run, and the addresses are shared by the monitors.")
+	flagDNSTTL         = flag.Int("dns-ttl", 0, "Seconds the addresses resolved with -dns-prefetch are used, before a host is resolved again. Zero means the whole run.")
+	flagOTLP           = flag.String("otlp", "", "Base URL of an OpenTelemetry collector (OTLP over HTTP, like http://localhost:4318) to export the runs of the monitors to.")
+	flagOTLPSignals    = flag.String("otlp-signals", "traces,metrics", "Comma separated signals to export with -otlp: 'traces' (a span per monitor run) and 'metrics'.")
+	flagTemplate       = flag.String("template", "", "File with a Go text/template to render the results with, for the 'template' format.")
+	flagHistory        = flag.String("history", "", "JSON file with the results of the last run. When it exists, the summary compares this run with it. It's replaced by the results of this run.")
+	flagChaosTolerance = flag.Int("chaos-tolerance", 0, "When set, runs a chaos test: all monitors go through a local proxy which never answers, and must time out within this many ms.")
 )
 
+// The host overrides given with the -host-override flag(s).
+var flagHostOverride = hostOverrides{}
+
+// The globs given with the -skip and -skip-host flag(s).
+var flagSkip, flagSkipHost globs
+
+func init() {
+	flag.Var(flagHostOverride, "host-override", "Rewrites a host in all monitor URLs, as 'original=replacement'. Can be given multiple times.")
+	flag.Var(&flagSkip, "skip", "Skips the monitors with a name matching the glob. Can be given multiple times.")
+	flag.Var(&flagSkipHost, "skip-host", "Skips the monitors with a URL host matching the glob. Can be given multiple times.")
+}
+
+// hostOverrides is a flag.Value collecting 'original=replacement' host pairs.
+type hostOverrides map[string]string
+
+func (h hostOverrides) String() string {
+	var pairs []string
+	for from, to := range h {
+		pairs = append(pairs, from+"="+to)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// Set adds one or more (comma separated) 'original=replacement' pairs.
+func (h hostOverrides) Set(value string) error {
+	for _, pair := range strings.Split(value, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" || strings.TrimSpace(parts[1]) == "" {
+			return fmt.Errorf("expected 'original=replacement', got '%s'", pair)
+		}
+		h[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	return nil
+}
+
+// globs is a flag.Value collecting one or more (comma separated) globs.
+type globs []string
+
+func (g *globs) String() string {
+	return strings.Join(*g, ",")
+}
+
+// Set adds one or more (comma separated) globs.
+func (g *globs) Set(value string) error {
+	for _, glob := range strings.Split(value, ",") {
+		glob = strings.TrimSpace(glob)
+		if _, err := path.Match(glob, ""); glob == "" || err != nil {
+			return fmt.Errorf("invalid glob '%s'", glob)
+		}
+		*g = append(*g, glob)
+	}
+	return nil
+}
+
 // Validates all configurations in the slice. For every failed validation,
-// print it out to stdout. If any failures occured, simply bail out with exitcode 1.
-func validateConfigurations(configurations *[]Config) {
+// print it out to w. Returns the exit code: ExitValidation if any failures
+// occured, ExitUsage without any configurations and ExitOK otherwise.
+func validateConfigurations(w io.Writer, configurations *[]Config) int {
 	if len(*configurations) == 0 {
-		fmt.Printf("No configurations found were found in `%s'\n", *flagConfdir)
-		fmt.Printf("Note that only files with suffix *_hmon.xml are parsed.\n")
-		os.Exit(1)
+		fmt.Fprintf(w, "No configurations found were found in `%s'\n", *flagConfdir)
+		fmt.Fprintf(w, "Note that only files with suffix *_hmon.toml are parsed.\n")
+		return ExitUsage
 	}
 
 	// boolean indicating that configurations are not valid.
@@ -49,14 +155,18 @@ func validateConfigurations(configurations *[]Config) {
 		if err != nil {
 			// we got validation errors.
 			verr := err.(ValidationError)
-			fmt.Printf("%s: %s\n", c.FileName, verr)
+			fmt.Fprintf(w, "%s: %s\n", c.FileName, verr)
 			for i := range verr.ErrorList {
-				fmt.Printf("  %s\n", verr.ErrorList[i])
+				fmt.Fprintf(w, "  %s\n", verr.ErrorList[i])
 				totalerrs++
 			}
 
 			success = false
-			fmt.Println()
+			fmt.Fprintln(w)
+		}
+
+		for _, warning := range c.Warnings() {
+			fmt.Fprintf(w, "%s: warning: %s\n", c.FileName, warning)
 		}
 	}
 
@@ -67,7 +177,7 @@ func validateConfigurations(configurations *[]Config) {
 	for _, c := range *configurations {
 		filename, foundInMap := mapConfigNames[c.Name]
 		if foundInMap {
-			fmt.Printf("%s: hmonconfig name '%s' is already defined in file '%s'\n", c.FileName, c.Name, filename)
+			fmt.Fprintf(w, "%s: hmonconfig name '%s' is already defined in file '%s'\n", c.FileName, c.Name, filename)
 			success = false
 			totalerrs++
 		} else {
@@ -80,19 +190,10 @@ func validateConfigurations(configurations *[]Config) {
 		if totalerrs <= 1 {
 			plural = "error"
 		}
-		fmt.Printf("\nFailed due to a total of %d validation %s.\n", totalerrs, plural)
-		os.Exit(1)
-	}
-
-	// Is a flag provided that we only should do configuration validation?
-	if *flagValidateOnly {
-		// if so, no point in continuing. Exit code 0 to indicate an a-okay.
-		fmt.Printf("All configuration files (%d) are correctly validated:\n", len(*configurations))
-		for _, c := range *configurations {
-			fmt.Printf("  %s\n", c.FileName)
-		}
-		os.Exit(0)
+		fmt.Fprintf(w, "\nFailed due to a total of %d validation %s.\n", totalerrs, plural)
+		return ExitValidation
 	}
+	return ExitOK
 }
 
 // Writes a non-specialized format to the given filename.
@@ -102,50 +203,56 @@ func writeDefault(filename string, r *[]ConfigurationResult) error {
 	return nil
 }
 
-// Writes the slice of results to the given filename as Json.
-// Any error will exit the program with exitcode 1.
-func writeJSON(filename string, r *[]ConfigurationResult) error {
-	b, err := json.MarshalIndent(r, "  ", "  ")
+// The data of a templated output filename.
+type outputNameData struct {
+	Config string // the name of the configuration, usable in a filename
+	Format string // the output format
+}
+
+// parseOutputTemplate returns the template of the output filename when it
+// contains template actions, like "results/{{.Config}}.json". It returns nil
+// when all results are written to a single file.
+func parseOutputTemplate(output string) (*template.Template, error) {
+	if !strings.Contains(output, "{{") {
+		return nil, nil
+	}
+	tmpl, err := template.New("output").Parse(output)
 	if err != nil {
-		return fmt.Errorf("error marshaling json: %s", err)
+		return nil, fmt.Errorf("invalid -output template `%s': %s", output, err)
 	}
+	return tmpl, nil
+}
 
-	err = ioutil.WriteFile(filename, b, 0644)
+// outputFile renders the output filename for the configuration.
+func outputFile(tmpl *template.Template, configName, format string) (string, error) {
+	var buf bytes.Buffer
+	err := tmpl.Execute(&buf, outputNameData{unsafeFileChars.ReplaceAllString(configName, "_"), format})
 	if err != nil {
-		return fmt.Errorf("unable to write to file `%s': %s\n", filename, err)
+		return "", fmt.Errorf("unable to render -output template: %s", err)
 	}
-
-	return nil
+	return buf.String(), nil
 }
 
-// Writes the slice of results to the given filename as CSV. If any error
-// occurs, exit with code 1.
-func writeCsv(filename string, results *[]ConfigurationResult) error {
-	f, err := os.Create(filename)
-
+// Writes the slice of results to the given filename as Json.
+func writeJSON(filename string, r *[]ConfigurationResult) error {
+	for _, cr := range *r {
+		for i := range cr.Results {
+			cr.Results[i].Time = timestamps.In(cr.Results[i].Time)
+		}
+	}
+	b, err := json.MarshalIndent(r, "  ", "  ")
 	if err != nil {
-		return fmt.Errorf("unable to open file for writing `%s': %s\n", filename, err)
+		return fmt.Errorf("error marshaling json: %s", err)
 	}
 
-	w := csv.NewWriter(f)
-
-	for _, r := range *results {
-		for _, res := range r.Results {
-			status := "FAIL"
-			if res.Error == nil {
-				status = "OK"
-			}
-
-			record := []string{
-				status,
-				res.Monitor.Name,
-				res.Monitor.URL,
-				strconv.FormatInt(res.Latency, 10),
-			}
-			w.Write(record)
-		}
+	if filename == stdoutOutput {
+		_, err = os.Stdout.Write(append(b, '\n'))
+	} else {
+		err = ioutil.WriteFile(filename, b, 0644)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to write to file `%s': %s", filename, err)
 	}
-	w.Flush()
 
 	return nil
 }
@@ -175,21 +282,24 @@ func writePandoraAgents(outdir string, results *[]ConfigurationResult) error {
 		pfmsAgent := PfmsAgent{}
 		pfmsAgent.AgentName = result.ConfigurationName
 		pfmsAgent.GroupName = "Web Services" // ugh, currently hardcoded. Ah well, we'll fix that later.
+		pfmsAgent.Timestamp = timestamps.In(time.Now()).Format(pandoraTimeLayout)
 
 		for _, actualResult := range result.Results {
 			module := PfmsModule{}
 			module.Name = actualResult.Monitor.Name
 			module.Description = actualResult.Monitor.Description
+			if context := actualResult.Monitor.FailureContext(); context != "" {
+				module.Description = strings.TrimSpace(module.Description + " " + context)
+			}
 
 			if actualResult.Error != nil {
-				module.Data = sanitizePandoraData(actualResult.Error.Error())
+				module.Data = sanitizePandoraData(actualResult.ErrorText())
 				module.Type = "generic_data_string" // indicates string data
-				module.Status = "CRITICAL"
 			} else {
 				module.Data = strconv.FormatInt(actualResult.Latency, 10)
 				module.Type = "generic_data" // this indicates numeric data
-				module.Status = "NORMAL"
 			}
+			module.Status = pandoraStatus(actualResult)
 
 			pfmsAgent.Modules = append(pfmsAgent.Modules, module)
 		}
@@ -197,27 +307,101 @@ func writePandoraAgents(outdir string, results *[]ConfigurationResult) error {
 		// write agent to file...
 		xmlBytes, err := xml.MarshalIndent(pfmsAgent, " ", "   ")
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Could not marshal PFMS data to bytes: %s\n", err)
-			os.Exit(1)
+			return fmt.Errorf("could not marshal PFMS data to bytes: %s", err)
 		}
 		// As of PandoraFMS 5.0? The filename HAS to be named '$NAME.$TIMESTAMP.data' for some reason :/
 		outputFile := fmt.Sprintf("%s.%d.data", result.ConfigurationName, time.Now().Unix())
 		outputPath := path.Join(outdir, outputFile)
 		err = ioutil.WriteFile(outputPath, xmlBytes, 0644)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Could not write to file: %s\n", err)
-			os.Exit(1)
+			return fmt.Errorf("could not write to file `%s': %s", outputPath, err)
 		}
 	}
 
 	return nil
 }
 
+// The structured data ID used in syslog messages. 32473 is the private
+// enterprise number reserved for documentation and examples (RFC 5612).
+const syslogSDID = "hmon@32473"
+
+// Escapes a syslog structured data parameter value (RFC 5424, section 6.3.3).
+func escapeSyslogParam(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, `"`, `\"`, -1)
+	return strings.Replace(s, "]", `\]`, -1)
+}
+
+// Formats a single result as a RFC 5424 syslog message. Successful monitors
+// are logged with severity 'informational', failed ones with 'error'.
+func formatSyslog(hostname string, configName string, res Result, t time.Time) string {
+	const facilityUser = 1
+	severity, status, errText := 6, "OK", ""
+	if res.Error != nil {
+		severity, status, errText = 3, "FAIL", res.Error.Error()
+	}
+
+	sd := fmt.Sprintf(`[%s config="%s" monitor="%s" url="%s" owner="%s" status="%s" latency="%d" code="%s" error="%s"]`,
+		syslogSDID,
+		escapeSyslogParam(configName),
+		escapeSyslogParam(res.Monitor.Name),
+		escapeSyslogParam(res.Monitor.URL),
+		escapeSyslogParam(res.Monitor.Owner),
+		status,
+		res.Latency,
+		res.Code,
+		escapeSyslogParam(errText))
+
+	return fmt.Sprintf("<%d>1 %s %s hmon %d result %s %s",
+		facilityUser*8+severity, t.Format(time.RFC3339), hostname, os.Getpid(), sd, res)
+}
+
+// Writes the results as syslog messages to the given address, one message per
+// result. The address has the form host:port (UDP), or tcp://host:port. When
+// using TCP, the messages are framed using octet counting (RFC 6587).
+func writeSyslog(address string, results *[]ConfigurationResult) error {
+	network := "udp"
+	if strings.HasPrefix(address, "tcp://") {
+		network = "tcp"
+	}
+	address = strings.TrimPrefix(strings.TrimPrefix(address, "tcp://"), "udp://")
+
+	conn, err := net.Dial(network, address)
+	if err != nil {
+		return fmt.Errorf("unable to connect to syslog `%s': %s", address, err)
+	}
+	defer conn.Close()
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "-"
+	}
+
+	for _, r := range *results {
+		for _, res := range r.Results {
+			msg := formatSyslog(hostname, r.ConfigurationName, res, timestamps.In(res.Time))
+			if network == "tcp" {
+				msg = fmt.Sprintf("%d %s", len(msg), msg)
+			}
+			_, err = conn.Write([]byte(msg))
+			if err != nil {
+				return fmt.Errorf("unable to write to syslog `%s': %s", address, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// The layout of the timestamp of PandoraFMS agent data.
+const pandoraTimeLayout = "2006/01/02 15:04:05"
+
 // PfmsAgent is the root node when serializing PandoraFMS agent data.
 type PfmsAgent struct {
 	XMLName   struct{}     `xml:"agent_data"`
 	AgentName string       `xml:"agent_name,attr"`
 	GroupName string       `xml:"group,attr"`
+	Timestamp string       `xml:"timestamp,attr,omitempty"` // in the time zone of the timestamps
 	Modules   []PfmsModule `xml:"module"`
 }
 
@@ -230,72 +414,203 @@ type PfmsModule struct {
 	Status      string `xml:"status,omitempty"` // NORMAL, WARNING or CRITICAL
 }
 
-// When the verbose flag is supplied, each monitor is getting this as a callback
-// to output TODO: dox
-func verboseCallback(monitor *Monitor, input, output []byte) {
-	fmt.Printf("=================\n")
-	fmt.Printf("Monitor '%s'\n", monitor.Name)
-	fmt.Printf("INPUT:\n%s\n", string(input))
-	fmt.Printf("OUTPUT:\n%s\n", string(output))
-	fmt.Printf("=================\n")
+// When the verbose flag is supplied, each monitor is getting the returned
+// callback, which writes the input and output of the monitor to w.
+func verboseCallback(w io.Writer) func(*Monitor, []byte, []byte) {
+	return func(monitor *Monitor, input, output []byte) {
+		fmt.Fprintf(w, "=================\n")
+		fmt.Fprintf(w, "Monitor '%s'\n", monitor.Name)
+		fmt.Fprintf(w, "INPUT:\n%s\n", string(input))
+		fmt.Fprintf(w, "OUTPUT:\n%s\n", string(output))
+		fmt.Fprintf(w, "=================\n")
+	}
 }
 
-// Run the given monitors in sequential order, and return the results.
-func runSequential(filedir string, config Config, verbose bool) ConfigurationResult {
+// Prints the owner, runbook and notes of a failed monitor, the server timings
+// and the checks of the security audit of the result, if any, to w.
+func printDetails(w io.Writer, result Result) {
+	if result.Error != nil {
+		if result.Monitor.Owner != "" {
+			fmt.Fprintf(w, "      owner: %s\n", result.Monitor.Owner)
+		}
+		if result.Monitor.Runbook != "" {
+			fmt.Fprintf(w, "      runbook: %s\n", result.Monitor.Runbook)
+		}
+		if result.Monitor.Notes != "" {
+			fmt.Fprintf(w, "      notes: %s\n", result.Monitor.Notes)
+		}
+		if result.FailureFile != "" {
+			fmt.Fprintf(w, "      saved to: %s\n", result.FailureFile)
+		}
+	}
+	if len(result.ServerTimings) > 0 {
+		fmt.Fprintf(w, "      server timing: %s\n", formatServerTimings(result.ServerTimings))
+	}
+	for _, check := range result.Audit {
+		status := "pass"
+		if !check.Passed {
+			status = "FAIL"
+		}
+		if check.Detail != "" {
+			fmt.Fprintf(w, "      %s  %s (%s)\n", status, check.Name, check.Detail)
+		} else {
+			fmt.Fprintf(w, "      %s  %s\n", status, check.Name)
+		}
+	}
+}
+
+// Run the given monitors in sequential order, and return the results, which
+// are printed to w. Every result is passed to emit (if not nil) as soon as
+// the monitor completes.
+// The run variables are expanded in every monitor, and the variables it
+// captures are available to the monitors after it.
+func runSequential(w io.Writer, filedir string, config Config, verbose bool, vars map[string]string, emit func(Result)) ConfigurationResult {
 	// receiver channel
 	ch := make(chan Result)
 
 	results := ConfigurationResult{}
 	results.ConfigurationName = config.Name
 
-	for _, mon := range config.Monitor {
+	for _, mon := range config.SortedMonitors() {
 		if verbose {
-			mon.Callback = verboseCallback
+			mon.Callback = verboseCallback(w)
 		}
-		go mon.Run(filedir, ch)
+		go mon.withVariables(vars).Run(filedir, ch)
 		// immediately receive from the channel
 		result := <-ch
+		mergeCaptured(vars, result)
 		results.Results = append(results.Results, result)
-		fmt.Printf("%s\n", result)
+		fmt.Fprintf(w, "%s\n", result)
+		printDetails(w, result)
+		if emit != nil {
+			emit(result)
+		}
 	}
 
 	return results
 }
 
-func runParallel(filedir string, config Config, verbose bool) ConfigurationResult {
+// Run the given monitors in parallel, and return the results, which are
+// printed to w. When workers is larger than zero, at most that many monitors
+// run at the same time. Monitors are started in order of priority, and the
+// results are sorted that way too.
+// Every result is passed to emit (if not nil) as soon as the monitor completes.
+// The run variables captured before are expanded in every monitor. Variables
+// captured by these monitors are only available to later configurations.
+// When perHost is set, the monitors of a single host run one after another,
+// while monitors of different hosts still run in parallel.
+func runParallel(w io.Writer, filedir string, config Config, verbose bool, workers int, perHost bool, vars map[string]string, emit func(Result)) ConfigurationResult {
 	// receiver channel
 	ch := make(chan Result, len(config.Monitor))
 
 	results := ConfigurationResult{}
 	results.ConfigurationName = config.Name
 
-	for _, mon := range config.Monitor {
-		// fire all goroutines first
+	// the semaphore which limits the amount of concurrently running monitors.
+	var sem chan bool
+	if workers > 0 {
+		sem = make(chan bool, workers)
+	}
+
+	// fire all goroutines first, but the receiving starts after the last one
+	// has been started. This is ok, since the receiver channel is buffered.
+	monitors := config.SortedMonitors()
+	for i := range monitors {
 		if verbose {
-			mon.Callback = verboseCallback
+			monitors[i].Callback = verboseCallback(w)
+		}
+		monitors[i] = monitors[i].withVariables(vars)
+	}
+	if perHost {
+		// every host gets a goroutine running its monitors in order. The
+		// workers are only taken when a monitor is about to run, so hosts
+		// waiting for their previous monitor don't hold any.
+		for _, group := range groupByHost(monitors) {
+			go func(group []Monitor) {
+				for _, mon := range group {
+					if sem != nil {
+						sem <- true
+					}
+					mon.Run(filedir, ch)
+					if sem != nil {
+						<-sem
+					}
+				}
+			}(group)
+		}
+	} else {
+		for _, mon := range monitors {
+			if sem != nil {
+				sem <- true
+			}
+			go func(mon Monitor) {
+				mon.Run(filedir, ch)
+				if sem != nil {
+					<-sem
+				}
+			}(mon)
 		}
-		go mon.Run(filedir, ch)
 	}
 
 	// then receive from the channel
-	for _ = range config.Monitor {
+	for _ = range monitors {
 		result := <-ch
+		mergeCaptured(vars, result)
 		results.Results = append(results.Results, result)
-		fmt.Printf("%s\n", result)
+		fmt.Fprintf(w, "%s\n", result)
+		printDetails(w, result)
+		if emit != nil {
+			emit(result)
+		}
 	}
 
+	sort.SliceStable(results.Results, func(i, j int) bool {
+		return results.Results[i].Monitor.Priority > results.Results[j].Monitor.Priority
+	})
+
 	return results
 }
 
-// Prints a short execution summary using all the results gathered.
-func printExecutionSummary(configResults []ConfigurationResult) {
+// groupByHost groups the monitors by the host they connect to, keeping the
+// order of the monitors within each group. Monitors with a backend address
+// (see SweepPools) are grouped by that address, since that's where the
+// connections go to.
+func groupByHost(monitors []Monitor) [][]Monitor {
+	var groups [][]Monitor
+	index := make(map[string]int)
+	for _, mon := range monitors {
+		host := mon.Backend
+		if host == "" {
+			host = strings.ToLower(hostname(mon.URL))
+		}
+		i, found := index[host]
+		if !found {
+			i = len(groups)
+			index[host] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], mon)
+	}
+	return groups
+}
+
+// Prints a short execution summary using all the results gathered to w.
+func printExecutionSummary(w io.Writer, configResults []ConfigurationResult, previous []reportedResult) {
 	var total int
 	var countOk int
 	var countFail int
+	var countWarn int
+	var bytesSent int64
+	var bytesReceived int64
 
 	for _, cr := range configResults {
 		for _, res := range cr.Results {
 			total++
+			bytesSent += res.BytesSent
+			bytesReceived += res.BytesReceived
+			if len(res.Warnings) > 0 {
+				countWarn++
+			}
 			if res.Error == nil {
 				countOk++
 			} else {
@@ -304,13 +619,166 @@ func printExecutionSummary(configResults []ConfigurationResult) {
 		}
 	}
 
-	fmt.Printf("\nExecution summary:\n")
-	fmt.Printf("Monitors:  %d\n", total)
-	fmt.Printf("Successes: %d\n", countOk)
-	fmt.Printf("Failures:  %d\n", countFail)
+	fmt.Fprintf(w, "\nExecution summary:\n")
+	fmt.Fprintf(w, "Monitors:  %d\n", total)
+	fmt.Fprintf(w, "Successes: %d\n", countOk)
+	fmt.Fprintf(w, "Failures:  %d\n", countFail)
+	fmt.Fprintf(w, "Warnings:  %d\n", countWarn)
+	fmt.Fprintf(w, "Sent:      %d bytes\n", bytesSent)
+	fmt.Fprintf(w, "Received:  %d bytes\n", bytesReceived)
+	if previous != nil {
+		fmt.Fprintf(w, "Trend:     %s\n", compareRuns(previous, configResults))
+	}
+
+	variables := collectVariables(configResults)
+	if len(variables) > 0 {
+		fmt.Fprintf(w, "\nVariables:\n")
+		for _, v := range variables {
+			if v.Consistent() {
+				fmt.Fprintf(w, "  %s = %s\n", v.Name, v.Values[0])
+				continue
+			}
+			fmt.Fprintf(w, "  %s is inconsistent:\n", v.Name)
+			for _, value := range v.Values {
+				fmt.Fprintf(w, "    %s (%s)\n", value, strings.Join(v.By[value], ", "))
+			}
+		}
+	}
 
 }
 
+// exitCode returns the exit code of a completed run: ExitFailures when any
+// monitor failed. In a chaos run all monitors fail, so only the problems of
+// the chaos run count.
+func exitCode(configResults []ConfigurationResult, chaosProblems []string) int {
+	if *flagChaosTolerance > 0 {
+		if len(chaosProblems) > 0 {
+			return ExitFailures
+		}
+		return ExitOK
+	}
+	for _, cr := range configResults {
+		for _, r := range cr.Results {
+			if r.Error != nil {
+				return ExitFailures
+			}
+		}
+	}
+	return ExitOK
+}
+
+// flagExitCode returns the exit code for an error parsing the flags of hmon or
+// a subcommand: ExitOK when only the help was asked for, and ExitUsage for
+// unknown or invalid flags. The flag package has printed the problem already.
+func flagExitCode(err error) int {
+	if err == flag.ErrHelp {
+		return ExitOK
+	}
+	return ExitUsage
+}
+
+// Creates the notifiers requested through the cmdline flags. All of them share
+// the same notification template, which is returned too, for the notify
+// targets of monitors.
+func createNotifiers() ([]Notifier, NotifyTemplate, error) {
+	var notifiers []Notifier
+
+	var text string
+	if *flagNotifyTemplate != "" {
+		b, err := ioutil.ReadFile(*flagNotifyTemplate)
+		if err != nil {
+			return nil, NotifyTemplate{}, fmt.Errorf("unable to read notification template: %s", err)
+		}
+		text = string(b)
+	}
+
+	tmpl, err := NewNotifyTemplate(text)
+	if err != nil {
+		return nil, NotifyTemplate{}, err
+	}
+
+	if *flagNotifyTeams != "" {
+		notifiers = append(notifiers, TeamsNotifier{*flagNotifyTeams, tmpl})
+	}
+	if *flagNotifyWebhook != "" {
+		notifiers = append(notifiers, WebhookNotifier{*flagNotifyWebhook, tmpl})
+	}
+
+	return notifiers, tmpl, nil
+}
+
+// Sends the run report by e-mail. Failing to send it is reported to w, but
+// doesn't stop the run.
+func sendReport(w io.Writer, configResults []ConfigurationResult) {
+	var previous map[string]bool
+	if *flagMailPrevious != "" {
+		var err error
+		previous, err = ReadPreviousFailures(*flagMailPrevious)
+		if err != nil {
+			// without the previous results, all failures are reported.
+			fmt.Fprintf(w, "Unable to read previous results: %s\n", err)
+		}
+	}
+
+	var to []string
+	for _, addr := range strings.Split(*flagMailTo, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			to = append(to, addr)
+		}
+	}
+	mailer := Mailer{
+		Addr:     *flagMailSMTP,
+		From:     *flagMailFrom,
+		To:       to,
+		User:     *flagMailUser,
+		Password: os.Getenv("HMON_MAIL_PASSWORD"),
+	}
+	err := mailer.Send(NewReport(configResults, previous))
+	if err != nil {
+		fmt.Fprintln(w, err)
+	}
+}
+
+// Sends the run summary to all notifiers, but only if any monitor failed.
+// Failing notifiers are reported to w, but don't stop the others. Monitors
+// with a notify target of their own are notified to that target only, in a
+// summary per target.
+func sendNotifications(w io.Writer, notifiers []Notifier, tmpl NotifyTemplate, configResults []ConfigurationResult) {
+	global, routed := routeResults(configResults)
+	notify := func(notifiers []Notifier, configResults []ConfigurationResult) {
+		summary := NewRunSummary(configResults)
+		if summary.Failures == 0 {
+			return
+		}
+		for _, n := range notifiers {
+			err := n.Notify(summary)
+			if err != nil {
+				fmt.Fprintf(w, "Failed to send notification: %s\n", err)
+			}
+		}
+	}
+
+	notify(notifiers, global)
+	for target, results := range routed {
+		notify(target.notifiers(tmpl), results)
+	}
+}
+
+// Sends a SNMP trap for each (failed) result. Sending stops at the first error,
+// since the remaining traps will most likely fail for the same reason, which
+// is reported to w.
+func sendTraps(w io.Writer, trapper *SnmpTrapper, configResults []ConfigurationResult) {
+	for _, cr := range configResults {
+		for _, res := range cr.Results {
+			err := trapper.Trap(cr.ConfigurationName, res, *flagSnmpClear)
+			if err != nil {
+				fmt.Fprintf(w, "Failed to send SNMP trap: %s\n", err)
+				return
+			}
+		}
+	}
+}
+
 // Entry point of this program.
 func main() {
 	// cmdline usage function. Prints out to stderr of course.
@@ -328,7 +796,54 @@ and -output, the tool can write to other output formats:
 
 -format=json:    Javascript Object Notation
 -format=csv:     Comma Separated Values
+-format=jsonl:   JSON lines, one result per line
+-format=ndjson:  the same as jsonl
 -format=pandora  PandoraFMS agent data (XML)
+-format=syslog   RFC 5424 syslog messages, -output is the host:port to send to
+-format=prometheus Prometheus text format, e.g. for the node exporter textfile collector
+-format=template Rendered with the Go text/template given with -template
+
+With -output -, the json, csv, jsonl, ndjson, prometheus and template formats are written
+to stdout, and the regular output to stderr:
+
+hmon -format json -output - | jq '.[].Results[] | select(.Error != null)'
+
+When monitors fail, a notification can be posted to a Microsoft Teams channel
+(-notify-teams) or any other webhook (-notify-webhook). SNMP v2c traps can be
+sent to a manager using -snmp-trap.
+
+JSON output can be signed with an ed25519 key using -sign. To check the
+signature of a results file afterwards, use:
+
+hmon verify -key public.pem results.json
+
+SoapUI projects can be converted to hmon configurations using:
+
+hmon convert soapui project.xml -out directory
+
+Curl command lines can be imported as monitors using:
+
+hmon import curl "curl -H 'Accept: application/json' https://example.org"
+
+A monitor can be shown as equivalent curl command using:
+
+hmon show -confdir directory -as-curl "Monitor name"
+
+The failures of the JSON results of a run can be reported per owner using:
+
+hmon report -by-owner results.json
+
+The installation can be verified against an embedded HTTP server using:
+
+hmon selftest
+
+Legacy XML configurations can be converted to TOML using:
+
+hmon migrate-config -out new_hmon.toml old_hmon.xml
+
+A single URL can be checked without a configuration file using:
+
+hmon assert -url https://example.org -e 'regex:Welcome' -e 'status:200'
 
 For more information, check the GitHub page at http://github.com/krpors/hmon.
 
@@ -337,14 +852,44 @@ FLAGS (with defaults):
 		flag.PrintDefaults()
 	}
 
-	flag.Parse()
+	// Subcommands are dispatched before parsing the regular flags.
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "verify":
+			os.Exit(runVerify(os.Args[2:]))
+		case "convert":
+			os.Exit(runConvert(os.Args[2:]))
+		case "import":
+			os.Exit(runImport(os.Args[2:]))
+		case "show":
+			os.Exit(runShow(os.Args[2:]))
+		case "assert":
+			os.Exit(runAssert(os.Args[2:]))
+		case "report":
+			os.Exit(runReport(os.Args[2:]))
+		case "selftest":
+			os.Exit(runSelftest(os.Args[2:]))
+		case "migrate-config":
+			os.Exit(runMigrateConfig(os.Args[2:]))
+		}
+	}
+
+	flag.CommandLine.Init(os.Args[0], flag.ContinueOnError)
+	if err := flag.CommandLine.Parse(os.Args[1:]); err != nil {
+		os.Exit(flagExitCode(err))
+	}
 
 	// If version is requested, report that and then exit normally.
 	if *flagVersion {
 		fmt.Fprintf(os.Stderr, "hmon version %s\n", VERSION)
-		os.Exit(0)
+		os.Exit(ExitOK)
 	}
 
+	os.Exit(run())
+}
+
+// Runs the monitors as requested by the cmdline flags. Returns the exit code.
+func run() int {
 	var writeFunc func(string, *[]ConfigurationResult) error
 	// determine type of format
 	switch *flagFormat {
@@ -354,33 +899,130 @@ FLAGS (with defaults):
 	case "json":
 		writeFunc = writeJSON
 		break
-	case "csv":
-		writeFunc = writeCsv
+	case "csv", "jsonl", "ndjson":
+		// written while running, see streamingFormats.
 		break
 	case "pandora":
 		writeFunc = writePandoraAgents
 		break
+	case "syslog":
+		writeFunc = writeSyslog
+		break
+	case "prometheus":
+		writeFunc = writePrometheus
+		break
+	case "template":
+		if *flagTemplate == "" {
+			fmt.Printf("The template format needs a -template\n")
+			return ExitUsage
+		}
+		var err error
+		writeFunc, err = newTemplateWriter(*flagTemplate)
+		if err != nil {
+			fmt.Println(err)
+			return ExitUsage
+		}
 	default:
 		// unknown output format. Bail out
 		fmt.Printf("Unknown output format: %s\n", *flagFormat)
-		os.Exit(1)
+		return ExitUsage
+	}
+
+	outputTemplate, err := parseOutputTemplate(*flagOutput)
+	if err != nil {
+		fmt.Println(err)
+		return ExitUsage
+	}
+	if outputTemplate != nil && *flagFormat != "json" && *flagFormat != "csv" && *flagFormat != "jsonl" && *flagFormat != "ndjson" && *flagFormat != "template" {
+		fmt.Printf("A templated -output is only supported for the json, csv, jsonl, ndjson and template formats\n")
+		return ExitUsage
+	}
+
+	// results written to stdout can be piped, so everything else is written
+	// to stderr instead.
+	var out io.Writer = os.Stdout
+	if *flagOutput == stdoutOutput {
+		if _, streaming := streamingFormats[*flagFormat]; !streaming && *flagFormat != "json" && *flagFormat != "prometheus" && *flagFormat != "template" {
+			fmt.Printf("Writing to stdout (-output -) is only supported for the json, csv, jsonl, ndjson, prometheus and template formats\n")
+			return ExitUsage
+		}
+		out = os.Stderr
 	}
 
 	// Emit a warning that no output file or directory is specified. Only tell the user
 	// this when a different format is specified.
 	if *flagFormat != "" && strings.TrimSpace(*flagOutput) == "" {
-		fmt.Printf("Warning: no explicit output file or directory specified. No file(s) will be created!\n")
+		fmt.Fprintf(out, "Warning: no explicit output file or directory specified. No file(s) will be created!\n")
+	}
+
+	notifiers, notifyTemplate, err := createNotifiers()
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return ExitUsage
+	}
+
+	var signingKey ed25519.PrivateKey
+	if *flagSign != "" {
+		if *flagFormat != "json" {
+			fmt.Fprintf(out, "Signing (-sign) is only supported for the json format\n")
+			return ExitUsage
+		}
+		if *flagOutput == stdoutOutput {
+			fmt.Fprintf(out, "Signing (-sign) needs an output file, not stdout\n")
+			return ExitUsage
+		}
+		signingKey, err = ReadSigningKey(*flagSign)
+		if err != nil {
+			fmt.Fprintln(out, err)
+			return ExitUsage
+		}
+	}
+
+	environmentProxy = !*flagNoEnvProxy
+
+	timestamps, err = NewTimestamps(*flagTimezone, *flagTimeFormat)
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return ExitUsage
+	}
+
+	var trapper *SnmpTrapper
+	if *flagSnmpTrap != "" {
+		trapper, err = NewSnmpTrapper(*flagSnmpTrap, *flagSnmpCommunity, *flagSnmpOID)
+		if err != nil {
+			fmt.Fprintf(out, "Invalid SNMP settings: %s\n", err)
+			return ExitUsage
+		}
+	}
+
+	// a chaos run would flood the dashboards with failures, so it sends no
+	// metrics (nor traces).
+	var exporter *OTLPExporter
+	if *flagOTLP != "" && *flagChaosTolerance <= 0 {
+		exporter, err = NewOTLPExporter(*flagOTLP, *flagOTLPSignals)
+		if err != nil {
+			fmt.Fprintln(out, err)
+			return ExitUsage
+		}
+	}
+	var statsd *StatsdClient
+	if *flagStatsd != "" && *flagChaosTolerance <= 0 {
+		statsd, err = NewStatsdClient(*flagStatsd, *flagStatsdPrefix, *flagDogStatsD)
+		if err != nil {
+			fmt.Fprintln(out, err)
+			return ExitUsage
+		}
+		defer statsd.Close()
 	}
 
 	var configurations []Config
-	var err error
 
 	// Check if we should read a single configuration, or a configuration directory.
 	if *flagConf != "" {
 		c, err := ReadConfig(*flagConf)
 		if err != nil {
-			fmt.Printf("Unable to parse single configuration file `%s': %s\n", *flagConf, err)
-			os.Exit(1)
+			fmt.Fprintf(out, "Unable to parse single configuration file `%s': %s\n", *flagConf, err)
+			return ExitUsage
 		}
 		// just append the parsed config to the slice. It should now be 1 in length, only.
 		configurations = append(configurations, c)
@@ -388,50 +1030,293 @@ FLAGS (with defaults):
 		// First, find the configurations from the flagConfdir. Bail if anything fails.
 		configurations, err = FindConfigs(*flagConfdir)
 		if err != nil {
-			fmt.Printf("Unable to find/parse configuration files. Nested error is: %s\n", err)
-			os.Exit(1)
+			fmt.Fprintf(out, "Unable to find/parse configuration files. Nested error is: %s\n", err)
+			return ExitUsage
+		}
+	}
+
+	for i := range configurations {
+		configurations[i].SelectEnvironment(*flagEnv)
+	}
+
+	if len(flagHostOverride) > 0 {
+		for i := range configurations {
+			configurations[i].OverrideHosts(flagHostOverride)
+		}
+	}
+
+	excludes := Excludes{Names: flagSkip, Hosts: flagSkipHost}
+	if *flagExclude != "" {
+		e, err := ReadExcludes(*flagExclude)
+		if err != nil {
+			fmt.Fprintf(out, "Unable to read excludes file `%s': %s\n", *flagExclude, err)
+			return ExitUsage
 		}
+		excludes.Names = append(excludes.Names, e.Names...)
+		excludes.Hosts = append(excludes.Hosts, e.Hosts...)
+	}
+	if len(excludes.Names) > 0 || len(excludes.Hosts) > 0 {
+		skipped := 0
+		for i := range configurations {
+			skipped += configurations[i].Skip(excludes)
+		}
+		fmt.Fprintf(out, "Skipping %d monitor(s) due to the excludes\n", skipped)
+	}
+
+	for i := range configurations {
+		configurations[i].SweepPools()
 	}
 
-	validateConfigurations(&configurations)
+	if *flagInsecure {
+		for i := range configurations {
+			configurations[i].SkipVerify()
+		}
+	}
+
+	if *flagMaxBody > 0 {
+		for i := range configurations {
+			configurations[i].LimitBodies(*flagMaxBody)
+		}
+	}
+
+	if *flagSecurityPolicy != "" {
+		policy, err := ReadSecurityPolicy(*flagSecurityPolicy)
+		if err != nil {
+			fmt.Fprintf(out, "Unable to read security policy `%s': %s\n", *flagSecurityPolicy, err)
+			return ExitUsage
+		}
+		for i := range configurations {
+			configurations[i].ApplySecurityPolicy(policy)
+		}
+	}
+
+	if *flagSaveFailures != "" {
+		err = os.MkdirAll(*flagSaveFailures, 0755)
+		if err != nil {
+			fmt.Fprintf(out, "Unable to create directory for failures `%s': %s\n", *flagSaveFailures, err)
+			return ExitInternal
+		}
+		for i := range configurations {
+			configurations[i].SaveFailures(*flagSaveFailures)
+		}
+	}
+
+	// a chaos run never reaches the servers of the monitors, but checks that
+	// all of them time out, and that their failures are reported.
+	if *flagChaosTolerance > 0 {
+		done := make(chan bool)
+		proxy := httptest.NewServer(newChaosProxy(done))
+		defer proxy.Close()
+		defer close(done)
+		for i := range configurations {
+			configurations[i].InjectChaos(proxy.URL, *flagChaosTolerance)
+		}
+		fmt.Fprintf(out, "Chaos run: all monitors go through %s, and must time out within %d ms\n", proxy.URL, *flagChaosTolerance)
+	}
+
+	if code := validateConfigurations(out, &configurations); code != ExitOK {
+		return code
+	}
+
+	// Is a flag provided that we only should do configuration validation?
+	if *flagValidateOnly {
+		// if so, no point in continuing. Exit code 0 to indicate an a-okay.
+		fmt.Fprintf(out, "All configuration files (%d) are correctly validated:\n", len(configurations))
+		for _, c := range configurations {
+			fmt.Fprintf(out, "  %s\n", c.FileName)
+		}
+		return ExitOK
+	}
+
+	if *flagDNSPrefetch {
+		resolveCache = newDNSCache(time.Duration(*flagDNSTTL) * time.Second)
+		hosts := prefetchHosts(configurations)
+		resolved := resolveCache.prefetch(hosts)
+		fmt.Fprintf(out, "Resolved %d of %d hosts before the run\n", resolved, len(hosts))
+	}
 
 	_, err = os.Open(*flagFiledir)
 	if err != nil {
-		fmt.Printf("Failed to open request directory. Nested error is: %s\n", err)
-		os.Exit(1)
+		fmt.Fprintf(out, "Failed to open request directory. Nested error is: %s\n", err)
+		return ExitUsage
+	}
+
+	// the results of the last run, if kept. A chaos run is neither compared
+	// with it, nor kept.
+	history := *flagHistory
+	if *flagChaosTolerance > 0 {
+		history = ""
+	}
+	var previous []reportedResult
+	if history != "" {
+		previous, err = ReadResults(history)
+		if err != nil && !os.IsNotExist(err) {
+			// without the last run, there's no trend to show.
+			fmt.Fprintf(out, "Unable to read the results of the last run: %s\n", err)
+		}
+	}
+
+	// streaming formats are written while the monitors run.
+	// with a templated output, every configuration has its own file.
+	var resultWriter ResultWriter
+	newWriter, streaming := streamingFormats[*flagFormat]
+	streaming = streaming && strings.TrimSpace(*flagOutput) != ""
+	if streaming && outputTemplate == nil {
+		resultWriter, err = newWriter(*flagOutput)
+		if err != nil {
+			fmt.Fprintln(out, err)
+			return ExitInternal
+		}
 	}
 
 	var configResults []ConfigurationResult
+	// the variables captured from response headers during the run.
+	vars := make(map[string]string)
 
 	for _, c := range configurations {
-		fmt.Printf("Processing configuration `%s' with %d monitors\n", c.Name, len(c.Monitor))
+		writer := resultWriter
+		if streaming && outputTemplate != nil {
+			file, err := outputFile(outputTemplate, c.Name, *flagFormat)
+			if err == nil {
+				writer, err = newWriter(file)
+			}
+			if err != nil {
+				fmt.Fprintln(out, err)
+				return ExitInternal
+			}
+		}
+
+		var emit func(Result)
+		if writer != nil || statsd != nil {
+			name := c.Name
+			emit = func(r Result) {
+				if writer != nil {
+					writer.WriteResult(name, r)
+				}
+				if statsd != nil {
+					if err := statsd.Send(name, r); err != nil {
+						fmt.Fprintf(out, "Unable to send metrics to statsd: %s\n", err)
+					}
+				}
+			}
+		}
+
+		monitors := c.SortedMonitors()
+		if disabled := len(c.Monitor) - len(monitors); disabled > 0 {
+			fmt.Fprintf(out, "Processing configuration `%s' with %d monitors (%d disabled)\n", c.Name, len(monitors), disabled)
+		} else {
+			fmt.Fprintf(out, "Processing configuration `%s' with %d monitors\n", c.Name, len(monitors))
+		}
 
 		// should we run in parallel?
 		var cr ConfigurationResult
-		if !*flagSequential {
-			cr = runParallel(*flagFiledir, c, *flagVerbose)
+		if c.CookieJar {
+			// the monitors share a session, so they run in order.
+			c.ShareCookies()
+			cr = runSequential(out, *flagFiledir, c, *flagVerbose, vars, emit)
+		} else if !*flagSequential {
+			cr = runParallel(out, *flagFiledir, c, *flagVerbose, *flagWorkers, *flagPerHost, vars, emit)
 		} else {
 			// or sequential.
-			cr = runSequential(*flagFiledir, c, *flagVerbose)
+			cr = runSequential(out, *flagFiledir, c, *flagVerbose, vars, emit)
 		}
 		configResults = append(configResults, cr)
 
-		fmt.Println()
+		if writer != nil && writer != resultWriter {
+			err = writer.Close()
+			if err != nil {
+				fmt.Fprintln(out, err)
+				return ExitInternal
+			}
+		}
+
+		fmt.Fprintln(out)
+	}
+
+	if resultWriter != nil {
+		err = resultWriter.Close()
+		if err != nil {
+			fmt.Fprintln(out, err)
+			return ExitInternal
+		}
 	}
 
 	// print execution summary with totals, amount failed, amount ok, etc.
-	printExecutionSummary(configResults)
+	printExecutionSummary(out, configResults, previous)
+
+	fmt.Fprintln(out)
+
+	var chaosProblems []string
+	if *flagChaosTolerance > 0 {
+		chaosProblems = checkChaosResults(configResults)
+		if len(chaosProblems) > 0 {
+			fmt.Fprintf(out, "Chaos run failed with %d problem(s):\n", len(chaosProblems))
+			for _, p := range chaosProblems {
+				fmt.Fprintf(out, "  %s\n", p)
+			}
+		} else {
+			fmt.Fprintf(out, "Chaos run passed: all monitors failed as expected.\n")
+		}
+		fmt.Fprintln(out)
+	}
+
+	sendNotifications(out, notifiers, notifyTemplate, configResults)
+	if trapper != nil {
+		sendTraps(out, trapper, configResults)
+	}
+	if exporter != nil {
+		if err := exporter.Export(configResults); err != nil {
+			fmt.Fprintf(out, "Unable to export to OpenTelemetry: %s\n", err)
+		}
+	}
+	if *flagMailTo != "" {
+		sendReport(out, configResults)
+	}
 
-	fmt.Println()
+	// writes the results to the file, and signs it if requested.
+	writeOutput := func(file string, results []ConfigurationResult) error {
+		err := writeFunc(file, &results)
+		if err == nil && signingKey != nil {
+			err = SignFile(file, signingKey)
+		}
+		return err
+	}
 
 	if strings.TrimSpace(*flagOutput) != "" {
 		// sanity nil check.
-		if writeFunc != nil {
-			err := writeFunc(*flagOutput, &configResults)
-			if err != nil {
-				fmt.Println(err)
-				os.Exit(1)
+		if writeFunc != nil && outputTemplate != nil {
+			for _, cr := range configResults {
+				file, err := outputFile(outputTemplate, cr.ConfigurationName, *flagFormat)
+				if err == nil {
+					err = writeOutput(file, []ConfigurationResult{cr})
+				}
+				if err != nil {
+					fmt.Fprintln(out, err)
+					return ExitInternal
+				}
+			}
+		} else if writeFunc != nil {
+			if err := writeOutput(*flagOutput, configResults); err != nil {
+				fmt.Fprintln(out, err)
+				return ExitInternal
 			}
 		}
 	}
+
+	if history != "" {
+		if err := writeJSON(history, &configResults); err != nil {
+			fmt.Fprintln(out, err)
+		}
+	}
+
+	// the run is complete, so let the dead man's switch know we're alive. A
+	// chaos run doesn't count as a run of the monitors.
+	if *flagHeartbeat != "" && *flagChaosTolerance <= 0 {
+		err := sendHeartbeat(*flagHeartbeat)
+		if err != nil {
+			fmt.Fprintf(out, "Unable to send heartbeat: %s\n", err)
+		}
+	}
+
+	return exitCode(configResults, chaosProblems)
 }
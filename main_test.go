@@ -1,7 +1,16 @@
 package main
 
 import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestSanitize(t *testing.T) {
@@ -20,6 +29,183 @@ func TestSanitize(t *testing.T) {
 	s = "``````'''''unlimited backticks'''' and'''``\"\" quotes"
 	result = sanitizePandoraData(s)
 	if result != "unlimited backticks and quotes" {
-		t.Errorf("Unexpected: '%s'", result) 
+		t.Errorf("Unexpected: '%s'", result)
+	}
+}
+
+func TestFormatSyslog(t *testing.T) {
+	res := Result{Monitor: Monitor{Name: `Say "hi"`, URL: "http://example.org"}, Latency: 12}
+	tm := time.Date(2015, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	msg := formatSyslog("probe", "Config [one]", res, tm)
+	if !strings.HasPrefix(msg, "<14>1 2015-03-01T12:00:00Z probe hmon ") {
+		t.Errorf("Unexpected header: '%s'", msg)
+	}
+	if !strings.Contains(msg, `config="Config [one\]" monitor="Say \"hi\""`) {
+		t.Errorf("Unexpected structured data: '%s'", msg)
+	}
+
+	res.Monitor.Owner = "team-payments"
+	msg = formatSyslog("probe", "Config [one]", res, tm)
+	if !strings.Contains(msg, ` owner="team-payments" `) {
+		t.Errorf("Expected the owner in the structured data: '%s'", msg)
+	}
+}
+
+func TestOutputTemplate(t *testing.T) {
+	tmpl, err := parseOutputTemplate("results.json")
+	if tmpl != nil || err != nil {
+		t.Errorf("expected no template for a plain filename")
+	}
+
+	tmpl, err = parseOutputTemplate("results/{{.Config}}.{{.Format}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := outputFile(tmpl, "Common tests/API", "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file != "results/Common_tests_API.json" {
+		t.Errorf("unexpected filename '%s'", file)
+	}
+
+	if _, err := parseOutputTemplate("results/{{.Config"); err == nil {
+		t.Errorf("expected an error for an invalid template")
+	}
+}
+
+func TestGroupByHost(t *testing.T) {
+	monitors := []Monitor{
+		{Name: "a", URL: "http://www.example.org/a"},
+		{Name: "b", URL: "http://api.example.org/b"},
+		{Name: "c", URL: "https://WWW.example.org:8443/c"},
+		{Name: "d", URL: "http://www.example.org/d", Backend: "10.0.0.1"},
+	}
+	var got []string
+	for _, group := range groupByHost(monitors) {
+		var names []string
+		for _, m := range group {
+			names = append(names, m.Name)
+		}
+		got = append(got, strings.Join(names, ","))
+	}
+	if strings.Join(got, " ") != "a,c b d" {
+		t.Errorf("expected groups 'a,c b d', got '%s'", strings.Join(got, " "))
+	}
+}
+
+func TestRunParallelPerHost(t *testing.T) {
+	// the highest amount of concurrent requests, by host.
+	var mu sync.Mutex
+	running := make(map[string]int)
+	highest := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := strings.Split(r.Host, ":")[0]
+		mu.Lock()
+		running[host]++
+		if running[host] > highest[host] {
+			highest[host] = running[host]
+		}
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		running[host]--
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	port := strings.Split(server.URL, ":")[2]
+	c := Config{Monitor: make(map[string]Monitor)}
+	for i := 0; i < 3; i++ {
+		c.Monitor[fmt.Sprintf("local%d", i)] = Monitor{Name: fmt.Sprintf("local%d", i), URL: "http://localhost:" + port}
+		c.Monitor[fmt.Sprintf("ip%d", i)] = Monitor{Name: fmt.Sprintf("ip%d", i), URL: "http://127.0.0.1:" + port}
+	}
+
+	cr := runParallel(ioutil.Discard, ".", c, false, 0, true, make(map[string]string), nil)
+	if len(cr.Results) != 6 {
+		t.Fatalf("expected 6 results, got %d", len(cr.Results))
+	}
+	for _, r := range cr.Results {
+		if r.Error != nil {
+			t.Errorf("%s: expected no error, got %s", r.Monitor.Name, r.Error)
+		}
+	}
+	if highest["localhost"] != 1 || highest["127.0.0.1"] != 1 {
+		t.Errorf("expected one request at a time per host, got %v", highest)
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	ok := ConfigurationResult{Results: []Result{{}}}
+	failed := ConfigurationResult{Results: []Result{{}, {Error: ResultError{fmt.Errorf("timeout")}}}}
+
+	if code := exitCode([]ConfigurationResult{ok}, nil); code != ExitOK {
+		t.Errorf("expected exit code %d, got %d", ExitOK, code)
+	}
+	if code := exitCode([]ConfigurationResult{ok, failed}, nil); code != ExitFailures {
+		t.Errorf("expected exit code %d, got %d", ExitFailures, code)
+	}
+
+	// in a chaos run, failures are expected.
+	*flagChaosTolerance = 100
+	defer func() { *flagChaosTolerance = 0 }()
+	if code := exitCode([]ConfigurationResult{failed}, nil); code != ExitOK {
+		t.Errorf("expected exit code %d for a chaos run, got %d", ExitOK, code)
+	}
+	if code := exitCode([]ConfigurationResult{failed}, []string{"responded"}); code != ExitFailures {
+		t.Errorf("expected exit code %d for a failed chaos run, got %d", ExitFailures, code)
+	}
+}
+
+func TestFlagExitCode(t *testing.T) {
+	// the usage of the subcommands is printed to stderr.
+	stderr := os.Stderr
+	os.Stderr, _ = os.Open(os.DevNull)
+	defer func() { os.Stderr = stderr }()
+
+	subcommands := map[string]func([]string) int{
+		"assert": runAssert, "convert": runConvert, "import": runImport, "migrate-config": runMigrateConfig,
+		"report": runReport, "selftest": runSelftest, "show": runShow, "verify": runVerify,
+	}
+	for name, run := range subcommands {
+		if code := run([]string{"-nosuchflag", "x"}); code != ExitUsage {
+			t.Errorf("%s: expected exit code %d for an unknown flag, got %d", name, ExitUsage, code)
+		}
+		if code := run([]string{"-h"}); code != ExitOK {
+			t.Errorf("%s: expected exit code %d for -h, got %d", name, ExitOK, code)
+		}
+	}
+}
+
+func TestValidateConfigurations(t *testing.T) {
+	if code := validateConfigurations(ioutil.Discard, &[]Config{}); code != ExitUsage {
+		t.Errorf("expected exit code %d without configurations, got %d", ExitUsage, code)
+	}
+	invalid := []Config{{Name: "c", FileName: "c_hmon.toml", Monitor: map[string]Monitor{"m": {Name: "m"}}}}
+	if code := validateConfigurations(ioutil.Discard, &invalid); code != ExitValidation {
+		t.Errorf("expected exit code %d for an invalid configuration, got %d", ExitValidation, code)
+	}
+}
+
+func TestRunSequentialPrintsToWriter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "OK")
+	}))
+	defer server.Close()
+
+	c := Config{Monitor: map[string]Monitor{"m": {Name: "Home", URL: server.URL}}}
+	var buf bytes.Buffer
+	cr := runSequential(&buf, ".", c, true, make(map[string]string), nil)
+	if len(cr.Results) != 1 {
+		t.Fatalf("expected 1 result, got %d", len(cr.Results))
+	}
+	printExecutionSummary(&buf, []ConfigurationResult{cr}, nil)
+
+	out := buf.String()
+	for _, expected := range []string{"Home", "OUTPUT:\nOK", "Execution summary:"} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected '%s' in the output, got:\n%s", expected, out)
+		}
 	}
 }
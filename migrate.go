@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/krpors/hmon/soapui"
+)
+
+// xmlNode is a generic XML element, used to read legacy configurations
+// without depending on their exact schema.
+type xmlNode struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr `xml:",any,attr"`
+	Text     string     `xml:",chardata"`
+	Children []xmlNode  `xml:",any"`
+}
+
+// attr returns the attribute with the given name, and whether it was found.
+func (n xmlNode) attr(name string) (string, bool) {
+	for _, a := range n.Attrs {
+		if a.Name.Local == name {
+			return strings.TrimSpace(a.Value), true
+		}
+	}
+	return "", false
+}
+
+// value returns the attribute or child element with the given name, and
+// whether it was found.
+func (n xmlNode) value(name string) (string, bool) {
+	if v, found := n.attr(name); found {
+		return v, true
+	}
+	for _, c := range n.Children {
+		if c.XMLName.Local == name {
+			return strings.TrimSpace(c.Text), true
+		}
+	}
+	return "", false
+}
+
+// legacyMonitor is a monitor of a legacy XML configuration.
+type legacyMonitor struct {
+	Name, Description, URL, File, Timeout string
+	Headers, Assertions                   []string
+}
+
+// The attributes and elements of a legacy monitor which are converted.
+var legacyMonitorFields = map[string]bool{
+	"name": true, "desc": true, "description": true, "url": true, "file": true,
+	"timeout": true, "headers": true, "header": true, "assertions": true, "assertion": true,
+}
+
+// parseLegacyMonitor reads a <monitor> element. Everything which can't be
+// converted is added to the problems.
+func parseLegacyMonitor(n xmlNode, problems *[]string) legacyMonitor {
+	var m legacyMonitor
+	m.Name, _ = n.value("name")
+	m.Description, _ = n.value("desc")
+	if desc, found := n.value("description"); found {
+		m.Description = desc
+	}
+	m.URL, _ = n.value("url")
+	m.File, _ = n.value("file")
+	m.Timeout, _ = n.value("timeout")
+
+	problem := func(format string, args ...interface{}) {
+		*problems = append(*problems, fmt.Sprintf("monitor '%s': ", m.Name)+fmt.Sprintf(format, args...))
+	}
+
+	// headers and assertions are either direct children, or wrapped in a
+	// <headers> or <assertions> element.
+	var headers, assertions []xmlNode
+	for _, c := range n.Children {
+		switch c.XMLName.Local {
+		case "header":
+			headers = append(headers, c)
+		case "headers":
+			headers = append(headers, c.Children...)
+		case "assertion":
+			assertions = append(assertions, c)
+		case "assertions":
+			assertions = append(assertions, c.Children...)
+		default:
+			if !legacyMonitorFields[c.XMLName.Local] {
+				problem("unknown element <%s> is not converted", c.XMLName.Local)
+			}
+		}
+	}
+	for _, a := range n.Attrs {
+		if !legacyMonitorFields[a.Name.Local] {
+			problem("unknown attribute '%s' is not converted", a.Name.Local)
+		}
+	}
+
+	for _, h := range headers {
+		text := strings.TrimSpace(h.Text)
+		if name, found := h.attr("name"); found {
+			// <header name="SOAPAction">value</header>
+			text = name + ": " + text
+		}
+		if h.XMLName.Local != "header" || !strings.Contains(text, ":") {
+			problem("header <%s>%s</%s> is not converted", h.XMLName.Local, text, h.XMLName.Local)
+			continue
+		}
+		m.Headers = append(m.Headers, text)
+	}
+	for _, a := range assertions {
+		if a.XMLName.Local != "assertion" || len(a.Attrs) > 0 {
+			problem("assertion <%s> with attributes or an unknown element is not converted", a.XMLName.Local)
+			continue
+		}
+		m.Assertions = append(m.Assertions, strings.TrimSpace(a.Text))
+	}
+
+	if m.URL == "" {
+		problem("no url")
+	}
+	if m.Timeout != "" {
+		if _, err := strconv.Atoi(m.Timeout); err != nil {
+			problem("timeout '%s' is not a number, and is not converted", m.Timeout)
+			m.Timeout = ""
+		}
+	}
+	return m
+}
+
+// MigrateXMLConfig converts a legacy XML configuration, with a <hmonconfig>
+// root and <monitor> elements, to the current TOML schema. Everything which
+// can't be converted is returned as problems.
+func MigrateXMLConfig(r io.Reader, w io.Writer) ([]string, error) {
+	var root xmlNode
+	if err := xml.NewDecoder(r).Decode(&root); err != nil {
+		return nil, fmt.Errorf("unable to parse XML: %s", err)
+	}
+	if root.XMLName.Local != "hmonconfig" {
+		return nil, fmt.Errorf("root element is <%s> instead of <hmonconfig>", root.XMLName.Local)
+	}
+
+	var problems []string
+	name, _ := root.value("name")
+	if name == "" {
+		problems = append(problems, "configuration has no name")
+	}
+	fmt.Fprintf(w, "schema = %d\n", CurrentSchema)
+	fmt.Fprintf(w, "name = %s\n", soapui.TOMLString(name))
+
+	usedKeys := make(map[string]bool)
+	for _, n := range root.Children {
+		if n.XMLName.Local == "name" {
+			continue
+		}
+		if n.XMLName.Local != "monitor" {
+			problems = append(problems, fmt.Sprintf("unknown element <%s> is not converted", n.XMLName.Local))
+			continue
+		}
+
+		m := parseLegacyMonitor(n, &problems)
+		key := soapui.UniqueKey(strings.Replace(m.Name, ".", "", -1), usedKeys)
+
+		fmt.Fprintf(w, "\n[monitor.%s]\n", soapui.TOMLString(key))
+		fmt.Fprintf(w, "name = %s\n", soapui.TOMLString(m.Name))
+		if m.Description != "" {
+			fmt.Fprintf(w, "description = %s\n", soapui.TOMLString(m.Description))
+		}
+		fmt.Fprintf(w, "url = %s\n", soapui.TOMLString(m.URL))
+		if m.File != "" {
+			fmt.Fprintf(w, "file = %s\n", soapui.TOMLString(m.File))
+		}
+		if m.Timeout != "" {
+			fmt.Fprintf(w, "timeout = %s\n", m.Timeout)
+		}
+		if len(m.Headers) > 0 {
+			fmt.Fprintf(w, "headers = [\n")
+			for _, h := range m.Headers {
+				fmt.Fprintf(w, "  %s,\n", soapui.TOMLString(h))
+			}
+			fmt.Fprintf(w, "]\n")
+		}
+		fmt.Fprintf(w, "assertions = [\n")
+		for _, a := range m.Assertions {
+			fmt.Fprintf(w, "  %s,\n", soapui.TOMLString(a))
+		}
+		fmt.Fprintf(w, "]\n")
+	}
+	return problems, nil
+}
+
+// Runs the 'migrate-config' subcommand with the given arguments. Converts a
+// legacy XML configuration to the current TOML schema. Returns the exit code.
+func runMigrateConfig(args []string) int {
+	fs := flag.NewFlagSet("migrate-config", flag.ContinueOnError)
+	out := fs.String("out", "", "The configuration file to write. If empty, it's written to stdout.")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: hmon migrate-config [flags] old_hmon.xml\n\n")
+		fmt.Fprintf(os.Stderr, "Converts a legacy XML configuration to the current TOML schema, and\n")
+		fmt.Fprintf(os.Stderr, "reports everything which could not be converted.\n\n")
+		fs.PrintDefaults()
+	}
+
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return flagExitCode(err)
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return ExitUsage
+	}
+
+	f, err := os.Open(positional[0])
+	if err != nil {
+		fmt.Printf("Unable to open configuration `%s': %s\n", positional[0], err)
+		return ExitUsage
+	}
+	defer f.Close()
+
+	var buf bytes.Buffer
+	problems, err := MigrateXMLConfig(f, &buf)
+	if err != nil {
+		fmt.Printf("Unable to migrate configuration `%s': %s\n", positional[0], err)
+		return ExitUsage
+	}
+
+	// the result must be readable as a current configuration.
+	var c Config
+	if _, err := toml.Decode(buf.String(), &c); err != nil {
+		fmt.Printf("Migrated configuration can't be parsed: %s\n", err)
+		return ExitUsage
+	}
+
+	if *out == "" {
+		os.Stdout.Write(buf.Bytes())
+	} else {
+		err = ioutil.WriteFile(*out, buf.Bytes(), 0644)
+		if err != nil {
+			fmt.Printf("Unable to write configuration `%s': %s\n", *out, err)
+			return ExitInternal
+		}
+		fmt.Printf("Migrated %d monitor(s) to `%s'\n", len(c.Monitor), *out)
+	}
+
+	if len(problems) > 0 {
+		fmt.Fprintf(os.Stderr, "The following could not be converted:\n")
+		for _, p := range problems {
+			fmt.Fprintf(os.Stderr, "  %s\n", p)
+		}
+		return ExitUsage
+	}
+	return ExitOK
+}
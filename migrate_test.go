@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+)
+
+func TestMigrateXMLConfig(t *testing.T) {
+	legacy := `<?xml version="1.0"?>
+<hmonconfig name="Common tests">
+	<monitor name="Github test" desc="Status page" timeout="30000">
+		<url>https://status.github.com</url>
+		<assertions>
+			<assertion>All systems (go|operational)</assertion>
+		</assertions>
+	</monitor>
+	<monitor>
+		<name>SOAP service</name>
+		<url>http://example.org/service</url>
+		<file>request.xml</file>
+		<headers>
+			<header name="SOAPAction">getStatus</header>
+			<header>Content-Type: text/xml</header>
+		</headers>
+		<retries>3</retries>
+	</monitor>
+</hmonconfig>`
+
+	var buf bytes.Buffer
+	problems, err := MigrateXMLConfig(strings.NewReader(legacy), &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 1 || !strings.Contains(problems[0], "<retries>") {
+		t.Errorf("expected a problem for <retries>, got %v", problems)
+	}
+
+	var c Config
+	if _, err := toml.Decode(buf.String(), &c); err != nil {
+		t.Fatalf("migrated configuration can't be parsed: %s\n%s", err, buf.String())
+	}
+	if c.Name != "Common tests" || len(c.Monitor) != 2 {
+		t.Fatalf("unexpected configuration %+v", c)
+	}
+
+	github := c.Monitor["Github test"]
+	if github.Description != "Status page" || github.Timeout != 30000 || len(github.Assertions) != 1 {
+		t.Errorf("unexpected monitor %+v", github)
+	}
+	soap := c.Monitor["SOAP service"]
+	if soap.File != "request.xml" || len(soap.Headers) != 2 || soap.Headers[0] != "SOAPAction: getStatus" {
+		t.Errorf("unexpected monitor %+v", soap)
+	}
+
+	if _, err := MigrateXMLConfig(strings.NewReader("<config/>"), &buf); err == nil {
+		t.Errorf("expected an error for an unknown root element")
+	}
+}
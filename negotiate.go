@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// qualityValue is an element of a header like Accept or Accept-Language,
+// with its quality (the q parameter, 1 by default).
+type qualityValue struct {
+	value string
+	q     float64
+}
+
+// parseQualityList parses a header like "nl-NL, nl;q=0.9, en;q=0.5". Other
+// parameters than q are kept with the value.
+func parseQualityList(header string) []qualityValue {
+	var values []qualityValue
+	for _, element := range strings.Split(header, ",") {
+		qv := qualityValue{q: 1}
+		var params []string
+		for i, part := range strings.Split(element, ";") {
+			part = strings.TrimSpace(part)
+			if i > 0 && strings.HasPrefix(strings.ToLower(part), "q=") {
+				if q, err := strconv.ParseFloat(part[2:], 64); err == nil {
+					qv.q = q
+				}
+				continue
+			}
+			params = append(params, part)
+		}
+		qv.value = strings.Join(params, ";")
+		if qv.value != "" {
+			values = append(values, qv)
+		}
+	}
+	return values
+}
+
+// splitList splits a comma separated list, like the value of a Vary header,
+// into its trimmed, non-empty elements.
+func splitList(list string) []string {
+	var elements []string
+	for _, e := range strings.Split(list, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			elements = append(elements, e)
+		}
+	}
+	return elements
+}
+
+// languageMatches returns true if the language tag matches the language range
+// (RFC 4647 basic filtering): "nl" matches "nl" and "nl-BE", and "*" matches
+// any tag.
+func languageMatches(languageRange, tag string) bool {
+	languageRange, tag = strings.ToLower(languageRange), strings.ToLower(tag)
+	return languageRange == "*" || languageRange == tag || strings.HasPrefix(tag, languageRange+"-")
+}
+
+// mediaTypeMatches returns true if the media type matches the media range of
+// an Accept header, like "application/*". Parameters are ignored.
+func mediaTypeMatches(mediaRange, mediaType string) bool {
+	mediaRange = strings.ToLower(strings.TrimSpace(strings.Split(mediaRange, ";")[0]))
+	mediaType = strings.ToLower(strings.TrimSpace(strings.Split(mediaType, ";")[0]))
+	if mediaRange == "*/*" || mediaRange == mediaType {
+		return true
+	}
+	return strings.HasSuffix(mediaRange, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(mediaRange, "*"))
+}
+
+// acceptable returns true if the value matches an element of the list with a
+// quality above zero.
+func acceptable(list []qualityValue, value string, matches func(string, string) bool) bool {
+	for _, qv := range list {
+		if qv.q > 0 && matches(qv.value, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// varies returns true if the Vary header of the response lists the header,
+// or is "*".
+func varies(header http.Header, name string) bool {
+	for _, value := range header["Vary"] {
+		for _, v := range splitList(value) {
+			if v == "*" || strings.EqualFold(v, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkContentLanguage checks that the Content-Language of the response
+// matches one of the comma separated language ranges.
+func checkContentLanguage(expected string, header http.Header) error {
+	languages := splitList(header.Get("Content-Language"))
+	if len(languages) == 0 {
+		return fmt.Errorf("assertion failed for content_language `%s': header Content-Language is missing", expected)
+	}
+	for _, languageRange := range splitList(expected) {
+		for _, language := range languages {
+			if languageMatches(languageRange, language) {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("assertion failed for content_language `%s': got `%s'", expected, header.Get("Content-Language"))
+}
+
+// checkVary checks that the Vary header of the response lists all of the
+// comma separated header names.
+func checkVary(expected string, header http.Header) error {
+	var missing []string
+	for _, name := range splitList(expected) {
+		if !varies(header, name) {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("assertion failed for vary `%s': Vary `%s' doesn't list %s", expected, strings.Join(header["Vary"], ", "), strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// negotiates returns true if the monitor sends an Accept or Accept-Language
+// header, either with accept and accept_language or its headers.
+func (m Monitor) negotiates() bool {
+	if m.Accept != "" || m.AcceptLanguage != "" {
+		return true
+	}
+	for _, h := range m.Headers {
+		if name := h.GetName(); strings.EqualFold(name, "Accept") || strings.EqualFold(name, "Accept-Language") {
+			return true
+		}
+	}
+	return false
+}
+
+// checkNegotiation checks the representation negotiated for the Accept and
+// Accept-Language headers of the request: the Content-Type and
+// Content-Language of the response must be acceptable, and the response must
+// vary on these headers, so caches don't serve it for other requests.
+func checkNegotiation(request, response http.Header) error {
+	var problems []string
+	if accept := request.Get("Accept"); accept != "" {
+		contentType := response.Get("Content-Type")
+		if !acceptable(parseQualityList(accept), contentType, mediaTypeMatches) {
+			problems = append(problems, fmt.Sprintf("Content-Type `%s' doesn't match Accept `%s'", contentType, accept))
+		}
+		if !varies(response, "Accept") {
+			problems = append(problems, "Vary doesn't list Accept")
+		}
+	}
+	if acceptLanguage := request.Get("Accept-Language"); acceptLanguage != "" {
+		ranges := parseQualityList(acceptLanguage)
+		languages := splitList(response.Get("Content-Language"))
+		matched := false
+		for _, language := range languages {
+			matched = matched || acceptable(ranges, language, languageMatches)
+		}
+		if !matched {
+			problems = append(problems, fmt.Sprintf("Content-Language `%s' doesn't match Accept-Language `%s'", response.Get("Content-Language"), acceptLanguage))
+		}
+		if !varies(response, "Accept-Language") {
+			problems = append(problems, "Vary doesn't list Accept-Language")
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("content negotiation failed: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
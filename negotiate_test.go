@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCheckContentLanguageAndVary(t *testing.T) {
+	header := http.Header{}
+	header.Set("Content-Language", "nl-BE")
+	header.Add("Vary", "Accept-Encoding, accept-language")
+	header.Add("Vary", "Accept")
+
+	tests := []struct {
+		assertion Assertion
+		ok        bool
+	}{
+		{Assertion{Type: AssertionLanguage, Value: "nl"}, true},
+		{Assertion{Type: AssertionLanguage, Value: "en, nl-BE"}, true},
+		{Assertion{Type: AssertionLanguage, Value: "nl-NL"}, false},
+		{Assertion{Type: AssertionLanguage, Value: "n"}, false},
+		{Assertion{Type: AssertionVary, Value: "Accept-Language, Accept"}, true},
+		{Assertion{Type: AssertionVary, Value: "Accept, Cookie"}, false},
+	}
+	for _, test := range tests {
+		err := test.assertion.Check(200, header, nil, nil)
+		if test.ok && err != nil {
+			t.Errorf("%s: expected no error, got %s", test.assertion, err)
+		}
+		if !test.ok && err == nil {
+			t.Errorf("%s: expected an error, got none", test.assertion)
+		}
+	}
+
+	if err := (Assertion{Type: AssertionLanguage, Value: "nl"}).Check(200, http.Header{}, nil, nil); err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Errorf("expected a missing header error, got %v", err)
+	}
+	if err := (Assertion{Type: AssertionVary, Value: "Accept"}).Check(200, http.Header{"Vary": {"*"}}, nil, nil); err != nil {
+		t.Errorf("expected Vary: * to vary on everything, got %s", err)
+	}
+	if err := (&Assertion{Type: AssertionVary, Value: " , "}).Validate(); err == nil {
+		t.Errorf("expected an error for an empty list")
+	}
+}
+
+func TestCheckNegotiation(t *testing.T) {
+	request := http.Header{}
+	request.Set("Accept", "application/json, text/*;q=0.5, application/xml;q=0")
+	request.Set("Accept-Language", "nl-NL, nl;q=0.9, en;q=0.5")
+
+	tests := []struct {
+		contentType, language, vary string
+		problems                    []string
+	}{
+		{"application/json; charset=utf-8", "nl", "Accept, Accept-Language", nil},
+		{"text/html", "en-GB", "*", nil},
+		{"application/xml", "nl-NL", "Accept, Accept-Language", []string{"Content-Type `application/xml'"}},
+		{"application/json", "de", "Accept", []string{"Content-Language `de'", "Vary doesn't list Accept-Language"}},
+		{"application/json", "", "", []string{"Content-Language `'", "Vary doesn't list Accept;"}},
+	}
+	for _, test := range tests {
+		response := http.Header{}
+		response.Set("Content-Type", test.contentType)
+		response.Set("Content-Language", test.language)
+		response.Set("Vary", test.vary)
+		err := checkNegotiation(request, response)
+		if len(test.problems) == 0 && err != nil {
+			t.Errorf("%+v: expected no error, got %s", test, err)
+		}
+		if len(test.problems) > 0 && err == nil {
+			t.Errorf("%+v: expected an error, got none", test)
+			continue
+		}
+		for _, problem := range test.problems {
+			if !strings.Contains(err.Error(), problem) {
+				t.Errorf("%+v: expected '%s' in the error, got %s", test, problem, err)
+			}
+		}
+	}
+}
+
+func TestRunNegotiation(t *testing.T) {
+	// the server negotiates the language, but forgets the Vary header.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		if strings.HasPrefix(r.Header.Get("Accept-Language"), "nl") {
+			w.Header().Set("Content-Language", "nl")
+			fmt.Fprint(w, "Welkom")
+			return
+		}
+		w.Header().Set("Content-Language", "en")
+		fmt.Fprint(w, "Welcome")
+	}))
+	defer server.Close()
+
+	m := Monitor{URL: server.URL, Accept: "text/html", AcceptLanguage: "nl", Assertions: []Assertion{{Value: "Welkom"}, {Type: AssertionLanguage, Value: "nl"}}}
+	ch := make(chan Result, 1)
+	go m.Run(".", ch)
+	if r := <-ch; r.Error != nil {
+		t.Errorf("expected the Dutch page, got %s", r.Error)
+	}
+
+	m.Negotiation = true
+	go m.Run(".", ch)
+	if r := <-ch; r.Error == nil || r.Code != FailureNegotiate || !strings.Contains(r.Error.Error(), "Vary doesn't list Accept") {
+		t.Errorf("expected a negotiation failure for the missing Vary, got %v (%s)", r.Error, r.Code)
+	}
+
+	c := Config{Name: "c", Monitor: map[string]Monitor{"a": {Name: "a", URL: server.URL, Negotiation: true}}}
+	if err := c.Validate("."); err == nil {
+		t.Errorf("expected an error for negotiation without accept headers")
+	}
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"text/template"
+	"time"
+)
+
+// The default template used to render the text of a notification. The
+// template is executed with a RunSummary as its data.
+const defaultNotifyTemplate = `{{.Failures}} of {{.Total}} monitors failed.
+{{range .Failed}}
+- {{.ConfigurationName}} / {{.Result.Monitor.Name}}: {{.Result.ErrorText}}
+{{- with .Result.Monitor.Owner}}
+  Owner: {{.}}{{end}}
+{{- with .Result.Monitor.Runbook}}
+  Runbook: {{.}}{{end}}
+{{- with .Result.Monitor.Notes}}
+  Notes: {{.}}{{end}}{{end}}
+`
+
+// The timeout used when posting notifications to a webhook.
+const notifyTimeout = 30 * time.Second
+
+// FailedMonitor couples a failed result with the name of the configuration
+// it belongs to, since monitor names are only unique within a configuration.
+type FailedMonitor struct {
+	ConfigurationName string
+	Result            Result
+}
+
+// RunSummary is the data every notifier renders its message from. It is
+// built once per run with NewRunSummary.
+type RunSummary struct {
+	Total     int
+	Successes int
+	Failures  int
+	Failed    []FailedMonitor
+}
+
+// NewRunSummary gathers the totals and failed monitors from all the results.
+func NewRunSummary(configResults []ConfigurationResult) RunSummary {
+	s := RunSummary{}
+	for _, cr := range configResults {
+		for _, res := range cr.Results {
+			s.Total++
+			if res.Error == nil {
+				s.Successes++
+			} else {
+				s.Failures++
+				s.Failed = append(s.Failed, FailedMonitor{cr.ConfigurationName, res})
+			}
+		}
+	}
+	return s
+}
+
+// Title returns a one-line title for the summary, usable as a message header.
+func (s RunSummary) Title() string {
+	if s.Failures == 0 {
+		return fmt.Sprintf("hmon: all %d monitors OK", s.Total)
+	}
+	return fmt.Sprintf("hmon: %d of %d monitors failed", s.Failures, s.Total)
+}
+
+// NotifyTemplate is the template engine shared by all notifiers. It renders
+// the free text part of a notification from a RunSummary.
+type NotifyTemplate struct {
+	tmpl *template.Template
+}
+
+// NewNotifyTemplate parses the given template text. When the text is empty,
+// the default notification template is used.
+func NewNotifyTemplate(text string) (NotifyTemplate, error) {
+	if text == "" {
+		text = defaultNotifyTemplate
+	}
+	t, err := template.New("notify").Parse(text)
+	if err != nil {
+		return NotifyTemplate{}, fmt.Errorf("invalid notification template: %s", err)
+	}
+	return NotifyTemplate{t}, nil
+}
+
+// Render executes the template using the summary as data.
+func (nt NotifyTemplate) Render(s RunSummary) (string, error) {
+	var buf bytes.Buffer
+	err := nt.tmpl.Execute(&buf, s)
+	if err != nil {
+		return "", fmt.Errorf("failed to render notification: %s", err)
+	}
+	return buf.String(), nil
+}
+
+// Notifier is implemented by anything that can send out a notification
+// about a finished run.
+type Notifier interface {
+	Notify(s RunSummary) error
+}
+
+// WebhookNotifier posts a generic JSON document to a URL. The document
+// contains the title, the rendered text and the totals of the run.
+type WebhookNotifier struct {
+	URL      string
+	Template NotifyTemplate
+}
+
+// Notify implements Notifier.
+func (w WebhookNotifier) Notify(s RunSummary) error {
+	text, err := w.Template.Render(s)
+	if err != nil {
+		return err
+	}
+
+	type failure struct {
+		Configuration string `json:"configuration"`
+		Monitor       string `json:"monitor"`
+		Error         string `json:"error"`
+		Code          string `json:"code"`
+		Owner         string `json:"owner,omitempty"`
+	}
+	payload := struct {
+		Title     string    `json:"title"`
+		Text      string    `json:"text"`
+		Total     int       `json:"total"`
+		Successes int       `json:"successes"`
+		Failures  int       `json:"failures"`
+		Failed    []failure `json:"failed"`
+	}{s.Title(), text, s.Total, s.Successes, s.Failures, []failure{}}
+
+	for _, f := range s.Failed {
+		payload.Failed = append(payload.Failed, failure{f.ConfigurationName, f.Result.Monitor.Name, f.Result.Error.Error(), f.Result.Code, f.Result.Monitor.Owner})
+	}
+
+	return postJSON(w.URL, payload)
+}
+
+// TeamsNotifier posts an adaptive card to a Microsoft Teams (incoming) webhook.
+// The card shows the run summary, followed by a fact per failing monitor.
+type TeamsNotifier struct {
+	URL      string
+	Template NotifyTemplate
+}
+
+// Notify implements Notifier.
+func (t TeamsNotifier) Notify(s RunSummary) error {
+	text, err := t.Template.Render(s)
+	if err != nil {
+		return err
+	}
+
+	type fact struct {
+		Title string `json:"title"`
+		Value string `json:"value"`
+	}
+	facts := []fact{}
+	for _, f := range s.Failed {
+		value := f.Result.ErrorText()
+		if m := f.Result.Monitor; m.FailureContext() != "" {
+			value += "\n\n" + m.FailureContext()
+		}
+		facts = append(facts, fact{f.ConfigurationName + " / " + f.Result.Monitor.Name, value})
+	}
+
+	body := []map[string]interface{}{
+		{"type": "TextBlock", "text": s.Title(), "weight": "bolder", "size": "medium"},
+		{"type": "TextBlock", "text": text, "wrap": true},
+	}
+	if len(facts) > 0 {
+		body = append(body, map[string]interface{}{"type": "FactSet", "facts": facts})
+	}
+
+	card := map[string]interface{}{
+		"type": "message",
+		"attachments": []map[string]interface{}{
+			{
+				"contentType": "application/vnd.microsoft.card.adaptive",
+				"content": map[string]interface{}{
+					"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+					"type":    "AdaptiveCard",
+					"version": "1.2",
+					"body":    body,
+				},
+			},
+		},
+	}
+
+	return postJSON(t.URL, card)
+}
+
+// SlackNotifier posts a message to a Slack incoming webhook. The message is
+// the title of the run, followed by the rendered text.
+type SlackNotifier struct {
+	URL      string
+	Template NotifyTemplate
+}
+
+// Notify implements Notifier.
+func (n SlackNotifier) Notify(s RunSummary) error {
+	text, err := n.Template.Render(s)
+	if err != nil {
+		return err
+	}
+	return postJSON(n.URL, map[string]string{"text": "*" + s.Title() + "*\n" + text})
+}
+
+// NotifyTarget is where the failures of a monitor are notified, instead of
+// the notifiers of the command line, so every team gets the failures of its
+// own monitors:
+//
+//	notify = { slack = "https://hooks.slack.com/services/T000/B000/XXXX" }
+//
+// Any combination of a Slack, Microsoft Teams and generic webhook can be given.
+type NotifyTarget struct {
+	Slack   string // Slack incoming webhook URL
+	Teams   string // Microsoft Teams webhook URL
+	Webhook string // URL to post a generic JSON notification to
+}
+
+// validate checks that at least one URL is given, and that all are valid.
+func (t NotifyTarget) validate() error {
+	if t.Slack == "" && t.Teams == "" && t.Webhook == "" {
+		return fmt.Errorf("needs a 'slack', 'teams' or 'webhook' URL")
+	}
+	for name, u := range map[string]string{"slack": t.Slack, "teams": t.Teams, "webhook": t.Webhook} {
+		if u == "" {
+			continue
+		}
+		if _, err := url.ParseRequestURI(u); err != nil {
+			return fmt.Errorf("malformed %s URL (%s)", name, err)
+		}
+	}
+	return nil
+}
+
+// notifiers returns the notifiers of the target, rendering the given template.
+func (t NotifyTarget) notifiers(tmpl NotifyTemplate) []Notifier {
+	var notifiers []Notifier
+	if t.Slack != "" {
+		notifiers = append(notifiers, SlackNotifier{t.Slack, tmpl})
+	}
+	if t.Teams != "" {
+		notifiers = append(notifiers, TeamsNotifier{t.Teams, tmpl})
+	}
+	if t.Webhook != "" {
+		notifiers = append(notifiers, WebhookNotifier{t.Webhook, tmpl})
+	}
+	return notifiers
+}
+
+// routeResults splits the results by where they're notified: the results of
+// monitors with a notify target of their own are returned per target, all
+// others are returned as the results for the notifiers of the command line.
+func routeResults(configResults []ConfigurationResult) ([]ConfigurationResult, map[NotifyTarget][]ConfigurationResult) {
+	var global []ConfigurationResult
+	routed := make(map[NotifyTarget][]ConfigurationResult)
+
+	// adds the result to the results of its configuration, within the list.
+	add := func(list []ConfigurationResult, configName string, r Result) []ConfigurationResult {
+		if len(list) == 0 || list[len(list)-1].ConfigurationName != configName {
+			list = append(list, ConfigurationResult{ConfigurationName: configName})
+		}
+		list[len(list)-1].Results = append(list[len(list)-1].Results, r)
+		return list
+	}
+
+	for _, cr := range configResults {
+		for _, r := range cr.Results {
+			if r.Monitor.Notify != nil {
+				target := *r.Monitor.Notify
+				routed[target] = add(routed[target], cr.ConfigurationName, r)
+			} else {
+				global = add(global, cr.ConfigurationName, r)
+			}
+		}
+	}
+	return global, routed
+}
+
+// postJSON marshals v and posts it to the given URL. Any non 2xx response
+// status is reported as an error.
+func postJSON(url string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("error marshaling notification: %s", err)
+	}
+
+	client := http.Client{Timeout: notifyTimeout}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	ioutil.ReadAll(resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("notification to `%s' failed with status %s", url, resp.Status)
+	}
+
+	return nil
+}
+
+// sendHeartbeat requests the heartbeat URL, to report a completed run to a
+// dead man's switch. Any non 2xx response status is reported as an error.
+func sendHeartbeat(url string) error {
+	client := http.Client{Timeout: notifyTimeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	ioutil.ReadAll(resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("heartbeat to `%s' failed with status %s", url, resp.Status)
+	}
+	return nil
+}
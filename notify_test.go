@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func prepareResults() []ConfigurationResult {
+	return []ConfigurationResult{
+		{
+			ConfigurationName: "Config one",
+			Results: []Result{
+				{Monitor: Monitor{Name: "Up"}, Latency: 10},
+				{Monitor: Monitor{Name: "Down"}, Error: ResultError{errors.New("timeout after 100 ms")}},
+			},
+		},
+	}
+}
+
+func TestRunSummary(t *testing.T) {
+	s := NewRunSummary(prepareResults())
+	if s.Total != 2 || s.Successes != 1 || s.Failures != 1 {
+		t.Errorf("unexpected totals: %+v", s)
+	}
+
+	tmpl, err := NewNotifyTemplate("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, err := tmpl.Render(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(text, "Config one / Down: timeout after 100 ms") {
+		t.Errorf("unexpected notification text: '%s'", text)
+	}
+}
+
+func TestTeamsNotifier(t *testing.T) {
+	var card map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&card)
+	}))
+	defer server.Close()
+
+	tmpl, _ := NewNotifyTemplate("")
+	n := TeamsNotifier{server.URL, tmpl}
+	err := n.Notify(NewRunSummary(prepareResults()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if card["type"] != "message" {
+		t.Errorf("expected a message card, got '%v'", card["type"])
+	}
+}
+
+func TestNotifyTemplateRunbook(t *testing.T) {
+	results := prepareResults()
+	results[0].Results[1].Monitor.Runbook = "https://wiki/down"
+	results[0].Results[1].Monitor.Notes = "Restart the backend"
+
+	tmpl, _ := NewNotifyTemplate("")
+	text, err := tmpl.Render(NewRunSummary(results))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(text, "\n  Runbook: https://wiki/down\n  Notes: Restart the backend") {
+		t.Errorf("expected runbook and notes in notification text, got '%s'", text)
+	}
+}
+
+func TestSendHeartbeat(t *testing.T) {
+	pings := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ping" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		pings++
+	}))
+	defer server.Close()
+
+	if err := sendHeartbeat(server.URL + "/ping"); err != nil || pings != 1 {
+		t.Errorf("expected a single ping, got %d (%v)", pings, err)
+	}
+	if err := sendHeartbeat(server.URL + "/unknown"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("expected the status to be reported, got %v", err)
+	}
+}
+
+func TestRouteResults(t *testing.T) {
+	target := NotifyTarget{Slack: "https://hooks.slack.com/services/T/B/X"}
+	results := prepareResults()
+	results[0].Results[1].Monitor.Notify = &target
+
+	global, routed := routeResults(results)
+	if len(global) != 1 || len(global[0].Results) != 1 || global[0].Results[0].Monitor.Name != "Up" {
+		t.Errorf("expected only 'Up' for the global notifiers, got %+v", global)
+	}
+	if len(routed) != 1 || len(routed[target]) != 1 || routed[target][0].ConfigurationName != "Config one" {
+		t.Errorf("expected 'Down' routed to its target, got %+v", routed)
+	}
+}
+
+func TestSendNotificationsPerMonitor(t *testing.T) {
+	var globalPosts, slackPosts int
+	var message map[string]string
+	global := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		globalPosts++
+	}))
+	defer global.Close()
+	slack := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		slackPosts++
+		json.NewDecoder(r.Body).Decode(&message)
+	}))
+	defer slack.Close()
+
+	results := prepareResults()
+	results[0].Results[1].Monitor.Notify = &NotifyTarget{Slack: slack.URL}
+
+	tmpl, _ := NewNotifyTemplate("")
+	sendNotifications(ioutil.Discard, []Notifier{WebhookNotifier{global.URL, tmpl}}, tmpl, results)
+	if globalPosts != 0 {
+		t.Errorf("expected no global notification without global failures, got %d", globalPosts)
+	}
+	if slackPosts != 1 {
+		t.Fatalf("expected 1 notification to the monitor's target, got %d", slackPosts)
+	}
+	if !strings.Contains(message["text"], "Config one / Down") {
+		t.Errorf("expected the failure in the Slack message, got '%s'", message["text"])
+	}
+}
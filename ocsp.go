@@ -0,0 +1,228 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// The OCSP response (RFC 6960) as stapled by the server, decoded with
+// encoding/asn1. Only basic responses are supported, which is what OCSP
+// responders send.
+type ocspResponse struct {
+	Status   asn1.Enumerated
+	Response ocspResponseBytes `asn1:"explicit,tag:0,optional"`
+}
+
+type ocspResponseBytes struct {
+	ResponseType asn1.ObjectIdentifier
+	Response     []byte
+}
+
+type ocspBasicResponse struct {
+	TBSResponseData    ocspResponseData
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          asn1.BitString
+	Certificates       []asn1.RawValue `asn1:"explicit,tag:0,optional"`
+}
+
+type ocspResponseData struct {
+	Raw         asn1.RawContent
+	Version     int `asn1:"optional,default:0,explicit,tag:0"`
+	ResponderID asn1.RawValue
+	ProducedAt  time.Time `asn1:"generalized"`
+	Responses   []ocspSingleResponse
+}
+
+type ocspSingleResponse struct {
+	CertID           ocspCertID
+	Good             asn1.Flag        `asn1:"tag:0,optional"`
+	Revoked          ocspRevokedInfo  `asn1:"tag:1,optional"`
+	Unknown          asn1.Flag        `asn1:"tag:2,optional"`
+	ThisUpdate       time.Time        `asn1:"generalized"`
+	NextUpdate       time.Time        `asn1:"generalized,explicit,tag:0,optional"`
+	SingleExtensions []pkix.Extension `asn1:"explicit,tag:1,optional"`
+}
+
+type ocspRevokedInfo struct {
+	RevocationTime time.Time       `asn1:"generalized"`
+	Reason         asn1.Enumerated `asn1:"explicit,tag:0,optional"`
+}
+
+type ocspCertID struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	NameHash      []byte
+	IssuerKeyHash []byte
+	SerialNumber  *big.Int
+}
+
+var oidOCSPBasic = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 1}
+
+// The signature algorithms of OCSP responses, by their object identifier.
+var ocspSignatureAlgorithms = map[string]x509.SignatureAlgorithm{
+	"1.2.840.113549.1.1.5":  x509.SHA1WithRSA,
+	"1.2.840.113549.1.1.11": x509.SHA256WithRSA,
+	"1.2.840.113549.1.1.12": x509.SHA384WithRSA,
+	"1.2.840.113549.1.1.13": x509.SHA512WithRSA,
+	"1.2.840.10045.4.1":     x509.ECDSAWithSHA1,
+	"1.2.840.10045.4.3.2":   x509.ECDSAWithSHA256,
+	"1.2.840.10045.4.3.3":   x509.ECDSAWithSHA384,
+	"1.2.840.10045.4.3.4":   x509.ECDSAWithSHA512,
+	"1.3.101.112":           x509.PureEd25519,
+}
+
+// stapledOCSP is the status of the server certificate in a stapled OCSP
+// response.
+type stapledOCSP struct {
+	ProducedAt     time.Time
+	NextUpdate     time.Time // zero when the responder doesn't give one
+	Revoked        bool
+	RevokedAt      time.Time
+	Unknown        bool // the responder doesn't know the certificate
+	serial         *big.Int
+	basic          ocspBasicResponse
+	signatureAlgo  x509.SignatureAlgorithm
+	responderCerts []*x509.Certificate
+}
+
+// parseStapledOCSP decodes the stapled OCSP response of the connection, and
+// returns the status of the server certificate. Returns nil without a stapled
+// response.
+func parseStapledOCSP(state *tls.ConnectionState) (*stapledOCSP, error) {
+	if state == nil || len(state.OCSPResponse) == 0 {
+		return nil, nil
+	}
+
+	var resp ocspResponse
+	if _, err := asn1.Unmarshal(state.OCSPResponse, &resp); err != nil {
+		return nil, fmt.Errorf("malformed OCSP response: %s", err)
+	}
+	if resp.Status != 0 {
+		return nil, fmt.Errorf("OCSP response has status %d, not successful", resp.Status)
+	}
+	if !resp.Response.ResponseType.Equal(oidOCSPBasic) {
+		return nil, fmt.Errorf("unsupported OCSP response type %s", resp.Response.ResponseType)
+	}
+
+	s := &stapledOCSP{}
+	if _, err := asn1.Unmarshal(resp.Response.Response, &s.basic); err != nil {
+		return nil, fmt.Errorf("malformed OCSP response: %s", err)
+	}
+	if len(s.basic.TBSResponseData.Responses) == 0 {
+		return nil, fmt.Errorf("OCSP response has no certificate status")
+	}
+	algo, ok := ocspSignatureAlgorithms[s.basic.SignatureAlgorithm.Algorithm.String()]
+	if !ok {
+		return nil, fmt.Errorf("unsupported OCSP signature algorithm %s", s.basic.SignatureAlgorithm.Algorithm)
+	}
+	s.signatureAlgo = algo
+	for _, raw := range s.basic.Certificates {
+		cert, err := x509.ParseCertificate(raw.FullBytes)
+		if err != nil {
+			return nil, fmt.Errorf("malformed certificate in OCSP response: %s", err)
+		}
+		s.responderCerts = append(s.responderCerts, cert)
+	}
+
+	single := s.basic.TBSResponseData.Responses[0]
+	s.ProducedAt = s.basic.TBSResponseData.ProducedAt
+	s.NextUpdate = single.NextUpdate
+	s.serial = single.CertID.SerialNumber
+	s.Unknown = bool(single.Unknown)
+	if !single.Good && !single.Unknown {
+		s.Revoked = true
+		s.RevokedAt = single.Revoked.RevocationTime
+	}
+	return s, nil
+}
+
+// verify checks that the response is about the certificate, and signed by
+// its issuer, or by a responder the issuer delegated to.
+func (s *stapledOCSP) verify(cert, issuer *x509.Certificate) error {
+	if s.serial == nil || s.serial.Cmp(cert.SerialNumber) != 0 {
+		return fmt.Errorf("OCSP response is not about the certificate of the server")
+	}
+
+	signer := issuer
+	for _, responder := range s.responderCerts {
+		if responder.CheckSignatureFrom(issuer) != nil {
+			continue
+		}
+		for _, usage := range responder.ExtKeyUsage {
+			if usage == x509.ExtKeyUsageOCSPSigning {
+				signer = responder
+			}
+		}
+	}
+	err := signer.CheckSignature(s.signatureAlgo, s.basic.TBSResponseData.Raw, s.basic.Signature.RightAlign())
+	if err != nil {
+		return fmt.Errorf("OCSP response is not signed by the issuer: %s", err)
+	}
+	return nil
+}
+
+// ocspAge returns the age of the stapled OCSP response in seconds, or nil
+// when the server didn't staple a (valid) response.
+func ocspAge(state *tls.ConnectionState, now time.Time) *int64 {
+	s, err := parseStapledOCSP(state)
+	if s == nil || err != nil {
+		return nil
+	}
+	age := int64(now.Sub(s.ProducedAt) / time.Second)
+	return &age
+}
+
+// issuerOf returns the certificate which issued the server certificate: from
+// the verified chain, or else the next certificate served.
+func issuerOf(state *tls.ConnectionState) *x509.Certificate {
+	if len(state.VerifiedChains) > 0 && len(state.VerifiedChains[0]) > 1 {
+		return state.VerifiedChains[0][1]
+	}
+	if len(state.PeerCertificates) > 1 {
+		return state.PeerCertificates[1]
+	}
+	return nil
+}
+
+// checkOCSP checks that the server stapled an OCSP response for its
+// certificate, which is signed by the issuer, not revoked, not expired and
+// no older than the maximum age.
+func checkOCSP(maxAge string, state *tls.ConnectionState, now time.Time) error {
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return fmt.Errorf("assertion failed for ocsp: no TLS connection")
+	}
+	s, err := parseStapledOCSP(state)
+	if err != nil {
+		return fmt.Errorf("assertion failed for ocsp: %s", err)
+	}
+	if s == nil {
+		return fmt.Errorf("assertion failed for ocsp: server doesn't staple an OCSP response")
+	}
+	cert := state.PeerCertificates[0]
+	issuer := issuerOf(state)
+	if issuer == nil {
+		return fmt.Errorf("assertion failed for ocsp: issuer of `%s' is not served", cert.Subject.CommonName)
+	}
+	if err := s.verify(cert, issuer); err != nil {
+		return fmt.Errorf("assertion failed for ocsp: %s", err)
+	}
+
+	switch {
+	case s.Revoked:
+		return fmt.Errorf("assertion failed, certificate of `%s' was revoked at %s", cert.Subject.CommonName, s.RevokedAt.UTC().Format(time.RFC3339))
+	case s.Unknown:
+		return fmt.Errorf("assertion failed, certificate of `%s' is unknown to the OCSP responder", cert.Subject.CommonName)
+	case !s.NextUpdate.IsZero() && now.After(s.NextUpdate):
+		return fmt.Errorf("assertion failed, stapled OCSP response expired at %s", s.NextUpdate.UTC().Format(time.RFC3339))
+	}
+	// the maximum age is validated beforehand.
+	max, _ := time.ParseDuration(maxAge)
+	if age := now.Sub(s.ProducedAt); age > max {
+		return fmt.Errorf("assertion failed, stapled OCSP response is %s old, more than %s", age.Round(time.Second), maxAge)
+	}
+	return nil
+}
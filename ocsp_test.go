@@ -0,0 +1,190 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testPKI is a certificate authority with a server certificate it issued.
+type testPKI struct {
+	caKey   *ecdsa.PrivateKey
+	ca      *x509.Certificate
+	leafKey *ecdsa.PrivateKey
+	leaf    *x509.Certificate
+}
+
+func newTestPKI(t *testing.T) testPKI {
+	var p testPKI
+	var err error
+	p.caKey, _ = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	p.leafKey, _ = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &p.caKey.PublicKey, p.caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.ca, _ = x509.ParseCertificate(der)
+
+	leafTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(42),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err = x509.CreateCertificate(rand.Reader, leafTemplate, p.ca, &p.leafKey.PublicKey, p.caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.leaf, _ = x509.ParseCertificate(der)
+	return p
+}
+
+// ocspResponse returns a stapled OCSP response about the server certificate,
+// with the given status (0 good, 1 revoked, 2 unknown), signed by the key.
+func (p testPKI) ocspResponse(t *testing.T, status int, producedAt time.Time, signer crypto.Signer) []byte {
+	keyHash := sha256.Sum256(p.ca.RawSubjectPublicKeyInfo)
+	single := ocspSingleResponse{
+		CertID: ocspCertID{
+			HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}, Parameters: asn1.NullRawValue},
+			NameHash:      keyHash[:],
+			IssuerKeyHash: keyHash[:],
+			SerialNumber:  p.leaf.SerialNumber,
+		},
+		ThisUpdate: producedAt,
+		NextUpdate: producedAt.Add(7 * 24 * time.Hour),
+	}
+	switch status {
+	case 0:
+		single.Good = true
+	case 1:
+		single.Revoked = ocspRevokedInfo{RevocationTime: producedAt.Add(-time.Hour)}
+	case 2:
+		single.Unknown = true
+	}
+
+	responderID, _ := asn1.Marshal(keyHash[:])
+	tbs, err := asn1.Marshal(ocspResponseData{
+		ResponderID: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 2, IsCompound: true, Bytes: responderID},
+		ProducedAt:  producedAt.UTC().Truncate(time.Second),
+		Responses:   []ocspSingleResponse{single},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256(tbs)
+	signature, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	basic, err := asn1.Marshal(ocspBasicResponse{
+		TBSResponseData:    ocspResponseData{Raw: tbs},
+		SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}},
+		Signature:          asn1.BitString{Bytes: signature, BitLength: 8 * len(signature)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := asn1.Marshal(ocspResponse{Response: ocspResponseBytes{ResponseType: oidOCSPBasic, Response: basic}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+// newStaplingServer starts a TLS server serving the certificate of the PKI
+// (and its CA), stapling the OCSP response if not nil.
+func newStaplingServer(p testPKI, staple []byte) *httptest.Server {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	}))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{{
+		Certificate: [][]byte{p.leaf.Raw, p.ca.Raw},
+		PrivateKey:  p.leafKey,
+		OCSPStaple:  staple,
+	}}}
+	server.StartTLS()
+	return server
+}
+
+func TestRunOCSP(t *testing.T) {
+	p := newTestPKI(t)
+	otherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	now := time.Now()
+
+	tests := []struct {
+		name   string
+		staple []byte
+		maxAge string
+		error  string // expected in the error, empty on success
+	}{
+		{"good", p.ocspResponse(t, 0, now.Add(-time.Hour), p.caKey), "96h", ""},
+		{"no staple", nil, "96h", "doesn't staple"},
+		{"revoked", p.ocspResponse(t, 1, now.Add(-time.Hour), p.caKey), "96h", "was revoked"},
+		{"unknown", p.ocspResponse(t, 2, now.Add(-time.Hour), p.caKey), "96h", "unknown to the OCSP responder"},
+		{"too old", p.ocspResponse(t, 0, now.Add(-48*time.Hour), p.caKey), "24h", "more than 24h"},
+		{"expired", p.ocspResponse(t, 0, now.Add(-8*24*time.Hour), p.caKey), "960h", "expired"},
+		{"other signer", p.ocspResponse(t, 0, now.Add(-time.Hour), otherKey), "96h", "not signed by the issuer"},
+	}
+	for _, test := range tests {
+		server := newStaplingServer(p, test.staple)
+		m := Monitor{URL: server.URL, TLS: &TLSOptions{InsecureSkipVerify: true}, Assertions: []Assertion{{Type: AssertionOCSP, Value: test.maxAge}}}
+		ch := make(chan Result, 1)
+		go m.Run(".", ch)
+		r := <-ch
+		server.Close()
+
+		if test.error == "" && r.Error != nil {
+			t.Errorf("%s: expected no error, got %s", test.name, r.Error)
+		}
+		if test.error != "" && (r.Error == nil || !strings.Contains(r.Error.Error(), test.error) || r.Code != FailureOCSP) {
+			t.Errorf("%s: expected %s error containing '%s', got %v (%s)", test.name, FailureOCSP, test.error, r.Error, r.Code)
+		}
+		if test.staple != nil && (r.OCSPAge == nil || *r.OCSPAge < 3600) {
+			t.Errorf("%s: expected the age of the stapled response in the result, got %v", test.name, r.OCSPAge)
+		}
+		if test.staple == nil && r.OCSPAge != nil {
+			t.Errorf("%s: expected no age without a stapled response, got %d", test.name, *r.OCSPAge)
+		}
+	}
+}
+
+func TestValidateOCSPAssertion(t *testing.T) {
+	for _, value := range []string{"", "0s", "-1h", "a week"} {
+		a := Assertion{Type: AssertionOCSP, Value: value}
+		if err := a.Validate(); err == nil {
+			t.Errorf("expected error for an invalid maximum age '%s'", value)
+		}
+	}
+	a := Assertion{Type: AssertionOCSP, Value: "96h"}
+	if err := a.Validate(); err != nil {
+		t.Errorf("expected no error, got %s", err)
+	}
+	if err := a.Check(200, nil, nil, nil); err == nil {
+		t.Errorf("expected the assertion to fail without a TLS connection")
+	}
+}
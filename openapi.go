@@ -0,0 +1,292 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The methods of the operations of an OpenAPI path item, in the order they're
+// searched.
+var openAPIMethods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+// openAPIDocument is the part of an OpenAPI 3 document (in JSON) needed to
+// run one of its operations.
+type openAPIDocument struct {
+	Servers []openAPIServer
+	Paths   map[string]map[string]json.RawMessage // path -> method (or 'parameters') -> operation
+}
+
+type openAPIServer struct {
+	URL       string
+	Variables map[string]struct{ Default string }
+}
+
+type openAPIOperationSpec struct {
+	OperationID string `json:"operationId"`
+	Parameters  []openAPIParameter
+	RequestBody *struct {
+		Required bool
+		Content  map[string]openAPIMediaType
+	} `json:"requestBody"`
+}
+
+type openAPIParameter struct {
+	Name     string
+	In       string
+	Required bool
+	Example  interface{}
+	Examples map[string]struct{ Value interface{} }
+	Schema   struct{ Example, Default interface{} }
+}
+
+type openAPIMediaType struct {
+	Example  interface{}
+	Examples map[string]struct{ Value interface{} }
+	Schema   struct{ Example interface{} }
+}
+
+// openAPIRequest is the request of an operation, with the documented examples.
+type openAPIRequest struct {
+	Method      string
+	URL         string
+	ContentType string // the media type of the body, if any
+	Body        []byte // nil when the operation has no example body
+}
+
+// example returns the first example of the values: an explicit example, the
+// first of the named examples (sorted by name), or the example of the schema.
+func example(explicit interface{}, examples map[string]struct{ Value interface{} }, fallbacks ...interface{}) interface{} {
+	if explicit != nil {
+		return explicit
+	}
+	var names []string
+	for name := range examples {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if v := examples[name].Value; v != nil {
+			return v
+		}
+	}
+	for _, v := range fallbacks {
+		if v != nil {
+			return v
+		}
+	}
+	return nil
+}
+
+// exampleString returns an example value of a parameter as a string.
+func exampleString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64, bool:
+		return fmt.Sprint(v)
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// serverURL returns the URL of the first server of the document, with its
+// variables replaced by their defaults. Relative URLs are resolved against
+// the URL of the document.
+func (d openAPIDocument) serverURL(docURL string) (string, error) {
+	if len(d.Servers) == 0 {
+		return "", fmt.Errorf("document has no servers, so the monitor needs a 'url'")
+	}
+	s := d.Servers[0]
+	server := s.URL
+	for name, v := range s.Variables {
+		server = strings.Replace(server, "{"+name+"}", v.Default, -1)
+	}
+	ref, err := url.Parse(server)
+	if err != nil {
+		return "", fmt.Errorf("invalid server URL `%s': %s", server, err)
+	}
+	if ref.IsAbs() {
+		return server, nil
+	}
+	base, err := url.Parse(docURL)
+	if err != nil || !base.IsAbs() {
+		return "", fmt.Errorf("server URL `%s' is relative, so the monitor needs a 'url'", server)
+	}
+	return base.ResolveReference(ref).String(), nil
+}
+
+// resolveOperation finds the operation with the given id in the OpenAPI
+// document, and returns its request with the documented examples. The
+// request is made to the base URL, or the first server of the document when
+// the base URL is empty.
+func resolveOperation(doc []byte, docURL, baseURL, operationID string) (openAPIRequest, error) {
+	var d openAPIDocument
+	if err := json.Unmarshal(doc, &d); err != nil {
+		return openAPIRequest{}, fmt.Errorf("unable to parse OpenAPI document: %s", err)
+	}
+
+	var paths []string
+	for path := range d.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		item := d.Paths[path]
+		for _, method := range openAPIMethods {
+			raw, ok := item[method]
+			if !ok {
+				continue
+			}
+			var op openAPIOperationSpec
+			if err := json.Unmarshal(raw, &op); err != nil {
+				return openAPIRequest{}, fmt.Errorf("invalid operation %s %s: %s", strings.ToUpper(method), path, err)
+			}
+			if op.OperationID != operationID {
+				continue
+			}
+
+			// the parameters of the path item apply to all of its operations,
+			// unless the operation overrides them.
+			var shared []openAPIParameter
+			if raw, ok := item["parameters"]; ok {
+				json.Unmarshal(raw, &shared)
+			}
+			for _, p := range shared {
+				overridden := false
+				for _, o := range op.Parameters {
+					overridden = overridden || (o.Name == p.Name && o.In == p.In)
+				}
+				if !overridden {
+					op.Parameters = append(op.Parameters, p)
+				}
+			}
+
+			if baseURL == "" {
+				var err error
+				baseURL, err = d.serverURL(docURL)
+				if err != nil {
+					return openAPIRequest{}, err
+				}
+			}
+			return op.request(strings.ToUpper(method), strings.TrimRight(baseURL, "/")+path)
+		}
+	}
+	return openAPIRequest{}, fmt.Errorf("no operation `%s' in OpenAPI document", operationID)
+}
+
+// request returns the request of the operation to the URL, of which the path
+// parameters are replaced by their examples.
+func (op openAPIOperationSpec) request(method, rawurl string) (openAPIRequest, error) {
+	r := openAPIRequest{Method: method}
+
+	query := url.Values{}
+	for _, p := range op.Parameters {
+		v := example(p.Example, p.Examples, p.Schema.Example, p.Schema.Default)
+		switch p.In {
+		case "path":
+			if v == nil {
+				return r, fmt.Errorf("path parameter `%s' has no example", p.Name)
+			}
+			rawurl = strings.Replace(rawurl, "{"+p.Name+"}", url.PathEscape(exampleString(v)), -1)
+		case "query":
+			// optional query parameters are left out.
+			if v == nil && p.Required {
+				return r, fmt.Errorf("query parameter `%s' has no example", p.Name)
+			}
+			if p.Required {
+				query.Set(p.Name, exampleString(v))
+			}
+		}
+	}
+	if len(query) > 0 {
+		rawurl += "?" + query.Encode()
+	}
+	r.URL = rawurl
+
+	if op.RequestBody == nil || len(op.RequestBody.Content) == 0 {
+		return r, nil
+	}
+	// JSON is preferred, otherwise the first media type is used.
+	var mediaTypes []string
+	for mediaType := range op.RequestBody.Content {
+		mediaTypes = append(mediaTypes, mediaType)
+	}
+	sort.Strings(mediaTypes)
+	r.ContentType = mediaTypes[0]
+	if _, ok := op.RequestBody.Content["application/json"]; ok {
+		r.ContentType = "application/json"
+	}
+
+	content := op.RequestBody.Content[r.ContentType]
+	v := example(content.Example, content.Examples, content.Schema.Example)
+	switch {
+	case v == nil && op.RequestBody.Required:
+		return r, fmt.Errorf("request body of `%s' has no example", r.ContentType)
+	case v == nil:
+		r.ContentType = ""
+	default:
+		if s, ok := v.(string); ok && !strings.Contains(r.ContentType, "json") {
+			r.Body = []byte(s)
+		} else {
+			r.Body, _ = json.Marshal(v)
+		}
+	}
+	return r, nil
+}
+
+// fetchOpenAPI returns the OpenAPI document of the monitor, from its URL or
+// from a file relative to the base directory.
+func (m Monitor) fetchOpenAPI(baseDir string, client *http.Client) ([]byte, error) {
+	if !strings.HasPrefix(m.OpenAPI, "http://") && !strings.HasPrefix(m.OpenAPI, "https://") {
+		b, err := ioutil.ReadFile(filepath.Join(baseDir, m.OpenAPI))
+		if err != nil {
+			return nil, fmt.Errorf("unable to read OpenAPI document `%s': %s", m.OpenAPI, err)
+		}
+		return b, nil
+	}
+
+	resp, err := client.Get(m.OpenAPI)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch OpenAPI document `%s': %s", m.OpenAPI, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unable to fetch OpenAPI document `%s': status %d", m.OpenAPI, resp.StatusCode)
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch OpenAPI document `%s': %s", m.OpenAPI, err)
+	}
+	return b, nil
+}
+
+// withOperation returns the monitor doing the request of its OpenAPI
+// operation, and the request body. The URL of the monitor, if any, replaces
+// the servers of the document. The Content-Type of the body is sent, unless
+// the monitor has a Content-Type header of its own.
+func (m Monitor) withOperation(baseDir string, client *http.Client, timeout time.Duration) (Monitor, []byte, error) {
+	c := *client
+	c.Timeout = timeout
+	doc, err := m.fetchOpenAPI(baseDir, &c)
+	if err != nil {
+		return m, nil, err
+	}
+	r, err := resolveOperation(doc, m.OpenAPI, m.URL, m.Operation)
+	if err != nil {
+		return m, nil, err
+	}
+	m.URL = r.URL
+	m.method = r.Method
+	if r.ContentType != "" {
+		m.Headers = append([]Header{Header("Content-Type: " + r.ContentType)}, m.Headers...)
+	}
+	return m, r.Body, nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testOpenAPI = `{
+	"openapi": "3.0.3",
+	"servers": [{ "url": "/{version}", "variables": { "version": { "default": "v1" } } }],
+	"paths": {
+		"/users/{id}": {
+			"parameters": [{ "name": "id", "in": "path", "required": true, "example": 42 }],
+			"get": {
+				"operationId": "getUser",
+				"parameters": [
+					{ "name": "fields", "in": "query", "required": true, "schema": { "example": "name" } },
+					{ "name": "debug", "in": "query", "example": true }
+				]
+			},
+			"put": {
+				"operationId": "updateUser",
+				"requestBody": {
+					"required": true,
+					"content": {
+						"application/xml": { "example": "<user/>" },
+						"application/json": { "examples": { "b": { "value": { "name": "b" } }, "a": { "value": { "name": "a" } } } }
+					}
+				}
+			}
+		}
+	}
+}`
+
+func TestResolveOperation(t *testing.T) {
+	r, err := resolveOperation([]byte(testOpenAPI), "https://api.example.org/spec/openapi.json", "", "getUser")
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if r.Method != "GET" || r.URL != "https://api.example.org/v1/users/42?fields=name" || r.Body != nil {
+		t.Errorf("unexpected request: %+v", r)
+	}
+
+	r, err = resolveOperation([]byte(testOpenAPI), "openapi.json", "https://test.example.org/", "updateUser")
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if r.Method != "PUT" || r.URL != "https://test.example.org/users/42" {
+		t.Errorf("unexpected request: %+v", r)
+	}
+	if r.ContentType != "application/json" || string(r.Body) != `{"name":"a"}` {
+		t.Errorf("expected the first JSON example, got %s '%s'", r.ContentType, r.Body)
+	}
+
+	tests := map[string]string{
+		"deleteUser": "no operation `deleteUser'",
+		"getUser":    "is relative, so the monitor needs a 'url'",
+	}
+	for operation, expected := range tests {
+		_, err := resolveOperation([]byte(testOpenAPI), "openapi.json", "", operation)
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected an error containing '%s' for %s, got %v", expected, operation, err)
+		}
+	}
+}
+
+func TestRunOpenAPI(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/openapi.json" {
+			fmt.Fprint(w, testOpenAPI)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		fmt.Fprintf(w, "%s %s %s %s", r.Method, r.URL, r.Header.Get("Content-Type"), body)
+	}))
+	defer server.Close()
+
+	m := Monitor{OpenAPI: server.URL + "/openapi.json", Operation: "updateUser", Assertions: []Assertion{{Value: `PUT /v1/users/42 application/json \{"name":"a"\}`}}}
+	ch := make(chan Result, 1)
+	go m.Run(".", ch)
+	r := <-ch
+	if r.Error != nil {
+		t.Errorf("expected no error, got %s", r.Error)
+	}
+	if r.Monitor.URL != server.URL+"/v1/users/42" {
+		t.Errorf("expected the URL of the operation in the result, got '%s'", r.Monitor.URL)
+	}
+
+	m.Operation = "deleteUser"
+	go m.Run(".", ch)
+	if r := <-ch; r.Code != FailureConfig {
+		t.Errorf("expected %s for an unknown operation, got %s (%v)", FailureConfig, r.Code, r.Error)
+	}
+}
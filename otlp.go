@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The signals which can be exported over OTLP.
+const (
+	SignalTraces  = "traces"
+	SignalMetrics = "metrics"
+)
+
+// The kinds and status codes of OTLP spans.
+const (
+	otlpSpanKindInternal = 1
+	otlpSpanKindClient   = 3
+	otlpStatusOk         = 1
+	otlpStatusError      = 2
+)
+
+// OTLPExporter exports the results of a run to an OpenTelemetry collector,
+// with OTLP over HTTP in the JSON encoding. Every monitor run is a span (in a
+// trace of its own) with its phases as child spans, and the results are
+// gauges.
+type OTLPExporter struct {
+	Endpoint string // the base URL of the collector, like http://localhost:4318
+	Traces   bool   // export the spans
+	Metrics  bool   // export the gauges
+}
+
+// NewOTLPExporter creates an exporter for the endpoint, exporting the signals
+// in the comma separated list.
+func NewOTLPExporter(endpoint, signals string) (*OTLPExporter, error) {
+	if !strings.HasPrefix(endpoint, "http://") && !strings.HasPrefix(endpoint, "https://") {
+		return nil, fmt.Errorf("OTLP endpoint `%s' must be an http(s) URL", endpoint)
+	}
+	e := &OTLPExporter{Endpoint: strings.TrimRight(endpoint, "/")}
+	for _, signal := range splitList(signals) {
+		switch signal {
+		case SignalTraces:
+			e.Traces = true
+		case SignalMetrics:
+			e.Metrics = true
+		default:
+			return nil, fmt.Errorf("unknown OTLP signal '%s' (must be traces or metrics)", signal)
+		}
+	}
+	if !e.Traces && !e.Metrics {
+		return nil, fmt.Errorf("no OTLP signals to export")
+	}
+	return e, nil
+}
+
+type otlpValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"` // 64 bit integers are strings in JSON
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+func stringAttribute(key, value string) otlpAttribute {
+	return otlpAttribute{key, otlpValue{StringValue: &value}}
+}
+
+func intAttribute(key string, value int64) otlpAttribute {
+	s := strconv.FormatInt(value, 10)
+	return otlpAttribute{key, otlpValue{IntValue: &s}}
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScope struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            *otlpStatus     `json:"status,omitempty"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpTraces struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpDataPoint struct {
+	Attributes   []otlpAttribute `json:"attributes"`
+	TimeUnixNano string          `json:"timeUnixNano"`
+	AsInt        string          `json:"asInt"`
+}
+
+type otlpMetric struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Unit        string `json:"unit,omitempty"`
+	Gauge       struct {
+		DataPoints []otlpDataPoint `json:"dataPoints"`
+	} `json:"gauge"`
+}
+
+type otlpScopeMetrics struct {
+	Scope   otlpScope    `json:"scope"`
+	Metrics []otlpMetric `json:"metrics"`
+}
+
+type otlpResourceMetrics struct {
+	Resource     otlpResource       `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpMetrics struct {
+	ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+// The resource and scope of everything exported.
+var (
+	otlpHmonResource = otlpResource{[]otlpAttribute{stringAttribute("service.name", "hmon"), stringAttribute("service.version", VERSION)}}
+	otlpHmonScope    = otlpScope{"hmon", VERSION}
+)
+
+// otlpID returns a random trace or span ID of n bytes, hex encoded.
+func otlpID(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+// otlpResultAttributes returns the attributes identifying the result.
+func otlpResultAttributes(configName string, r Result) []otlpAttribute {
+	attributes := []otlpAttribute{
+		stringAttribute("hmon.configuration", configName),
+		stringAttribute("hmon.monitor", r.Monitor.Name),
+	}
+	if r.Monitor.Owner != "" {
+		attributes = append(attributes, stringAttribute("hmon.owner", r.Monitor.Owner))
+	}
+	return attributes
+}
+
+// resultSpans returns the span of the monitor run, and a child span for each
+// of its phases. The durations of the phases are known, but not when they
+// started, so they're laid out one after the other from the start of the run.
+func resultSpans(configName string, r Result) []otlpSpan {
+	traceID, spanID := otlpID(16), otlpID(8)
+	end := r.Time.Add(time.Duration(r.Latency) * time.Millisecond)
+
+	span := otlpSpan{
+		TraceID:           traceID,
+		SpanID:            spanID,
+		Name:              r.Monitor.Name,
+		Kind:              otlpSpanKindClient,
+		StartTimeUnixNano: unixNano(r.Time),
+		EndTimeUnixNano:   unixNano(end),
+		Attributes:        otlpResultAttributes(configName, r),
+		Status:            &otlpStatus{Code: otlpStatusOk},
+	}
+	span.Attributes = append(span.Attributes,
+		stringAttribute("url.full", r.Monitor.URL),
+		intAttribute("hmon.bytes_sent", r.BytesSent),
+		intAttribute("hmon.bytes_received", r.BytesReceived))
+	if r.StatusCode > 0 {
+		span.Attributes = append(span.Attributes, intAttribute("http.response.status_code", int64(r.StatusCode)))
+	}
+	if r.Error != nil {
+		span.Status = &otlpStatus{Code: otlpStatusError, Message: r.Error.Error()}
+		if r.Code != "" {
+			span.Attributes = append(span.Attributes, stringAttribute("hmon.code", r.Code))
+		}
+	}
+
+	spans := []otlpSpan{span}
+	start := r.Time
+	phases := []struct {
+		name     string
+		duration int64
+	}{
+		{"dns", r.Phases.DNS},
+		{"connect", r.Phases.Connect},
+		{"tls", r.Phases.TLS},
+		{"first_byte", r.Phases.FirstByte},
+	}
+	for _, phase := range phases {
+		if phase.duration <= 0 {
+			continue
+		}
+		phaseEnd := start.Add(time.Duration(phase.duration) * time.Millisecond)
+		spans = append(spans, otlpSpan{
+			TraceID:           traceID,
+			SpanID:            otlpID(8),
+			ParentSpanID:      spanID,
+			Name:              phase.name,
+			Kind:              otlpSpanKindInternal,
+			StartTimeUnixNano: unixNano(start),
+			EndTimeUnixNano:   unixNano(phaseEnd),
+		})
+		start = phaseEnd
+	}
+	return spans
+}
+
+// tracesRequest returns the OTLP request with the spans of all results.
+func tracesRequest(configResults []ConfigurationResult) otlpTraces {
+	spans := []otlpSpan{}
+	for _, cr := range configResults {
+		for _, r := range cr.Results {
+			spans = append(spans, resultSpans(cr.ConfigurationName, r)...)
+		}
+	}
+	scope := otlpScopeSpans{otlpHmonScope, spans}
+	return otlpTraces{[]otlpResourceSpans{{otlpHmonResource, []otlpScopeSpans{scope}}}}
+}
+
+// metricsRequest returns the OTLP request with the gauges of all results.
+func metricsRequest(configResults []ConfigurationResult, now time.Time) otlpMetrics {
+	up := otlpMetric{Name: "hmon.monitor.up", Description: "Whether the monitor succeeded (1) or failed (0)."}
+	latency := otlpMetric{Name: "hmon.monitor.latency", Description: "Latency of the request of the monitor.", Unit: "ms"}
+	up.Gauge.DataPoints = []otlpDataPoint{}
+	latency.Gauge.DataPoints = []otlpDataPoint{}
+	for _, cr := range configResults {
+		for _, r := range cr.Results {
+			attributes := otlpResultAttributes(cr.ConfigurationName, r)
+			value := "1"
+			if r.Error != nil {
+				value = "0"
+			}
+			up.Gauge.DataPoints = append(up.Gauge.DataPoints, otlpDataPoint{attributes, unixNano(now), value})
+			latency.Gauge.DataPoints = append(latency.Gauge.DataPoints, otlpDataPoint{attributes, unixNano(now), strconv.FormatInt(r.Latency, 10)})
+		}
+	}
+
+	scope := otlpScopeMetrics{otlpHmonScope, []otlpMetric{up, latency}}
+	return otlpMetrics{[]otlpResourceMetrics{{otlpHmonResource, []otlpScopeMetrics{scope}}}}
+}
+
+// post posts the OTLP request to the path of the endpoint.
+func (e *OTLPExporter) post(path string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("error marshaling OTLP request: %s", err)
+	}
+
+	url := e.Endpoint + path
+	client := http.Client{Timeout: notifyTimeout}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	ioutil.ReadAll(resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("export to `%s' failed with status %s", url, resp.Status)
+	}
+	return nil
+}
+
+// Export exports the spans and gauges of the results.
+func (e *OTLPExporter) Export(configResults []ConfigurationResult) error {
+	if e.Traces {
+		if err := e.post("/v1/traces", tracesRequest(configResults)); err != nil {
+			return err
+		}
+	}
+	if e.Metrics {
+		if err := e.post("/v1/metrics", metricsRequest(configResults, time.Now())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
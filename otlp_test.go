@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNewOTLPExporter(t *testing.T) {
+	for _, test := range []struct{ endpoint, signals string }{
+		{"localhost:4318", "traces"},
+		{"http://localhost:4318", "logs"},
+		{"http://localhost:4318", ""},
+	} {
+		if _, err := NewOTLPExporter(test.endpoint, test.signals); err == nil {
+			t.Errorf("expected error for endpoint '%s' and signals '%s'", test.endpoint, test.signals)
+		}
+	}
+	e, err := NewOTLPExporter("http://localhost:4318/", "metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Endpoint != "http://localhost:4318" || e.Traces || !e.Metrics {
+		t.Errorf("expected only metrics to http://localhost:4318, got %+v", e)
+	}
+}
+
+func TestOTLPExport(t *testing.T) {
+	requests := make(map[string][]byte)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("expected JSON, got %s", r.Header.Get("Content-Type"))
+		}
+		requests[r.URL.Path], _ = ioutil.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	ok := Result{Monitor: Monitor{Name: "status", URL: "http://example.com"}, Time: time.Now(), Latency: 30, StatusCode: 200, Phases: Phases{DNS: 5, Connect: 10, FirstByte: 15}}
+	failed := Result{Monitor: Monitor{Name: "orders", Owner: "team"}, Time: time.Now(), Latency: 10, Error: ResultError{errors.New("timeout")}, Code: FailureTimeout}
+	configResults := []ConfigurationResult{{ConfigurationName: "shop", Results: []Result{ok, failed}}}
+
+	e, err := NewOTLPExporter(server.URL, "traces,metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Export(configResults); err != nil {
+		t.Fatal(err)
+	}
+
+	var traces otlpTraces
+	if err := json.Unmarshal(requests["/v1/traces"], &traces); err != nil {
+		t.Fatal(err)
+	}
+	spans := traces.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 5 {
+		t.Fatalf("expected 5 spans (2 runs, 3 phases), got %d", len(spans))
+	}
+	if spans[0].Name != "status" || spans[0].Status.Code != otlpStatusOk {
+		t.Errorf("expected successful span 'status', got %+v", spans[0])
+	}
+	for _, span := range spans[1:4] {
+		if span.ParentSpanID != spans[0].SpanID || span.TraceID != spans[0].TraceID {
+			t.Errorf("expected phase %s to be a child of the run", span.Name)
+		}
+	}
+	if spans[3].Name != "first_byte" || spans[3].StartTimeUnixNano != unixNano(ok.Time.Add(15*time.Millisecond)) {
+		t.Errorf("expected first_byte to start after dns and connect, got %+v", spans[3])
+	}
+	run := spans[4]
+	if run.Status.Code != otlpStatusError || run.Status.Message != "timeout" || run.ParentSpanID != "" {
+		t.Errorf("expected failed span 'orders', got %+v", run)
+	}
+	if a := run.Attributes[len(run.Attributes)-1]; a.Key != "hmon.code" || *a.Value.StringValue != FailureTimeout {
+		t.Errorf("expected hmon.code attribute, got %+v", a)
+	}
+
+	var metrics otlpMetrics
+	if err := json.Unmarshal(requests["/v1/metrics"], &metrics); err != nil {
+		t.Fatal(err)
+	}
+	up := metrics.ResourceMetrics[0].ScopeMetrics[0].Metrics[0]
+	if up.Name != "hmon.monitor.up" || up.Gauge.DataPoints[0].AsInt != "1" || up.Gauge.DataPoints[1].AsInt != "0" {
+		t.Errorf("expected hmon.monitor.up 1 and 0, got %+v", up)
+	}
+}
+
+func TestOTLPExportStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	e, _ := NewOTLPExporter(server.URL, "traces")
+	if err := e.Export(nil); err == nil {
+		t.Errorf("expected error on status 400")
+	}
+}
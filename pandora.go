@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The statuses of PandoraFMS modules.
+const (
+	PandoraNormal   = "NORMAL"
+	PandoraWarning  = "WARNING"
+	PandoraCritical = "CRITICAL"
+)
+
+// The keys of the pandora_status table besides the failure codes: the status
+// of failures without a code of their own in the table, and of results with
+// only warnings.
+const (
+	pandoraStatusFailure = "failure"
+	pandoraStatusWarning = "warning"
+)
+
+// validatePandoraStatus validates the pandora_status table of a monitor, which
+// maps failure codes (like HM-TIMEOUT), 'failure' and 'warning' to a status.
+func validatePandoraStatus(statuses map[string]string) []string {
+	var errs []string
+	for key, status := range statuses {
+		if key != pandoraStatusFailure && key != pandoraStatusWarning && !strings.HasPrefix(key, "HM-") {
+			errs = append(errs, fmt.Sprintf("pandora_status has an invalid key '%s' (must be a failure code, failure or warning)", key))
+		}
+		if status != PandoraNormal && status != PandoraWarning && status != PandoraCritical {
+			errs = append(errs, fmt.Sprintf("pandora_status '%s' has an invalid status '%s' (must be NORMAL, WARNING or CRITICAL)", key, status))
+		}
+	}
+	return errs
+}
+
+// pandoraStatus returns the status of the Pandora module of the result.
+// Failures are CRITICAL and results with only warnings NORMAL, unless the
+// pandora_status of the monitor says otherwise.
+func pandoraStatus(r Result) string {
+	statuses := r.Monitor.PandoraStatus
+	if r.Error != nil {
+		if status, ok := statuses[r.Code]; ok {
+			return status
+		}
+		if status, ok := statuses[pandoraStatusFailure]; ok {
+			return status
+		}
+		return PandoraCritical
+	}
+	if len(r.Warnings) > 0 {
+		if status, ok := statuses[pandoraStatusWarning]; ok {
+			return status
+		}
+	}
+	return PandoraNormal
+}
+
+// mergePandoraStatus merges the pandora_status of the configuration into the
+// monitors. The statuses of a monitor take precedence.
+func (c *Config) mergePandoraStatus() {
+	if len(c.PandoraStatus) == 0 {
+		return
+	}
+	for key, monitor := range c.Monitor {
+		statuses := make(map[string]string, len(c.PandoraStatus)+len(monitor.PandoraStatus))
+		for code, status := range c.PandoraStatus {
+			statuses[code] = status
+		}
+		for code, status := range monitor.PandoraStatus {
+			statuses[code] = status
+		}
+		monitor.PandoraStatus = statuses
+		c.Monitor[key] = monitor
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestPandoraStatus(t *testing.T) {
+	statuses := map[string]string{FailureTimeout: PandoraWarning, "warning": PandoraWarning}
+	failed := ResultError{errors.New("failed")}
+
+	tests := []struct {
+		result Result
+		status string
+	}{
+		{Result{}, PandoraNormal},
+		{Result{Error: failed, Code: FailureTimeout}, PandoraCritical},
+		{Result{Warnings: []string{"slow"}}, PandoraNormal},
+		{Result{Monitor: Monitor{PandoraStatus: statuses}, Error: failed, Code: FailureTimeout}, PandoraWarning},
+		{Result{Monitor: Monitor{PandoraStatus: statuses}, Error: failed, Code: FailureStatus}, PandoraCritical},
+		{Result{Monitor: Monitor{PandoraStatus: statuses}, Warnings: []string{"slow"}}, PandoraWarning},
+		{Result{Monitor: Monitor{PandoraStatus: map[string]string{"failure": PandoraWarning}}, Error: failed, Code: FailureStatus}, PandoraWarning},
+	}
+	for i, test := range tests {
+		if status := pandoraStatus(test.result); status != test.status {
+			t.Errorf("%d: expected status %s, got %s", i, test.status, status)
+		}
+	}
+
+	errs := validatePandoraStatus(map[string]string{"timeout": PandoraWarning, FailureDNS: "critical"})
+	if len(errs) != 2 {
+		t.Errorf("expected 2 errors for an invalid key and status, got %v", errs)
+	}
+}
+
+func TestMergePandoraStatus(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hmon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := path.Join(dir, "pandora_hmon.toml")
+	content := `name = "Pandora"
+
+[pandora_status]
+HM-TIMEOUT = "WARNING"
+warning = "WARNING"
+
+[monitor.Home]
+url = "http://example.org"
+
+[monitor.Checkout]
+url = "http://example.org/checkout"
+pandora_status = { HM-TIMEOUT = "CRITICAL" }
+`
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := ReadConfig(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	home, checkout := c.Monitor["Home"].PandoraStatus, c.Monitor["Checkout"].PandoraStatus
+	if home[FailureTimeout] != PandoraWarning || home["warning"] != PandoraWarning {
+		t.Errorf("expected the statuses of the configuration, got %v", home)
+	}
+	if checkout[FailureTimeout] != PandoraCritical || checkout["warning"] != PandoraWarning {
+		t.Errorf("expected the statuses of the monitor to take precedence, got %v", checkout)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// Returns true if c separates path elements. Both slashes are accepted, so
+// configurations written on Windows and Unix work on either.
+func isPathSeparator(c byte) bool {
+	return c == '/' || c == '\\'
+}
+
+// uncPrefix returns the \\server\share prefix of a UNC path, as written in p
+// (with either kind of slashes), or an empty string if p is not a UNC path.
+func uncPrefix(p string) string {
+	if len(p) < 5 || !isPathSeparator(p[0]) || !isPathSeparator(p[1]) || isPathSeparator(p[2]) {
+		return ""
+	}
+	// the server name, followed by the share name.
+	i := 2
+	for i < len(p) && !isPathSeparator(p[i]) {
+		i++
+	}
+	if i+1 >= len(p) || isPathSeparator(p[i+1]) {
+		return ""
+	}
+	i++
+	for i < len(p) && !isPathSeparator(p[i]) {
+		i++
+	}
+	return p[:i]
+}
+
+// Returns true if p starts with a drive letter, like C: or c:\.
+func hasDriveLetter(p string) bool {
+	return len(p) >= 2 && p[1] == ':' && (p[0] >= 'a' && p[0] <= 'z' || p[0] >= 'A' && p[0] <= 'Z')
+}
+
+// isAbsPath returns true if p is absolute on this platform, or is a Windows
+// UNC path or a path with a drive letter. The latter are checked on every
+// platform, so a file referring to a Windows share is never joined with the
+// base directory.
+func isAbsPath(p string) bool {
+	return filepath.IsAbs(p) || uncPrefix(p) != "" || hasDriveLetter(p)
+}
+
+// resolveFile resolves a file referenced in a configuration (like a request
+// file) relative to the base directory. Forward slashes in the file are
+// converted to the separator of the platform. Absolute files, UNC paths and
+// paths with a drive letter are used as-is. A base directory on a UNC share
+// keeps its \\server\share prefix, which filepath.Join would otherwise clean
+// to a single slash on Unix.
+func resolveFile(baseDir, file string) string {
+	file = filepath.FromSlash(file)
+	if isAbsPath(file) {
+		return file
+	}
+	if prefix := uncPrefix(baseDir); prefix != "" {
+		rest := filepath.Join(string(filepath.Separator), filepath.FromSlash(baseDir[len(prefix):]), file)
+		return prefix + strings.TrimSuffix(rest, string(filepath.Separator))
+	}
+	return filepath.Join(baseDir, file)
+}
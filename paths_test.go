@@ -0,0 +1,78 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUNCPrefix(t *testing.T) {
+	cases := map[string]string{
+		`\\server\share\postdata`: `\\server\share`,
+		`//server/share/postdata`: `//server/share`,
+		`\\server\share`:          `\\server\share`,
+		`\\server`:                "",
+		`\\\server\share`:         "",
+		`C:\postdata`:             "",
+		`/postdata`:               "",
+		`postdata`:                "",
+	}
+	for p, expected := range cases {
+		if prefix := uncPrefix(p); prefix != expected {
+			t.Errorf("expected prefix '%s' for '%s', got '%s'", expected, p, prefix)
+		}
+	}
+}
+
+func TestIsAbsPath(t *testing.T) {
+	for _, p := range []string{`\\server\share\req.xml`, `C:\postdata\req.xml`, `c:/postdata/req.xml`} {
+		if !isAbsPath(p) {
+			t.Errorf("expected '%s' to be absolute", p)
+		}
+	}
+	for _, p := range []string{`req.xml`, `sub/req.xml`, `..\req.xml`} {
+		if isAbsPath(p) {
+			t.Errorf("expected '%s' to be relative", p)
+		}
+	}
+}
+
+func TestResolveFile(t *testing.T) {
+	sep := string(filepath.Separator)
+	cases := []struct {
+		baseDir, file, expected string
+	}{
+		{".", "req.xml", "req.xml"},
+		{"postdata", "sub/req.xml", "postdata" + sep + "sub" + sep + "req.xml"},
+		{`\\server\share`, "req.xml", `\\server\share` + sep + "req.xml"},
+		{"//server/share/postdata", "sub/req.xml", "//server/share" + sep + "postdata" + sep + "sub" + sep + "req.xml"},
+		{"postdata", `\\server\share\req.xml`, `\\server\share\req.xml`},
+		{"postdata", `C:\requests\req.xml`, `C:\requests\req.xml`},
+	}
+	for _, c := range cases {
+		if file := resolveFile(c.baseDir, c.file); file != c.expected {
+			t.Errorf("expected '%s' for '%s' in '%s', got '%s'", c.expected, c.file, c.baseDir, file)
+		}
+	}
+}
+
+func TestReadRequestFileSubdirectory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hmon-paths")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	os.Mkdir(filepath.Join(dir, "soap"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "soap", "envelope.xml"), []byte("<envelope/>"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "soap", "req.xml"), []byte(`{{ include "soap/envelope.xml" }}`), 0644)
+
+	b, err := ReadRequestFile(dir, "soap/req.xml")
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if string(b) != "<envelope/>" {
+		t.Errorf("expected the included envelope, got '%s'", b)
+	}
+}
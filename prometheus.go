@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// The metrics written in the Prometheus format, with their type and help.
+var prometheusMetrics = []struct {
+	name, kind, help string
+	value            func(Result) float64
+}{
+	{"hmon_monitor_up", "gauge", "Whether the monitor succeeded (1) or failed (0).", func(r Result) float64 {
+		if r.Error == nil {
+			return 1
+		}
+		return 0
+	}},
+	{"hmon_monitor_latency_seconds", "gauge", "Latency of the request of the monitor.", func(r Result) float64 {
+		return float64(r.Latency) / 1000
+	}},
+	{"hmon_monitor_scheduler_wait_seconds", "gauge", "Time the request of the monitor waited to be started by hmon, not part of the latency.", func(r Result) float64 {
+		return float64(r.SchedulerWait) / 1000
+	}},
+	{"hmon_monitor_warnings", "gauge", "Amount of warnings of the monitor, like assertions with severity warning.", func(r Result) float64 {
+		return float64(len(r.Warnings))
+	}},
+	{"hmon_monitor_bytes_sent", "gauge", "Bytes sent over the wire by the monitor.", func(r Result) float64 {
+		return float64(r.BytesSent)
+	}},
+	{"hmon_monitor_bytes_received", "gauge", "Bytes received over the wire by the monitor.", func(r Result) float64 {
+		return float64(r.BytesReceived)
+	}},
+}
+
+// Escapes a Prometheus label value.
+func escapePrometheusLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+// formatPrometheus writes the results in the Prometheus text exposition
+// format, with the time of the run as hmon_last_run_timestamp_seconds.
+func formatPrometheus(w io.Writer, results []ConfigurationResult, now time.Time) {
+	for _, metric := range prometheusMetrics {
+		fmt.Fprintf(w, "# HELP %s %s\n", metric.name, metric.help)
+		fmt.Fprintf(w, "# TYPE %s %s\n", metric.name, metric.kind)
+		for _, cr := range results {
+			for _, r := range cr.Results {
+				// the owner label is only added for monitors with an owner.
+				owner := ""
+				if r.Monitor.Owner != "" {
+					owner = ",owner=\"" + escapePrometheusLabel(r.Monitor.Owner) + "\""
+				}
+				fmt.Fprintf(w, "%s{config=\"%s\",monitor=\"%s\",url=\"%s\"%s} %g\n",
+					metric.name,
+					escapePrometheusLabel(cr.ConfigurationName),
+					escapePrometheusLabel(r.Monitor.Name),
+					escapePrometheusLabel(r.Monitor.URL),
+					owner,
+					metric.value(r))
+			}
+		}
+	}
+	fmt.Fprintf(w, "# HELP hmon_last_run_timestamp_seconds Time of the last run of hmon.\n")
+	fmt.Fprintf(w, "# TYPE hmon_last_run_timestamp_seconds gauge\n")
+	fmt.Fprintf(w, "hmon_last_run_timestamp_seconds %d\n", now.Unix())
+}
+
+// Writes the results to the given filename in the Prometheus text format,
+// for instance for the textfile collector of the node exporter. The file is
+// replaced atomically, so it's never read half written.
+func writePrometheus(filename string, r *[]ConfigurationResult) error {
+	var buf bytes.Buffer
+	formatPrometheus(&buf, *r, time.Now())
+	if filename == stdoutOutput {
+		_, err := os.Stdout.Write(buf.Bytes())
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(path.Dir(filename), ".hmon-metrics")
+	if err != nil {
+		return fmt.Errorf("unable to write to file `%s': %s", filename, err)
+	}
+	_, err = tmp.Write(buf.Bytes())
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filename)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("unable to write to file `%s': %s", filename, err)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatPrometheus(t *testing.T) {
+	results := []ConfigurationResult{
+		{
+			ConfigurationName: "Config one",
+			Results: []Result{
+				{Monitor: Monitor{Name: `Say "hi"`, URL: "http://example.org"}, Latency: 1500},
+				{Monitor: Monitor{Name: "Down", URL: "http://example.com"}, Error: ResultError{errors.New("timeout")}},
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	formatPrometheus(&buf, results, time.Unix(1425211200, 0))
+	text := buf.String()
+
+	expected := []string{
+		"# TYPE hmon_monitor_up gauge\n",
+		`hmon_monitor_up{config="Config one",monitor="Say \"hi\"",url="http://example.org"} 1` + "\n",
+		`hmon_monitor_up{config="Config one",monitor="Down",url="http://example.com"} 0` + "\n",
+		`hmon_monitor_latency_seconds{config="Config one",monitor="Say \"hi\"",url="http://example.org"} 1.5` + "\n",
+		"hmon_last_run_timestamp_seconds 1425211200\n",
+	}
+	for _, e := range expected {
+		if !strings.Contains(text, e) {
+			t.Errorf("expected '%s' in the output, got:\n%s", e, text)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+)
+
+// The group of the results of monitors without an owner, with -by-owner.
+const noOwner = "(no owner)"
+
+// reportedResult is a single result read from the JSON output of a run.
+type reportedResult struct {
+	ConfigurationName string
+	Name              string
+	Owner             string
+	Error             string // empty when the monitor succeeded
+	Code              string
+	Latency           int64
+}
+
+// ReadResults reads the JSON output (-format json) of a run.
+func ReadResults(file string) ([]reportedResult, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []struct {
+		ConfigurationName string
+		Results           []struct {
+			Monitor struct{ Name, Owner string }
+			Error   *string
+			Code    string
+			Latency int64
+		}
+	}
+	if err := json.Unmarshal(b, &results); err != nil {
+		return nil, fmt.Errorf("unable to parse results `%s': %s", file, err)
+	}
+
+	var reported []reportedResult
+	for _, cr := range results {
+		for _, r := range cr.Results {
+			rr := reportedResult{ConfigurationName: cr.ConfigurationName, Name: r.Monitor.Name, Owner: r.Monitor.Owner, Code: r.Code, Latency: r.Latency}
+			if r.Error != nil {
+				rr.Error = *r.Error
+			}
+			reported = append(reported, rr)
+		}
+	}
+	return reported, nil
+}
+
+// reportGroup is the aggregation of the results of a configuration, or of an
+// owner.
+type reportGroup struct {
+	Name     string
+	Total    int
+	Failures []reportedResult
+}
+
+// groupResults aggregates the results per owner, or per configuration when
+// byOwner is false. The groups are sorted by name.
+func groupResults(results []reportedResult, byOwner bool) []reportGroup {
+	groups := make(map[string]*reportGroup)
+	var names []string
+	for _, r := range results {
+		name := r.ConfigurationName
+		if byOwner {
+			name = r.Owner
+			if name == "" {
+				name = noOwner
+			}
+		}
+		g, ok := groups[name]
+		if !ok {
+			g = &reportGroup{Name: name}
+			groups[name] = g
+			names = append(names, name)
+		}
+		g.Total++
+		if r.Error != "" {
+			g.Failures = append(g.Failures, r)
+		}
+	}
+
+	sort.Strings(names)
+	var sorted []reportGroup
+	for _, name := range names {
+		sorted = append(sorted, *groups[name])
+	}
+	return sorted
+}
+
+// printReport prints the groups, with the failures of each.
+func printReport(w io.Writer, groups []reportGroup) {
+	for _, g := range groups {
+		fmt.Fprintf(w, "%s: %d of %d monitors failed\n", g.Name, len(g.Failures), g.Total)
+		for _, f := range g.Failures {
+			text := f.Error
+			if f.Code != "" {
+				text = "[" + f.Code + "] " + text
+			}
+			fmt.Fprintf(w, "  - %s / %s: %s\n", f.ConfigurationName, f.Name, text)
+		}
+	}
+}
+
+// Runs the 'report' subcommand with the given arguments. Prints the totals and
+// failures of the JSON results of a run, per configuration or per owner.
+// Returns the exit code.
+func runReport(args []string) int {
+	fs := flag.NewFlagSet("report", flag.ContinueOnError)
+	byOwner := fs.Bool("by-owner", false, "Aggregate the results per owner, instead of per configuration.")
+	owner := fs.String("owner", "", "Only report the monitors of this owner.")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: hmon report [flags] <results.json>\n\n")
+		fmt.Fprintf(os.Stderr, "Reports the totals and failures of the JSON results (-format json) of a\n")
+		fmt.Fprintf(os.Stderr, "run, per configuration or per owner.\n\n")
+		fs.PrintDefaults()
+	}
+
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return flagExitCode(err)
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return ExitUsage
+	}
+
+	results, err := ReadResults(positional[0])
+	if err != nil {
+		fmt.Printf("Unable to read results: %s\n", err)
+		return ExitUsage
+	}
+	if *owner != "" {
+		var owned []reportedResult
+		for _, r := range results {
+			if r.Owner == *owner {
+				owned = append(owned, r)
+			}
+		}
+		results = owned
+	}
+
+	printReport(os.Stdout, groupResults(results, *byOwner))
+	return ExitOK
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadResults(t *testing.T) {
+	configResults := []ConfigurationResult{
+		{
+			ConfigurationName: "Shop",
+			Results: []Result{
+				{Monitor: Monitor{Name: "Checkout", Owner: "team-payments"}, Error: ResultError{errors.New("timeout after 100 ms")}, Code: FailureTimeout, Latency: 100},
+				{Monitor: Monitor{Name: "Home"}},
+			},
+		},
+	}
+	b, err := json.Marshal(configResults)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "hmon-report")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "results.json")
+	if err := ioutil.WriteFile(file, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := ReadResults(file)
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(results))
+	}
+	expected := reportedResult{"Shop", "Checkout", "team-payments", "timeout after 100 ms", FailureTimeout, 100}
+	if results[0] != expected {
+		t.Errorf("expected %+v, got %+v", expected, results[0])
+	}
+	if results[1].Error != "" || results[1].Owner != "" {
+		t.Errorf("expected a successful result without owner, got %+v", results[1])
+	}
+}
+
+func TestGroupResults(t *testing.T) {
+	results := []reportedResult{
+		{ConfigurationName: "Shop", Name: "Checkout", Owner: "team-payments", Error: "timeout after 100 ms", Code: FailureTimeout},
+		{ConfigurationName: "Shop", Name: "Home"},
+		{ConfigurationName: "Bank", Name: "Transfer", Owner: "team-payments"},
+	}
+
+	groups := groupResults(results, true)
+	if len(groups) != 2 || groups[0].Name != noOwner || groups[1].Name != "team-payments" {
+		t.Fatalf("expected groups '%s' and 'team-payments', got %+v", noOwner, groups)
+	}
+	if groups[1].Total != 2 || len(groups[1].Failures) != 1 {
+		t.Errorf("expected 1 of 2 failures for team-payments, got %+v", groups[1])
+	}
+
+	groups = groupResults(results, false)
+	if len(groups) != 2 || groups[0].Name != "Bank" || groups[1].Name != "Shop" {
+		t.Errorf("expected groups per configuration, got %+v", groups)
+	}
+
+	var buf bytes.Buffer
+	printReport(&buf, groupResults(results, true))
+	if !strings.Contains(buf.String(), "team-payments: 1 of 2 monitors failed\n  - Shop / Checkout: [HM-TIMEOUT] timeout after 100 ms\n") {
+		t.Errorf("unexpected report: '%s'", buf.String())
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The request file of monitors which POST the data piped into hmon.
+const stdinFile = "-"
+
+// The stdin the request bodies are read from, once, so every monitor with
+// file = "-" POSTs the same data.
+var (
+	stdin     io.Reader = os.Stdin
+	stdinOnce sync.Once
+	stdinBody []byte
+	stdinErr  error
+)
+
+// readStdinBody returns the data piped into hmon.
+func readStdinBody() ([]byte, error) {
+	stdinOnce.Do(func() {
+		stdinBody, stdinErr = ioutil.ReadAll(stdin)
+		if stdinErr != nil {
+			stdinErr = fmt.Errorf("unable to read request body from stdin: %s", stdinErr)
+		}
+	})
+	return stdinBody, stdinErr
+}
+
+// isRemoteFile returns true if the request file is an http(s) URL, fetched at
+// run time instead of read from the request directory.
+func isRemoteFile(file string) bool {
+	return strings.HasPrefix(file, "http://") || strings.HasPrefix(file, "https://")
+}
+
+// remoteFile is a request file fetched during this run. It's fetched once, so
+// monitors sharing a payload fetch it only once, and monitors fetching another
+// URL don't wait for it.
+type remoteFile struct {
+	once sync.Once
+	body []byte
+	err  error
+}
+
+// The request files fetched during this run, by URL.
+var (
+	remoteFilesMu sync.Mutex
+	remoteFiles   = make(map[string]*remoteFile)
+)
+
+// fetchRequestFile fetches the request file of the monitor from its URL, like
+// an artifact store. It's fetched through the proxy and with the TLS settings
+// and timeout of the monitor which first needs it. A failed fetch is not
+// retried during this run. Failures of the exchange get the code of a failed
+// exchange of the monitor itself, like a timeout. Others are configuration
+// failures.
+func (m Monitor) fetchRequestFile() ([]byte, error) {
+	remoteFilesMu.Lock()
+	f, ok := remoteFiles[m.File]
+	if !ok {
+		f = &remoteFile{}
+		remoteFiles[m.File] = f
+	}
+	remoteFilesMu.Unlock()
+
+	f.once.Do(func() {
+		f.body, f.err = m.fetchRemoteFile()
+		if f.err != nil {
+			f.err = withCode(failureCode(f.err), fmt.Errorf("unable to fetch request file `%s': %s", m.File, f.err))
+		}
+	})
+	return f.body, f.err
+}
+
+// fetchRemoteFile does the GET of the request file. Its traffic is not counted.
+func (m Monitor) fetchRemoteFile() ([]byte, error) {
+	tlsConfig, err := m.TLS.config()
+	if err != nil {
+		return nil, withCode(FailureConfig, err)
+	}
+	var proxy *url.URL
+	if m.Proxy != "" {
+		proxy, err = parseProxy(m.Proxy)
+		if err != nil {
+			return nil, withCode(FailureConfig, fmt.Errorf("invalid proxy `%s': %s", m.Proxy, err))
+		}
+	}
+	timeout := time.Duration(TimeoutDefault) * time.Second
+	if m.Timeout > 0 {
+		timeout = time.Duration(int64(m.Timeout)) * time.Millisecond
+	}
+
+	client := http.Client{
+		Transport: newTransport(&byteCounter{}, hostname(m.File), "", proxy, tlsConfig, m.Transport),
+		Timeout:   timeout,
+	}
+	resp, err := client.Get(m.File)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, withCode(FailureConfig, fmt.Errorf("status %d", resp.StatusCode))
+	}
+	return ioutil.ReadAll(resp.Body)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequestBodyFromStdin(t *testing.T) {
+	stdin = strings.NewReader("<order/>")
+	m := Monitor{File: stdinFile}
+	for i := 0; i < 2; i++ {
+		body, err := m.RequestBody(".")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != "<order/>" {
+			t.Errorf("expected the body piped to stdin, got '%s'", body)
+		}
+	}
+}
+
+func TestRequestBodyFromURL(t *testing.T) {
+	fetched := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetched++
+		if r.URL.Path != "/order.xml" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, "<order/>")
+	}))
+	defer server.Close()
+
+	m := Monitor{File: server.URL + "/order.xml"}
+	for i := 0; i < 2; i++ {
+		body, err := m.RequestBody(".")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != "<order/>" {
+			t.Errorf("expected the fetched body, got '%s'", body)
+		}
+	}
+	if fetched != 1 {
+		t.Errorf("expected the request file to be fetched once, got %d", fetched)
+	}
+
+	// failures are not retried either.
+	m.File = server.URL + "/missing.xml"
+	for i := 0; i < 2; i++ {
+		if _, err := m.RequestBody("."); err == nil || !strings.Contains(err.Error(), "status 404") {
+			t.Errorf("expected error on status 404, got %v", err)
+		}
+	}
+	if fetched != 2 {
+		t.Errorf("expected the missing request file to be fetched once, got %d", fetched-1)
+	}
+
+	// the request file is only fetched when running.
+	c := Config{Name: "c", Monitor: map[string]Monitor{"m": {Name: "m", URL: server.URL, File: server.URL + "/missing.xml"}}}
+	if err := c.Validate("."); err != nil {
+		t.Errorf("expected no validation error, got %s", err)
+	}
+}
+
+func TestRequestBodyFromURLThroughProxy(t *testing.T) {
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "<proxied>%s</proxied>", r.URL)
+	}))
+	defer proxy.Close()
+
+	m := Monitor{File: "http://artifacts.example.org/order.xml", Proxy: proxy.URL}
+	body, err := m.RequestBody(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "<proxied>http://artifacts.example.org/order.xml</proxied>" {
+		t.Errorf("expected the request file to be fetched through the proxy, got '%s'", body)
+	}
+}
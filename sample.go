@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"regexp"
+	"time"
+)
+
+// Sampling repeats the request of a monitor, to check the distribution of a
+// marker in the responses. For instance, whether a new version is served for
+// about 10% of the requests when a canary is weighted at 10%.
+type Sampling struct {
+	Requests   int     // the amount of requests to send
+	Header     string  // the header to match; if empty, the body is matched
+	Match      string  // the regex of the marker
+	Percentage float64 // the expected percentage of responses with the marker
+	Tolerance  float64 // the allowed deviation, in percentage points
+
+	rex *regexp.Regexp // the compiled marker, set by validate
+}
+
+// validate checks the settings, and compiles the marker regex.
+func (s *Sampling) validate() error {
+	if s.Requests <= 0 {
+		return fmt.Errorf("requests must be larger than zero")
+	}
+	if s.Percentage < 0 || s.Percentage > 100 {
+		return fmt.Errorf("percentage must be between 0 and 100")
+	}
+	if s.Tolerance < 0 {
+		return fmt.Errorf("tolerance cannot be negative")
+	}
+	rex, err := regexp.Compile(s.Match)
+	if err != nil {
+		return fmt.Errorf("match has an invalid regex: %s", err)
+	}
+	s.rex = rex
+	return nil
+}
+
+// matches returns true if the response contains the marker.
+func (s *Sampling) matches(resp *http.Response, readLimit int64) (bool, error) {
+	rex := s.rex
+	if rex == nil {
+		rex = regexp.MustCompile(s.Match)
+	}
+
+	if s.Header != "" {
+		for _, value := range resp.Header[http.CanonicalHeaderKey(s.Header)] {
+			if rex.MatchString(value) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	var r io.Reader = resp.Body
+	if readLimit > 0 {
+		r = io.LimitReader(r, readLimit)
+	}
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		return false, err
+	}
+	return rex.Match(body), nil
+}
+
+// sample sends the request of the monitor the configured amount of times, and
+// checks whether the percentage of responses with the marker is within the
+// tolerance. Every request uses a new connection, so load balancers can route
+// each of them differently.
+func (m Monitor) sample(client *http.Client, requestBody []byte, timeout time.Duration) error {
+	s := m.Sample
+	c := *client
+	c.Timeout = timeout
+
+	matched := 0
+	for i := 0; i < s.Requests; i++ {
+		req, err := m.newRequest(m.URL, requestBody)
+		if err != nil {
+			return err
+		}
+		resp, err := c.Do(req)
+		if err != nil {
+			return fmt.Errorf("sample request %d: %s", i+1, err)
+		}
+		ok, err := s.matches(resp, m.ReadLimit)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("sample request %d: %s", i+1, err)
+		}
+		if ok {
+			matched++
+		}
+	}
+
+	observed := float64(matched) * 100 / float64(s.Requests)
+	if math.Abs(observed-s.Percentage) > s.Tolerance {
+		return fmt.Errorf("marker `%s' seen in %.1f%% of %d responses, expected %.1f%% (±%.1f)",
+			s.Match, observed, s.Requests, s.Percentage, s.Tolerance)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"github.com/BurntSushi/toml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRunSample(t *testing.T) {
+	// every fourth response is served by the canary.
+	var count int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt64(&count, 1)%4 == 0 {
+			w.Header().Set("X-Version", "2.0.1")
+		} else {
+			w.Header().Set("X-Version", "1.9.0")
+		}
+	}))
+	defer server.Close()
+
+	var m Monitor
+	_, err := toml.Decode(`
+name = "Canary"
+url = "`+server.URL+`"
+
+[sample]
+requests = 20
+header = "x-version"
+match = "^2\\."
+percentage = 25.0
+tolerance = 5.0
+`, &m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Sample.validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	ch := make(chan Result, 1)
+	go m.Run(".", ch)
+	if r := <-ch; r.Error != nil {
+		t.Errorf("expected the distribution to be within tolerance, got: %s", r.Error)
+	}
+
+	m.Sample.Percentage = 10
+	go m.Run(".", ch)
+	if r := <-ch; r.Error == nil || !strings.Contains(r.Error.Error(), "25.0% of 20") {
+		t.Errorf("expected the distribution to be out of tolerance, got: %v", r.Error)
+	}
+}
+
+func TestSamplingValidate(t *testing.T) {
+	invalid := []Sampling{
+		{Requests: 0, Match: "x"},
+		{Requests: 10, Match: "(", Percentage: 10},
+		{Requests: 10, Match: "x", Percentage: 110},
+		{Requests: 10, Match: "x", Percentage: 10, Tolerance: -1},
+	}
+	for _, s := range invalid {
+		if err := s.validate(); err == nil {
+			t.Errorf("expected error for %+v", s)
+		}
+	}
+}
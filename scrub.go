@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// The replacement of scrubbed values, for rules without a mask.
+const defaultScrubMask = "***"
+
+// ScrubRule masks sensitive parts of request and response bodies before they
+// are written to disk or shown, in saved failures and the verbose output:
+//
+//	scrub = [
+//		{ regex = '"password":\s*"([^"]*)"' },
+//		{ jsonpath = "$.customer.email", mask = "<email>" },
+//		{ xpath = "//CreditCardNumber" },
+//	]
+//
+// Exactly one of regex, jsonpath and xpath is given. A regex masks what it
+// matches, or only its groups when it has any. A jsonpath masks the value at
+// the path of a JSON body. An xpath masks the text of the matching elements
+// (and their children) of an XML body. Only paths of element names are
+// supported, like "/Envelope/Body/Card" or "//Card", where '*' matches any
+// element. The checks of the monitor still see the original body.
+type ScrubRule struct {
+	Regex    string
+	JSONPath string `toml:"jsonpath"`
+	XPath    string `toml:"xpath"`
+	Mask     string // the replacement, "***" by default
+
+	rex   *regexp.Regexp // the compiled regex, set by compile
+	path  *jsonPath      // the parsed JSONPath, set by compile
+	xpath *xmlPath       // the parsed XPath, set by compile
+}
+
+// compile checks the rule, and compiles its regex or path.
+func (r *ScrubRule) compile() error {
+	given := 0
+	for _, s := range []string{r.Regex, r.JSONPath, r.XPath} {
+		if s != "" {
+			given++
+		}
+	}
+	if given != 1 {
+		return fmt.Errorf("rule needs exactly one of 'regex', 'jsonpath' or 'xpath'")
+	}
+
+	var err error
+	switch {
+	case r.Regex != "":
+		r.rex, err = regexp.Compile(r.Regex)
+		if err != nil {
+			return fmt.Errorf("invalid regex '%s': %s", r.Regex, err)
+		}
+	case r.JSONPath != "":
+		r.path, err = parseJSONPath(r.JSONPath)
+		if err != nil {
+			return fmt.Errorf("invalid jsonpath '%s': %s", r.JSONPath, err)
+		}
+		if r.path.op != "" || r.path.length {
+			return fmt.Errorf("jsonpath '%s' can't have a comparison or length", r.JSONPath)
+		}
+	case r.XPath != "":
+		r.xpath, err = parseXMLPath(r.XPath)
+		if err != nil {
+			return fmt.Errorf("invalid xpath '%s': %s", r.XPath, err)
+		}
+	}
+	return nil
+}
+
+// apply returns the body with the parts matched by the rule masked. Rules
+// which were not compiled are compiled on the spot. When that fails, the
+// whole body is masked, rather than leaking what the rule should've masked.
+func (r ScrubRule) apply(body []byte) []byte {
+	mask := r.Mask
+	if mask == "" {
+		mask = defaultScrubMask
+	}
+	if r.rex == nil && r.path == nil && r.xpath == nil {
+		if err := r.compile(); err != nil {
+			return []byte(mask)
+		}
+	}
+
+	switch {
+	case r.rex != nil:
+		return scrubRegex(r.rex, body, []byte(mask))
+	case r.path != nil:
+		return scrubJSON(r.path, body, mask)
+	}
+	return r.xpath.scrub(body, []byte(mask))
+}
+
+// scrub returns the body with all scrub rules of the monitor applied.
+func (m Monitor) scrub(body []byte) []byte {
+	if len(body) == 0 {
+		return body
+	}
+	for _, rule := range m.Scrub {
+		body = rule.apply(body)
+	}
+	return body
+}
+
+// mergeScrubRules puts the scrub rules of the configuration before the rules
+// of every monitor.
+func (c *Config) mergeScrubRules() {
+	if len(c.Scrub) == 0 {
+		return
+	}
+	for key, monitor := range c.Monitor {
+		rules := make([]ScrubRule, 0, len(c.Scrub)+len(monitor.Scrub))
+		rules = append(rules, c.Scrub...)
+		monitor.Scrub = append(rules, monitor.Scrub...)
+		c.Monitor[key] = monitor
+	}
+}
+
+// scrubRegex masks the matches of the regex, or only the groups of the
+// matches when the regex has groups.
+func scrubRegex(rex *regexp.Regexp, body, mask []byte) []byte {
+	if rex.NumSubexp() == 0 {
+		return rex.ReplaceAllLiteral(body, mask)
+	}
+
+	var buf bytes.Buffer
+	last := 0
+	for _, match := range rex.FindAllSubmatchIndex(body, -1) {
+		for i := 2; i < len(match); i += 2 {
+			start, end := match[i], match[i+1]
+			// groups which didn't participate, or are nested in a group
+			// which was masked already, are skipped.
+			if start < 0 || start < last {
+				continue
+			}
+			buf.Write(body[last:start])
+			buf.Write(mask)
+			last = end
+		}
+	}
+	buf.Write(body[last:])
+	return buf.Bytes()
+}
+
+// scrubJSON masks the value at the path of a JSON body. Bodies which aren't
+// JSON, or don't have the path, are returned as-is. The masked body is
+// re-encoded, so its formatting and the order of its members may change.
+func scrubJSON(p *jsonPath, body []byte, mask string) []byte {
+	d := json.NewDecoder(bytes.NewReader(body))
+	d.UseNumber()
+	var doc interface{}
+	if err := d.Decode(&doc); err != nil {
+		return body
+	}
+	doc, masked := maskJSONValue(doc, p.path, mask)
+	if !masked {
+		return body
+	}
+
+	var buf bytes.Buffer
+	e := json.NewEncoder(&buf)
+	e.SetEscapeHTML(false)
+	if err := e.Encode(doc); err != nil {
+		return []byte(mask)
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n")
+}
+
+// maskJSONValue replaces the value at the path with the mask. Returns the
+// (changed) value, and whether the path existed.
+func maskJSONValue(v interface{}, path []interface{}, mask string) (interface{}, bool) {
+	if len(path) == 0 {
+		return mask, true
+	}
+	switch step := path[0].(type) {
+	case string:
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return v, false
+		}
+		child, found := obj[step]
+		if !found {
+			return v, false
+		}
+		child, masked := maskJSONValue(child, path[1:], mask)
+		obj[step] = child
+		return obj, masked
+	case int:
+		arr, ok := v.([]interface{})
+		if !ok {
+			return v, false
+		}
+		index := step
+		if index < 0 {
+			index += len(arr)
+		}
+		if index < 0 || index >= len(arr) {
+			return v, false
+		}
+		child, masked := maskJSONValue(arr[index], path[1:], mask)
+		arr[index] = child
+		return arr, masked
+	}
+	return v, false
+}
+
+// xmlPath is a parsed XPath of a scrub rule: the names of the elements from
+// the root, or from anywhere in the document when the path starts with '//'.
+type xmlPath struct {
+	anywhere bool
+	names    []string // local element names, or '*' for any element
+}
+
+// Matches a step of an XPath: an element name, or '*'.
+var xmlPathStepRegexp = regexp.MustCompile(`^(\*|[A-Za-z_][A-Za-z0-9_.-]*(:[A-Za-z_][A-Za-z0-9_.-]*)?)$`)
+
+// parseXMLPath parses an XPath of element names, like "/a/b" or "//b".
+func parseXMLPath(expr string) (*xmlPath, error) {
+	p := &xmlPath{}
+	s := strings.TrimSpace(expr)
+	switch {
+	case strings.HasPrefix(s, "//"):
+		p.anywhere = true
+		s = s[2:]
+	case strings.HasPrefix(s, "/"):
+		s = s[1:]
+	default:
+		return nil, fmt.Errorf("path must start with '/' or '//'")
+	}
+	for _, name := range strings.Split(s, "/") {
+		if !xmlPathStepRegexp.MatchString(name) {
+			return nil, fmt.Errorf("unsupported step '%s' (only element names and '*' are supported)", name)
+		}
+		// the namespace prefix is ignored, like the namespace of elements.
+		if i := strings.Index(name, ":"); i >= 0 {
+			name = name[i+1:]
+		}
+		p.names = append(p.names, name)
+	}
+	return p, nil
+}
+
+// matchesAt returns true if the path matches the elements of the stack,
+// ending with the element at index end.
+func (p *xmlPath) matchesAt(stack []string, end int) bool {
+	start := end - len(p.names) + 1
+	if start < 0 || (!p.anywhere && start != 0) {
+		return false
+	}
+	for i, name := range p.names {
+		if name != "*" && name != stack[start+i] {
+			return false
+		}
+	}
+	return true
+}
+
+// within returns true if the innermost element of the stack is an element
+// matching the path, or a descendant of one.
+func (p *xmlPath) within(stack []string) bool {
+	for end := range stack {
+		if p.matchesAt(stack, end) {
+			return true
+		}
+	}
+	return false
+}
+
+// scrub masks the (non-blank) text within the elements matching the path.
+// Everything else of the body is kept as-is. Bodies which aren't XML are
+// scrubbed up to where they can't be parsed.
+func (p *xmlPath) scrub(body, mask []byte) []byte {
+	d := xml.NewDecoder(bytes.NewReader(body))
+	d.Strict = false
+
+	var buf bytes.Buffer
+	var stack []string
+	last := int64(0)
+	for {
+		start := d.InputOffset()
+		tok, err := d.RawToken()
+		if err != nil {
+			break
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			stack = append(stack, t.Name.Local)
+		case xml.EndElement:
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		case xml.CharData:
+			if len(bytes.TrimSpace(t)) > 0 && p.within(stack) {
+				buf.Write(body[last:start])
+				buf.Write(mask)
+				last = d.InputOffset()
+			}
+		}
+	}
+	buf.Write(body[last:])
+	return buf.Bytes()
+}
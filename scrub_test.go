@@ -0,0 +1,132 @@
+package main
+
+import (
+	"github.com/BurntSushi/toml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestScrubRules(t *testing.T) {
+	tests := []struct {
+		rule ScrubRule
+		body string
+		exp  string
+	}{
+		{ScrubRule{Regex: `\d{4}-\d{4}-\d{4}-\d{4}`}, "card 1234-5678-9012-3456 ok", "card *** ok"},
+		{ScrubRule{Regex: `"password":\s*"([^"]*)"`}, `{"user":"x","password": "secret"}`, `{"user":"x","password": "***"}`},
+		{ScrubRule{Regex: `(\w+)@(\w+)\.org`, Mask: "?"}, "a@b.org, c@d.org", "?@?.org, ?@?.org"},
+		{ScrubRule{JSONPath: "$.customer.email"}, `{"customer": {"email": "a@b.org", "id": 12345678901234567890}}`, `{"customer":{"email":"***","id":12345678901234567890}}`},
+		{ScrubRule{JSONPath: "$.users[-1].name", Mask: "<name>"}, `{"users": [{"name": "a"}, {"name": "b"}]}`, `{"users":[{"name":"a"},{"name":"<name>"}]}`},
+		{ScrubRule{JSONPath: "$.missing"}, `{"a":  1}`, `{"a":  1}`},
+		{ScrubRule{JSONPath: "$.a"}, `not json`, `not json`},
+		{ScrubRule{XPath: "//Card"}, `<r><Card>1234</Card><Name>x</Name><Card>5678</Card></r>`, `<r><Card>***</Card><Name>x</Name><Card>***</Card></r>`},
+		{ScrubRule{XPath: "/Envelope/Body/*"}, `<s:Envelope xmlns:s="urn:s"><s:Body><Customer><Name>Jane</Name> <Id>1</Id></Customer></s:Body></s:Envelope>`, `<s:Envelope xmlns:s="urn:s"><s:Body><Customer><Name>***</Name> <Id>***</Id></Customer></s:Body></s:Envelope>`},
+		{ScrubRule{XPath: "/Body/Name"}, `<Envelope><Body><Name>Jane</Name></Body></Envelope>`, `<Envelope><Body><Name>Jane</Name></Body></Envelope>`},
+		{ScrubRule{XPath: "//Name"}, `<r><Name><![CDATA[Jane & Joe]]></Name><Empty/></r>`, `<r><Name>***</Name><Empty/></r>`},
+		// invalid rules mask everything.
+		{ScrubRule{Regex: "("}, "secret", "***"},
+	}
+	for _, test := range tests {
+		if got := string(test.rule.apply([]byte(test.body))); got != test.exp {
+			t.Errorf("%+v: expected '%s', got '%s'", test.rule, test.exp, got)
+		}
+	}
+}
+
+func TestCompileScrubRules(t *testing.T) {
+	tests := map[string]ScrubRule{
+		"none":       {},
+		"two":        {Regex: "a", XPath: "//a"},
+		"regex":      {Regex: "("},
+		"jsonpath":   {JSONPath: "a.b"},
+		"comparison": {JSONPath: "$.a == 1"},
+		"xpath":      {XPath: "a/b"},
+		"attribute":  {XPath: "//a/@id"},
+	}
+	for name, rule := range tests {
+		if err := rule.compile(); err == nil {
+			t.Errorf("%s: expected an error, got none", name)
+		}
+	}
+}
+
+func TestScrubConfiguration(t *testing.T) {
+	var c Config
+	_, err := toml.Decode(`
+name = "Scrub"
+scrub = [ { regex = "secret-\\w+" } ]
+
+[monitor.a]
+name = "a"
+url = "http://example.org"
+scrub = [ { jsonpath = "$.email" } ]
+
+[monitor.b]
+name = "b"
+url = "http://example.org"
+`, &c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.mergeScrubRules()
+	if err := c.Validate("."); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+
+	a, b := c.Monitor["a"], c.Monitor["b"]
+	if len(a.Scrub) != 2 || len(b.Scrub) != 1 {
+		t.Fatalf("expected the rules of the configuration to be merged, got %+v and %+v", a.Scrub, b.Scrub)
+	}
+	if got := string(a.scrub([]byte(`{"email": "a@b.org", "token": "secret-abc"}`))); got != `{"email":"***","token":"***"}` {
+		t.Errorf("expected both rules to be applied, got '%s'", got)
+	}
+}
+
+func TestScrubFailuresAndVerbose(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Welcome, your token is secret-abc"))
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "hmon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var shown []byte
+	m := Monitor{
+		Name:       "scrubbed",
+		URL:        server.URL,
+		Body:       "login secret-xyz",
+		Scrub:      []ScrubRule{{Regex: `secret-\w+`}},
+		Assertions: []Assertion{{Value: "secret-abc"}, {Value: "Goodbye"}},
+		failureDir: dir,
+		Callback: func(m *Monitor, input, output []byte) {
+			shown = append(append(shown, input...), output...)
+		},
+	}
+	ch := make(chan Result, 1)
+	go m.Run(".", ch)
+	r := <-ch
+	if r.Error == nil || r.FailureFile == "" {
+		t.Fatalf("expected a saved failure, got %v", r.Error)
+	}
+	if !r.Assertions[0].Passed {
+		t.Errorf("expected the assertions to see the original body")
+	}
+
+	saved, err := ioutil.ReadFile(r.FailureFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, b := range map[string][]byte{"saved failure": saved, "verbose output": shown} {
+		if strings.Contains(string(b), "secret-") || !strings.Contains(string(b), "your token is ***") {
+			t.Errorf("expected the %s to be scrubbed, got '%s'", name, b)
+		}
+	}
+}
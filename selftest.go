@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// The configuration run by the selftest. The base URL of the embedded server
+// is filled in for {{URL}}.
+const selftestConfig = `schema = 2
+name = "hmon selftest"
+
+[group.selftest]
+base_url = "{{URL}}"
+
+[group.selftest.monitor.Homepage]
+name = "Homepage"
+url = "/ok"
+assertions = ["hmon selftest", "wellformed:html"]
+
+[group.selftest.monitor.JSON]
+name = "JSON API"
+url = "/json"
+assertions = ["wellformed:json"]
+
+[group.selftest.monitor.Post]
+name = "POST request"
+url = "/echo"
+file = "request.xml"
+assertions = ["<ping/>"]
+
+[group.selftest.monitor.Warning]
+name = "Warning assertion"
+url = "/ok"
+assertions = [ { value = "not on the page", severity = "warning" } ]
+
+[group.selftest.monitor.Assertion]
+name = "Failing assertion"
+url = "/ok"
+assertions = ["not on the page"]
+
+[group.selftest.monitor.Timeout]
+name = "Timeout"
+url = "/slow"
+timeout = 200
+
+[group.selftest.monitor.Protected]
+name = "Protected page"
+url = "/protected"
+assertions = ["Welcome admin"]
+
+[group.selftest.monitor.Protected.identities.admin]
+username = "admin"
+password = "selftest"
+
+[group.selftest.monitor.Protected.identities.anonymous]
+assertions = [ { type = "status", value = "401" } ]
+`
+
+// The outcomes of the selftest monitors, by key: ok, warn or fail.
+var selftestExpectations = map[string]string{
+	"selftest/Homepage":            "ok",
+	"selftest/JSON":                "ok",
+	"selftest/Post":                "ok",
+	"selftest/Warning":             "warn",
+	"selftest/Assertion":           "fail",
+	"selftest/Timeout":             "fail",
+	"selftest/Protected#admin":     "ok",
+	"selftest/Protected#anonymous": "ok",
+}
+
+// newSelftestServer returns the handler of the embedded server of the
+// selftest. Slow requests are released when done is closed.
+func newSelftestServer(done chan bool) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, "<html><body><p>hmon selftest<br></p></body></html>")
+	})
+	mux.HandleFunc("/json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"status": "ok"}`)
+	})
+	mux.HandleFunc("/echo", func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		w.Write(b)
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-done:
+		case <-time.After(10 * time.Second):
+		}
+	})
+	mux.HandleFunc("/protected", func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+		if !ok || user != "admin" || password != "selftest" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprintf(w, "Welcome admin")
+	})
+	return mux
+}
+
+// outcome returns the outcome of the result: ok, warn or fail.
+func outcome(r Result) string {
+	if r.Error != nil {
+		return "fail"
+	}
+	if len(r.Warnings) > 0 {
+		return "warn"
+	}
+	return "ok"
+}
+
+// checkSelftestResults compares the results with the expected outcomes, and
+// returns the problems. The monitor names of the selftest are unique.
+func checkSelftestResults(config Config, results []Result) []string {
+	keys := make(map[string]string) // monitor name to key
+	for key, m := range config.Monitor {
+		keys[m.Name] = key
+	}
+
+	var problems []string
+	ran := make(map[string]bool)
+	for _, r := range results {
+		key := keys[r.Monitor.Name]
+		ran[key] = true
+		if o := outcome(r); o != selftestExpectations[key] {
+			problems = append(problems, fmt.Sprintf("monitor '%s': expected %s, got %s (%v)", r.Monitor.Name, selftestExpectations[key], o, r.Error))
+		}
+	}
+	for key := range selftestExpectations {
+		if !ran[key] {
+			problems = append(problems, fmt.Sprintf("monitor '%s' did not run", key))
+		}
+	}
+	return problems
+}
+
+// checkSelftestOutputs checks whether the output files in dir contain all the
+// results, and returns the problems.
+func checkSelftestOutputs(dir string, count int) []string {
+	var problems []string
+
+	f, err := os.Open(path.Join(dir, "results.csv"))
+	if err == nil {
+		records, err := csv.NewReader(f).ReadAll()
+		f.Close()
+		if err != nil || len(records) != count {
+			problems = append(problems, fmt.Sprintf("csv: expected %d records, got %d (%v)", count, len(records), err))
+		}
+	} else {
+		problems = append(problems, fmt.Sprintf("csv: %s", err))
+	}
+
+	f, err = os.Open(path.Join(dir, "results.jsonl"))
+	if err == nil {
+		lines := 0
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var line map[string]interface{}
+			if err := json.Unmarshal(scanner.Bytes(), &line); err != nil || line["ConfigurationName"] == nil {
+				problems = append(problems, fmt.Sprintf("jsonl: invalid line %d (%v)", lines+1, err))
+			}
+			lines++
+		}
+		f.Close()
+		if lines != count {
+			problems = append(problems, fmt.Sprintf("jsonl: expected %d lines, got %d", count, lines))
+		}
+	} else {
+		problems = append(problems, fmt.Sprintf("jsonl: %s", err))
+	}
+
+	b, err := ioutil.ReadFile(path.Join(dir, "results.json"))
+	var configResults []struct{ Results []interface{} }
+	if err == nil {
+		err = json.Unmarshal(b, &configResults)
+	}
+	if err != nil || len(configResults) != 1 || len(configResults[0].Results) != count {
+		problems = append(problems, fmt.Sprintf("json: expected %d results (%v)", count, err))
+	}
+
+	return problems
+}
+
+// Runs the 'selftest' subcommand with the given arguments. Starts an embedded
+// HTTP server, runs a bundled configuration against it and checks the results
+// and the outputs. Returns the exit code.
+func runSelftest(args []string) int {
+	fs := flag.NewFlagSet("selftest", flag.ContinueOnError)
+	verbose := fs.Bool("verbose", false, "Print the input and output of the monitors.")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: hmon selftest [flags]\n\n")
+		fmt.Fprintf(os.Stderr, "Runs a bundled configuration against an embedded HTTP server, to verify\n")
+		fmt.Fprintf(os.Stderr, "the requests, assertions, timeouts and outputs of hmon on this host.\n\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return flagExitCode(err)
+	}
+	if len(positional) != 0 {
+		fs.Usage()
+		return ExitUsage
+	}
+
+	done := make(chan bool)
+	server := httptest.NewServer(newSelftestServer(done))
+	defer server.Close()
+	defer close(done)
+
+	dir, err := ioutil.TempDir("", "hmon-selftest")
+	if err != nil {
+		fmt.Printf("Unable to create a temporary directory: %s\n", err)
+		return ExitInternal
+	}
+	defer os.RemoveAll(dir)
+
+	configFile := path.Join(dir, "selftest_hmon.toml")
+	files := map[string]string{
+		configFile:                    strings.Replace(selftestConfig, "{{URL}}", server.URL, -1),
+		path.Join(dir, "request.xml"): "<ping/>",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(name, []byte(content), 0644); err != nil {
+			fmt.Printf("Unable to write `%s': %s\n", name, err)
+			return ExitInternal
+		}
+	}
+
+	config, err := ReadConfig(configFile)
+	if err != nil {
+		fmt.Printf("Unable to parse the selftest configuration: %s\n", err)
+		return ExitUsage
+	}
+	if err := config.Validate(dir); err != nil {
+		fmt.Printf("Invalid selftest configuration: %s\n", err)
+		return ExitUsage
+	}
+
+	fmt.Printf("Running selftest against %s\n", server.URL)
+
+	var writers []ResultWriter
+	for _, format := range []string{"csv", "jsonl"} {
+		w, err := streamingFormats[format](path.Join(dir, "results."+format))
+		if err != nil {
+			fmt.Println(err)
+			return ExitInternal
+		}
+		writers = append(writers, w)
+	}
+	emit := func(r Result) {
+		for _, w := range writers {
+			w.WriteResult(config.Name, r)
+		}
+	}
+
+	cr := runParallel(os.Stdout, dir, config, *verbose, 0, false, make(map[string]string), emit)
+	fmt.Println()
+
+	var problems []string
+	for _, w := range writers {
+		if err := w.Close(); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	configResults := []ConfigurationResult{cr}
+	if err := writeJSON(path.Join(dir, "results.json"), &configResults); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	problems = append(problems, checkSelftestResults(config, cr.Results)...)
+	problems = append(problems, checkSelftestOutputs(dir, len(cr.Results))...)
+	if len(problems) > 0 {
+		fmt.Printf("Selftest failed with %d problem(s):\n", len(problems))
+		for _, p := range problems {
+			fmt.Printf("  %s\n", p)
+		}
+		return ExitFailures
+	}
+
+	fmt.Printf("Selftest passed: %d monitors behaved as expected, and all outputs were written.\n", len(cr.Results))
+	return ExitOK
+}
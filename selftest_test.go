@@ -0,0 +1,27 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSelftest(t *testing.T) {
+	if code := runSelftest(nil); code != ExitOK {
+		t.Errorf("expected the selftest to pass, got exit code %d", code)
+	}
+}
+
+func TestCheckSelftestResults(t *testing.T) {
+	config := Config{Monitor: map[string]Monitor{
+		"selftest/Homepage": {Name: "Homepage"},
+	}}
+	results := []Result{
+		{Monitor: Monitor{Name: "Homepage"}, Error: ResultError{errors.New("connection refused")}},
+	}
+
+	problems := checkSelftestResults(config, results)
+	// the homepage failed, and all other monitors did not run.
+	if len(problems) != len(selftestExpectations) {
+		t.Errorf("expected %d problems, got %v", len(selftestExpectations), problems)
+	}
+}
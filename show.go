@@ -0,0 +1,165 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// shellQuote quotes s for a POSIX shell, using single quotes.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// curlCommandLine returns a curl command line doing the same request as the
+// monitor. The request body is the inline body or the rendered request file,
+// including any includes, so it's added inline. A request file read from stdin
+// is read from stdin by curl too, and a request file at a URL is fetched by
+// another curl piping it in.
+func curlCommandLine(m Monitor, baseDir string) (string, error) {
+	args := []string{"curl"}
+
+	if m.File == stdinFile || isRemoteFile(m.File) {
+		if isRemoteFile(m.File) {
+			args = append([]string{"curl", "-s", shellQuote(m.File), "|"}, args...)
+		}
+		args = append(args, "-X", "POST", "--data-binary", "@-")
+	} else {
+		body, err := m.RequestBody(baseDir)
+		if err != nil {
+			return "", err
+		}
+		if body != nil {
+			args = append(args, "-X", "POST", "--data-binary", shellQuote(string(body)))
+		}
+	}
+
+	if m.Proxy != "" {
+		args = append(args, "-x", shellQuote(m.Proxy))
+	}
+	if m.TLS != nil && m.TLS.InsecureSkipVerify {
+		args = append(args, "-k")
+	}
+	if m.TLS != nil && m.TLS.CAFile != "" {
+		args = append(args, "--cacert", shellQuote(m.TLS.CAFile))
+	}
+	if len(m.PinSHA256) > 0 {
+		args = append(args, "--pinnedpubkey", shellQuote("sha256//"+strings.Join(m.PinSHA256, ";sha256//")))
+	}
+	if auth := m.basicAuth(); auth != nil {
+		args = append(args, "-u", shellQuote(auth.Username+":"+auth.Password))
+	}
+	if m.Accept != "" {
+		args = append(args, "-H", shellQuote("Accept: "+m.Accept))
+	}
+	if m.AcceptLanguage != "" {
+		args = append(args, "-H", shellQuote("Accept-Language: "+m.AcceptLanguage))
+	}
+	for _, header := range m.Headers {
+		args = append(args, "-H", shellQuote(header.GetName()+": "+header.GetValue()))
+	}
+
+	timeout := int64(TimeoutDefault) * 1000
+	if m.Timeout > 0 {
+		timeout = int64(m.Timeout)
+	}
+	if m.ConnectTimeout > 0 {
+		args = append(args, "--connect-timeout", strconv.FormatFloat(float64(m.ConnectTimeout)/1000, 'f', -1, 64))
+	}
+	args = append(args, "--max-time", strconv.FormatFloat(float64(timeout)/1000, 'f', -1, 64))
+
+	args = append(args, shellQuote(m.URL))
+	return strings.Join(args, " "), nil
+}
+
+// findMonitors returns the monitors of the configurations with the given key
+// or name, as 'configuration name -> monitor'.
+func findMonitors(configurations []Config, nameOrKey string) map[string]Monitor {
+	found := make(map[string]Monitor)
+	for _, c := range configurations {
+		for key, m := range c.Monitor {
+			if key == nameOrKey || m.Name == nameOrKey {
+				found[c.Name+": "+key] = m
+			}
+		}
+	}
+	return found
+}
+
+// Runs the 'show' subcommand with the given arguments. Prints the monitors
+// with the given name (or key), optionally as curl command. Returns the exit
+// code.
+func runShow(args []string) int {
+	fs := flag.NewFlagSet("show", flag.ContinueOnError)
+	conf := fs.String("conf", "", "Single configuration file. This param takes precedence over -confdir.")
+	confdir := fs.String("confdir", ".", "Directory with configurations of *_hmon.toml files.")
+	filedir := fs.String("filedir", ".", "Base directory to search for request files.")
+	env := fs.String("env", "", "Environment to show monitors with environments in.")
+	asCurl := fs.Bool("as-curl", false, "Print the monitor as an equivalent curl command.")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: hmon show [flags] <monitor>\n\n")
+		fmt.Fprintf(os.Stderr, "Shows the monitor(s) with the given name or key, for instance as curl\n")
+		fmt.Fprintf(os.Stderr, "command to reproduce a check manually.\n\n")
+		fs.PrintDefaults()
+	}
+
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return flagExitCode(err)
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return ExitUsage
+	}
+
+	var configurations []Config
+	if *conf != "" {
+		c, err := ReadConfig(*conf)
+		if err != nil {
+			fmt.Printf("Unable to parse single configuration file `%s': %s\n", *conf, err)
+			return ExitUsage
+		}
+		configurations = append(configurations, c)
+	} else {
+		var err error
+		configurations, err = FindConfigs(*confdir)
+		if err != nil {
+			fmt.Printf("Unable to find/parse configuration files. Nested error is: %s\n", err)
+			return ExitUsage
+		}
+	}
+	for i := range configurations {
+		configurations[i].SelectEnvironment(*env)
+	}
+
+	found := findMonitors(configurations, positional[0])
+	if len(found) == 0 {
+		fmt.Printf("No monitor found with name or key `%s'\n", positional[0])
+		return ExitUsage
+	}
+
+	var names []string
+	for name := range found {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		m := found[name]
+		fmt.Printf("# %s\n", name)
+		if !*asCurl {
+			fmt.Printf("%s\n", m)
+			continue
+		}
+		line, err := curlCommandLine(m, *filedir)
+		if err != nil {
+			fmt.Printf("Unable to use HTTP POST data: %s\n", err)
+			return ExitUsage
+		}
+		fmt.Printf("%s\n", line)
+	}
+	return ExitOK
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestCurlCommandLine(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hmon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(path.Join(dir, "body.xml"), []byte("<it's>\n</it's>"), 0644)
+
+	m := Monitor{
+		URL:            "http://example.org/service?a=1&b=2",
+		File:           "body.xml",
+		Timeout:        2500,
+		ConnectTimeout: 500,
+		Headers:        []Header{"SOAPAction: urn:do"},
+		Proxy:          "http://proxy:3128",
+		BasicAuth:      &BasicAuth{Username: "probe", Password: "secret"},
+		TLS:            &TLSOptions{InsecureSkipVerify: true, CAFile: "/etc/ssl/ca.pem"},
+		PinSHA256:      []string{"x4QzPSC810K5/cMjb05Qm4k3Bw5zBn4lTdO/nEW/Td4=", "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="},
+	}
+	line, err := curlCommandLine(m, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the command line must parse back to the same request.
+	words, err := splitShellWords(line)
+	if err != nil {
+		t.Fatalf("expected a valid command line, got: %s", err)
+	}
+	cmd, err := parseCurl(words)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmd.URL != m.URL || cmd.method() != "POST" || cmd.Timeout != 2500 {
+		t.Errorf("unexpected command %+v", cmd)
+	}
+	if !reflect.DeepEqual(cmd.Data, []string{"<it's>\n</it's>"}) {
+		t.Errorf("unexpected data %q", cmd.Data)
+	}
+	if !reflect.DeepEqual(cmd.Headers, []string{"SOAPAction: urn:do"}) {
+		t.Errorf("unexpected headers %q", cmd.Headers)
+	}
+	if cmd.Connect != 500 {
+		t.Errorf("expected connect timeout 500, got %d", cmd.Connect)
+	}
+	if !cmd.Insecure || cmd.CACert != "/etc/ssl/ca.pem" {
+		t.Errorf("expected the TLS options, got %+v", cmd)
+	}
+	if cmd.User != "probe:secret" {
+		t.Errorf("unexpected basic authentication '%s'", cmd.User)
+	}
+	if cmd.Proxy != m.Proxy {
+		t.Errorf("unexpected proxy '%s'", cmd.Proxy)
+	}
+	if !reflect.DeepEqual(cmd.Pins, m.PinSHA256) {
+		t.Errorf("unexpected pins %q", cmd.Pins)
+	}
+}
+
+func TestCurlCommandLinePipedBody(t *testing.T) {
+	// neither stdin is read, nor the URL fetched.
+	m := Monitor{URL: "http://example.org/orders", File: stdinFile, Timeout: 1000}
+	if line, err := curlCommandLine(m, "."); err != nil || line != "curl -X POST --data-binary @- --max-time 1 'http://example.org/orders'" {
+		t.Errorf("expected curl to read the body from stdin, got %s (%v)", line, err)
+	}
+
+	m.File = "http://hmon.invalid/order.xml"
+	line, err := curlCommandLine(m, ".")
+	if err != nil || line != "curl -s 'http://hmon.invalid/order.xml' | curl -X POST --data-binary @- --max-time 1 'http://example.org/orders'" {
+		t.Errorf("expected the request file to be piped into curl, got %s (%v)", line, err)
+	}
+}
+
+func TestFindMonitors(t *testing.T) {
+	configurations := []Config{
+		{Name: "one", Monitor: map[string]Monitor{"login": {Name: "Login"}, "home": {Name: "Home"}}},
+		{Name: "two", Monitor: map[string]Monitor{"other": {Name: "Login"}}},
+	}
+
+	if found := findMonitors(configurations, "Login"); len(found) != 2 {
+		t.Errorf("expected 2 monitors by name, got %d", len(found))
+	}
+	if found := findMonitors(configurations, "home"); len(found) != 1 {
+		t.Errorf("expected 1 monitor by key, got %d", len(found))
+	}
+}
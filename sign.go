@@ -0,0 +1,138 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// The suffix appended to a result file to get the name of its signature file.
+const signatureSuffix = ".sig"
+
+// Reads a PEM encoded file and returns the DER bytes of the first block.
+func readPEM(file string) ([]byte, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("`%s' does not contain PEM data", file)
+	}
+	return block.Bytes, nil
+}
+
+// ReadSigningKey reads an ed25519 private key from a PEM encoded PKCS #8 file,
+// as generated by for instance `openssl genpkey -algorithm ed25519'.
+func ReadSigningKey(file string) (ed25519.PrivateKey, error) {
+	der, err := readPEM(file)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse private key `%s': %s", file, err)
+	}
+	edkey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("`%s' is not an ed25519 private key", file)
+	}
+	return edkey, nil
+}
+
+// ReadVerifyKey reads an ed25519 public key from a PEM encoded PKIX file, as
+// generated by for instance `openssl pkey -pubout'.
+func ReadVerifyKey(file string) (ed25519.PublicKey, error) {
+	der, err := readPEM(file)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse public key `%s': %s", file, err)
+	}
+	edkey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("`%s' is not an ed25519 public key", file)
+	}
+	return edkey, nil
+}
+
+// SignFile signs the contents of the given file, and writes the base64
+// encoded signature to the file with the .sig suffix appended.
+func SignFile(file string, key ed25519.PrivateKey) error {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	sig := base64.StdEncoding.EncodeToString(ed25519.Sign(key, b))
+	err = ioutil.WriteFile(file+signatureSuffix, []byte(sig+"\n"), 0644)
+	if err != nil {
+		return fmt.Errorf("unable to write signature: %s", err)
+	}
+	return nil
+}
+
+// VerifyFile verifies the given file against the signature in the file with
+// the .sig suffix appended. A nil error means the signature is valid.
+func VerifyFile(file string, key ed25519.PublicKey) error {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	encoded, err := ioutil.ReadFile(file + signatureSuffix)
+	if err != nil {
+		return fmt.Errorf("unable to read signature: %s", err)
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
+	if err != nil {
+		return fmt.Errorf("malformed signature: %s", err)
+	}
+	if !ed25519.Verify(key, b, sig) {
+		return fmt.Errorf("signature of `%s' does not match", file)
+	}
+	return nil
+}
+
+// Runs the 'verify' subcommand with the given arguments. Returns the exit code.
+func runVerify(args []string) int {
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	keyFile := fs.String("key", "", "PEM encoded ed25519 public key to verify the signature with.")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: hmon verify -key public.pem results.json [...]\n\n")
+		fmt.Fprintf(os.Stderr, "Verifies result files against their signature (.sig) files.\n\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return flagExitCode(err)
+	}
+
+	if *keyFile == "" || fs.NArg() == 0 {
+		fs.Usage()
+		return ExitUsage
+	}
+
+	key, err := ReadVerifyKey(*keyFile)
+	if err != nil {
+		fmt.Println(err)
+		return ExitUsage
+	}
+
+	code := ExitOK
+	for _, file := range fs.Args() {
+		err := VerifyFile(file, key)
+		if err != nil {
+			fmt.Printf("FAIL  %s: %s\n", file, err)
+			code = ExitValidation
+		} else {
+			fmt.Printf("ok    %s\n", file)
+		}
+	}
+	return code
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "hmon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := path.Join(dir, "results.json")
+	ioutil.WriteFile(file, []byte(`[{"ConfigurationName": "test"}]`), 0644)
+
+	if err := SignFile(file, priv); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyFile(file, pub); err != nil {
+		t.Errorf("expected valid signature, got: %s", err)
+	}
+
+	// tamper with the results
+	ioutil.WriteFile(file, []byte(`[{"ConfigurationName": "tampered"}]`), 0644)
+	if err := VerifyFile(file, pub); err == nil {
+		t.Errorf("expected signature mismatch after tampering")
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The default base OID for hmon's traps and objects. This falls under the
+// netSnmpPlaypen arc, which is meant for experimental use. Use -snmp-oid to
+// use your own enterprise OID instead.
+const defaultSnmpBaseOID = "1.3.6.1.4.1.8072.9999.8484"
+
+// Well-known OIDs which must be the first two variable bindings of a
+// SNMPv2-Trap-PDU.
+const (
+	oidSysUpTime   = "1.3.6.1.2.1.1.3.0"
+	oidSnmpTrapOID = "1.3.6.1.6.3.1.1.4.1.0"
+)
+
+// BER tags used in the trap messages.
+const (
+	berInteger     = 0x02
+	berOctetString = 0x04
+	berOID         = 0x06
+	berSequence    = 0x30
+	berGauge32     = 0x42
+	berTimeTicks   = 0x43
+	berTrapV2      = 0xa7
+)
+
+// SnmpTrapper sends SNMPv2c traps for monitor results. Given the base OID,
+// the traps and objects are:
+//
+//	<base>.0.1    hmonMonitorFailed (trap)
+//	<base>.0.2    hmonMonitorOk (trap)
+//	<base>.1.1    configuration name (OCTET STRING)
+//	<base>.1.2    monitor name (OCTET STRING)
+//	<base>.1.3    status, 1 = ok, 2 = failed (INTEGER)
+//	<base>.1.4    latency in milliseconds (Gauge32)
+//	<base>.1.5    error description (OCTET STRING)
+type SnmpTrapper struct {
+	Address   string // host:port of the trap receiver
+	Community string // the v2c community string
+	BaseOID   string // base OID for traps and objects
+	started   time.Time
+}
+
+// NewSnmpTrapper creates a new trapper. An empty base OID results in the
+// default base OID being used.
+func NewSnmpTrapper(address, community, baseOID string) (*SnmpTrapper, error) {
+	if baseOID == "" {
+		baseOID = defaultSnmpBaseOID
+	}
+	if _, err := berEncodeOID(baseOID); err != nil {
+		return nil, err
+	}
+	if !strings.Contains(address, ":") {
+		address = address + ":162"
+	}
+	return &SnmpTrapper{address, community, baseOID, time.Now()}, nil
+}
+
+// Trap sends a single trap for the given result. Successful results are
+// only sent when ok is true; receivers can use those to clear earlier
+// failure events.
+func (s *SnmpTrapper) Trap(configName string, r Result, ok bool) error {
+	if r.Error == nil && !ok {
+		return nil
+	}
+
+	conn, err := net.Dial("udp", s.Address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write(s.message(configName, r))
+	return err
+}
+
+// message builds the complete BER encoded SNMPv2c trap message.
+func (s *SnmpTrapper) message(configName string, r Result) []byte {
+	trap, status, errText := ".0.1", 2, ""
+	if r.Error == nil {
+		trap, status = ".0.2", 1
+	} else {
+		errText = r.Error.Error()
+	}
+
+	uptime := int64(time.Since(s.started) / (10 * time.Millisecond))
+
+	// The base OID is validated when creating the trapper, so encoding the
+	// OIDs below can't fail.
+	varbinds := [][]byte{}
+	add := func(oid string, value []byte) {
+		name, _ := berEncodeOID(oid)
+		varbinds = append(varbinds, berTLV(berSequence, name, value))
+	}
+
+	trapOID, _ := berEncodeOID(s.BaseOID + trap)
+
+	add(oidSysUpTime, berTLV(berTimeTicks, berInt(uptime)))
+	add(oidSnmpTrapOID, trapOID)
+	add(s.BaseOID+".1.1", berTLV(berOctetString, []byte(configName)))
+	add(s.BaseOID+".1.2", berTLV(berOctetString, []byte(r.Monitor.Name)))
+	add(s.BaseOID+".1.3", berTLV(berInteger, berInt(int64(status))))
+	add(s.BaseOID+".1.4", berTLV(berGauge32, berInt(r.Latency)))
+	add(s.BaseOID+".1.5", berTLV(berOctetString, []byte(errText)))
+	add(s.BaseOID+".1.6", berTLV(berOctetString, []byte(r.Code)))
+	add(s.BaseOID+".1.7", berTLV(berOctetString, []byte(r.Monitor.Owner)))
+
+	pdu := berTLV(berTrapV2,
+		berTLV(berInteger, berInt(int64(rand.Int31()))), // request id
+		berTLV(berInteger, berInt(0)),                   // error status
+		berTLV(berInteger, berInt(0)),                   // error index
+		berTLV(berSequence, varbinds...),
+	)
+
+	return berTLV(berSequence,
+		berTLV(berInteger, berInt(1)), // version: 1 means v2c
+		berTLV(berOctetString, []byte(s.Community)),
+		pdu,
+	)
+}
+
+// berTLV encodes a tag, the length of the contents and the contents itself.
+func berTLV(tag byte, contents ...[]byte) []byte {
+	body := bytes.Join(contents, nil)
+
+	var buf bytes.Buffer
+	buf.WriteByte(tag)
+	if len(body) < 0x80 {
+		buf.WriteByte(byte(len(body)))
+	} else {
+		// long form: first byte is the amount of length bytes following.
+		var l []byte
+		for n := len(body); n > 0; n >>= 8 {
+			l = append([]byte{byte(n)}, l...)
+		}
+		buf.WriteByte(0x80 | byte(len(l)))
+		buf.Write(l)
+	}
+	buf.Write(body)
+	return buf.Bytes()
+}
+
+// berInt encodes an integer as the minimal amount of two's complement bytes.
+func berInt(n int64) []byte {
+	b := []byte{byte(n)}
+	for n > 127 || n < -128 {
+		n >>= 8
+		b = append([]byte{byte(n)}, b...)
+	}
+	return b
+}
+
+// berEncodeOID encodes a dotted OID string to a complete BER OID element.
+func berEncodeOID(oid string) ([]byte, error) {
+	parts := strings.Split(strings.TrimPrefix(oid, "."), ".")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("invalid OID '%s'", oid)
+	}
+
+	var ids []uint64
+	for _, p := range parts {
+		id, err := strconv.ParseUint(p, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid OID '%s'", oid)
+		}
+		ids = append(ids, id)
+	}
+
+	// the first two identifiers are packed into a single one.
+	encoded := []byte{byte(ids[0]*40 + ids[1])}
+	for _, id := range ids[2:] {
+		// base 128, most significant group first, continuation bit on all but the last.
+		chunk := []byte{byte(id & 0x7f)}
+		for id >>= 7; id > 0; id >>= 7 {
+			chunk = append([]byte{byte(id&0x7f) | 0x80}, chunk...)
+		}
+		encoded = append(encoded, chunk...)
+	}
+
+	return berTLV(berOID, encoded), nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestBerEncodeOID(t *testing.T) {
+	b, err := berEncodeOID("1.3.6.1.4.1.8072")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []byte{0x06, 0x07, 0x2b, 0x06, 0x01, 0x04, 0x01, 0xbf, 0x08}
+	if !bytes.Equal(b, expected) {
+		t.Errorf("expected % x, got % x", expected, b)
+	}
+
+	if _, err := berEncodeOID("1.3.six"); err == nil {
+		t.Errorf("expected error for an invalid OID")
+	}
+}
+
+func TestBerInt(t *testing.T) {
+	tests := map[int64][]byte{
+		0:    {0x00},
+		127:  {0x7f},
+		128:  {0x00, 0x80},
+		256:  {0x01, 0x00},
+		-129: {0xff, 0x7f},
+	}
+	for n, expected := range tests {
+		if b := berInt(n); !bytes.Equal(b, expected) {
+			t.Errorf("%d: expected % x, got % x", n, expected, b)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package soapui
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// The markers around the generated settings of a configuration, and of each
+// of its monitors. Everything outside of them was added by hand, and is kept
+// when the configuration is generated again.
+const (
+	GeneratedBegin = "# --- generated by stoh: changes in this section are overwritten ---"
+	GeneratedEnd   = "# --- end of generated section ---"
+)
+
+var (
+	// the table header of a monitor, of which the key is captured as written.
+	monitorHeader = regexp.MustCompile(`^\s*\[\s*monitor\.("(?:[^"\\]|\\.)*"|[A-Za-z0-9_-]+)\s*\]\s*(#.*)?$`)
+	// a key/value pair, of which the key is captured.
+	settingLine = regexp.MustCompile(`^\s*([A-Za-z0-9_-]+)\s*=`)
+	// the header of a (array of) table in a monitor, of which the key in the
+	// monitor is captured.
+	subTableHeader = regexp.MustCompile(`^\s*\[\[?\s*monitor\.(?:"(?:[^"\\]|\\.)*"|[A-Za-z0-9_-]+)\.([A-Za-z0-9_-]+)`)
+)
+
+// setting is a generated setting of a configuration or a monitor: the key,
+// and the lines with its value.
+type setting struct {
+	key  string
+	text string
+}
+
+// settings collects the generated settings of a configuration or a monitor.
+type settings []setting
+
+// add adds the setting with the key, of which the value is formatted.
+func (s *settings) add(key, format string, args ...interface{}) {
+	*s = append(*s, setting{key, fmt.Sprintf(key+" = "+format+"\n", args...)})
+}
+
+// manualEdits are the lines of an earlier generated configuration outside of
+// the generated sections.
+type manualEdits struct {
+	top      []string            // the lines before the first monitor
+	monitors map[string][]string // monitor key (as written in the header) -> lines
+	keys     []string            // the monitor keys, in order
+}
+
+// parseManualEdits returns the manual edits of an earlier generated
+// configuration. Configurations without generated sections (generated before
+// the markers were introduced) have no manual edits, but their monitors are
+// still returned.
+func parseManualEdits(config []byte) manualEdits {
+	edits := manualEdits{monitors: make(map[string][]string)}
+	marked := strings.Contains(string(config), GeneratedBegin)
+
+	var key string // the monitor of the current line, empty before the first
+	generated := false
+	for _, line := range strings.Split(string(config), "\n") {
+		switch trimmed := strings.TrimSpace(line); {
+		case trimmed == GeneratedBegin:
+			generated = true
+			continue
+		case trimmed == GeneratedEnd:
+			generated = false
+			continue
+		case generated:
+			continue
+		}
+
+		if m := monitorHeader.FindStringSubmatch(line); m != nil {
+			key = m[1]
+			if _, ok := edits.monitors[key]; !ok {
+				edits.monitors[key] = nil
+				edits.keys = append(edits.keys, key)
+			}
+			continue
+		}
+		if !marked {
+			continue
+		}
+		if key == "" {
+			edits.top = append(edits.top, line)
+		} else {
+			edits.monitors[key] = append(edits.monitors[key], line)
+		}
+	}
+	return edits
+}
+
+// overriddenKeys returns the keys set by the manual lines: the keys before the
+// first table header, and the tables of the monitor (such as assertions with
+// a severity). These replace the generated settings with the same key.
+func overriddenKeys(lines []string) map[string]bool {
+	keys := make(map[string]bool)
+	inTable := false
+	for _, line := range lines {
+		if m := subTableHeader.FindStringSubmatch(line); m != nil {
+			keys[m[1]] = true
+		}
+		if strings.HasPrefix(strings.TrimSpace(line), "[") {
+			inTable = true
+		}
+		if m := settingLine.FindStringSubmatch(line); m != nil && !inTable {
+			keys[m[1]] = true
+		}
+	}
+	return keys
+}
+
+// trimBlank returns the lines without the leading and trailing blank lines.
+func trimBlank(lines []string) []string {
+	for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// writeSettings writes the generated settings between the markers, followed
+// by the manual lines. Settings of which the key is set by the manual lines
+// are left out, so the manual value is used.
+func writeSettings(w io.Writer, generated settings, manual []string) {
+	overridden := overriddenKeys(manual)
+	fmt.Fprintln(w, GeneratedBegin)
+	for _, s := range generated {
+		if !overridden[s.key] {
+			io.WriteString(w, s.text)
+		}
+	}
+	fmt.Fprintln(w, GeneratedEnd)
+	for _, line := range trimBlank(manual) {
+		fmt.Fprintln(w, line)
+	}
+	fmt.Fprintln(w)
+}
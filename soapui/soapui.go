@@ -0,0 +1,784 @@
+// Package soapui converts SoapUI projects to hmon configurations. It is used
+// by both the stoh tool and the 'hmon convert soapui' subcommand.
+package soapui
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+/*
+A SoapUI project has the following structure (only the elements
+we're interested in are given):
+
+soapui-project
+	interface* (@name = binding name)
+		operation* (@action = soapaction for this binding)
+					@bindingOperationName = operation name)
+	testSuite* (@name)
+		testCase*
+			testStep* (@name)
+				config
+					interface = the endpoint binding
+					operation = the operation of the binding
+					request (@name)
+						endpoint (endpoint URL)
+						request (cdata content with request)
+						assertion @type ("Simple NotContains",  "Not Contains", "Simple Contains")
+							configuration
+								token ("Error")
+								ignoreCase bool
+								useRegEx bool
+						wsaConfig (@action, unreliable)
+*/
+
+// Project is the root node of a SoapUI project.
+type Project struct {
+	Name      string      `xml:"name,attr"`           // the project name
+	Interface []Interface `xml:"interface"`           // all deffed interfaces
+	TestSuite []TestSuite `xml:"testSuite"`           // all testsuites
+	Property  []Property  `xml:"properties>property"` // project-wide properties
+}
+
+// Print prints out the full project to the given writer, in a
+// structured view.
+func (p Project) Print(writer io.Writer) {
+	for _, i := range p.Interface {
+		fmt.Fprintf(writer, "Interface '%s'\n", i.Name)
+		for _, x := range i.Operation {
+			fmt.Fprintf(writer, "\tOperation name:  %s\n", x.Name)
+			fmt.Fprintf(writer, "\tSOAP Action:     %s\n\n", x.SoapAction)
+		}
+	}
+
+	fmt.Fprintf(writer, "Project properties: %d\n", len(p.Property))
+	for _, p := range p.Property {
+		fmt.Fprintf(writer, "\t%s = %s\n", p.Name, p.Value)
+	}
+
+	fmt.Fprintln(writer)
+
+	for _, s := range p.TestSuite {
+		fmt.Fprintf(writer, "Testsuite '%s'\n", s.Name)
+		fmt.Fprintf(writer, "\tTestsuite properties: %d\n", len(s.Property))
+		for _, p := range s.Property {
+			fmt.Fprintf(writer, "\t\t%s = %s\n", p.Name, p.Value)
+		}
+
+		fmt.Fprintln(writer)
+
+		for _, t := range s.TestCase {
+			fmt.Printf("\tTestcase '%s'\n", t.Name)
+			fmt.Fprintf(writer, "\t\tTestcase properties: %d\n", len(t.Property))
+			for _, p := range t.Property {
+				fmt.Fprintf(writer, "\t\t\t%s = %s\n", p.Name, p.Value)
+			}
+
+			fmt.Fprintln(writer)
+
+			for _, ts := range t.TestStep {
+				fmt.Fprintf(writer, "\t\tName:        %s\n", ts.Name)
+				fmt.Fprintf(writer, "\t\tType:        %s\n", ts.Type)
+				fmt.Fprintf(writer, "\t\tTimeout:     %d ms\n", ts.Request.GetTimeout())
+
+				if ts.Type == "request" {
+					fmt.Fprintf(writer, "\t\tEndpoint:    %s\n", ts.Request.Endpoint)
+					fmt.Fprintf(writer, "\t\tOperation:   %s\n", ts.Operation)
+					fmt.Fprintf(writer, "\t\tBinding:     %s\n", ts.Binding)
+					fmt.Fprintf(writer, "\t\tReq len:     %d\n", len(ts.Request.Content))
+					fmt.Fprintf(writer, "\t\tSOAPAction:  %s\n", p.FindSoapAction(ts.Binding, ts.Operation))
+					fmt.Fprintf(writer, "\t\tAssertions:  %d\n", len(ts.Request.Assertion))
+					fmt.Fprintf(writer, "\t\t (valid):    %d\n", len(ts.Request.GetAssertions()))
+				} else if ts.Type == "httprequest" {
+					fmt.Fprintf(writer, "\t\tEndpoint:    %s\n", ts.Endpoint)
+					fmt.Fprintf(writer, "\t\tReq len:     %d\n", len(ts.Request.Content2))
+					fmt.Fprintf(writer, "\t\tAssertions:  %d\n", len(ts.Assertion))
+					fmt.Fprintf(writer, "\t\t (valid):    %d\n", len(ts.GetAssertions()))
+				}
+				fmt.Fprintln(writer)
+			}
+		}
+	}
+}
+
+// GetAllProperties finds all project propeties and puts them in a map.
+// The keys of the map will have the following form:
+//
+//	${#Project#some.property.name}
+//	${#Project#another.property.name}
+//
+// and so on.
+func (p Project) GetAllProperties() map[string]string {
+	m := make(map[string]string)
+
+	// get all project wide properties
+	for _, pp := range p.Property {
+		key := fmt.Sprintf("${#Project#%s}", pp.Name)
+		m[key] = pp.Value
+	}
+
+	return m
+}
+
+// FindSoapAction iterates through the interfaces and its operations to
+// find the correct SOAPAction belonging to the binding name and operation
+// name. This function is used to get the correct SOAP Action when processing
+// testsuites/cases, since the SOAP action cannot be retrieved reliably from
+// those elements and descendants.
+func (p Project) FindSoapAction(bindingName, operationName string) string {
+	for _, interf := range p.Interface {
+		if interf.Name == bindingName {
+			for _, operation := range interf.Operation {
+				if operation.Name == operationName {
+					return operation.SoapAction
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// Interface is a repeating element in the Project rootnode.
+type Interface struct {
+	Name      string      `xml:"name,attr"` // the binding name
+	Operation []Operation `xml:"operation"` // operations per binding
+}
+
+// Operation is a repeating element in the Project rootnode.
+type Operation struct {
+	Name       string `xml:"name,attr"`   // op name
+	SoapAction string `xml:"action,attr"` // soapaction for op
+}
+
+// TestSuite contains SoapUI testcases.
+type TestSuite struct {
+	Name     string     `xml:"name,attr"`
+	TestCase []TestCase `xml:"testCase"`
+	Property []Property `xml:"properties>property"`
+}
+
+func (t TestSuite) GetAllProperties() map[string]string {
+	m := make(map[string]string)
+
+	// get all testsuite properties
+	for _, pp := range t.Property {
+		key := fmt.Sprintf("${#TestSuite#%s}", pp.Name)
+		m[key] = pp.Value
+	}
+
+	return m
+
+}
+
+// TestCase contains SoapUI test steps.
+type TestCase struct {
+	Name     string     `xml:"name,attr"`
+	TestStep []TestStep `xml:"testStep"`
+	Property []Property `xml:"properties>property"`
+}
+
+func (t TestCase) GetAllProperties() map[string]string {
+	m := make(map[string]string)
+
+	// get all testsuite properties
+	for _, pp := range t.Property {
+		key := fmt.Sprintf("${#TestCase#%s}", pp.Name)
+		m[key] = pp.Value
+	}
+
+	return m
+
+}
+
+// TestStep contains information about teststeps within a testcase.
+type TestStep struct {
+	Name      string  `xml:"name,attr"`
+	Type      string  `xml:"type,attr"`
+	Disabled  bool    `xml:"disabled,attr"`
+	Binding   string  `xml:"config>interface"`
+	Operation string  `xml:"config>operation"`
+	Request   Request `xml:"config>request"`
+
+	// Only in case type == "httprequest":
+	Assertion []Assertion `xml:"config>assertion"`
+	Endpoint  string      `xml:"config>endpoint"`
+}
+
+// GetAssertions find the correct assertions applicable for hmon. SoapUI defines
+// several types of assertions (like Groovy scripts etc.) but we're only interested
+// in the simple "Contains" assertions, since hmon can only assert against those.
+// The tokens are converted using Assertion.Regex.
+func (ts TestStep) GetAssertions() []string {
+	var validAssertions []string
+
+	for _, ass := range ts.Assertion {
+		if ass.Type == "Simple Contains" {
+			validAssertions = append(validAssertions, ass.Regex())
+		}
+	}
+	return validAssertions
+}
+
+// GetSanitizedName sanitizes the name of a teststep so it can be used in the resulting
+// toml configuration file. Keys are written quoted, but periods are still removed to keep
+// the keys readable, and compatible with earlier generated configurations.
+func (ts TestStep) GetSanitizedName() string {
+	return strings.Replace(ts.Name, ".", "", -1)
+}
+
+// Request contains information about the teststep request. The timeout is defined in an
+// attribute, so we need to deserialize it in this struct.
+type Request struct {
+	Endpoint  string      `xml:"endpoint"`
+	Content   string      `xml:"request"` // when SOAP, content is within the request element
+	Timeout   int         `xml:"timeout,attr"`
+	Assertion []Assertion `xml:"assertion"`
+
+	// Only applicable when step type == "httprequest"
+	Content2 string `xml:",chardata"` // when non-SOAP, content is contained within this tag :/
+}
+
+// GetAssertions find the correct assertions applicable for hmon. SoapUI defines
+// several types of assertions (like Groovy scripts etc.) but we're only interested
+// in the simple "Contains" assertions, since hmon can only assert against those.
+// The tokens are converted using Assertion.Regex.
+func (req Request) GetAssertions() []string {
+	var validAssertions []string
+
+	for _, ass := range req.Assertion {
+		if ass.Type == "Simple Contains" {
+			validAssertions = append(validAssertions, ass.Regex())
+		}
+	}
+	return validAssertions
+}
+
+// GetTimeout returns a 'sane' timeout value. If it's not found, or lower than zero, the
+// timeout will be set to a default of 30000 ms.
+func (req Request) GetTimeout() int {
+	if req.Timeout <= 0 {
+		return 30000
+	}
+
+	return req.Timeout
+}
+
+// Assertion contains information about the teststep's assertions.
+type Assertion struct {
+	Type       string `xml:"type,attr"`
+	Token      string `xml:"configuration>token"`
+	IgnoreCase bool   `xml:"configuration>ignoreCase"`
+	UseRegEx   bool   `xml:"configuration>useRegEx"`
+}
+
+// Regex returns the assertion as a regular expression for hmon. Tokens which
+// are not regular expressions in SoapUI are quoted, so they are matched
+// literally. When SoapUI ignores the case of the token, the regex gets the
+// (?i) flag. Regex tokens get the (?s) flag, since SoapUI lets '.' match
+// newlines as well.
+func (a Assertion) Regex() string {
+	regex := regexp.QuoteMeta(a.Token)
+	if a.UseRegEx {
+		regex = "(?s)" + a.Token
+	}
+	if a.IgnoreCase {
+		regex = "(?i)" + regex
+	}
+	return regex
+}
+
+// Property contains project, testsuite or testcase properties.
+type Property struct {
+	Name  string `xml:"name"`
+	Value string `xml:"value"`
+}
+
+// ParseFile parses the given file to a Project struct. Will return
+// an error if anything failed.
+func ParseFile(file string) (Project, error) {
+	p := Project{}
+
+	bytes, err := ioutil.ReadFile(file)
+	if err != nil {
+		return p, err
+	}
+
+	err = xml.Unmarshal(bytes, &p)
+	if err != nil {
+		return p, err
+	}
+
+	return p, nil
+}
+
+// Output is where the converter writes the generated files to. Names are
+// slash separated paths, relative to the root of the output.
+type Output interface {
+	// Create creates (or truncates) the named file, creating any parent
+	// directories as needed.
+	Create(name string) (io.WriteCloser, error)
+}
+
+// Reader is implemented by outputs which can read back the files generated
+// earlier, so the manual edits of configurations are kept when they're
+// generated again.
+type Reader interface {
+	// ReadFile returns the contents of the named file, or an error for
+	// which os.IsNotExist is true when it doesn't exist.
+	ReadFile(name string) ([]byte, error)
+}
+
+// DirOutput writes the generated files below a directory on disk.
+type DirOutput string
+
+// Create implements Output.
+func (d DirOutput) Create(name string) (io.WriteCloser, error) {
+	file := filepath.Join(string(d), filepath.FromSlash(name))
+	err := os.MkdirAll(filepath.Dir(file), 0755)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create directory: %s", err)
+	}
+
+	f, err := os.Create(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file: %s", err)
+	}
+	return f, nil
+}
+
+// ReadFile implements Reader.
+func (d DirOutput) ReadFile(name string) ([]byte, error) {
+	return ioutil.ReadFile(filepath.Join(string(d), filepath.FromSlash(name)))
+}
+
+// MemOutput keeps the generated files in memory, keyed by name. This is
+// mostly useful for testing, or to process the output any further.
+type MemOutput map[string]*bytes.Buffer
+
+// Create implements Output.
+func (m MemOutput) Create(name string) (io.WriteCloser, error) {
+	buf := &bytes.Buffer{}
+	m[name] = buf
+	return nopCloser{buf}, nil
+}
+
+// ReadFile implements Reader.
+func (m MemOutput) ReadFile(name string) ([]byte, error) {
+	buf, ok := m[name]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	return buf.Bytes(), nil
+}
+
+// nopCloser adds a no-op Close method to a writer.
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+// writeFile creates the named file in the output and writes the contents.
+func writeFile(out Output, name string, contents []byte) error {
+	w, err := out.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(contents)
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write `%s': %s", name, err)
+	}
+	return nil
+}
+
+// SearchAndReplace searches in the given text for all the keys given in the map, and
+// replaces them with the value belonging to that key.
+func SearchAndReplace(text string, kvs map[string]string) string {
+	for key, value := range kvs {
+		text = strings.Replace(text, key, value, -1)
+	}
+
+	return text
+}
+
+// The pattern of a property reference, e.g. ${#Project#endpoint} or ${endpoint}.
+var propertyPattern = regexp.MustCompile(`\$\{[^{}]*\}`)
+
+// The maximum depth of property references within property values. Anything
+// deeper is most likely a reference cycle.
+const maxExpandDepth = 10
+
+// Expander expands SoapUI property references in texts. Property values may
+// contain references themselves, which are expanded recursively. References
+// which can't be resolved are left as-is, and are recorded in Unresolved
+// (reference -> the location given to Expand).
+type Expander struct {
+	Properties map[string]string
+	Unresolved map[string]string
+}
+
+// NewExpander creates an expander for the properties of the given project,
+// testsuite and testcase. Besides the scoped references (${#Project#x},
+// ${#TestSuite#x} and ${#TestCase#x}), unscoped references (${x}) are
+// resolved too, where testcase properties take precedence over testsuite
+// properties, which take precedence over project properties.
+func NewExpander(p Project, s TestSuite, c TestCase, unresolved map[string]string) *Expander {
+	properties := p.GetAllProperties()
+	MergeMap(s.GetAllProperties(), properties)
+	MergeMap(c.GetAllProperties(), properties)
+
+	for _, scope := range [][]Property{p.Property, s.Property, c.Property} {
+		for _, pp := range scope {
+			properties["${"+pp.Name+"}"] = pp.Value
+		}
+	}
+
+	return &Expander{properties, unresolved}
+}
+
+// Expand expands all property references in the text. The location is only
+// used for reporting unresolved references.
+func (e *Expander) Expand(text, location string) string {
+	return e.expand(text, location, 0)
+}
+
+func (e *Expander) expand(text, location string, depth int) string {
+	return propertyPattern.ReplaceAllStringFunc(text, func(ref string) string {
+		value, found := e.Properties[ref]
+		if !found || depth >= maxExpandDepth {
+			if _, seen := e.Unresolved[ref]; !seen {
+				e.Unresolved[ref] = location
+			}
+			return ref
+		}
+		return e.expand(value, location, depth+1)
+	})
+}
+
+// MergeMap is a small utility function to copy all elements from the src map to the dst map.
+func MergeMap(src map[string]string, dst map[string]string) {
+	for k, v := range src {
+		dst[k] = v
+	}
+}
+
+// The schema version of the generated configurations.
+const ConfigSchema = 2
+
+// The granularities in which configuration files can be generated.
+const (
+	SplitByProject   = "project"   // one configuration for the whole project
+	SplitByTestSuite = "testsuite" // one configuration per testsuite
+	SplitByTestCase  = "testcase"  // one configuration per testcase
+)
+
+// UniqueKey returns the sanitized name as a monitor key, made unique within a
+// single configuration file by appending a sequence number if needed. The used
+// keys are tracked in the given map.
+func UniqueKey(name string, used map[string]bool) string {
+	key := name
+	for i := 2; used[key]; i++ {
+		key = fmt.Sprintf("%s_%d", name, i)
+	}
+	used[key] = true
+	return key
+}
+
+// Options control the conversion of a project.
+type Options struct {
+	SplitBy string // one of SplitByProject, SplitByTestSuite or SplitByTestCase
+}
+
+// Report contains the findings of a conversion.
+type Report struct {
+	Unresolved map[string]string // unresolved property references -> location of first use
+	Problems   []string          // problems found when verifying the generated configurations
+	Removed    []string          // monitors of earlier generated configurations which are no longer in the project
+}
+
+// Print writes the unresolved property references, with the location they
+// were first used in, and the problems of the generated configurations to
+// the writer.
+func (r Report) Print(writer io.Writer) {
+	if len(r.Unresolved) > 0 {
+		var refs []string
+		for ref := range r.Unresolved {
+			refs = append(refs, ref)
+		}
+		sort.Strings(refs)
+
+		fmt.Fprintf(writer, "Warning: %d unresolved property reference(s):\n", len(refs))
+		for _, ref := range refs {
+			fmt.Fprintf(writer, "\t%s (first used in %s)\n", ref, r.Unresolved[ref])
+		}
+	}
+
+	if len(r.Removed) > 0 {
+		fmt.Fprintf(writer, "Warning: removed %d monitor(s) (and their manual edits) no longer in the project:\n", len(r.Removed))
+		for _, m := range r.Removed {
+			fmt.Fprintf(writer, "\t%s\n", m)
+		}
+	}
+
+	if len(r.Problems) > 0 {
+		fmt.Fprintf(writer, "Error: %d problem(s) in the generated configurations:\n", len(r.Problems))
+		for _, p := range r.Problems {
+			fmt.Fprintf(writer, "\t%s\n", p)
+		}
+	}
+}
+
+// TOMLString returns s as a quoted TOML basic string, escaping the characters
+// which can't be used as-is.
+func TOMLString(s string) string {
+	var buf bytes.Buffer
+	buf.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"':
+			buf.WriteString(`\"`)
+		case r == '\\':
+			buf.WriteString(`\\`)
+		case r == '\n':
+			buf.WriteString(`\n`)
+		case r == '\r':
+			buf.WriteString(`\r`)
+		case r == '\t':
+			buf.WriteString(`\t`)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&buf, `\u%04X`, r)
+		default:
+			buf.WriteRune(r)
+		}
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
+
+// The part of a hmon configuration which is verified after generation.
+type generatedConfig struct {
+	Name    string
+	Monitor map[string]struct {
+		Name       string
+		URL        string
+		File       string
+		Assertions []interface{} // manually edited assertions may be tables
+	}
+}
+
+// verifyConfig parses a generated configuration like hmon would, and checks
+// the monitors for problems: malformed URLs, invalid assertions and request
+// files which have not been generated. The postdata map contains the names
+// of the generated request files, relative to the postdata directory.
+func verifyConfig(name string, config []byte, postdata map[string]bool) []string {
+	var problems []string
+
+	var c generatedConfig
+	_, err := toml.Decode(string(config), &c)
+	if err != nil {
+		return append(problems, fmt.Sprintf("%s: unparsable configuration: %s", name, err))
+	}
+
+	for key, m := range c.Monitor {
+		if _, err := url.ParseRequestURI(m.URL); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: monitor '%s': malformed url (%s)", name, key, err))
+		}
+		if m.File != "" && !postdata[m.File] {
+			problems = append(problems, fmt.Sprintf("%s: monitor '%s': request file '%s' does not exist", name, key, m.File))
+		}
+		for _, v := range m.Assertions {
+			a, ok := v.(string)
+			if !ok {
+				continue
+			}
+			if _, err := regexp.Compile(a); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: monitor '%s': assertion '%s' has an invalid regex: %s", name, key, a, err))
+			}
+		}
+	}
+
+	sort.Strings(problems)
+	return problems
+}
+
+// Process converts the given project, and writes the generated files to the
+// output. Configurations are written to 'configs/', and the request files to
+// 'postdata/<testsuite>/'. The Options determine whether one configuration
+// file is generated for the whole project, per testsuite or per testcase.
+// Every generated configuration is verified by parsing it again; the returned
+// report contains any problems found, and the property references which
+// could not be resolved.
+//
+// When the output is a Reader, configurations generated earlier are merged:
+// the generated settings are replaced, while the lines added by hand outside
+// of the generated sections are kept, per monitor. Manually set keys take
+// precedence over the generated ones. Monitors of steps which are no longer
+// in the project are removed, and listed in the report.
+func Process(p Project, out Output, opts Options) (Report, error) {
+	report := Report{Unresolved: make(map[string]string)}
+
+	switch opts.SplitBy {
+	case SplitByProject, SplitByTestSuite, SplitByTestCase:
+	default:
+		return report, fmt.Errorf("invalid split '%s' (must be project, testsuite or testcase)", opts.SplitBy)
+	}
+
+	// the configuration currently being generated.
+	var configName string
+	var config *bytes.Buffer
+	var usedKeys map[string]bool
+	var written map[string]bool // the monitor keys, as written in the headers
+	var order int               // position of the step within the configuration
+	var edits manualEdits       // of the earlier generated configuration, if any
+
+	// the request files generated so far, relative to the postdata directory.
+	postdata := make(map[string]bool)
+
+	// verifies and writes the current configuration (if any) to the output.
+	flushConfig := func() error {
+		if config == nil {
+			return nil
+		}
+		name := path.Join("configs", configName+"_hmon.toml")
+		for _, key := range edits.keys {
+			if !written[key] {
+				report.Removed = append(report.Removed, fmt.Sprintf("%s: monitor %s", name, key))
+			}
+		}
+		report.Problems = append(report.Problems, verifyConfig(name, config.Bytes(), postdata)...)
+		return writeFile(out, name, config.Bytes())
+	}
+
+	// starts a new configuration with the given name.
+	newConfig := func(name string) error {
+		if err := flushConfig(); err != nil {
+			return err
+		}
+		configName = name
+		config = &bytes.Buffer{}
+		usedKeys = make(map[string]bool)
+		written = make(map[string]bool)
+		order = 0
+
+		edits = manualEdits{}
+		if r, ok := out.(Reader); ok {
+			file := path.Join("configs", name+"_hmon.toml")
+			b, err := r.ReadFile(file)
+			if err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to read `%s': %s", file, err)
+			}
+			edits = parseManualEdits(b)
+		}
+
+		var top settings
+		top.add("schema", "%d", ConfigSchema)
+		top.add("name", "%s", TOMLString(name))
+		writeSettings(config, top, edits.top)
+		return nil
+	}
+
+	if opts.SplitBy == SplitByProject {
+		if err := newConfig(p.Name); err != nil {
+			return report, err
+		}
+	}
+
+	for _, s := range p.TestSuite {
+		// the request files of a suite share its directory, while step
+		// names repeat across its testcases.
+		usedFiles := make(map[string]bool)
+		if opts.SplitBy == SplitByTestSuite {
+			if err := newConfig(s.Name); err != nil {
+				return report, err
+			}
+		}
+
+		for _, c := range s.TestCase {
+			if opts.SplitBy == SplitByTestCase {
+				if err := newConfig(s.Name + " - " + c.Name); err != nil {
+					return report, err
+				}
+			}
+
+			// first, gather all possible properties for the underlying testcases
+			expander := NewExpander(p, s, c, report.Unresolved)
+
+			for _, step := range c.TestStep {
+				location := fmt.Sprintf("%s / %s / %s", s.Name, c.Name, step.Name)
+
+				// write the request file
+				var content string
+				if step.Type == "request" {
+					content = expander.Expand(step.Request.Content, location)
+				} else if step.Type == "httprequest" {
+					content = expander.Expand(step.Request.Content2, location)
+				}
+				file := path.Join(s.Name, UniqueKey(step.Name, usedFiles)+".xml")
+				err := writeFile(out, path.Join("postdata", file), []byte(content))
+				if err != nil {
+					return report, err
+				}
+				postdata[file] = true
+
+				var monitor settings
+				monitor.add("name", "%s", TOMLString(step.Name))
+				monitor.add("file", "%s", TOMLString(file))
+				monitor.add("timeout", "%d", step.Request.GetTimeout())
+
+				// keep the order of the steps as in the SoapUI project, and
+				// retain the steps which are disabled there.
+				order++
+				monitor.add("order", "%d", order)
+				if step.Disabled {
+					monitor.add("disabled", "true")
+				}
+
+				var assertions []string
+				if step.Type == "request" {
+					monitor.add("url", "%s", TOMLString(expander.Expand(step.Request.Endpoint, location)))
+					monitor.add("headers", "[\n  %s,\n  %s\n]",
+						TOMLString("SOAPAction: "+p.FindSoapAction(step.Binding, step.Operation)),
+						TOMLString("Content-Type: application/soap+xml"))
+					assertions = step.Request.GetAssertions()
+				} else if step.Type == "httprequest" {
+					monitor.add("url", "%s", TOMLString(expander.Expand(step.Endpoint, location)))
+					assertions = step.GetAssertions()
+				}
+				if step.Type == "request" || step.Type == "httprequest" {
+					var list bytes.Buffer
+					for _, ass := range assertions {
+						fmt.Fprintf(&list, "  %s,\n", TOMLString(ass))
+					}
+					monitor.add("assertions", "[\n%s]", list.String())
+				}
+
+				key := TOMLString(UniqueKey(step.GetSanitizedName(), usedKeys))
+				written[key] = true
+				fmt.Fprintf(config, "[monitor.%s]\n", key)
+				writeSettings(config, monitor, edits.monitors[key])
+			}
+		}
+	}
+
+	if err := flushConfig(); err != nil {
+		return report, err
+	}
+
+	return report, nil
+}
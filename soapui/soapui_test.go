@@ -0,0 +1,430 @@
+package soapui
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Simply prepares a project file, serialized as structs to test with.
+func prepareProject() Project {
+	p := Project{
+		TestSuite: []TestSuite{
+			{
+				Name: "TestSuite One",
+				TestCase: []TestCase{
+					{
+						Name: "GetRelation Tests",
+						TestStep: []TestStep{
+							{
+								Name:      "Step 1",
+								Binding:   "GetRelation1.0-EndpointBinding",
+								Operation: "getRelationName",
+								Request: Request{
+									Endpoint: "http://example.org:80/getRelationName/1.0",
+									Content:  "<soapenv:Envelope> ... </soapenv:Envelope>",
+									Timeout:  0,
+									Assertion: []Assertion{
+										{
+											Type:  "Simple Contains",
+											Token: "Text in response",
+										},
+										{
+											Type:  "Simple Contains",
+											Token: "Other text",
+										},
+										{
+											// should be ignored for now (also, not sure
+											// if correct Type. Figure this out)
+											Type:  "RegEx",
+											Token: "^whatevs$",
+										},
+										{
+											// should be ignored
+											Type:  "Groovy Script",
+											Token: "slkjdalksj",
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		Interface: []Interface{
+			{
+				Name: "GetRelation-1.0EndpointBinding",
+				Operation: []Operation{
+					{
+						Name:       "getRelationName",
+						SoapAction: "http://example.org/getRelationName",
+					},
+					{
+						Name:       "getRelationAge",
+						SoapAction: "http://example.org/getRelationAge",
+					},
+				},
+			},
+			{
+				Name: "Authenticate-1.0EndpointBinding",
+				Operation: []Operation{
+					{
+						Name:       "authenticateUserPass",
+						SoapAction: "http://example.org/authenticateUserPass",
+					},
+					{
+						Name:       "authenticateFake",
+						SoapAction: "http://example.org/authenticateFake",
+					},
+				},
+			},
+		},
+	}
+
+	return p
+}
+
+func TestFindSoapAction(t *testing.T) {
+	p := prepareProject()
+
+	assert := func(expected, actual string) {
+		if expected != actual {
+			t.Errorf("Expected '%s', got '%s'", expected, actual)
+		}
+	}
+
+	action := p.FindSoapAction("GetRelation-1.0EndpointBinding", "getRelationAge")
+	expected := "http://example.org/getRelationAge"
+	assert(expected, action)
+
+	action = p.FindSoapAction("GetRelation-1.0EndpointBinding", "getRelationName")
+	expected = "http://example.org/getRelationName"
+	assert(expected, action)
+
+	action = p.FindSoapAction("Authenticate-1.0EndpointBinding", "authenticateFake")
+	expected = "http://example.org/authenticateFake"
+	assert(expected, action)
+}
+
+func TestGetAssertions(t *testing.T) {
+	p := prepareProject()
+
+	testStep := p.TestSuite[0].TestCase[0].TestStep[0]
+	assertions := testStep.Request.GetAssertions()
+
+	if len(assertions) != 2 {
+		t.Errorf("Expected 2 assertions, got %d", len(assertions))
+	}
+
+	expected := "Text in response"
+	if assertions[0] != expected {
+		t.Errorf("First assertion should be '%s', got '%s'", expected, assertions[0])
+	}
+	expected = "Other text"
+	if assertions[1] != expected {
+		t.Errorf("Second assertion should be '%s', got '%s'", expected, assertions[1])
+	}
+}
+
+func TestAssertionRegex(t *testing.T) {
+	tests := []struct {
+		assertion Assertion
+		expected  string
+	}{
+		{Assertion{Token: "a.b (c)"}, `a\.b \(c\)`},
+		{Assertion{Token: "error", IgnoreCase: true}, `(?i)error`},
+		{Assertion{Token: "^OK.*$", UseRegEx: true}, `(?s)^OK.*$`},
+		{Assertion{Token: "ok.*", UseRegEx: true, IgnoreCase: true}, `(?i)(?s)ok.*`},
+	}
+	for _, test := range tests {
+		if regex := test.assertion.Regex(); regex != test.expected {
+			t.Errorf("Expected regex '%s', got '%s'", test.expected, regex)
+		}
+	}
+}
+
+func TestGetTimeout(t *testing.T) {
+	p := prepareProject()
+	request := p.TestSuite[0].TestCase[0].TestStep[0].Request
+
+	timeout := request.GetTimeout()
+	if timeout != 30000 {
+		t.Errorf("Expected a default of 30000 ms when timeout is not specified")
+	}
+}
+
+func TestSearchAndReplace(t *testing.T) {
+	m := make(map[string]string)
+	m["${#Project#project.property.endpoint}"] = "http://example.org"
+	m["${#Project#another.property}"] = "http://example.org"
+	m["${#TestSuite#prop.hello}"] = "world!"
+
+	text := "The endpoint is ${#Project#project.property.endpoint}. Hello ${#TestSuite#prop.hello}!"
+	text = SearchAndReplace(text, m)
+	if text != "The endpoint is http://example.org. Hello world!!" {
+		t.Errorf("Unexpected substitution: %s", text)
+	}
+}
+
+func TestMergeMap(t *testing.T) {
+	src := make(map[string]string)
+	dst := make(map[string]string)
+
+	src["Kevin"] = "Left handed"
+	src["Margot"] = "Right handed"
+
+	dst["Michael"] = "Right handed"
+	dst["Brunings"] = "Middle handed"
+
+	MergeMap(src, dst)
+
+	if _, found := dst["Kevin"]; !found {
+		t.Errorf("Expecting 'Kevin' in map")
+	}
+
+	if _, found := dst["Margot"]; !found {
+		t.Errorf("Expecting 'Margot' in map")
+	}
+
+	if _, found := dst["Michael"]; !found {
+		t.Errorf("Expecting 'Michael' in map")
+	}
+
+	if _, found := dst["Brunings"]; !found {
+		t.Errorf("Expecting 'Brunings' in map")
+	}
+
+}
+
+func TestUniqueKey(t *testing.T) {
+	used := make(map[string]bool)
+
+	keys := []string{
+		UniqueKey("Step", used),
+		UniqueKey("Step", used),
+		UniqueKey("Other", used),
+		UniqueKey("Step", used),
+	}
+	expected := []string{"Step", "Step_2", "Other", "Step_3"}
+	for i := range keys {
+		if keys[i] != expected[i] {
+			t.Errorf("Expected '%s', got '%s'", expected[i], keys[i])
+		}
+	}
+}
+
+func TestExpander(t *testing.T) {
+	p := Project{Property: []Property{
+		{"host", "example.org"},
+		{"endpoint", "http://${#Project#host}:${port}"},
+		{"port", "80"},
+	}}
+	s := TestSuite{Property: []Property{{"port", "8080"}}}
+	c := TestCase{Property: []Property{{"path", "/service/${#TestSuite#port}"}}}
+
+	unresolved := make(map[string]string)
+	e := NewExpander(p, s, c, unresolved)
+
+	text := e.Expand("${#Project#endpoint}${#TestCase#path} ${missing}", "here")
+	if text != "http://example.org:8080/service/8080 ${missing}" {
+		t.Errorf("Unexpected expansion: %s", text)
+	}
+
+	if len(unresolved) != 1 || unresolved["${missing}"] != "here" {
+		t.Errorf("Expected ${missing} to be unresolved, got %v", unresolved)
+	}
+}
+
+var update = flag.Bool("update", false, "Update the golden files in testdata/golden")
+
+// Converts the demo project, and compares all generated files with the golden
+// files. Run the tests with -update to regenerate the golden files.
+func TestProcessGolden(t *testing.T) {
+	project, err := ParseFile(filepath.Join("testdata", "Demo-soapui-project.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := MemOutput{}
+	report, err := Process(project, out, Options{SplitBy: SplitByTestSuite})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Problems) > 0 {
+		t.Errorf("Expected no problems in the generated configurations, got %v", report.Problems)
+	}
+
+	goldenDir := filepath.Join("testdata", "golden")
+	if *update {
+		os.RemoveAll(goldenDir)
+		err = writeAll(DirOutput(goldenDir), out)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	goldenFiles := 0
+	filepath.Walk(goldenDir, func(file string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			goldenFiles++
+		}
+		return nil
+	})
+	if goldenFiles != len(out) {
+		t.Errorf("Expected %d generated files, got %d", goldenFiles, len(out))
+	}
+
+	for name, buf := range out {
+		expected, err := ioutil.ReadFile(filepath.Join(goldenDir, filepath.FromSlash(name)))
+		if err != nil {
+			t.Errorf("Unexpected generated file '%s': %s", name, err)
+			continue
+		}
+		if !bytes.Equal(expected, buf.Bytes()) {
+			t.Errorf("Generated file '%s' differs from the golden file:\n%s", name, buf)
+		}
+	}
+}
+
+// Generates the demo project twice: the manual edits of the first generated
+// configuration must be kept, and the monitors of removed steps dropped.
+func TestProcessMerge(t *testing.T) {
+	project, err := ParseFile(filepath.Join("testdata", "Demo-soapui-project.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := MemOutput{}
+	if _, err := Process(project, out, Options{SplitBy: SplitByTestSuite}); err != nil {
+		t.Fatal(err)
+	}
+
+	name := "configs/HTTP Only_hmon.toml"
+	edited := strings.Replace(out[name].String(), GeneratedEnd+"\n\n[monitor", GeneratedEnd+"\n# tuned by hand\nname = \"Custom\"\n\n[monitor", 1)
+	edited = strings.Replace(edited, "]\n"+GeneratedEnd+"\n", "]\n"+GeneratedEnd+"\nowner = \"ops\"\ntimeout = 5000\n[[monitor.\"Test with properties\".assertions]]\nregex = \"OK\"\nseverity = \"warning\"\n", 1)
+	edited += "[monitor.\"Removed step\"]\n" + GeneratedBegin + "\nurl = \"http://example.com\"\n" + GeneratedEnd + "\n"
+	out[name] = bytes.NewBufferString(edited)
+
+	report, err := Process(project, out, Options{SplitBy: SplitByTestSuite})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Problems) > 0 {
+		t.Errorf("expected no problems, got %v", report.Problems)
+	}
+	if len(report.Removed) != 1 || report.Removed[0] != name+`: monitor "Removed step"` {
+		t.Errorf("expected the removed step to be reported, got %v", report.Removed)
+	}
+
+	merged := out[name].String()
+	for _, expected := range []string{"# tuned by hand\nname = \"Custom\"\n", "owner = \"ops\"\ntimeout = 5000\n", "severity = \"warning\"\n"} {
+		if !strings.Contains(merged, expected) {
+			t.Errorf("expected the manual edit %q to be kept, got:\n%s", expected, merged)
+		}
+	}
+	for _, unexpected := range []string{"name = \"HTTP Only\"", "timeout = 30000", "assertions = [", "Removed step"} {
+		if strings.Contains(merged, unexpected) {
+			t.Errorf("expected %q to be replaced by the manual edits, got:\n%s", unexpected, merged)
+		}
+	}
+
+	// generating the merged configuration again changes nothing.
+	if _, err := Process(project, out, Options{SplitBy: SplitByTestSuite}); err != nil {
+		t.Fatal(err)
+	}
+	if out[name].String() != merged {
+		t.Errorf("expected the merge to be stable, got:\n%s", out[name])
+	}
+}
+
+func TestTOMLString(t *testing.T) {
+	tests := map[string]string{
+		`plain`:          `"plain"`,
+		`with "quotes"`:  `"with \"quotes\""`,
+		`C:\dir`:         `"C:\\dir"`,
+		"tab\tnewline\n": `"tab\tnewline\n"`,
+		"bell\a":         `"bell\u0007"`,
+	}
+	for in, expected := range tests {
+		if out := TOMLString(in); out != expected {
+			t.Errorf("Expected %s, got %s", expected, out)
+		}
+	}
+}
+
+func TestVerifyConfig(t *testing.T) {
+	postdata := map[string]bool{"suite/step.xml": true}
+
+	good := `name = "good"
+[monitor."a step"]
+url = "http://example.com/"
+file = "suite/step.xml"
+assertions = [ "OK", "(?i)ok" ]
+`
+	if problems := verifyConfig("good", []byte(good), postdata); len(problems) != 0 {
+		t.Errorf("Expected no problems, got %v", problems)
+	}
+
+	bad := `name = "bad"
+[monitor.step]
+url = "not a url"
+file = "suite/missing.xml"
+assertions = [ "(unclosed" ]
+`
+	if problems := verifyConfig("bad", []byte(bad), postdata); len(problems) != 3 {
+		t.Errorf("Expected 3 problems, got %v", problems)
+	}
+
+	if problems := verifyConfig("unparsable", []byte("[monitor.a b]"), postdata); len(problems) != 1 {
+		t.Errorf("Expected 1 problem, got %v", problems)
+	}
+}
+
+// Steps with the same name in different testcases of a suite must have
+// request files of their own.
+func TestProcessRepeatedStepNames(t *testing.T) {
+	project := prepareProject()
+	suite := &project.TestSuite[0]
+	suite.TestCase[0].TestStep[0].Type = "request"
+	step := suite.TestCase[0].TestStep[0]
+	step.Request.Content = "<soapenv:Envelope> second </soapenv:Envelope>"
+	suite.TestCase = append(suite.TestCase, TestCase{Name: "Other Tests", TestStep: []TestStep{step}})
+
+	out := MemOutput{}
+	if _, err := Process(project, out, Options{SplitBy: SplitByTestSuite}); err != nil {
+		t.Fatal(err)
+	}
+	first, second := out["postdata/TestSuite One/Step 1.xml"], out["postdata/TestSuite One/Step 1_2.xml"]
+	if first == nil || second == nil {
+		t.Fatalf("expected two request files, got %d files", len(out))
+	}
+	if strings.Contains(first.String(), "second") || !strings.Contains(second.String(), "second") {
+		t.Errorf("expected the request of each step in its own file, got '%s' and '%s'", first, second)
+	}
+	config := out["configs/TestSuite One_hmon.toml"]
+	if config == nil || !strings.Contains(config.String(), `file = "TestSuite One/Step 1_2.xml"`) {
+		t.Errorf("expected the second monitor to use the second request file, got:\n%s", config)
+	}
+}
+
+func TestProcessInvalidSplit(t *testing.T) {
+	_, err := Process(prepareProject(), MemOutput{}, Options{SplitBy: "teststep"})
+	if err == nil {
+		t.Errorf("Expected error on invalid split")
+	}
+}
+
+// Copies all files from the in-memory output to another output.
+func writeAll(out Output, files MemOutput) error {
+	for name, buf := range files {
+		if err := writeFile(out, name, buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// StatsdClient sends the metrics of monitor results to a StatsD server, over
+// UDP. For every result, a latency timer and a success or failure counter are
+// sent:
+//
+//	<prefix>.<config>.<monitor>.latency:120|ms
+//	<prefix>.<config>.<monitor>.success:1|c
+//
+// With DogStatsD, the configuration, monitor, owner and failure code are sent
+// as tags instead, so the metric names are the same for all monitors:
+//
+//	<prefix>.latency:120|ms|#config:orders,monitor:status
+//	<prefix>.failure:1|c|#config:orders,monitor:status,code:HM-TIMEOUT
+type StatsdClient struct {
+	Address   string // host:port of the StatsD server
+	Prefix    string // prefix of the metric names
+	DogStatsD bool   // send the names as tags
+	conn      net.Conn
+}
+
+// NewStatsdClient creates a client sending to the address, of which the port
+// defaults to 8125.
+func NewStatsdClient(address, prefix string, dogStatsD bool) (*StatsdClient, error) {
+	if !strings.Contains(address, ":") {
+		address = address + ":8125"
+	}
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to statsd `%s': %s", address, err)
+	}
+	return &StatsdClient{address, prefix, dogStatsD, conn}, nil
+}
+
+// statsdName replaces the characters which have a meaning in the StatsD
+// protocol (and in metric names) by underscores.
+func statsdName(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ':', '|', '@', '#', ',', '.', '/', ' ', '\t', '\n':
+			return '_'
+		}
+		return r
+	}, s)
+}
+
+// message returns the metrics of the result, one per line.
+func (s *StatsdClient) message(configName string, r Result) []byte {
+	counter := "success"
+	if r.Error != nil {
+		counter = "failure"
+	}
+
+	var buf bytes.Buffer
+	if !s.DogStatsD {
+		name := s.Prefix + "." + statsdName(configName) + "." + statsdName(r.Monitor.Name)
+		fmt.Fprintf(&buf, "%s.latency:%d|ms\n", name, r.Latency)
+		fmt.Fprintf(&buf, "%s.%s:1|c", name, counter)
+		return buf.Bytes()
+	}
+
+	tags := "|#config:" + statsdName(configName) + ",monitor:" + statsdName(r.Monitor.Name)
+	if r.Monitor.Owner != "" {
+		tags += ",owner:" + statsdName(r.Monitor.Owner)
+	}
+	fmt.Fprintf(&buf, "%s.latency:%d|ms%s\n", s.Prefix, r.Latency, tags)
+	if r.Code != "" {
+		tags += ",code:" + r.Code
+	}
+	fmt.Fprintf(&buf, "%s.%s:1|c%s", s.Prefix, counter, tags)
+	return buf.Bytes()
+}
+
+// Send sends the metrics of a single result, in one datagram.
+func (s *StatsdClient) Send(configName string, r Result) error {
+	_, err := s.conn.Write(s.message(configName, r))
+	return err
+}
+
+// Close closes the connection.
+func (s *StatsdClient) Close() error {
+	return s.conn.Close()
+}
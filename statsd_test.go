@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestStatsdMessage(t *testing.T) {
+	s := &StatsdClient{Prefix: "hmon"}
+	ok := Result{Monitor: Monitor{Name: "Order status"}, Latency: 120}
+	failed := Result{Monitor: Monitor{Name: "Order status", Owner: "team.orders"}, Latency: 80, Error: ResultError{errors.New("timeout")}, Code: FailureTimeout}
+
+	expected := "hmon.orders_eu.Order_status.latency:120|ms\nhmon.orders_eu.Order_status.success:1|c"
+	if msg := string(s.message("orders.eu", ok)); msg != expected {
+		t.Errorf("expected %q, got %q", expected, msg)
+	}
+
+	s.DogStatsD = true
+	expected = "hmon.latency:80|ms|#config:orders_eu,monitor:Order_status,owner:team_orders\n" +
+		"hmon.failure:1|c|#config:orders_eu,monitor:Order_status,owner:team_orders,code:HM-TIMEOUT"
+	if msg := string(s.message("orders.eu", failed)); msg != expected {
+		t.Errorf("expected %q, got %q", expected, msg)
+	}
+}
+
+func TestStatsdSend(t *testing.T) {
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	s, err := NewStatsdClient(server.LocalAddr().String(), "hmon", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if err := s.Send("c", Result{Monitor: Monitor{Name: "m"}, Latency: 5}); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 1024)
+	server.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := server.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "hmon.c.m.latency:5|ms\nhmon.c.m.success:1|c"; string(buf[:n]) != expected {
+		t.Errorf("expected %q, got %q", expected, buf[:n])
+	}
+}
@@ -4,17 +4,60 @@ S to H: SoapUI to Hmon converter.
 Very simple SoapUI project file to hmon configuration converter. This tool
 currently only works with SoapUI projects with WSDLs, testsuites and testcases.
 Normal HTTP calls are not (yet) supported.  To invoke the tool, supply SoapUI
-project file as the first argument to the tool. It will generate two folders:
+project file as the first argument to the tool. It will generate two folders
+in the '_generated' directory, or the directory given with -out:
 	
 	configs
 
-This folder contains the generated hmon configuration file. The filename is
-based on the name of the testcase.
+This folder contains the generated hmon configuration files. By default, one
+configuration file is generated per testsuite, and the filename is based on
+the name of the testsuite. Using the -split-by flag, this can be changed to
+one configuration for the whole 'project', or one per 'testcase':
+
+	stoh -split-by testcase project.xml
+
+When splitting per testcase, the configuration is named after both the
+testsuite and the testcase.
 
 	postdata
 
 This folder contains one subdirectory named after the testsuite. That folder
 contains XML files which are the postdata.
 
+Property references in endpoints and requests are expanded. Both scoped
+(${#Project#x}, ${#TestSuite#x}, ${#TestCase#x}) and unscoped (${x})
+references are supported, where an unscoped reference resolves to the
+testcase, testsuite or project property, in that order. Property values may
+contain references themselves. References which could not be resolved are
+reported at the end of the conversion.
+
+Only 'Simple Contains' assertions are converted. Tokens are matched literally,
+unless the assertion uses a regular expression in SoapUI. When the assertion
+ignores case, the generated regex starts with (?i).
+
+The order of the test steps is kept using the 'order' attribute of the
+generated monitors. Test steps which are disabled in SoapUI are generated as
+monitors with 'disabled = true', so hmon won't run them.
+
+Every generated configuration is parsed again after generation, and its
+monitors are checked for malformed URLs, invalid assertion regexes and
+request files which were not generated. Any problems are reported, and stoh
+exits with code 3.
+
+The generated settings of the configurations and their monitors are placed
+between the markers
+
+	# --- generated by stoh: changes in this section are overwritten ---
+	# --- end of generated section ---
+
+When stoh is run again on an updated project, with the same -out directory,
+the existing configurations are merged: the generated sections are replaced,
+monitors of new test steps are added, and everything added by hand after the
+generated section of a monitor (or of the configuration) is kept, such as
+tags, owners and notification settings. A key set by hand replaces the
+generated key, so moving the assertions out of the generated section (for
+instance to give them a severity) keeps them as edited. Monitors of test steps
+which were removed from the project are removed too, and reported.
+
 */
 package main
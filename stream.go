@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// ResultWriter writes results as soon as the monitors complete, instead of
+// after all configurations have run. This way, long runs produce usable
+// partial output, and the results don't have to be kept around for writing.
+//
+// Errors are sticky: after a failed write, further writes are ignored and the
+// error is returned by Close.
+type ResultWriter interface {
+	// WriteResult writes a single result of the given configuration.
+	WriteResult(configName string, r Result)
+	// Close flushes and closes the output, and returns the first error.
+	Close() error
+}
+
+// The output formats which are written while running, and the functions
+// creating their writers. 'ndjson' is the same as 'jsonl'.
+var streamingFormats = map[string]func(filename string) (ResultWriter, error){
+	"csv":    newCsvWriter,
+	"jsonl":  newJSONLinesWriter,
+	"ndjson": newJSONLinesWriter,
+}
+
+// The output file which writes to stdout instead, for the streaming formats,
+// json and prometheus.
+const stdoutOutput = "-"
+
+// createOutput creates the output file of a streaming format, or returns
+// stdout for the stdoutOutput.
+func createOutput(filename string) (*os.File, error) {
+	if filename == stdoutOutput {
+		return os.Stdout, nil
+	}
+	f, err := os.Create(filename)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open file for writing `%s': %s", filename, err)
+	}
+	return f, nil
+}
+
+// closeOutput closes the output file, unless it's stdout.
+func closeOutput(f *os.File) error {
+	if f == os.Stdout {
+		return nil
+	}
+	return f.Close()
+}
+
+// csvWriter writes every result as a CSV record, flushed right away.
+type csvWriter struct {
+	f   *os.File
+	w   *csv.Writer
+	err error
+}
+
+func newCsvWriter(filename string) (ResultWriter, error) {
+	f, err := createOutput(filename)
+	if err != nil {
+		return nil, err
+	}
+	return &csvWriter{f: f, w: csv.NewWriter(f)}, nil
+}
+
+// csvRecord returns the CSV record of a result.
+func csvRecord(res Result) []string {
+	status := "FAIL"
+	if res.Error == nil {
+		status = "OK"
+	}
+
+	notAfter := ""
+	if res.CertNotAfter != nil {
+		notAfter = timestamps.String(*res.CertNotAfter)
+	}
+
+	return []string{
+		status,
+		res.Monitor.Name,
+		res.Monitor.URL,
+		strconv.FormatInt(res.Latency, 10),
+		strconv.FormatInt(res.BytesSent, 10),
+		strconv.FormatInt(res.BytesReceived, 10),
+		timestamps.String(res.Time),
+		notAfter,
+		strconv.FormatInt(res.Phases.DNS, 10),
+		strconv.FormatInt(res.Phases.Connect, 10),
+		strconv.FormatInt(res.Phases.TLS, 10),
+		strconv.FormatInt(res.Phases.FirstByte, 10),
+		res.Monitor.Owner,
+		res.Code,
+	}
+}
+
+func (c *csvWriter) WriteResult(configName string, res Result) {
+	if c.err != nil {
+		return
+	}
+
+	c.w.Write(csvRecord(res))
+	c.w.Flush()
+	c.err = c.w.Error()
+}
+
+func (c *csvWriter) Close() error {
+	err := closeOutput(c.f)
+	if c.err != nil {
+		return fmt.Errorf("unable to write to file `%s': %s", c.f.Name(), c.err)
+	}
+	return err
+}
+
+// jsonLinesWriter writes every result as a JSON object on a single line,
+// including the name of the configuration it belongs to.
+type jsonLinesWriter struct {
+	f   *os.File
+	w   *bufio.Writer
+	err error
+}
+
+func newJSONLinesWriter(filename string) (ResultWriter, error) {
+	f, err := createOutput(filename)
+	if err != nil {
+		return nil, err
+	}
+	return &jsonLinesWriter{f: f, w: bufio.NewWriter(f)}, nil
+}
+
+// The object written per line by the jsonLinesWriter.
+type jsonLine struct {
+	ConfigurationName string
+	Time              string // the time of the result, formatted by the timestamps
+	Result            Result
+}
+
+func (j *jsonLinesWriter) WriteResult(configName string, res Result) {
+	if j.err != nil {
+		return
+	}
+
+	res.Time = timestamps.In(res.Time)
+	b, err := json.Marshal(jsonLine{configName, timestamps.String(res.Time), res})
+	if err != nil {
+		j.err = err
+		return
+	}
+	j.w.Write(b)
+	j.w.WriteByte('\n')
+	j.err = j.w.Flush()
+}
+
+func (j *jsonLinesWriter) Close() error {
+	err := closeOutput(j.f)
+	if j.err != nil {
+		return fmt.Errorf("unable to write to file `%s': %s", j.f.Name(), j.err)
+	}
+	return err
+}
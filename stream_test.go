@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestStreamingWriters(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hmon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	results := []Result{
+		{Monitor: Monitor{Name: "first", URL: "http://example.org"}, Latency: 12},
+		{Monitor: Monitor{Name: "second", URL: "http://example.org"}, Error: ResultError{errors.New(`quoted "error"`)}},
+	}
+
+	for format, newWriter := range streamingFormats {
+		file := path.Join(dir, "results."+format)
+		w, err := newWriter(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// every result must be in the file right after writing it.
+		for i, r := range results {
+			w.WriteResult("config", r)
+			b, _ := ioutil.ReadFile(file)
+			if lines := strings.Count(string(b), "\n"); lines != i+1 {
+				t.Errorf("%s: expected %d lines after writing, got %d", format, i+1, lines)
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Errorf("%s: unexpected error on close: %s", format, err)
+		}
+	}
+
+	b, err := ioutil.ReadFile(path.Join(dir, "results.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	var line struct {
+		ConfigurationName string
+		Result            struct{ Error string }
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &line); err != nil {
+		t.Fatalf("expected valid json, got: %s", err)
+	}
+	if line.ConfigurationName != "config" || line.Result.Error != `quoted "error"` {
+		t.Errorf("unexpected line %s", lines[1])
+	}
+}
+
+// captureStdout returns what's written to stdout by f.
+func captureStdout(t *testing.T, f func()) string {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	f()
+	// stdout is left open by the writers.
+	w.WriteString("end\n")
+	w.Close()
+	b, _ := ioutil.ReadAll(r)
+	return string(b)
+}
+
+func TestStreamingToStdout(t *testing.T) {
+	out := captureStdout(t, func() {
+		writer, err := streamingFormats["ndjson"](stdoutOutput)
+		if err != nil {
+			t.Fatal(err)
+		}
+		writer.WriteResult("config", Result{Monitor: Monitor{Name: "first"}})
+		if err := writer.Close(); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 2 || lines[1] != "end" {
+		t.Fatalf("expected a result and 'end', got %q", out)
+	}
+	var line jsonLine
+	if err := json.Unmarshal([]byte(lines[0]), &line); err != nil || line.ConfigurationName != "config" {
+		t.Errorf("expected a result of configuration 'config', got %q (%v)", lines[0], err)
+	}
+}
+
+func TestWriteToStdout(t *testing.T) {
+	results := []ConfigurationResult{{ConfigurationName: "config", Results: []Result{{Monitor: Monitor{Name: "first"}}}}}
+
+	out := captureStdout(t, func() {
+		if err := writeJSON(stdoutOutput, &results); err != nil {
+			t.Fatal(err)
+		}
+	})
+	var written []ConfigurationResult
+	if err := json.Unmarshal([]byte(strings.TrimSuffix(out, "end\n")), &written); err != nil || len(written) != 1 {
+		t.Errorf("expected the json results on stdout, got %q (%v)", out, err)
+	}
+
+	out = captureStdout(t, func() {
+		if err := writePrometheus(stdoutOutput, &results); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if !strings.Contains(out, `monitor="first"`) {
+		t.Errorf("expected the prometheus metrics on stdout, got %q", out)
+	}
+}
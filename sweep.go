@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+)
+
+// Resolves the addresses of a host. A variable, so tests can replace it.
+var lookupIP = net.LookupIP
+
+// Returns the hostname of the URL, or an empty string if it can't be parsed.
+func hostname(rawurl string) string {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
+// SweepPools replaces every enabled monitor with 'sweep = true' by one
+// monitor per address (A and AAAA records) of its host, so every backend
+// behind round-robin DNS is checked, instead of whichever one the resolver
+// returns. The monitors get the key 'monitor%address' and the address
+// appended to their name. They connect to their address, but still send the
+// Host header and TLS server name of the URL. Monitors of which the host
+// can't be resolved are left alone, so the run reports the resolve error, and
+// so are monitors with a proxy, since the proxy connects to the host.
+// Returns the number of monitors added.
+func (c *Config) SweepPools() int {
+	added := 0
+	for key, monitor := range c.Monitor {
+		if !monitor.Sweep || monitor.Disabled || monitor.Backend != "" || monitor.Proxy != "" {
+			continue
+		}
+		host := hostname(monitor.URL)
+		if host == "" || net.ParseIP(host) != nil {
+			continue
+		}
+		ips, err := lookupIP(host)
+		if err != nil || len(ips) == 0 {
+			continue
+		}
+
+		addresses := make([]string, 0, len(ips))
+		seen := make(map[string]bool)
+		for _, ip := range ips {
+			if a := ip.String(); !seen[a] {
+				seen[a] = true
+				addresses = append(addresses, a)
+			}
+		}
+		sort.Strings(addresses)
+
+		delete(c.Monitor, key)
+		for _, address := range addresses {
+			m := monitor
+			m.Backend = address
+			m.Name = fmt.Sprintf("%s @ %s", monitor.Name, address)
+			c.Monitor[key+"%"+address] = m
+		}
+		added += len(addresses) - 1
+	}
+	return added
+}
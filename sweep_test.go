@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSweepPools(t *testing.T) {
+	defer func(f func(string) ([]net.IP, error)) { lookupIP = f }(lookupIP)
+	lookupIP = func(host string) ([]net.IP, error) {
+		if host != "pool.example.org" {
+			return nil, fmt.Errorf("no such host")
+		}
+		return []net.IP{net.ParseIP("10.0.0.2"), net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2"), net.ParseIP("2001:db8::1")}, nil
+	}
+
+	c := Config{Monitor: map[string]Monitor{
+		"pool":     {Name: "Pool", URL: "https://pool.example.org/health", Sweep: true},
+		"unknown":  {Name: "Unknown", URL: "https://unknown.example.org/", Sweep: true},
+		"literal":  {Name: "Literal", URL: "http://10.1.1.1/", Sweep: true},
+		"disabled": {Name: "Disabled", URL: "https://pool.example.org/", Sweep: true, Disabled: true},
+		"single":   {Name: "Single", URL: "https://pool.example.org/"},
+	}}
+	if added := c.SweepPools(); added != 2 {
+		t.Errorf("expected 2 monitors to be added, got %d", added)
+	}
+
+	for _, address := range []string{"10.0.0.1", "10.0.0.2", "2001:db8::1"} {
+		m, found := c.Monitor["pool%"+address]
+		if !found {
+			t.Errorf("expected a monitor for %s, got %v", address, c.Monitor)
+			continue
+		}
+		if m.Backend != address || m.Name != "Pool @ "+address || m.URL != "https://pool.example.org/health" {
+			t.Errorf("unexpected monitor for %s: %+v", address, m)
+		}
+	}
+	for _, key := range []string{"unknown", "literal", "disabled", "single"} {
+		if m, found := c.Monitor[key]; !found || m.Backend != "" {
+			t.Errorf("expected monitor '%s' to be left alone, got %+v", key, m)
+		}
+	}
+}
+
+func TestRunBackend(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "Host %s", r.Host)
+	}))
+	defer server.Close()
+
+	// the host doesn't resolve, so the request can only reach the server
+	// through the backend address.
+	_, port, _ := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+	m := Monitor{
+		URL:        "http://pool.invalid:" + port + "/",
+		Backend:    "127.0.0.1",
+		Assertions: []Assertion{{Value: "Host pool.invalid:" + port}},
+	}
+	ch := make(chan Result, 1)
+	go m.Run(".", ch)
+	if r := <-ch; r.Error != nil {
+		t.Errorf("expected the request to reach the backend with the original host, got %s", r.Error)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// The named formats of timestamps, besides Go reference layouts.
+const (
+	TimeFormatRFC3339 = "rfc3339" // e.g. 2006-01-02T15:04:05+07:00
+	TimeFormatUnix    = "unix"    // seconds since the Unix epoch
+	TimeFormatUnixMs  = "unixms"  // milliseconds since the Unix epoch
+)
+
+// Timestamps determines how the times of results are written by the output
+// formats: in which time zone, and with which format. The format is one of the
+// TimeFormat constants, or a Go reference layout like "2006-01-02 15:04:05".
+type Timestamps struct {
+	Location *time.Location
+	Format   string
+}
+
+// The timestamps used by all output formats, set by the -timezone and
+// -time-format flags. Defaults to RFC 3339 in the local time zone.
+var timestamps = Timestamps{time.Local, TimeFormatRFC3339}
+
+// NewTimestamps creates Timestamps from a time zone name like "UTC" or
+// "Europe/Amsterdam", and a format. An empty zone means the local time zone,
+// and an empty format means RFC 3339.
+func NewTimestamps(zone, format string) (Timestamps, error) {
+	ts := Timestamps{time.Local, TimeFormatRFC3339}
+	if zone != "" {
+		loc, err := time.LoadLocation(zone)
+		if err != nil {
+			return ts, fmt.Errorf("unknown time zone `%s': %s", zone, err)
+		}
+		ts.Location = loc
+	}
+	if format != "" {
+		ts.Format = format
+	}
+	return ts, nil
+}
+
+// In returns the time in the time zone of the timestamps.
+func (ts Timestamps) In(t time.Time) time.Time {
+	return t.In(ts.Location)
+}
+
+// String formats the time. The zero time (e.g. of results from before results
+// had a time) is formatted as an empty string.
+func (ts Timestamps) String(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	switch ts.Format {
+	case TimeFormatRFC3339:
+		return ts.In(t).Format(time.RFC3339)
+	case TimeFormatUnix:
+		return strconv.FormatInt(t.Unix(), 10)
+	case TimeFormatUnixMs:
+		return strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10)
+	}
+	return ts.In(t).Format(ts.Format)
+}
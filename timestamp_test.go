@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimestamps(t *testing.T) {
+	tm := time.Date(2015, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		zone, format, expected string
+	}{
+		{"UTC", "", "2015-03-01T12:00:00Z"},
+		{"Europe/Amsterdam", "", "2015-03-01T13:00:00+01:00"},
+		{"Europe/Amsterdam", "2006-01-02 15:04", "2015-03-01 13:00"},
+		{"Europe/Amsterdam", TimeFormatUnix, "1425211200"},
+		{"UTC", TimeFormatUnixMs, "1425211200000"},
+	}
+	for _, test := range tests {
+		ts, err := NewTimestamps(test.zone, test.format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := ts.String(tm); s != test.expected {
+			t.Errorf("expected '%s' for %s/%s, got '%s'", test.expected, test.zone, test.format, s)
+		}
+	}
+
+	ts, _ := NewTimestamps("UTC", "")
+	if s := ts.String(time.Time{}); s != "" {
+		t.Errorf("expected an empty string for the zero time, got '%s'", s)
+	}
+	if _, err := NewTimestamps("Nowhere/Special", ""); err == nil {
+		t.Errorf("expected an error for an unknown time zone")
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ServerTiming is a timing reported by the server, through the Server-Timing
+// header or one of the timing headers of the monitor.
+type ServerTiming struct {
+	Name        string
+	Duration    float64 // in milliseconds
+	Description string  `json:",omitempty"`
+}
+
+// splitQuoted splits s on sep, except where sep is within double quotes.
+func splitQuoted(s string, sep byte) []string {
+	var parts []string
+	quoted := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '"':
+			quoted = !quoted
+		case s[i] == sep && !quoted:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// parseServerTiming parses the values of Server-Timing headers, like
+// 'db;dur=53, app;dur=47.2;desc="Application"'. Metrics without a duration
+// are included with a duration of zero.
+func parseServerTiming(values []string) []ServerTiming {
+	var timings []ServerTiming
+	for _, value := range values {
+		for _, metric := range splitQuoted(value, ',') {
+			params := splitQuoted(metric, ';')
+			name := strings.TrimSpace(params[0])
+			if name == "" {
+				continue
+			}
+
+			timing := ServerTiming{Name: name}
+			for _, param := range params[1:] {
+				kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+				if len(kv) != 2 {
+					continue
+				}
+				v := strings.Trim(strings.TrimSpace(kv[1]), `"`)
+				switch strings.ToLower(strings.TrimSpace(kv[0])) {
+				case "dur":
+					timing.Duration, _ = strconv.ParseFloat(v, 64)
+				case "desc":
+					timing.Description = v
+				}
+			}
+			timings = append(timings, timing)
+		}
+	}
+	return timings
+}
+
+// parseTimingHeader parses a custom timing header. Its value is either a
+// number of milliseconds, or a duration like '120ms' or '1.5s'.
+func parseTimingHeader(value string) (float64, error) {
+	value = strings.TrimSpace(value)
+	if ms, err := strconv.ParseFloat(value, 64); err == nil {
+		return ms, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("unparsable timing `%s'", value)
+	}
+	return float64(d) / float64(time.Millisecond), nil
+}
+
+// serverTimings returns the timings reported in the response headers: the
+// Server-Timing header, and the given custom timing headers. Custom headers
+// which can't be parsed are skipped.
+func serverTimings(header http.Header, timingHeaders []string) []ServerTiming {
+	timings := parseServerTiming(header["Server-Timing"])
+	for _, name := range timingHeaders {
+		value := header.Get(name)
+		if value == "" {
+			continue
+		}
+		if ms, err := parseTimingHeader(value); err == nil {
+			timings = append(timings, ServerTiming{Name: name, Duration: ms})
+		}
+	}
+	return timings
+}
+
+// Returns the timings as a single line, like 'db=53ms app=47.2ms'.
+func formatServerTimings(timings []ServerTiming) string {
+	var parts []string
+	for _, t := range timings {
+		parts = append(parts, fmt.Sprintf("%s=%sms", t.Name, strconv.FormatFloat(t.Duration, 'f', -1, 64)))
+	}
+	return strings.Join(parts, " ")
+}
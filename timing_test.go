@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestParseServerTiming(t *testing.T) {
+	timings := parseServerTiming([]string{
+		`db;dur=53, app;dur=47.2;desc="Application, main"`,
+		`cache;desc="hit"`,
+	})
+
+	expected := []ServerTiming{
+		{Name: "db", Duration: 53},
+		{Name: "app", Duration: 47.2, Description: "Application, main"},
+		{Name: "cache", Description: "hit"},
+	}
+	if !reflect.DeepEqual(timings, expected) {
+		t.Errorf("expected %+v, got %+v", expected, timings)
+	}
+}
+
+func TestServerTimings(t *testing.T) {
+	header := http.Header{}
+	header.Set("Server-Timing", "db;dur=12")
+	header.Set("X-Backend-Time", "1.5s")
+	header.Set("X-Elapsed", "80")
+	header.Set("X-Broken", "soon")
+
+	timings := serverTimings(header, []string{"X-Backend-Time", "X-Elapsed", "X-Broken", "X-Missing"})
+	if line := formatServerTimings(timings); line != "db=12ms X-Backend-Time=1500ms X-Elapsed=80ms" {
+		t.Errorf("unexpected timings '%s'", line)
+	}
+}
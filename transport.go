@@ -0,0 +1,435 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// byteCounter counts the bytes sent and received over the connections of a
+// single monitor run. These are the bytes on the wire, so they include the
+// HTTP headers and any TLS overhead.
+type byteCounter struct {
+	sent     int64
+	received int64
+}
+
+// Sent returns the amount of bytes written so far.
+func (b *byteCounter) Sent() int64 {
+	return atomic.LoadInt64(&b.sent)
+}
+
+// Received returns the amount of bytes read so far.
+func (b *byteCounter) Received() int64 {
+	return atomic.LoadInt64(&b.received)
+}
+
+// countingConn is a net.Conn which adds all read and written bytes to a counter.
+type countingConn struct {
+	net.Conn
+	counter *byteCounter
+}
+
+func (c countingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	atomic.AddInt64(&c.counter.received, int64(n))
+	return n, err
+}
+
+func (c countingConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	atomic.AddInt64(&c.counter.sent, int64(n))
+	return n, err
+}
+
+// Phases is the latency of a request broken down into its phases, in
+// milliseconds. Phases which didn't happen are zero, like DNS when the URL
+// has an IP address, or TLS for plain HTTP. Only the first request is timed
+// when the monitor is redirected.
+type Phases struct {
+	DNS       int64 // resolving the host
+	Connect   int64 // setting up the TCP connection
+	TLS       int64 // the TLS handshake
+	FirstByte int64 // from sending the request until the first byte of the response
+}
+
+// connectTimer records when the transport starts getting a connection for
+// a request. Measuring latency from there, instead of from before the request
+// goroutine is scheduled, keeps hmon's own queueing out of the latency when
+// many monitors run in parallel. It also records the phases of the request.
+type connectTimer struct {
+	sync.Mutex
+	start time.Time // when the first connection was requested, zero before
+
+	// the moments of the phases of the first request, zero until they happen.
+	dnsStart, dnsDone         time.Time
+	connectStart, connectDone time.Time
+	tlsStart, tlsDone         time.Time
+	wroteRequest, firstByte   time.Time
+}
+
+// trace returns the client trace which starts the timer.
+func (t *connectTimer) trace() *httptrace.ClientTrace {
+	// sets the moment, unless it was set by an earlier request already.
+	mark := func(moment *time.Time) {
+		t.Lock()
+		defer t.Unlock()
+		if moment.IsZero() {
+			*moment = time.Now()
+		}
+	}
+	return &httptrace.ClientTrace{
+		// redirects get a connection of their own, which are part of the
+		// latency of the first.
+		GetConn:              func(string) { mark(&t.start) },
+		DNSStart:             func(httptrace.DNSStartInfo) { mark(&t.dnsStart) },
+		DNSDone:              func(httptrace.DNSDoneInfo) { mark(&t.dnsDone) },
+		ConnectStart:         func(string, string) { mark(&t.connectStart) },
+		ConnectDone:          func(string, string, error) { mark(&t.connectDone) },
+		TLSHandshakeStart:    func() { mark(&t.tlsStart) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { mark(&t.tlsDone) },
+		WroteRequest:         func(httptrace.WroteRequestInfo) { mark(&t.wroteRequest) },
+		GotFirstResponseByte: func() { mark(&t.firstByte) },
+	}
+}
+
+// phases returns the phases recorded so far.
+func (t *connectTimer) phases() Phases {
+	t.Lock()
+	defer t.Unlock()
+	between := func(start, end time.Time) int64 {
+		if start.IsZero() || end.IsZero() {
+			return 0
+		}
+		return int64(end.Sub(start) / time.Millisecond)
+	}
+	return Phases{
+		DNS:       between(t.dnsStart, t.dnsDone),
+		Connect:   between(t.connectStart, t.connectDone),
+		TLS:       between(t.tlsStart, t.tlsDone),
+		FirstByte: between(t.wroteRequest, t.firstByte),
+	}
+}
+
+// started returns when the connection was requested, or the fallback when
+// it wasn't (yet).
+func (t *connectTimer) started(fallback time.Time) time.Time {
+	t.Lock()
+	defer t.Unlock()
+	if t.start.IsZero() {
+		return fallback
+	}
+	return t.start
+}
+
+// latency returns the milliseconds since the connection was requested, or
+// since the fallback when it wasn't.
+func (t *connectTimer) latency(fallback time.Time) int64 {
+	return int64(time.Now().Sub(t.started(fallback)) / time.Millisecond)
+}
+
+// wait returns the milliseconds between queued and the connection being
+// requested: the time the request waited for hmon itself.
+func (t *connectTimer) wait(queued time.Time) int64 {
+	return int64(t.started(queued).Sub(queued) / time.Millisecond)
+}
+
+// Whether the proxies of the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment
+// variables are used, for monitors without a proxy of their own. Cleared by
+// the -no-env-proxy flag.
+var environmentProxy = true
+
+// parseProxy parses the URL of a proxy, which must be an http, https or
+// socks5 URL with a host.
+func parseProxy(rawurl string) (*url.URL, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("unsupported scheme '%s' (must be http, https or socks5)", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("no host")
+	}
+	return u, nil
+}
+
+// newTransport creates the HTTP transport for a single monitor run. It's
+// based on the default transport, but every connection is counted using
+// the given counter. Connections are not kept alive, since each monitor
+// run issues a single request. When a proxy is given, all requests go
+// through it. Otherwise, the proxy of the environment is used (if enabled).
+// When a backend address is given, connections to the host are made to that
+// address instead, bypassing the proxy of the environment. The Host header
+// and the TLS server name are still those of the host. The TLS config is
+// used when it's not nil. Hosts are looked up in the resolve cache, if any.
+func newTransport(counter *byteCounter, host, backend string, proxy *url.URL, tlsConfig *tls.Config, opts *TransportOptions) *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.DisableKeepAlives = true
+	if tlsConfig != nil {
+		t.TLSClientConfig = tlsConfig
+	}
+	switch {
+	case proxy != nil:
+		t.Proxy = http.ProxyURL(proxy)
+	case backend != "" || !environmentProxy:
+		t.Proxy = nil
+	}
+
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	opts.apply(t, dialer)
+	t.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if h, port, err := net.SplitHostPort(addr); err == nil && backend != "" && h == host {
+			addr = net.JoinHostPort(backend, port)
+		}
+		var conn net.Conn
+		var err error
+		if resolveCache != nil {
+			conn, err = resolveCache.dial(ctx, dialer, network, addr)
+		} else {
+			conn, err = dialer.DialContext(ctx, network, addr)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return countingConn{conn, counter}, nil
+	}
+
+	return t
+}
+
+// setTimeouts sets the timeout of making a connection (including the TLS
+// handshake), and of receiving the response headers after the request was
+// sent. Zero timeouts are left at their defaults: 30 seconds to connect, and
+// no timeout of their own for the response headers.
+func setTimeouts(t *http.Transport, connect, responseHeader time.Duration) {
+	if connect > 0 {
+		dial := t.DialContext
+		t.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			ctx, cancel := context.WithTimeout(ctx, connect)
+			defer cancel()
+			return dial(ctx, network, addr)
+		}
+		t.TLSHandshakeTimeout = connect
+	}
+	t.ResponseHeaderTimeout = responseHeader
+}
+
+// TLSOptions are the TLS settings of a monitor:
+//
+//	tls = { ca_file = "/etc/ssl/private-ca.pem" }
+//
+// The certificates in the CA file are trusted in addition to the system's
+// certificates. With insecure_skip_verify, certificates aren't verified at
+// all.
+type TLSOptions struct {
+	InsecureSkipVerify bool   `toml:"insecure_skip_verify"`
+	CAFile             string `toml:"ca_file"`
+
+	rootCAs *x509.CertPool // the system's and the CA file's certificates, set by load
+}
+
+// load reads the certificates of the CA file, if any.
+func (o *TLSOptions) load() error {
+	if o.CAFile == "" {
+		return nil
+	}
+	b, err := ioutil.ReadFile(o.CAFile)
+	if err != nil {
+		return fmt.Errorf("unable to read ca_file: %s", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(b) {
+		return fmt.Errorf("ca_file `%s' contains no PEM encoded certificates", o.CAFile)
+	}
+	o.rootCAs = pool
+	return nil
+}
+
+// TransportOptions are the settings of the HTTP transport of a monitor:
+//
+//	[transport]
+//	tls_min_version = "1.2"
+//	dial_timeout = 5000
+//	expect_continue_timeout = 1000
+//	disable_compression = true
+//
+// Given at the top level of a configuration, they apply to all its monitors,
+// and the settings of a monitor take precedence. The timeouts are in ms.
+//
+// Every monitor run has a transport of its own, which counts the bytes of the
+// run and connects to its backend, through its proxy, with its pins. So
+// connections aren't kept alive, and there's no pool of idle connections to
+// size.
+type TransportOptions struct {
+	TLSMinVersion         string `toml:"tls_min_version"`
+	DialTimeout           int    `toml:"dial_timeout"`
+	ExpectContinueTimeout int    `toml:"expect_continue_timeout"` // POSTs send Expect: 100-continue, and wait this long for the server to continue
+	DisableCompression    *bool  `toml:"disable_compression"`
+}
+
+// The TLS versions of tls_min_version.
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// validate checks the options, if any.
+func (o *TransportOptions) validate() error {
+	if o == nil {
+		return nil
+	}
+	if _, ok := tlsVersions[o.TLSMinVersion]; o.TLSMinVersion != "" && !ok {
+		return fmt.Errorf("has an invalid tls_min_version '%s' (must be 1.0, 1.1, 1.2 or 1.3)", o.TLSMinVersion)
+	}
+	if o.DialTimeout < 0 || o.ExpectContinueTimeout < 0 {
+		return fmt.Errorf("can't have negative settings")
+	}
+	return nil
+}
+
+// merge returns the options of the configuration, overridden by the settings
+// the monitor gives (m).
+func (o *TransportOptions) merge(m *TransportOptions) *TransportOptions {
+	if o == nil {
+		return m
+	}
+	if m == nil {
+		return o
+	}
+	merged := *o
+	if m.TLSMinVersion != "" {
+		merged.TLSMinVersion = m.TLSMinVersion
+	}
+	if m.DialTimeout != 0 {
+		merged.DialTimeout = m.DialTimeout
+	}
+	if m.ExpectContinueTimeout != 0 {
+		merged.ExpectContinueTimeout = m.ExpectContinueTimeout
+	}
+	if m.DisableCompression != nil {
+		merged.DisableCompression = m.DisableCompression
+	}
+	return &merged
+}
+
+// apply applies the options, if any, to the transport and its dialer.
+func (o *TransportOptions) apply(t *http.Transport, dialer *net.Dialer) {
+	if o == nil {
+		return
+	}
+	if version, ok := tlsVersions[o.TLSMinVersion]; ok {
+		config := &tls.Config{}
+		if t.TLSClientConfig != nil {
+			config = t.TLSClientConfig.Clone()
+		}
+		config.MinVersion = version
+		t.TLSClientConfig = config
+	}
+	if o.DialTimeout > 0 {
+		dialer.Timeout = time.Duration(o.DialTimeout) * time.Millisecond
+	}
+	if o.ExpectContinueTimeout > 0 {
+		t.ExpectContinueTimeout = time.Duration(o.ExpectContinueTimeout) * time.Millisecond
+	}
+	if o.DisableCompression != nil {
+		t.DisableCompression = *o.DisableCompression
+	}
+}
+
+// mergeTransport merges the transport settings of the configuration into the
+// monitors. The settings of a monitor take precedence.
+func (c *Config) mergeTransport() {
+	if c.Transport == nil {
+		return
+	}
+	for key, monitor := range c.Monitor {
+		monitor.Transport = c.Transport.merge(monitor.Transport)
+		c.Monitor[key] = monitor
+	}
+}
+
+// expectContinue returns true if requests with a body send Expect:
+// 100-continue.
+func (o *TransportOptions) expectContinue() bool {
+	return o != nil && o.ExpectContinueTimeout > 0
+}
+
+// spkiFingerprint returns the base64 encoded SHA-256 hash of the public key
+// (the SubjectPublicKeyInfo) of the certificate, as given in pin_sha256.
+func spkiFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// validatePin checks that the pin is a base64 encoded SHA-256 hash.
+func validatePin(pin string) error {
+	b, err := base64.StdEncoding.DecodeString(pin)
+	if err != nil || len(b) != sha256.Size {
+		return fmt.Errorf("`%s' is not a base64 encoded SHA-256 hash", pin)
+	}
+	return nil
+}
+
+// pinnedConfig returns the TLS config (nil for the default) which only accepts
+// connections of which one of the served certificates (the server's or an
+// intermediate) has a public key with one of the pinned fingerprints. The
+// connection is refused before the request is sent.
+func pinnedConfig(config *tls.Config, pins []string) *tls.Config {
+	if len(pins) == 0 {
+		return config
+	}
+	if config == nil {
+		config = &tls.Config{}
+	}
+	pinned := config.Clone()
+	pinned.VerifyConnection = func(cs tls.ConnectionState) error {
+		for _, cert := range cs.PeerCertificates {
+			fingerprint := spkiFingerprint(cert)
+			for _, pin := range pins {
+				if pin == fingerprint {
+					return nil
+				}
+			}
+		}
+		served := "none"
+		if len(cs.PeerCertificates) > 0 {
+			served = spkiFingerprint(cs.PeerCertificates[0])
+		}
+		return withCode(FailureTLSPin, fmt.Errorf("served certificates don't match pin_sha256 (the server's key is %s)", served))
+	}
+	return pinned
+}
+
+// config returns the TLS config of the options, or nil without options. The
+// CA file is read when it wasn't already.
+func (o *TLSOptions) config() (*tls.Config, error) {
+	if o == nil {
+		return nil, nil
+	}
+	if o.CAFile != "" && o.rootCAs == nil {
+		if err := o.load(); err != nil {
+			return nil, err
+		}
+	}
+	return &tls.Config{InsecureSkipVerify: o.InsecureSkipVerify, RootCAs: o.rootCAs}, nil
+}
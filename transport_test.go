@@ -0,0 +1,394 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDecodeTLSOptions(t *testing.T) {
+	var c Config
+	_, err := toml.Decode("[monitor.a]\ntls = { insecure_skip_verify = true, ca_file = \"ca.pem\" }\n", &c)
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	tls := c.Monitor["a"].TLS
+	if tls == nil || !tls.InsecureSkipVerify || tls.CAFile != "ca.pem" {
+		t.Errorf("expected the tls options to be decoded, got %+v", tls)
+	}
+}
+
+func TestRunTLSOptions(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "hmon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	caFile := filepath.Join(dir, "ca.pem")
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := ioutil.WriteFile(caFile, cert, 0644); err != nil {
+		t.Fatal(err)
+	}
+	emptyFile := filepath.Join(dir, "empty.pem")
+	if err := ioutil.WriteFile(emptyFile, []byte("no certificates"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		tls     *TLSOptions
+		success bool
+	}{
+		{"default", nil, false},
+		{"skip verify", &TLSOptions{InsecureSkipVerify: true}, true},
+		{"ca file", &TLSOptions{CAFile: caFile}, true},
+		{"no certificates", &TLSOptions{CAFile: emptyFile}, false},
+		{"missing ca file", &TLSOptions{CAFile: filepath.Join(dir, "missing.pem")}, false},
+	}
+	for _, test := range tests {
+		m := Monitor{Name: test.name, URL: server.URL, TLS: test.tls}
+		ch := make(chan Result, 1)
+		go m.Run(".", ch)
+		r := <-ch
+		if test.success && r.Error != nil {
+			t.Errorf("%s: expected success, got %s", test.name, r.Error)
+		}
+		if !test.success && r.Error == nil {
+			t.Errorf("%s: expected an error, got none", test.name)
+		}
+	}
+
+	// -insecure skips the verification of all monitors.
+	c := Config{Monitor: map[string]Monitor{"a": {URL: server.URL}, "b": {URL: server.URL, TLS: &TLSOptions{CAFile: caFile}}}}
+	c.SkipVerify()
+	for key, m := range c.Monitor {
+		if m.TLS == nil || !m.TLS.InsecureSkipVerify {
+			t.Errorf("%s: expected verification to be skipped, got %+v", key, m.TLS)
+		}
+	}
+	if c.Monitor["b"].TLS.CAFile != caFile {
+		t.Errorf("expected the ca_file to be kept, got '%s'", c.Monitor["b"].TLS.CAFile)
+	}
+}
+
+func TestConnectTimer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	}))
+	defer server.Close()
+
+	// before a connection is requested, everything is latency.
+	queued := time.Now().Add(-200 * time.Millisecond)
+	timer := &connectTimer{}
+	if wait := timer.wait(queued); wait != 0 {
+		t.Errorf("expected no wait without a connection, got %d ms", wait)
+	}
+	if latency := timer.latency(queued); latency < 200 {
+		t.Errorf("expected a latency of at least 200 ms, got %d ms", latency)
+	}
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), timer.trace()))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	resp.Body.Close()
+
+	if wait := timer.wait(queued); wait < 200 {
+		t.Errorf("expected a wait of at least 200 ms, got %d ms", wait)
+	}
+	if latency := timer.latency(queued); latency >= 200 {
+		t.Errorf("expected the wait to be excluded from the latency, got %d ms", latency)
+	}
+}
+
+func TestRunPinSHA256(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	}))
+	defer server.Close()
+
+	pin := spkiFingerprint(server.Certificate())
+	other := base64.StdEncoding.EncodeToString(make([]byte, 32))
+	tests := []struct {
+		name string
+		pins []string
+		code string
+	}{
+		{"no pins", nil, ""},
+		{"matching pin", []string{other, pin}, ""},
+		{"other pin", []string{other}, FailureTLSPin},
+	}
+	for _, test := range tests {
+		m := Monitor{Name: test.name, URL: server.URL, TLS: &TLSOptions{InsecureSkipVerify: true}, PinSHA256: test.pins}
+		ch := make(chan Result, 1)
+		go m.Run(".", ch)
+		r := <-ch
+		if r.Code != test.code {
+			t.Errorf("%s: expected code '%s', got '%s' (%v)", test.name, test.code, r.Code, r.Error)
+		}
+		if test.code != "" && !strings.Contains(r.Error.Error(), pin) {
+			t.Errorf("%s: expected the served fingerprint in the error, got %s", test.name, r.Error)
+		}
+	}
+
+	c := Config{Name: "pins", Monitor: map[string]Monitor{
+		"invalid": {Name: "Invalid", URL: server.URL, PinSHA256: []string{"not base64"}},
+		"short":   {Name: "Short", URL: server.URL, PinSHA256: []string{"AAAA"}},
+		"http":    {Name: "HTTP", URL: "http://example.org", PinSHA256: []string{pin}},
+	}}
+	verr, ok := c.Validate(".").(ValidationError)
+	if !ok || len(verr.ErrorList) != 3 {
+		t.Errorf("expected 3 validation errors, got %v", verr)
+	}
+}
+
+func TestRunPhases(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		fmt.Fprint(w, "ok")
+	}))
+	defer server.Close()
+
+	m := Monitor{URL: server.URL, TLS: &TLSOptions{InsecureSkipVerify: true}}
+	ch := make(chan Result, 1)
+	go m.Run(".", ch)
+	r := <-ch
+	if r.Error != nil {
+		t.Fatalf("expected no error, got %s", r.Error)
+	}
+	if r.Phases.FirstByte < 50 {
+		t.Errorf("expected a time to first byte of at least 50 ms, got %d ms", r.Phases.FirstByte)
+	}
+	// the URL has an IP address, so nothing is resolved.
+	if r.Phases.DNS != 0 {
+		t.Errorf("expected no DNS phase, got %d ms", r.Phases.DNS)
+	}
+	if sum := r.Phases.DNS + r.Phases.Connect + r.Phases.TLS + r.Phases.FirstByte; sum > r.Latency {
+		t.Errorf("expected the phases (%d ms) to be within the latency (%d ms)", sum, r.Latency)
+	}
+}
+
+func TestDecodeTimeouts(t *testing.T) {
+	var c Config
+	_, err := toml.Decode(`
+name = "Timeouts"
+
+[monitor.split]
+name = "Split"
+url = "http://example.org"
+connect_timeout = 2000
+response_header_timeout = 5000
+total_timeout = 10000
+
+[monitor.both]
+name = "Both"
+url = "http://example.org"
+timeout = 1000
+total_timeout = 1000
+`, &c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.mergeAssertions()
+
+	m := c.Monitor["split"]
+	if m.ConnectTimeout != 2000 || m.HeaderTimeout != 5000 || m.Timeout != 10000 || m.TotalTimeout != 0 {
+		t.Errorf("expected the timeouts to be decoded, and total_timeout to become the timeout, got %+v", m)
+	}
+	verr, ok := c.Validate(".").(ValidationError)
+	if !ok || len(verr.ErrorList) != 1 || !strings.Contains(verr.ErrorList[0], "'both'") {
+		t.Errorf("expected an error for monitor 'both', got %v", verr)
+	}
+
+	// without the merge, total_timeout alone is valid too.
+	c = Config{Name: "c", Monitor: map[string]Monitor{"m": {Name: "m", URL: "http://example.org", TotalTimeout: 1000}}}
+	if err := c.Validate("."); err != nil {
+		t.Errorf("expected no error for only a total_timeout, got %s", err)
+	}
+}
+
+func TestRunTimeouts(t *testing.T) {
+	done := make(chan bool)
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer slow.Close()
+	defer close(done)
+
+	// a listener which accepts connections, but never does a TLS handshake.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	tests := []struct {
+		monitor Monitor
+		code    string
+	}{
+		{Monitor{URL: slow.URL, Timeout: 1000, HeaderTimeout: 50}, FailureHeaderTimeout},
+		{Monitor{URL: slow.URL, Timeout: 50, HeaderTimeout: 1000}, FailureTimeout},
+		{Monitor{URL: "https://" + l.Addr().String(), Timeout: 1000, ConnectTimeout: 50}, FailureConnectTimeout},
+	}
+	for _, test := range tests {
+		ch := make(chan Result, 1)
+		go test.monitor.Run(".", ch)
+		r := <-ch
+		if r.Code != test.code {
+			t.Errorf("%+v: expected code '%s', got '%s' (%v)", test.monitor, test.code, r.Code, r.Error)
+		}
+	}
+}
+
+func TestRunProxy(t *testing.T) {
+	// the proxy gets the request with the full URL, for a host which doesn't
+	// exist.
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "proxied %s", r.URL)
+	}))
+	defer proxy.Close()
+
+	m := Monitor{URL: "http://hmon.invalid/status", Proxy: proxy.URL, Assertions: []Assertion{{Value: "proxied http://hmon.invalid/status"}}}
+	ch := make(chan Result, 1)
+	go m.Run(".", ch)
+	if r := <-ch; r.Error != nil {
+		t.Errorf("expected the request to go through the proxy, got %s", r.Error)
+	}
+
+	m.Proxy = "ftp://proxy.example.org"
+	go m.Run(".", ch)
+	if r := <-ch; r.Error == nil || !strings.Contains(r.Error.Error(), "invalid proxy") {
+		t.Errorf("expected an invalid proxy error, got %v", r.Error)
+	}
+}
+
+func TestParseProxy(t *testing.T) {
+	tests := map[string]bool{
+		"http://proxy.example.org:3128":  true,
+		"https://proxy.example.org":      true,
+		"socks5://127.0.0.1:1080":        true,
+		"ftp://proxy.example.org":        false,
+		"proxy.example.org:3128":         false,
+		"http://":                        false,
+		"http://proxy.example.org:%zz12": false,
+	}
+	for proxy, valid := range tests {
+		_, err := parseProxy(proxy)
+		if valid && err != nil {
+			t.Errorf("%s: expected a valid proxy, got %s", proxy, err)
+		}
+		if !valid && err == nil {
+			t.Errorf("%s: expected an error, got none", proxy)
+		}
+	}
+}
+
+func TestTransportProxy(t *testing.T) {
+	req, _ := http.NewRequest("GET", "http://www.example.org", nil)
+	proxy, _ := parseProxy("http://proxy.example.org:3128")
+
+	u, err := newTransport(&byteCounter{}, "www.example.org", "10.0.0.1", proxy, nil, nil).Proxy(req)
+	if err != nil || u == nil || u.Host != "proxy.example.org:3128" {
+		t.Errorf("expected the proxy of the monitor, got %v (%v)", u, err)
+	}
+
+	defer func() { environmentProxy = true }()
+	environmentProxy = false
+	if newTransport(&byteCounter{}, "www.example.org", "", nil, nil, nil).Proxy != nil {
+		t.Errorf("expected no proxy with the environment proxy disabled")
+	}
+}
+
+func TestDecodeTransportOptions(t *testing.T) {
+	var c Config
+	content := "[transport]\ndial_timeout = 5000\ntls_min_version = \"1.2\"\ndisable_compression = true\n\n" +
+		"[monitor.a]\nurl = \"http://example.org\"\n\n" +
+		"[monitor.b]\nurl = \"http://example.org\"\ntransport = { tls_min_version = \"1.3\", disable_compression = false }\n"
+	if _, err := toml.Decode(content, &c); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	c.mergeTransport()
+
+	a, b := c.Monitor["a"].Transport, c.Monitor["b"].Transport
+	if a.DialTimeout != 5000 || a.TLSMinVersion != "1.2" || !*a.DisableCompression {
+		t.Errorf("expected the settings of the configuration, got %+v", a)
+	}
+	if b.DialTimeout != 5000 || b.TLSMinVersion != "1.3" || *b.DisableCompression {
+		t.Errorf("expected the settings of the monitor to take precedence, got %+v", b)
+	}
+
+	for _, o := range []TransportOptions{{TLSMinVersion: "1.4"}, {DialTimeout: -1}} {
+		if err := o.validate(); err == nil {
+			t.Errorf("expected error for %+v", o)
+		}
+	}
+}
+
+func TestTransportOptions(t *testing.T) {
+	noCompression := true
+	opts := &TransportOptions{TLSMinVersion: "1.3", ExpectContinueTimeout: 500, DisableCompression: &noCompression}
+	tr := newTransport(&byteCounter{}, "www.example.org", "", nil, &tls.Config{InsecureSkipVerify: true}, opts)
+	if !tr.DisableKeepAlives {
+		t.Errorf("expected no keep-alives for the transport of a single run")
+	}
+	if tr.TLSClientConfig.MinVersion != tls.VersionTLS13 || !tr.TLSClientConfig.InsecureSkipVerify {
+		t.Errorf("expected TLS 1.3 with the TLS options of the monitor, got %+v", tr.TLSClientConfig)
+	}
+	if tr.ExpectContinueTimeout != 500*time.Millisecond || !tr.DisableCompression {
+		t.Errorf("expected expect continue timeout and no compression, got %s and %v", tr.ExpectContinueTimeout, tr.DisableCompression)
+	}
+
+	// unset settings leave the defaults alone.
+	defaults := http.DefaultTransport.(*http.Transport)
+	tr = newTransport(&byteCounter{}, "www.example.org", "", nil, nil, &TransportOptions{TLSMinVersion: "1.2"})
+	if tr.ExpectContinueTimeout != defaults.ExpectContinueTimeout || tr.DisableCompression {
+		t.Errorf("expected the default expect continue timeout and compression, got %s and %v", tr.ExpectContinueTimeout, tr.DisableCompression)
+	}
+}
+
+func TestRunTransportOptions(t *testing.T) {
+	var expect string
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		expect = r.Header.Get("Expect")
+		fmt.Fprint(w, "ok")
+	}))
+	server.TLS = &tls.Config{MaxVersion: tls.VersionTLS12}
+	server.StartTLS()
+	defer server.Close()
+
+	run := func(opts *TransportOptions) Result {
+		m := Monitor{URL: server.URL, Body: "data", TLS: &TLSOptions{InsecureSkipVerify: true}, Transport: opts}
+		ch := make(chan Result, 1)
+		go m.Run(".", ch)
+		return <-ch
+	}
+
+	if r := run(&TransportOptions{TLSMinVersion: "1.3"}); r.Error == nil || r.Code != FailureTLS {
+		t.Errorf("expected %s for a server without TLS 1.3, got %v (%s)", FailureTLS, r.Error, r.Code)
+	}
+	if r := run(&TransportOptions{TLSMinVersion: "1.2", ExpectContinueTimeout: 1000}); r.Error != nil || expect != "100-continue" {
+		t.Errorf("expected success with Expect: 100-continue, got %v (%q)", r.Error, expect)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// runTrend is the comparison of a run with the previous run.
+type runTrend struct {
+	NewFailures    int   // monitors failing now, which didn't fail in the previous run
+	Recovered      int   // monitors which failed in the previous run, and succeed now
+	PreviousMedian int64 // median latency of the previous run, in ms
+	Median         int64 // median latency of this run, in ms
+}
+
+// median returns the median of the latencies, or zero without any.
+func median(latencies []int64) int64 {
+	if len(latencies) == 0 {
+		return 0
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	mid := len(latencies) / 2
+	if len(latencies)%2 == 0 {
+		return (latencies[mid-1] + latencies[mid]) / 2
+	}
+	return latencies[mid]
+}
+
+// compareRuns compares the results of this run with the previous results.
+// Monitors are matched on their configuration and name.
+func compareRuns(previous []reportedResult, configResults []ConfigurationResult) runTrend {
+	var t runTrend
+	failed := make(map[string]bool)
+	var latencies []int64
+	for _, r := range previous {
+		failed[reportKey(r.ConfigurationName, r.Name)] = r.Error != ""
+		latencies = append(latencies, r.Latency)
+	}
+	t.PreviousMedian = median(latencies)
+
+	latencies = nil
+	for _, cr := range configResults {
+		for _, r := range cr.Results {
+			latencies = append(latencies, r.Latency)
+			wasFailing := failed[reportKey(cr.ConfigurationName, r.Monitor.Name)]
+			if r.Error != nil && !wasFailing {
+				t.NewFailures++
+			} else if r.Error == nil && wasFailing {
+				t.Recovered++
+			}
+		}
+	}
+	t.Median = median(latencies)
+	return t
+}
+
+// String returns the trend as a single line, like "2 new failures, 1
+// recovered, median latency +12%".
+func (t runTrend) String() string {
+	failures := "failures"
+	if t.NewFailures == 1 {
+		failures = "failure"
+	}
+	s := fmt.Sprintf("%d new %s, %d recovered", t.NewFailures, failures, t.Recovered)
+	if t.PreviousMedian > 0 {
+		change := float64(t.Median-t.PreviousMedian) / float64(t.PreviousMedian) * 100
+		s += fmt.Sprintf(", median latency %+.0f%%", change)
+	}
+	return s
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCompareRuns(t *testing.T) {
+	previous := []reportedResult{
+		{ConfigurationName: "Shop", Name: "Checkout", Error: "timeout", Latency: 100},
+		{ConfigurationName: "Shop", Name: "Home", Latency: 100},
+		{ConfigurationName: "Shop", Name: "Search", Latency: 100},
+	}
+	configResults := []ConfigurationResult{
+		{
+			ConfigurationName: "Shop",
+			Results: []Result{
+				{Monitor: Monitor{Name: "Checkout"}, Latency: 100},
+				{Monitor: Monitor{Name: "Home"}, Latency: 112, Error: ResultError{errors.New("status 500")}},
+				{Monitor: Monitor{Name: "Search"}, Latency: 120, Error: ResultError{errors.New("status 500")}},
+				{Monitor: Monitor{Name: "New"}, Latency: 200, Error: ResultError{errors.New("status 404")}},
+			},
+		},
+	}
+
+	trend := compareRuns(previous, configResults)
+	if trend.NewFailures != 3 || trend.Recovered != 1 {
+		t.Errorf("expected 3 new failures and 1 recovered, got %+v", trend)
+	}
+	if expected := "3 new failures, 1 recovered, median latency +16%"; trend.String() != expected {
+		t.Errorf("expected '%s', got '%s'", expected, trend)
+	}
+
+	trend = compareRuns(nil, configResults[:0])
+	if expected := "0 new failures, 0 recovered"; trend.String() != expected {
+		t.Errorf("expected '%s', got '%s'", expected, trend)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// The functions available in the templates of the 'template' format, besides
+// the methods of the results (like ErrorText).
+var userTemplateFuncs = template.FuncMap{
+	// timestamp formats a time like the timestamps of the other formats.
+	"timestamp": func(t time.Time) string {
+		return timestamps.String(t)
+	},
+	"join": strings.Join,
+}
+
+// newTemplateWriter parses the Go text/template in the file, and returns the
+// function writing the results rendered with it, for the 'template' format.
+// The template is executed with the []ConfigurationResult.
+func newTemplateWriter(file string) (func(string, *[]ConfigurationResult) error, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read template `%s': %s", file, err)
+	}
+	tmpl, err := template.New(file).Funcs(userTemplateFuncs).Parse(string(b))
+	if err != nil {
+		return nil, fmt.Errorf("invalid template `%s': %s", file, err)
+	}
+
+	return func(filename string, r *[]ConfigurationResult) error {
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, *r); err != nil {
+			return fmt.Errorf("failed to render template `%s': %s", file, err)
+		}
+		if filename == stdoutOutput {
+			_, err = os.Stdout.Write(buf.Bytes())
+		} else {
+			err = ioutil.WriteFile(filename, buf.Bytes(), 0644)
+		}
+		if err != nil {
+			return fmt.Errorf("unable to write to file `%s': %s", filename, err)
+		}
+		return nil
+	}, nil
+}
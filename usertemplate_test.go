@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestTemplateWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hmon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tmplFile := path.Join(dir, "report.tmpl")
+	content := "{{range .}}# {{.ConfigurationName}}\n{{range .Results}}- {{.Monitor.Name}}: {{if .Error}}{{.ErrorText}}{{else}}ok{{end}}\n{{end}}{{end}}"
+	if err := ioutil.WriteFile(tmplFile, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	write, err := newTemplateWriter(tmplFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results := []ConfigurationResult{{ConfigurationName: "shop", Results: []Result{
+		{Monitor: Monitor{Name: "home"}},
+		{Monitor: Monitor{Name: "orders"}, Error: ResultError{errors.New("timeout")}, Code: FailureTimeout},
+	}}}
+	out := path.Join(dir, "report.md")
+	if err := write(out, &results); err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadFile(out)
+	expected := "# shop\n- home: ok\n- orders: [HM-TIMEOUT] timeout\n"
+	if string(b) != expected {
+		t.Errorf("expected %q, got %q", expected, b)
+	}
+
+	if err := ioutil.WriteFile(tmplFile, []byte("{{range}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newTemplateWriter(tmplFile); err == nil {
+		t.Errorf("expected error for an invalid template")
+	}
+	if _, err := newTemplateWriter(path.Join(dir, "missing.tmpl")); err == nil {
+		t.Errorf("expected error for a missing template")
+	}
+}
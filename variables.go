@@ -0,0 +1,147 @@
+package main
+
+import (
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Matches a reference to a run variable, like ${version}.
+var variableRegexp = regexp.MustCompile(`\$\{([A-Za-z0-9_.-]+)\}`)
+
+// Matches a valid name of a run variable.
+var variableNameRegexp = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// captureHeaders returns the values of the captured headers (variable ->
+// header name) of the response. Headers which are absent are not captured.
+func captureHeaders(capture map[string]string, header http.Header) map[string]string {
+	var captured map[string]string
+	for variable, name := range capture {
+		value := header.Get(strings.TrimSpace(name))
+		if value == "" {
+			continue
+		}
+		if captured == nil {
+			captured = make(map[string]string)
+		}
+		captured[variable] = value
+	}
+	return captured
+}
+
+// expandVariables replaces the references to run variables in s. When quote
+// is set, the values are quoted for use in a regex. References to unknown
+// variables are kept as written.
+func expandVariables(s string, vars map[string]string, quote bool) string {
+	if len(vars) == 0 || !strings.Contains(s, "${") {
+		return s
+	}
+	return variableRegexp.ReplaceAllStringFunc(s, func(ref string) string {
+		value, found := vars[ref[2:len(ref)-1]]
+		if !found {
+			return ref
+		}
+		if quote {
+			return regexp.QuoteMeta(value)
+		}
+		return value
+	})
+}
+
+// withVariables returns a copy of the monitor with the run variables
+// expanded in its URL, headers, and regex and header assertions. In the
+// assertions, the values are matched literally.
+func (m Monitor) withVariables(vars map[string]string) Monitor {
+	if len(vars) == 0 {
+		return m
+	}
+
+	m.URL = expandVariables(m.URL, vars, false)
+	headers := make([]Header, len(m.Headers))
+	for i, h := range m.Headers {
+		headers[i] = Header(expandVariables(string(h), vars, false))
+	}
+	m.Headers = headers
+
+	m.Assertions = assertionsWithVariables(m.Assertions, vars)
+	return m
+}
+
+// assertionsWithVariables returns the assertions with the run variables
+// expanded in the values of regex and header assertions, including those in
+// groups.
+func assertionsWithVariables(list []Assertion, vars map[string]string) []Assertion {
+	assertions := make([]Assertion, len(list))
+	for i, a := range list {
+		assertions[i] = a
+		if a.Group != nil {
+			assertions[i].Group = assertionsWithVariables(a.Group, vars)
+			continue
+		}
+		if a.Type != "" && a.Type != AssertionRegex && a.Type != AssertionHeader {
+			continue
+		}
+		value := expandVariables(a.Value, vars, true)
+		if value == a.Value {
+			continue
+		}
+		expanded := a
+		expanded.Value = value
+		if expanded.Validate() == nil {
+			assertions[i] = expanded
+		}
+	}
+	return assertions
+}
+
+// mergeCaptured adds the variables captured by the result to the run
+// variables. Later captures of a variable replace earlier ones.
+func mergeCaptured(vars map[string]string, r Result) {
+	for variable, value := range r.Captured {
+		vars[variable] = value
+	}
+}
+
+// CapturedVariable is a run variable with all the values captured for it,
+// and the monitors which captured each value.
+type CapturedVariable struct {
+	Name   string
+	Values []string
+	By     map[string][]string // value -> names of the monitors
+}
+
+// Consistent returns true if all monitors captured the same value.
+func (v CapturedVariable) Consistent() bool {
+	return len(v.Values) == 1
+}
+
+// collectVariables returns the captured variables of all results, ordered by
+// name, with their values in the order they were first captured.
+func collectVariables(configResults []ConfigurationResult) []CapturedVariable {
+	byName := make(map[string]*CapturedVariable)
+	for _, cr := range configResults {
+		for _, r := range cr.Results {
+			for name, value := range r.Captured {
+				v, found := byName[name]
+				if !found {
+					v = &CapturedVariable{Name: name, By: make(map[string][]string)}
+					byName[name] = v
+				}
+				if _, found := v.By[value]; !found {
+					v.Values = append(v.Values, value)
+				}
+				v.By[value] = append(v.By[value], r.Monitor.Name)
+			}
+		}
+	}
+
+	variables := make([]CapturedVariable, 0, len(byName))
+	for _, v := range byName {
+		variables = append(variables, *v)
+	}
+	sort.Slice(variables, func(i, j int) bool {
+		return variables[i].Name < variables[j].Name
+	})
+	return variables
+}
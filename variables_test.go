@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCaptureHeaders(t *testing.T) {
+	header := http.Header{}
+	header.Set("X-Deployed-Version", "1.4.2")
+
+	captured := captureHeaders(map[string]string{"version": "x-deployed-version", "build": "X-Build"}, header)
+	if len(captured) != 1 || captured["version"] != "1.4.2" {
+		t.Errorf("expected only the version to be captured, got %v", captured)
+	}
+	if captured := captureHeaders(nil, header); captured != nil {
+		t.Errorf("expected nothing to be captured, got %v", captured)
+	}
+}
+
+func TestExpandVariables(t *testing.T) {
+	vars := map[string]string{"version": "1.4.2", "host": "api.example.org"}
+
+	if s := expandVariables("https://${host}/v${version}/${unknown}", vars, false); s != "https://api.example.org/v1.4.2/${unknown}" {
+		t.Errorf("expected the known variables to be expanded, got '%s'", s)
+	}
+	if s := expandVariables("^${version}$", vars, true); s != `^1\.4\.2$` {
+		t.Errorf("expected the value to be quoted, got '%s'", s)
+	}
+}
+
+func TestWithVariables(t *testing.T) {
+	m := Monitor{
+		URL:     "http://${host}/health",
+		Headers: []Header{"X-Expected: ${version}"},
+		Assertions: []Assertion{
+			{Value: "Version ${version}"},
+			{Type: AssertionHeader, Value: "X-Deployed-Version: ^${version}$"},
+			{Type: AssertionJSONPath, Value: "$.version"},
+		},
+	}
+	expanded := m.withVariables(map[string]string{"host": "example.org", "version": "1.4.2"})
+
+	if expanded.URL != "http://example.org/health" || expanded.Headers[0] != "X-Expected: 1.4.2" {
+		t.Errorf("expected the url and headers to be expanded, got %s and %v", expanded.URL, expanded.Headers)
+	}
+	if expanded.Assertions[0].Value != `Version 1\.4\.2` || expanded.Assertions[1].Value != `X-Deployed-Version: ^1\.4\.2$` {
+		t.Errorf("expected the assertions to be expanded, got %+v", expanded.Assertions)
+	}
+	if m.URL != "http://${host}/health" || m.Assertions[0].Value != "Version ${version}" {
+		t.Errorf("expected the original monitor to be left alone, got %+v", m)
+	}
+
+	header := http.Header{}
+	header.Set("X-Deployed-Version", "1.4.20")
+	if err := expanded.Assertions[1].Check(200, header, nil, nil); err == nil {
+		t.Errorf("expected the captured version to be matched literally")
+	}
+}
+
+func TestRunSequentialVariables(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/version" {
+			w.Header().Set("X-Deployed-Version", "1.4.2")
+		}
+		fmt.Fprintf(w, "Path %s", r.URL.Path)
+	}))
+	defer server.Close()
+
+	c := Config{Name: "Variables", Monitor: map[string]Monitor{
+		"version": {Name: "Version", URL: server.URL + "/version", Priority: 1, Capture: map[string]string{"version": "X-Deployed-Version"}},
+		"release": {Name: "Release", URL: server.URL + "/release/${version}", Assertions: []Assertion{{Value: "Path /release/1.4.2"}}},
+	}}
+	vars := make(map[string]string)
+	cr := runSequential(ioutil.Discard, ".", c, false, vars, nil)
+
+	if vars["version"] != "1.4.2" {
+		t.Errorf("expected the version to be captured, got %v", vars)
+	}
+	for _, r := range cr.Results {
+		if r.Error != nil {
+			t.Errorf("expected %s to succeed, got %s", r.Monitor.Name, r.Error)
+		}
+	}
+}
+
+func TestCollectVariables(t *testing.T) {
+	results := []ConfigurationResult{
+		{Results: []Result{
+			{Monitor: Monitor{Name: "A"}, Captured: map[string]string{"version": "1.4.2", "region": "eu"}},
+			{Monitor: Monitor{Name: "B"}, Captured: map[string]string{"version": "1.4.1"}},
+		}},
+		{Results: []Result{
+			{Monitor: Monitor{Name: "C"}, Captured: map[string]string{"version": "1.4.2"}},
+		}},
+	}
+
+	variables := collectVariables(results)
+	if len(variables) != 2 || variables[0].Name != "region" || variables[1].Name != "version" {
+		t.Fatalf("expected region and version, got %+v", variables)
+	}
+	if !variables[0].Consistent() {
+		t.Errorf("expected the region to be consistent")
+	}
+	version := variables[1]
+	if version.Consistent() || len(version.Values) != 2 || version.Values[0] != "1.4.2" {
+		t.Errorf("expected two versions, got %+v", version)
+	}
+	if by := version.By["1.4.2"]; len(by) != 2 || by[0] != "A" || by[1] != "C" {
+		t.Errorf("expected 1.4.2 to be captured by A and C, got %v", by)
+	}
+}